@@ -0,0 +1,298 @@
+package main
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "time"
+
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/crypto"
+    "quantum-doc-verify/pkg/storage"
+)
+
+// accessOptions configures the access commands
+type accessOptions struct {
+    cid             string
+    contractAddress string
+    ethPrivateKey   string
+    nodeURL         string
+    storeURL        string
+    ipfsGateway     string
+}
+
+func (o *accessOptions) register(cmd *cobra.Command) {
+    cmd.Flags().StringVar(&o.cid, "cid", "", "IPFS CID of the document or bundle")
+    cmd.Flags().StringVar(&o.contractAddress, "contract", "", "Document registry contract address")
+    cmd.Flags().StringVar(&o.ethPrivateKey, "eth-key", "", "Ethereum private key in hex format")
+    cmd.Flags().StringVar(&o.nodeURL, "node", "http://localhost:8545", "Ethereum node URL")
+    cmd.Flags().StringVar(&o.ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&o.storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.MarkFlagRequired("cid")
+    cmd.MarkFlagRequired("contract")
+    cmd.MarkFlagRequired("eth-key")
+}
+
+func accessCmd() *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "access",
+        Short: "Grant and revoke read access to stored documents",
+    }
+
+    cmd.AddCommand(accessGrantCmd())
+    cmd.AddCommand(accessRevokeCmd())
+
+    return cmd
+}
+
+func accessGrantCmd() *cobra.Command {
+    var opts accessOptions
+    var ownerKeyPath string
+    var recipientKeyPath string
+    var dilithiumKeyPath string
+
+    cmd := &cobra.Command{
+        Use:   "grant",
+        Short: "Re-wrap a document's key to a new recipient without re-uploading it",
+        Run: func(cmd *cobra.Command, args []string) {
+            grantAccess(opts, ownerKeyPath, recipientKeyPath, dilithiumKeyPath)
+        },
+    }
+
+    opts.register(cmd)
+    cmd.Flags().StringVar(&ownerKeyPath, "key", "", "Path to a key that opens the document today: a recipient's ML-KEM-768 private key or the tenant key")
+    cmd.Flags().StringVar(&recipientKeyPath, "recipient", "", "Path to the new recipient's ML-KEM-768 public key")
+    cmd.Flags().StringVar(&dilithiumKeyPath, "dilithium-key", "", "Path to the Dilithium private key that signed the document; it signs the grant")
+    cmd.MarkFlagRequired("key")
+    cmd.MarkFlagRequired("recipient")
+    cmd.MarkFlagRequired("dilithium-key")
+
+    return cmd
+}
+
+func accessRevokeCmd() *cobra.Command {
+    var opts accessOptions
+    var recipientKeyPath string
+    var recipientKeyID string
+
+    cmd := &cobra.Command{
+        Use:   "revoke",
+        Short: "Record a revocation marker so a recipient's grants are no longer honoured",
+        Run: func(cmd *cobra.Command, args []string) {
+            if (recipientKeyPath == "") == (recipientKeyID == "") {
+                log.Fatal().Msg("Exactly one of --recipient and --recipient-id is required")
+            }
+            if recipientKeyPath != "" {
+                recipientKeyID = kemKeyIDFromFile(recipientKeyPath)
+            }
+            revokeAccess(opts, recipientKeyID)
+        },
+    }
+
+    opts.register(cmd)
+    cmd.Flags().StringVar(&recipientKeyPath, "recipient", "", "Path to the recipient's ML-KEM-768 public key")
+    cmd.Flags().StringVar(&recipientKeyID, "recipient-id", "", "Key ID of the recipient, as printed by access grant")
+
+    return cmd
+}
+
+// kemKeyIDFromFile returns the hex key ID of the ML-KEM-768 public key at path
+func kemKeyIDFromFile(path string) string {
+    pub, err := os.ReadFile(path)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read recipient public key")
+    }
+    if !crypto.IsKEMPublicKey(pub) {
+        log.Fatal().Msg("Recipient key is not an ML-KEM-768 public key")
+    }
+    return hex.EncodeToString(crypto.KEMKeyID(pub))
+}
+
+// readEnvelopeHeader reads the envelope header of a document, or of a bundle's payload,
+// and returns the bundle manifest if there is one
+func readEnvelopeHeader(ctx context.Context, store storage.DocumentStore, cid string) (*storage.EnvelopeHeader, *storage.Manifest) {
+    var manifest *storage.Manifest
+    var reader io.ReadCloser
+    bundle, err := storage.OpenBundle(ctx, store, cid)
+    switch {
+    case errors.Is(err, storage.ErrNotBundle):
+        reader, err = store.Get(ctx, cid)
+    case err == nil:
+        manifest, err = bundle.Manifest(ctx)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to read bundle manifest")
+        }
+        reader, err = bundle.Open(ctx, storage.BundlePayloadFile)
+    }
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to retrieve encrypted document")
+    }
+    defer reader.Close()
+
+    header, _, err := storage.ReadEnvelopeHeader(reader)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read document envelope")
+    }
+    return header, manifest
+}
+
+func grantAccess(opts accessOptions, ownerKeyPath, recipientKeyPath, dilithiumKeyPath string) {
+    ctx := context.Background()
+    log.Info().
+        Str("cid", opts.cid).
+        Msg("Granting access to document...")
+
+    store, err := storage.Open(storage.StoreURL(opts.storeURL, opts.ipfsGateway))
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to open document store")
+    }
+    header, manifest := readEnvelopeHeader(ctx, store, opts.cid)
+
+    recipientKey, err := os.ReadFile(recipientKeyPath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read recipient public key")
+    }
+
+    // Load the owner's signing key, which must be the one the document was signed with
+    signer := crypto.NewDilithiumSigner()
+    defer signer.Close()
+    if err := signer.LoadPrivateKeyFile(dilithiumKeyPath); err != nil {
+        log.Fatal().Err(err).Msg("Failed to read Dilithium private key")
+    }
+    if manifest != nil {
+        publicKey, err := signer.ExportPublicKey()
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to export Dilithium public key")
+        }
+        if keyID := crypto.DilithiumKeyID(publicKey); keyID != manifest.SignerKeyID {
+            log.Fatal().
+                Str("keyId", keyID).
+                Str("signerKeyId", manifest.SignerKeyID).
+                Msg("Grants must be signed with the key that signed the document")
+        }
+    }
+
+    // Unwrap the content key and wrap it to the recipient
+    ownerKey, err := crypto.ReadSecretFile(ownerKeyPath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read owner key")
+    }
+    var grant *storage.AccessGrant
+    err = ownerKey.Use(func(key []byte) error {
+        grant, err = storage.NewAccessGrant(header, opts.cid, key, recipientKey)
+        return err
+    })
+    ownerKey.Destroy()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to wrap document key to the recipient")
+    }
+    if err := grant.Sign(signer); err != nil {
+        log.Fatal().Err(err).Msg("Failed to sign access grant")
+    }
+
+    grantCID, err := storage.PutAccessGrant(ctx, store, grant)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to store access grant")
+    }
+
+    // Publish the grant so the recipient's retrievals find it
+    client, ethPrivKey := openRegistry(opts)
+    txHash, err := client.PublishGrant(ethPrivKey, opts.cid, grant.RecipientKeyID, grantCID, grant.Created)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to publish access grant")
+    }
+
+    log.Info().
+        Str("recipient", grant.RecipientKeyID).
+        Str("grantCid", grantCID).
+        Str("txHash", txHash).
+        Msg("Access granted")
+
+    fmt.Println("\nAccess Grant:")
+    fmt.Printf("Document CID: %s\n", opts.cid)
+    fmt.Printf("Recipient Key ID: %s\n", grant.RecipientKeyID)
+    fmt.Printf("Grant CID: %s\n", grantCID)
+    fmt.Printf("Blockchain transaction: %s\n", txHash)
+}
+
+func revokeAccess(opts accessOptions, recipientKeyID string) {
+    log.Info().
+        Str("cid", opts.cid).
+        Str("recipient", recipientKeyID).
+        Msg("Revoking access to document...")
+
+    client, ethPrivKey := openRegistry(opts)
+    txHash, err := client.RevokeGrant(ethPrivKey, opts.cid, recipientKeyID, time.Now())
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to record revocation")
+    }
+
+    log.Info().
+        Str("txHash", txHash).
+        Msg("Access revoked; grants created before now are no longer honoured")
+
+    fmt.Println("\nAccess Revocation:")
+    fmt.Printf("Document CID: %s\n", opts.cid)
+    fmt.Printf("Recipient Key ID: %s\n", recipientKeyID)
+    fmt.Printf("Blockchain transaction: %s\n", txHash)
+}
+
+func openRegistry(opts accessOptions) (*blockchain.BlockchainClient, *ecdsa.PrivateKey) {
+    ethPrivKey, err := blockchain.LoadPrivateKey(opts.ethPrivateKey)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to load Ethereum private key")
+    }
+    client, err := blockchain.NewBlockchainClient(opts.nodeURL, opts.contractAddress)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to create blockchain client")
+    }
+    return client, ethPrivKey
+}
+
+// lookupGrant finds the access grant published for the holder of privateKey, checking it
+// was signed by the document's signer and has not been revoked
+func lookupGrant(ctx context.Context, client *blockchain.BlockchainClient, store storage.DocumentStore, cid string, privateKey []byte, manifest *storage.Manifest) *storage.AccessGrant {
+    pub, err := crypto.KEMPublicKey(privateKey)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to derive ML-KEM public key")
+    }
+    keyID := hex.EncodeToString(crypto.KEMKeyID(pub))
+
+    record, exists, err := client.GetGrant(cid, keyID)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to look up access grant")
+    }
+    if !exists || record.GrantCID == "" {
+        log.Fatal().Str("recipient", keyID).Msg("Key is not a recipient of this document and holds no access grant")
+    }
+
+    grant, err := storage.GetAccessGrant(ctx, store, record.GrantCID)
+    if err != nil {
+        log.Fatal().Err(err).Str("grantCid", record.GrantCID).Msg("Failed to read access grant")
+    }
+    if grant.DocumentCID != cid || grant.RecipientKeyID != keyID {
+        log.Fatal().Str("grantCid", record.GrantCID).Msg("Access grant is for another document or recipient")
+    }
+    if !record.Honours(grant.Created) {
+        log.Fatal().Err(storage.ErrGrantRevoked).Str("revokedAt", record.RevokedAt.String()).Msg("Access denied")
+    }
+    if manifest != nil && grant.SignerKeyID != manifest.SignerKeyID {
+        log.Fatal().
+            Str("grantSignerKeyId", grant.SignerKeyID).
+            Str("signerKeyId", manifest.SignerKeyID).
+            Msg("Access grant was not signed by the document's signer")
+    }
+
+    log.Info().
+        Str("grantCid", record.GrantCID).
+        Str("signerKeyId", grant.SignerKeyID).
+        Msg("Using access grant")
+    return grant
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/benchmark"
+)
+
+func benchCmd() *cobra.Command {
+    var sizes string
+    var algorithms string
+    var iterations int
+    var maxDuration time.Duration
+    var jsonPath string
+    var markdownPath string
+
+    cmd := &cobra.Command{
+        Use:   "bench",
+        Short: "Compare post-quantum and classical signature performance",
+        Long: "Measures key generation, signing and verification throughput plus key and signature sizes " +
+            "for ML-DSA, SLH-DSA, Dilithium, Ed25519 and ECDSA P-256, and writes JSON and Markdown reports.",
+        Run: func(cmd *cobra.Command, args []string) {
+            runBenchmark(sizes, algorithms, iterations, maxDuration, jsonPath, markdownPath)
+        },
+    }
+
+    cmd.Flags().StringVar(&sizes, "sizes", "1KB,64KB,1MB", "Comma-separated document sizes to sign")
+    cmd.Flags().StringVar(&algorithms, "algorithms", "", "Comma-separated algorithm names (default: all)")
+    cmd.Flags().IntVar(&iterations, "iterations", 100, "Maximum operations per measurement")
+    cmd.Flags().DurationVar(&maxDuration, "max-duration", 2*time.Second, "Time budget per measurement")
+    cmd.Flags().StringVar(&jsonPath, "json", "", "Write the JSON report to this file")
+    cmd.Flags().StringVar(&markdownPath, "markdown", "", "Write the Markdown report to this file (default: stdout)")
+
+    return cmd
+}
+
+func runBenchmark(sizes, algorithms string, iterations int, maxDuration time.Duration, jsonPath, markdownPath string) {
+    cfg := benchmark.Config{
+        Iterations:  iterations,
+        MaxDuration: maxDuration,
+    }
+
+    for _, s := range strings.Split(sizes, ",") {
+        size, err := benchmark.ParseSize(s)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Invalid document size")
+        }
+        cfg.DocumentSizes = append(cfg.DocumentSizes, size)
+    }
+
+    var names []string
+    if algorithms != "" {
+        names = strings.Split(algorithms, ",")
+    }
+    algs, err := benchmark.SelectAlgorithms(names)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Invalid algorithm selection")
+    }
+    cfg.Algorithms = algs
+
+    log.Info().
+        Int("algorithms", len(cfg.Algorithms)).
+        Str("sizes", sizes).
+        Int("iterations", iterations).
+        Msg("Running signature benchmark...")
+
+    report, err := benchmark.Run(cfg)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Benchmark failed")
+    }
+
+    if jsonPath != "" {
+        data, err := report.JSON()
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to encode JSON report")
+        }
+        if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+            log.Fatal().Err(err).Msg("Failed to write JSON report")
+        }
+        log.Info().Str("path", jsonPath).Msg("JSON report saved")
+    }
+
+    markdown := report.Markdown()
+    if markdownPath != "" {
+        if err := os.WriteFile(markdownPath, []byte(markdown), 0644); err != nil {
+            log.Fatal().Err(err).Msg("Failed to write Markdown report")
+        }
+        log.Info().Str("path", markdownPath).Msg("Markdown report saved")
+    } else {
+        fmt.Println(markdown)
+    }
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/storage"
+)
+
+// cacheFlags configures the local document cache shared with the ipfs tool and the
+// API server
+type cacheFlags struct {
+    opts   storage.CacheOptions
+    sizeMB int64
+}
+
+// register adds the cache flags to cmd
+func (f *cacheFlags) register(cmd *cobra.Command) {
+    f.opts = storage.DefaultCacheOptions()
+    f.sizeMB = f.opts.MaxSize >> 20
+
+    cmd.Flags().StringVar(&f.opts.Dir, "cache-dir", f.opts.Dir, storage.CacheFlagUsage)
+    cmd.Flags().Int64Var(&f.sizeMB, "cache-size", f.sizeMB, "Maximum size of the document cache in MiB")
+    cmd.Flags().DurationVar(&f.opts.TTL, "cache-ttl", f.opts.TTL, "Drop cached documents not read for this long")
+}
+
+// open returns the configured cache, or nil if caching is disabled
+func (f *cacheFlags) open() (*storage.Cache, error) {
+    if f.opts.Dir == "" {
+        return nil, nil
+    }
+    f.opts.MaxSize = f.sizeMB << 20
+    return storage.OpenCache(f.opts)
+}
+
+// openOrWarn opens the cache for a retrieval, which carries on uncached if it cannot
+func (f *cacheFlags) openOrWarn() *storage.Cache {
+    cache, err := f.open()
+    if err != nil {
+        log.Warn().Err(err).Msg("Document cache unavailable, retrieving without it")
+        return nil
+    }
+    return cache
+}
+
+func cacheCmd() *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "cache",
+        Short: "Inspect or clear the local cache of retrieved documents",
+    }
+
+    cmd.AddCommand(cacheStatsCmd())
+    cmd.AddCommand(cachePurgeCmd())
+
+    return cmd
+}
+
+func cacheStatsCmd() *cobra.Command {
+    var flags cacheFlags
+
+    cmd := &cobra.Command{
+        Use:   "stats",
+        Short: "Show the size and age of the document cache",
+        Run: func(cmd *cobra.Command, args []string) {
+            cache := mustOpenCache(&flags)
+            stats, err := cache.Stats()
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to read document cache")
+            }
+
+            event := log.Info().
+                Str("dir", stats.Dir).
+                Int("entries", stats.Entries).
+                Int64("size", stats.Size).
+                Int64("maxSize", stats.MaxSize).
+                Str("ttl", stats.TTL).
+                Int("expired", stats.Expired)
+            if stats.Entries > 0 {
+                event = event.
+                    Time("oldestAccess", stats.OldestAccess).
+                    Time("newestAccess", stats.NewestAccess)
+            }
+            event.Msg("Document cache")
+        },
+    }
+    flags.register(cmd)
+
+    return cmd
+}
+
+func cachePurgeCmd() *cobra.Command {
+    var flags cacheFlags
+    var expiredOnly bool
+
+    cmd := &cobra.Command{
+        Use:   "purge",
+        Short: "Remove cached documents",
+        Run: func(cmd *cobra.Command, args []string) {
+            cache := mustOpenCache(&flags)
+
+            purge := cache.Purge
+            if expiredOnly {
+                purge = cache.Prune
+            }
+            removed, err := purge()
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to purge document cache")
+            }
+            log.Info().Int("removed", removed).Msg("Purged document cache")
+        },
+    }
+    flags.register(cmd)
+    cmd.Flags().BoolVar(&expiredOnly, "expired", false, "Only remove expired documents and those over the size limit")
+
+    return cmd
+}
+
+func mustOpenCache(flags *cacheFlags) *storage.Cache {
+    cache, err := flags.open()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to open document cache")
+    }
+    if cache == nil {
+        log.Fatal().Msg("Document cache is disabled (--cache-dir is empty)")
+    }
+    return cache
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+    "context"
+    "os"
+
+    "github.com/rs/zerolog/log"
+
+    "quantum-doc-verify/pkg/storage"
+)
+
+// openVerifiedCAR opens a CAR archive for offline verification and checks that the
+// DAG under cid is complete. An empty cid is set to the archive's root when it has
+// exactly one.
+func openVerifiedCAR(ctx context.Context, carPath string, cid *string) *storage.CARStore {
+    file, err := os.Open(carPath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to open CAR file")
+    }
+    archive, err := storage.OpenCAR(file)
+    file.Close()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read CAR archive")
+    }
+
+    if *cid == "" {
+        if len(archive.Roots) != 1 {
+            archive.Close()
+            log.Fatal().
+                Strs("roots", archive.Roots).
+                Msg("--cid is required for a CAR archive without exactly one root")
+        }
+        *cid = archive.Roots[0]
+    }
+
+    blocks, err := archive.Verify(ctx, *cid)
+    if err != nil {
+        archive.Close()
+        log.Fatal().Err(err).Msg("CAR archive failed verification")
+    }
+    log.Info().
+        Str("car", carPath).
+        Str("cid", *cid).
+        Int("blocks", blocks).
+        Msg("CAR archive verified; retrieving offline")
+    return archive
+}
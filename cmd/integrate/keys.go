@@ -0,0 +1,256 @@
+package main
+
+import (
+    "encoding/hex"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+func keysCmd() *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "keys",
+        Short: "Generate and recover Dilithium signing keys and ML-KEM encryption keys",
+    }
+
+    cmd.AddCommand(keysGenerateCmd())
+    cmd.AddCommand(keysRecoverCmd())
+    cmd.AddCommand(keysGenerateKEMCmd())
+    cmd.AddCommand(keysGenerateTenantCmd())
+
+    return cmd
+}
+
+func keysGenerateCmd() *cobra.Command {
+    var outDir string
+    var useMnemonic bool
+    var passphrase string
+    var path string
+    var count int
+
+    cmd := &cobra.Command{
+        Use:   "generate",
+        Short: "Generate a new Dilithium keypair, optionally backed by a mnemonic phrase",
+        Run: func(cmd *cobra.Command, args []string) {
+            if cmd.Flags().Changed("count") && !useMnemonic {
+                log.Fatal().Msg("--count requires --mnemonic; without it a single random keypair is generated")
+            }
+            generateKeys(outDir, useMnemonic, passphrase, path, count)
+        },
+    }
+
+    cmd.Flags().StringVar(&outDir, "out-dir", ".", "Directory to write the key files to")
+    cmd.Flags().BoolVar(&useMnemonic, "mnemonic", false, "Derive keys from a new BIP-39 mnemonic phrase")
+    cmd.Flags().StringVar(&passphrase, "passphrase", "", "Optional BIP-39 passphrase")
+    cmd.Flags().StringVar(&path, "path", crypto.DefaultDerivationPath, "Derivation path of the first key")
+    cmd.Flags().IntVar(&count, "count", 1, "Number of keys to derive (mnemonic mode only)")
+
+    return cmd
+}
+
+func keysRecoverCmd() *cobra.Command {
+    var outDir string
+    var mnemonic string
+    var mnemonicFile string
+    var passphrase string
+    var path string
+    var count int
+
+    cmd := &cobra.Command{
+        Use:   "recover",
+        Short: "Re-create Dilithium keypairs from a mnemonic phrase",
+        Run: func(cmd *cobra.Command, args []string) {
+            if mnemonicFile != "" {
+                data, err := os.ReadFile(mnemonicFile)
+                if err != nil {
+                    log.Fatal().Err(err).Msg("Failed to read mnemonic file")
+                }
+                mnemonic = string(data)
+            }
+            if strings.TrimSpace(mnemonic) == "" {
+                log.Fatal().Msg("A mnemonic is required (--mnemonic or --mnemonic-file)")
+            }
+            deriveKeys(outDir, mnemonic, passphrase, path, count)
+        },
+    }
+
+    cmd.Flags().StringVar(&outDir, "out-dir", ".", "Directory to write the key files to")
+    cmd.Flags().StringVar(&mnemonic, "mnemonic", "", "Mnemonic phrase (quoted)")
+    cmd.Flags().StringVar(&mnemonicFile, "mnemonic-file", "", "File containing the mnemonic phrase")
+    cmd.Flags().StringVar(&passphrase, "passphrase", "", "BIP-39 passphrase used at generation time")
+    cmd.Flags().StringVar(&path, "path", crypto.DefaultDerivationPath, "Derivation path of the first key")
+    cmd.Flags().IntVar(&count, "count", 1, "Number of keys to derive")
+
+    return cmd
+}
+
+func keysGenerateKEMCmd() *cobra.Command {
+    var outDir string
+
+    cmd := &cobra.Command{
+        Use:   "generate-kem",
+        Short: "Generate an ML-KEM-768 keypair for receiving encrypted documents",
+        Run: func(cmd *cobra.Command, args []string) {
+            generateKEMKeys(outDir)
+        },
+    }
+
+    cmd.Flags().StringVar(&outDir, "out-dir", ".", "Directory to write the key files to")
+
+    return cmd
+}
+
+func keysGenerateTenantCmd() *cobra.Command {
+    var outDir string
+
+    cmd := &cobra.Command{
+        Use:   "generate-tenant",
+        Short: "Generate a tenant key for convergent (deduplicating) encryption",
+        Run: func(cmd *cobra.Command, args []string) {
+            generateTenantKey(outDir)
+        },
+    }
+
+    cmd.Flags().StringVar(&outDir, "out-dir", ".", "Directory to write the key file to")
+
+    return cmd
+}
+
+func generateKeys(outDir string, useMnemonic bool, passphrase, path string, count int) {
+    if err := os.MkdirAll(outDir, 0700); err != nil {
+        log.Fatal().Err(err).Msg("Failed to create output directory")
+    }
+
+    if !useMnemonic {
+        log.Info().Msg("Generating new Dilithium keypair...")
+        signer := crypto.NewDilithiumSigner()
+        pubKey, privKey, err := signer.GenerateKeypair()
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to generate Dilithium keypair")
+        }
+        saveKeypair(signer, pubKey, privKey, outDir, 0, 1)
+        return
+    }
+
+    mnemonic, err := crypto.NewMnemonic()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to generate mnemonic")
+    }
+
+    deriveKeys(outDir, mnemonic, passphrase, path, count)
+
+    fmt.Println("\nRecovery phrase (write it down and store it offline):")
+    fmt.Println(mnemonic)
+    fmt.Println("\nAnyone with this phrase can re-create your private keys.")
+}
+
+func deriveKeys(outDir, mnemonic, passphrase, path string, count int) {
+    if count < 1 {
+        log.Fatal().Int("count", count).Msg("Count must be at least 1")
+    }
+
+    indexes, err := crypto.ParseDerivationPath(path)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Invalid derivation path")
+    }
+    first := indexes[len(indexes)-1] - crypto.HardenedOffset
+
+    if err := os.MkdirAll(outDir, 0700); err != nil {
+        log.Fatal().Err(err).Msg("Failed to create output directory")
+    }
+
+    for i := 0; i < count; i++ {
+        keyPath, err := crypto.DerivationPathForIndex(path, first+uint32(i))
+        if err != nil {
+            log.Fatal().Err(err).Msg("Invalid derivation path")
+        }
+
+        signer := crypto.NewDilithiumSigner()
+        pubKey, privKey, err := signer.GenerateKeypairFromMnemonic(mnemonic, passphrase, keyPath)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to derive Dilithium keypair")
+        }
+
+        log.Info().Str("path", keyPath).Msg("Derived Dilithium keypair")
+        saveKeypair(signer, pubKey, privKey, outDir, i, count)
+    }
+}
+
+// saveKeypair writes a keypair using the default file names, numbering them when several are derived
+func saveKeypair(signer *crypto.DilithiumSigner, pubKey, privKey []byte, outDir string, i, count int) {
+    pubName, privName := "dilithium_public.key", "dilithium_private.key"
+    if count > 1 {
+        pubName = fmt.Sprintf("dilithium_%d_public.key", i)
+        privName = fmt.Sprintf("dilithium_%d_private.key", i)
+    }
+
+    pubKeyPath := filepath.Join(outDir, pubName)
+    privKeyPath := filepath.Join(outDir, privName)
+
+    if err := signer.SaveKeys(pubKey, privKey, pubKeyPath, privKeyPath); err != nil {
+        log.Fatal().Err(err).Msg("Failed to save Dilithium keys")
+    }
+
+    log.Info().
+        Str("pubKeyPath", pubKeyPath).
+        Str("privKeyPath", privKeyPath).
+        Msg("Dilithium keys saved")
+}
+
+func generateKEMKeys(outDir string) {
+    if err := os.MkdirAll(outDir, 0700); err != nil {
+        log.Fatal().Err(err).Msg("Failed to create output directory")
+    }
+
+    log.Info().Msg("Generating new ML-KEM-768 keypair...")
+    pubKey, privKey, err := crypto.GenerateKEMKeypair()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to generate ML-KEM keypair")
+    }
+    defer crypto.Wipe(privKey)
+
+    pubKeyPath := filepath.Join(outDir, "mlkem_public.key")
+    privKeyPath := filepath.Join(outDir, "mlkem_private.key")
+
+    if err := os.WriteFile(pubKeyPath, pubKey, 0644); err != nil {
+        log.Fatal().Err(err).Msg("Failed to save ML-KEM public key")
+    }
+    if err := os.WriteFile(privKeyPath, privKey, 0600); err != nil {
+        log.Fatal().Err(err).Msg("Failed to save ML-KEM private key")
+    }
+
+    log.Info().
+        Str("pubKeyPath", pubKeyPath).
+        Str("privKeyPath", privKeyPath).
+        Str("keyID", hex.EncodeToString(crypto.KEMKeyID(pubKey))).
+        Msg("ML-KEM keys saved")
+}
+
+func generateTenantKey(outDir string) {
+    if err := os.MkdirAll(outDir, 0700); err != nil {
+        log.Fatal().Err(err).Msg("Failed to create output directory")
+    }
+
+    log.Info().Msg("Generating new tenant key...")
+    key, err := crypto.GenerateTenantKey()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to generate tenant key")
+    }
+    defer crypto.Wipe(key)
+
+    keyPath := filepath.Join(outDir, "tenant.key")
+    if err := os.WriteFile(keyPath, key, 0600); err != nil {
+        log.Fatal().Err(err).Msg("Failed to save tenant key")
+    }
+
+    log.Info().
+        Str("keyPath", keyPath).
+        Str("keyID", hex.EncodeToString(crypto.TenantKeyID(key))).
+        Msg("Tenant key saved; share it only within the tenant")
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+    "bytes"
+    "context"
+    "crypto/ecdsa"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
     "os"
     "path/filepath"
     "fmt"
     "strings"
+    "time"
     
     "github.com/rs/zerolog"
     "github.com/rs/zerolog/log"
     "github.com/spf13/cobra"
     
     "quantum-doc-verify/pkg/crypto"
+    "quantum-doc-verify/pkg/pinning"
+    "quantum-doc-verify/pkg/retention"
     "quantum-doc-verify/pkg/storage"
     "quantum-doc-verify/pkg/blockchain"
 )
@@ -28,6 +38,14 @@ func main() {
     // Add subcommands
     rootCmd.AddCommand(storeAndRegisterCmd())
     rootCmd.AddCommand(verifyAndRetrieveCmd())
+    rootCmd.AddCommand(ipnsUpdateCmd())
+    rootCmd.AddCommand(ipnsResolveCmd())
+    rootCmd.AddCommand(keysCmd())
+    rootCmd.AddCommand(benchCmd())
+    rootCmd.AddCommand(cacheCmd())
+    rootCmd.AddCommand(retentionCmd())
+    rootCmd.AddCommand(accessCmd())
+    rootCmd.AddCommand(monitorCmd())
     
     if err := rootCmd.Execute(); err != nil {
         log.Fatal().Err(err).Msg("Failed to execute command")
@@ -39,13 +57,29 @@ func storeAndRegisterCmd() *cobra.Command {
     var contractAddress string
     var ethPrivateKeyHex string
     var dilithiumKeyPath string
+    var signerCertPath string
     var ipfsGateway string
+    var storeURL string
+    var pinOpts pinOptions
+    var ipnsOpts ipnsOptions
+    var retentionOpts retentionOptions
+    var encryptOpts encryptOptions
+    var compression string
     
     cmd := &cobra.Command{
         Use:   "store-register",
         Short: "Store document on IPFS and register on blockchain",
         Run: func(cmd *cobra.Command, args []string) {
-            storeAndRegisterDocument(filePath, contractAddress, ethPrivateKeyHex, dilithiumKeyPath, ipfsGateway)
+            var err error
+            encryptOpts.compression, err = storage.ParseCompression(compression)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Invalid --compress")
+            }
+            if encryptOpts.hashCID && (encryptOpts.tenantKeyPath != "" || encryptOpts.recipientKeyPath != "" || encryptOpts.compression != storage.CompressionNone) {
+                log.Fatal().Msg("--hash-cid stores the document unencrypted in a single block; it cannot be combined with --recipient, --tenant-key or --compress")
+            }
+            ipnsOpts.gateway = ipfsGateway
+            storeAndRegisterDocument(filePath, contractAddress, ethPrivateKeyHex, dilithiumKeyPath, signerCertPath, storage.StoreURL(storeURL, ipfsGateway), encryptOpts, pinOpts, ipnsOpts, retentionOpts)
         },
     }
     
@@ -53,7 +87,20 @@ func storeAndRegisterCmd() *cobra.Command {
     cmd.Flags().StringVar(&contractAddress, "contract", "", "Document registry contract address")
     cmd.Flags().StringVar(&ethPrivateKeyHex, "eth-key", "", "Ethereum private key in hex format")
     cmd.Flags().StringVar(&dilithiumKeyPath, "dilithium-key", "", "Path to Dilithium private key")
+    cmd.Flags().StringVar(&signerCertPath, "signer-cert", "", "Signer certificate to include in the document bundle")
     cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.Flags().StringVar(&compression, "compress", "none", storage.CompressionFlagUsage)
+    cmd.Flags().StringVar(&encryptOpts.recipientKeyPath, "recipient", "", "Path to an ML-KEM-768 public key to encrypt the document to, so that access can later be granted to others")
+    cmd.Flags().StringVar(&encryptOpts.tenantKeyPath, "tenant-key", "", "Path to a tenant key: encrypt convergently, so identical documents within the tenant share a payload CID (anyone with the tenant key can tell which documents are stored)")
+    cmd.Flags().BoolVar(&encryptOpts.hashCID, "hash-cid", false, fmt.Sprintf("Store the document unencrypted under a CID derived from its SHA3-256 hash (at most %d bytes) instead of in an encrypted bundle", storage.MaxHashCIDSize))
+    cmd.Flags().StringVar(&pinOpts.configPath, "pinning-config", "", "JSON file listing remote pinning services (IPFS Pinning Services API)")
+    cmd.Flags().IntVar(&pinOpts.minPinned, "min-pinned", 0, "Number of pinning services that must confirm the pin (default: min_pinned from the config)")
+    cmd.Flags().DurationVar(&pinOpts.timeout, "pin-timeout", 10*time.Minute, "How long to wait for pinning services to confirm")
+    cmd.Flags().StringVar(&ipnsOpts.key, "ipns-key", "", "Key ring key naming the logical document; its IPNS name is pointed at this version and linked from the registry")
+    cmd.Flags().DurationVar(&ipnsOpts.lifetime, "ipns-lifetime", 0, "Validity of the IPNS record (default: the node's default)")
+    cmd.Flags().StringVar(&retentionOpts.class, "retention-class", "", "Retention class recorded for the document (default: default_class of the retention config)")
+    cmd.Flags().StringVar(&retentionOpts.configPath, "retention-config", "", "Retention policy file used to check --retention-class")
     cmd.MarkFlagRequired("file")
     cmd.MarkFlagRequired("contract")
     cmd.MarkFlagRequired("eth-key")
@@ -61,11 +108,55 @@ func storeAndRegisterCmd() *cobra.Command {
     return cmd
 }
 
-func storeAndRegisterDocument(filePath, contractAddress, ethPrivateKeyHex, dilithiumKeyPath, ipfsGateway string) {
+// encryptOptions configures how store-register encrypts the document, or with hashCID
+// stores it unencrypted under its hash CID
+type encryptOptions struct {
+    compression      uint8
+    tenantKeyPath    string
+    recipientKeyPath string
+    hashCID          bool
+}
+
+// pinOptions configures remote pinning for store-register
+type pinOptions struct {
+    configPath string
+    minPinned  int
+    timeout    time.Duration
+}
+
+// ipnsOptions configures the IPNS name that points to a document's latest version
+type ipnsOptions struct {
+    key      string
+    gateway  string
+    lifetime time.Duration
+}
+
+// retentionOptions selects the retention class recorded for a document
+type retentionOptions struct {
+    class      string
+    configPath string
+}
+
+func storeAndRegisterDocument(filePath, contractAddress, ethPrivateKeyHex, dilithiumKeyPath, signerCertPath, storeURL string, encryptOpts encryptOptions, pinOpts pinOptions, ipnsOpts ipnsOptions, retentionOpts retentionOptions) {
     log.Info().
         Str("file", filePath).
         Msg("Processing document with quantum-resistant verification...")
     
+    // Reject an unknown retention class before anything is stored. Without a class, the
+    // config's default class applies; without either, the document is kept indefinitely.
+    if retentionOpts.configPath != "" {
+        cfg, err := retention.LoadConfig(retentionOpts.configPath)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to load retention config")
+        }
+        if retentionOpts.class == "" {
+            retentionOpts.class = cfg.DefaultClass
+        }
+        if _, ok := cfg.Policy(retentionOpts.class); retentionOpts.class != "" && !ok {
+            log.Fatal().Str("class", retentionOpts.class).Msg("Retention class has no policy")
+        }
+    }
+    
     // 1. Read document
     content, err := os.ReadFile(filePath)
     if err != nil {
@@ -74,11 +165,12 @@ func storeAndRegisterDocument(filePath, contractAddress, ethPrivateKeyHex, dilit
     
     // 2. Create Dilithium signature
     signer := crypto.NewDilithiumSigner()
-    var dilithiumPrivKey []byte
+    defer signer.Close()
+    var dilithiumPrivKey *crypto.Secret
     
     if dilithiumKeyPath != "" {
-        // Load existing key
-        dilithiumPrivKey, err = os.ReadFile(dilithiumKeyPath)
+        // Load existing key straight into locked memory
+        dilithiumPrivKey, err = crypto.ReadSecretFile(dilithiumKeyPath)
         if err != nil {
             log.Fatal().Err(err).Msg("Failed to read Dilithium private key")
         }
@@ -105,8 +197,9 @@ func storeAndRegisterDocument(filePath, contractAddress, ethPrivateKeyHex, dilit
             Str("privKeyPath", privKeyPath).
             Msg("Dilithium keys saved")
         
-        dilithiumPrivKey = privKey
+        dilithiumPrivKey = crypto.NewSecretFromBytes(privKey)
     }
+    defer dilithiumPrivKey.Destroy()
     
     // Sign document with Dilithium
     tempPath := filepath.Join(os.TempDir(), "doc_to_sign.tmp")
@@ -116,46 +209,29 @@ func storeAndRegisterDocument(filePath, contractAddress, ethPrivateKeyHex, dilit
     }
     defer os.Remove(tempPath)
     
-    signature, err := signer.SignDocument(tempPath, dilithiumPrivKey)
+    signature, err := signer.SignDocument(tempPath, dilithiumPrivKey.Bytes())
     if err != nil {
         log.Fatal().Err(err).Msg("Failed to sign document with Dilithium")
     }
     
     // 3. Store on IPFS
     //3. Encrypt and store on IPFS
-ipfs, err := storage.NewIPFSClient(ipfsGateway)
-if err != nil {
-    log.Fatal().Err(err).Msg("Failed to create IPFS client")
-}
-
-// Generate encryption key from the Dilithium private key
-// This ensures only the document owner can decrypt it
-encryptionKey := crypto.DeriveEncryptionKey(dilithiumPrivKey)
-
-// Encrypt the document before storage
-log.Info().Msg("Encrypting document with AES-256-GCM...")
-encryptedContent, err := storage.EncryptDocument(content, dilithiumPrivKey)
+store, err := storage.Open(storeURL)
 if err != nil {
-    log.Fatal().Err(err).Msg("Failed to encrypt document")
+    log.Fatal().Err(err).Msg("Failed to open document store")
 }
 
-// Store the encrypted content on IPFS
-cid, err := ipfs.Store(encryptedContent)
-if err != nil {
-    log.Fatal().Err(err).Msg("Failed to store encrypted document on IPFS")
+var cid string
+if encryptOpts.hashCID {
+    cid = storeUnderHashCID(store, content)
+} else {
+    cid = storeEncryptedBundle(store, filePath, content, signature, signer, dilithiumPrivKey, signerCertPath, encryptOpts, retentionOpts.class)
 }
 
-// Save encryption key metadata for future retrieval
-// In a production system, this would be securely stored and shared
-keyFile := filepath.Join(filepath.Dir(filePath), filepath.Base(filePath)+".key")
-err = os.WriteFile(keyFile, encryptionKey, 0600) // Restricted permissions
-if err != nil {
-    log.Fatal().Err(err).Msg("Failed to save encryption key metadata")
-}
-
-log.Info().
-    Str("cid", cid).
-    Msg("Encrypted document stored on IPFS")
+    // Wait for the document to be pinned on enough remote services before registering it
+    if pinOpts.configPath != "" {
+        pinDocument(cid, filepath.Base(filePath), pinOpts)
+    }
     
     // 4. Calculate document hash
     hash := storage.CalculateDocumentHash(content)
@@ -180,6 +256,26 @@ log.Info().
         Str("txHash", txHash).
         Msg("Document registered on blockchain")
     
+    // Record when the document's retention period starts. The document is registered by
+    // now, so a failure leaves it kept indefinitely rather than undoing the store.
+    if retentionOpts.class != "" {
+        retentionTx, err := client.SetRetention(ethPrivKey, hash, retentionOpts.class, time.Now())
+        if err != nil {
+            log.Warn().Err(err).Str("class", retentionOpts.class).Msg("Failed to record retention class, the document is kept indefinitely")
+        } else {
+            log.Info().
+                Str("class", retentionOpts.class).
+                Str("txHash", retentionTx).
+                Msg("Retention class recorded")
+        }
+    }
+    
+    // Point the logical document's IPNS name at this version
+    if ipnsOpts.key != "" {
+        ipnsName := publishVersion(client, ethPrivKey, hash, cid, ipnsOpts)
+        fmt.Println("IPNS name (latest version):", "/ipns/"+ipnsName)
+    }
+    
     // 6. Save metadata for future verification
     meta := map[string]string{
         "hash": hash,
@@ -207,45 +303,494 @@ log.Info().
     fmt.Println("Blockchain transaction:", txHash)
 }
 
+// storeEncryptedBundle encrypts the document as encryptOpts select and stores it in a
+// bundle with its signature, returning the bundle's CID
+func storeEncryptedBundle(store storage.DocumentStore, filePath string, content, signature []byte, signer *crypto.DilithiumSigner, dilithiumPrivKey *crypto.Secret, signerCertPath string, encryptOpts encryptOptions, retentionClass string) string {
+    // Generate encryption key from the Dilithium private key
+    // This ensures only the document owner can decrypt it
+    encryptionKey := crypto.DeriveEncryptionKey(dilithiumPrivKey.Bytes())
+    defer crypto.Wipe(encryptionKey)
+
+    // Encrypt the document before storage
+    log.Info().Str("compression", storage.CompressionName(encryptOpts.compression)).Msg("Encrypting document with AES-256-GCM...")
+    var encryptedContent []byte
+    var err error
+    if encryptOpts.tenantKeyPath != "" {
+        tenantKey, keyErr := crypto.ReadSecretFile(encryptOpts.tenantKeyPath)
+        if keyErr != nil {
+            log.Fatal().Err(keyErr).Msg("Failed to read tenant key")
+        }
+        defer tenantKey.Destroy()
+        if !crypto.IsTenantKey(tenantKey.Bytes()) {
+            log.Fatal().Msg("Tenant key file does not hold a tenant key")
+        }
+        log.Warn().Msg("Convergent encryption: identical documents share a CID, and tenant key holders can confirm which documents are stored")
+        encryptedContent, err = storage.SealEnvelope(content, storage.EnvelopeOptions{
+            Compression: encryptOpts.compression,
+            TenantKey:   tenantKey.Bytes(),
+        })
+    } else if encryptOpts.recipientKeyPath != "" {
+        recipientKey, keyErr := os.ReadFile(encryptOpts.recipientKeyPath)
+        if keyErr != nil {
+            log.Fatal().Err(keyErr).Msg("Failed to read recipient public key")
+        }
+        if !crypto.IsKEMPublicKey(recipientKey) {
+            log.Fatal().Msg("Recipient key is not an ML-KEM-768 public key")
+        }
+        encryptedContent, err = storage.SealEnvelope(content, storage.EnvelopeOptions{
+            Compression: encryptOpts.compression,
+            Recipients:  [][]byte{recipientKey},
+        })
+    } else {
+        encryptedContent, err = storage.EncryptDocumentCompressed(content, dilithiumPrivKey.Bytes(), encryptOpts.compression)
+    }
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to encrypt document")
+    }
+
+    // Store the encrypted content with its signature and manifest, so that the root CID
+    // alone is enough to verify the document
+    cid := storeBundle(store, filePath, content, encryptedContent, signature, signer, signerCertPath, retentionClass)
+
+    // Save encryption key metadata for future retrieval
+    // In a production system, this would be securely stored and shared
+    keyFile := filepath.Join(filepath.Dir(filePath), filepath.Base(filePath)+".key")
+    err = os.WriteFile(keyFile, encryptionKey, 0600) // Restricted permissions
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to save encryption key metadata")
+    }
+
+    log.Info().
+        Str("cid", cid).
+        Msg("Encrypted document bundle stored on IPFS")
+    return cid
+}
+
+// storeUnderHashCID stores a public document unencrypted under the CID derived from its
+// hash, so that the registered hash alone locates it. There is no bundle: the signature
+// is only kept in the registry.
+func storeUnderHashCID(store storage.DocumentStore, content []byte) string {
+    log.Warn().Msg("Storing the document unencrypted under its hash CID; anyone who knows its hash can read it")
+    cid, err := store.Put(context.Background(), bytes.NewReader(content), storage.StoreOptions{HashCID: true})
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to store document under its hash CID")
+    }
+
+    log.Info().
+        Str("cid", cid).
+        Msg("Document stored on IPFS under its hash CID")
+    return cid
+}
+
+// storeBundle stores the encrypted document, its signature container, a manifest and the
+// optional signer certificate as one UnixFS directory, returning the directory's CID
+func storeBundle(store storage.DocumentStore, filePath string, content, encryptedContent, signature []byte, signer *crypto.DilithiumSigner, signerCertPath, retentionClass string) string {
+    publicKey, err := signer.ExportPublicKey()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to export Dilithium public key")
+    }
+    keyID := crypto.DilithiumKeyID(publicKey)
+    
+    manifest, err := json.MarshalIndent(storage.Manifest{
+        Version:            storage.ManifestVersion,
+        FileName:           filepath.Base(filePath),
+        MediaType:          http.DetectContentType(content),
+        Size:               int64(len(content)),
+        Hash:               storage.CalculateDocumentHash(content),
+        HashAlgorithm:      "SHA3-256",
+        SignatureAlgorithm: crypto.DilithiumAlgorithm,
+        SignerKeyID:        keyID,
+        Encrypted:          true,
+        RetentionClass:     retentionClass,
+    }, "", "  ")
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to encode manifest")
+    }
+    
+    container, err := json.MarshalIndent(storage.SignatureContainer{
+        Algorithm: crypto.DilithiumAlgorithm,
+        KeyID:     keyID,
+        PublicKey: publicKey,
+        Signature: signature,
+        Created:   time.Now().UTC(),
+    }, "", "  ")
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to encode signature container")
+    }
+    
+    files := []storage.BundleFile{
+        {Name: storage.BundlePayloadFile, Content: bytes.NewReader(encryptedContent), Size: int64(len(encryptedContent))},
+        {Name: storage.BundleSignatureFile, Content: bytes.NewReader(container), Size: int64(len(container))},
+        {Name: storage.BundleManifestFile, Content: bytes.NewReader(manifest), Size: int64(len(manifest))},
+    }
+    if signerCertPath != "" {
+        cert, err := os.ReadFile(signerCertPath)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to read signer certificate")
+        }
+        files = append(files, storage.BundleFile{Name: storage.BundleCertificateFile, Content: bytes.NewReader(cert), Size: int64(len(cert))})
+    }
+    
+    cid, err := storage.PutBundle(context.Background(), store, files)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to store document bundle on IPFS")
+    }
+    
+    log.Info().
+        Str("signerKeyId", keyID).
+        Int("files", len(files)).
+        Msg("Document bundle created")
+    
+    return cid
+}
+
+// pinDocument pins cid on the configured pinning services and exits unless the
+// required number of them confirm
+func pinDocument(cid, name string, pinOpts pinOptions) {
+    cfg, err := pinning.LoadConfig(pinOpts.configPath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to load pinning config")
+    }
+    if pinOpts.minPinned > 0 {
+        cfg.MinPinned = pinOpts.minPinned
+        if err := cfg.Validate(); err != nil {
+            log.Fatal().Err(err).Msg("Invalid --min-pinned")
+        }
+    }
+
+    log.Info().
+        Int("services", len(cfg.Services)).
+        Int("minPinned", cfg.MinPinned).
+        Msg("Pinning document on remote pinning services...")
+
+    ctx, cancel := context.WithTimeout(context.Background(), pinOpts.timeout)
+    defer cancel()
+
+    results, err := cfg.Pin(ctx, cid, name)
+    for _, result := range results {
+        if result.Pinned() {
+            log.Info().Str("service", result.Service).Str("requestId", result.Status.RequestID).Msg("Document pinned")
+        } else {
+            log.Warn().Err(result.Err).Str("service", result.Service).Msg("Pinning failed")
+        }
+    }
+    if err != nil {
+        log.Fatal().Err(err).Msg("Document was not pinned on enough services")
+    }
+}
+
+func ipnsUpdateCmd() *cobra.Command {
+    var cid string
+    var documentHash string
+    var contractAddress string
+    var ethPrivateKeyHex string
+    var nodeURL string
+    var ipnsOpts ipnsOptions
+    
+    cmd := &cobra.Command{
+        Use:   "ipns-update",
+        Short: "Point a document's IPNS name at a new version",
+        Run: func(cmd *cobra.Command, args []string) {
+            ethPrivKey, err := blockchain.LoadPrivateKey(ethPrivateKeyHex)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to load Ethereum private key")
+            }
+            
+            client, err := blockchain.NewBlockchainClient(nodeURL, contractAddress)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to create blockchain client")
+            }
+            
+            ipnsName := publishVersion(client, ethPrivKey, documentHash, cid, ipnsOpts)
+            fmt.Println("IPNS name:", "/ipns/"+ipnsName)
+            fmt.Println("Current version:", cid)
+        },
+    }
+    
+    cmd.Flags().StringVar(&cid, "cid", "", "CID of the new version")
+    cmd.Flags().StringVar(&documentHash, "hash", "", "Hash of the new version, which must already be registered")
+    cmd.Flags().StringVar(&ipnsOpts.key, "key", "", "Key ring key naming the logical document (generated if missing)")
+    cmd.Flags().DurationVar(&ipnsOpts.lifetime, "lifetime", 0, "Validity of the IPNS record (default: the node's default)")
+    cmd.Flags().StringVar(&contractAddress, "contract", "", "Document registry contract address")
+    cmd.Flags().StringVar(&ethPrivateKeyHex, "eth-key", "", "Ethereum private key in hex format")
+    cmd.Flags().StringVar(&ipnsOpts.gateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&nodeURL, "node", "http://localhost:8545", "Ethereum node URL")
+    
+    cmd.MarkFlagRequired("cid")
+    cmd.MarkFlagRequired("hash")
+    cmd.MarkFlagRequired("key")
+    cmd.MarkFlagRequired("contract")
+    cmd.MarkFlagRequired("eth-key")
+    
+    return cmd
+}
+
+func ipnsResolveCmd() *cobra.Command {
+    var name string
+    var documentHash string
+    var contractAddress string
+    var ipfsGateway string
+    var nodeURL string
+    
+    cmd := &cobra.Command{
+        Use:   "ipns-resolve",
+        Short: "Resolve the latest version of a document",
+        Run: func(cmd *cobra.Command, args []string) {
+            if name == "" {
+                if documentHash == "" {
+                    log.Fatal().Msg("Either --name or --hash is required")
+                }
+                
+                // Follow the link from the registry entry of any version
+                client, err := blockchain.NewBlockchainClient(nodeURL, contractAddress)
+                if err != nil {
+                    log.Fatal().Err(err).Msg("Failed to create blockchain client")
+                }
+                linked, ok := client.GetIPNSName(documentHash)
+                if !ok {
+                    log.Fatal().Str("hash", documentHash).Msg("Document has no linked IPNS name")
+                }
+                name = linked
+            }
+            
+            ipfsClient, err := storage.NewIPFSClient(ipfsGateway)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to create IPFS client")
+            }
+            
+            cid, err := ipfsClient.ResolveName(context.Background(), name)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to resolve IPNS name")
+            }
+            
+            fmt.Println("IPNS name:", "/ipns/"+strings.TrimPrefix(name, "/ipns/"))
+            fmt.Println("Current version:", cid)
+        },
+    }
+    
+    cmd.Flags().StringVar(&name, "name", "", "IPNS name to resolve")
+    cmd.Flags().StringVar(&documentHash, "hash", "", "Hash of any registered version linked to an IPNS name")
+    cmd.Flags().StringVar(&contractAddress, "contract", "", "Document registry contract address")
+    cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&nodeURL, "node", "http://localhost:8545", "Ethereum node URL")
+    
+    return cmd
+}
+
+// publishVersion points the IPNS name of ipnsOpts.key at cid and links the name from
+// the registry entry of documentHash. It returns the IPNS name.
+func publishVersion(client *blockchain.BlockchainClient, ethPrivKey *ecdsa.PrivateKey, documentHash, cid string, ipnsOpts ipnsOptions) string {
+    ipfsClient, err := storage.NewIPFSClient(ipnsOpts.gateway)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to create IPFS client")
+    }
+    
+    ctx := context.Background()
+    key, err := ipfsClient.EnsureKey(ctx, ipnsOpts.key)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to get IPNS key")
+    }
+    
+    log.Info().
+        Str("key", key.Name).
+        Str("cid", cid).
+        Msg("Publishing IPNS record...")
+    
+    ipnsName, err := ipfsClient.PublishName(ctx, key.Name, cid, ipnsOpts.lifetime)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to publish IPNS record")
+    }
+    
+    txHash, err := client.LinkIPNSName(ethPrivKey, documentHash, ipnsName)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to link IPNS name in the registry")
+    }
+    
+    log.Info().
+        Str("name", ipnsName).
+        Str("txHash", txHash).
+        Msg("IPNS name linked from registry entry")
+    
+    return ipnsName
+}
+
+// verifyBundleSignature checks the signature container of a bundle against the document.
+// Without pubKeyPath the key embedded in the container is used, which proves integrity
+// but not who the signer is.
+func verifyBundleSignature(ctx context.Context, bundle *storage.Bundle, manifest *storage.Manifest, content []byte, pubKeyPath, outputPath string) {
+    log.Info().Msg("Verifying Dilithium signature...")
+    
+    container, err := bundle.Signature(ctx)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read signature container")
+    }
+    if container.Algorithm != crypto.DilithiumAlgorithm {
+        log.Fatal().Str("algorithm", container.Algorithm).Msg("Unsupported signature algorithm")
+    }
+    
+    pubKey := container.PublicKey
+    if pubKeyPath != "" {
+        pubKey, err = os.ReadFile(pubKeyPath)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to read Dilithium public key")
+        }
+    } else {
+        log.Warn().
+            Str("signerKeyId", container.KeyID).
+            Msg("No --pubkey given; verifying with the key in the bundle, which does not identify the signer")
+    }
+    
+    keyID := crypto.DilithiumKeyID(pubKey)
+    if keyID != container.KeyID || keyID != manifest.SignerKeyID {
+        log.Fatal().
+            Str("keyId", keyID).
+            Str("containerKeyId", container.KeyID).
+            Str("manifestKeyId", manifest.SignerKeyID).
+            Msg("Signer key does not match the bundle")
+    }
+    
+    valid, err := storage.VerifyWithDilithium(content, container.Signature, pubKey)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to verify Dilithium signature")
+    }
+    if !valid {
+        log.Fatal().Msg("Dilithium signature verification failed - document may be compromised")
+    }
+    
+    // Hand the signer certificate to the caller for identity checks
+    if bundle.Has(storage.BundleCertificateFile) {
+        cert, err := bundle.ReadFile(ctx, storage.BundleCertificateFile)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to read signer certificate")
+        }
+        certPath := outputPath + ".crt"
+        if err := os.WriteFile(certPath, cert, 0644); err != nil {
+            log.Fatal().Err(err).Msg("Failed to save signer certificate")
+        }
+        log.Info().Str("path", certPath).Msg("Saved signer certificate")
+    }
+    
+    log.Info().
+        Str("signerKeyId", keyID).
+        Msg("Dilithium signature verification successful")
+}
+
 func verifyAndRetrieveCmd() *cobra.Command {
     var cid string
     var outputPath string
     var contractAddress string
     var documentHash string
     var dilithiumPubKeyPath string
+    var tenantKeyPath string
+    var kemKeyPath string
     var ipfsGateway string
+    var storeURL string
+    var carPath string
+    var fallbackGateways []string
     var nodeURL string
+    var cache cacheFlags
     
     cmd := &cobra.Command{
         Use:   "verify-retrieve",
         Short: "Verify document authenticity and retrieve from IPFS",
         Run: func(cmd *cobra.Command, args []string) {
-            verifyAndRetrieveDocument(cid, outputPath, contractAddress, documentHash, dilithiumPubKeyPath, ipfsGateway, nodeURL)
+            verifyAndRetrieveDocument(cid, outputPath, contractAddress, documentHash, dilithiumPubKeyPath, tenantKeyPath, kemKeyPath, storage.StoreURL(storeURL, ipfsGateway), carPath, fallbackGateways, cache.openOrWarn(), nodeURL)
         },
     }
     
-    cmd.Flags().StringVar(&cid, "cid", "", "IPFS CID of the document")
+    cmd.Flags().StringVar(&cid, "cid", "", "IPFS CID of the document (default: the root of --car)")
     cmd.Flags().StringVar(&outputPath, "out", "", "Output path for retrieved document")
     cmd.Flags().StringVar(&contractAddress, "contract", "", "Document registry contract address")
-    cmd.Flags().StringVar(&documentHash, "hash", "", "Document hash to verify")
+    cmd.Flags().StringVar(&documentHash, "hash", "", "Document hash to verify (default: from the bundle manifest)")
     cmd.Flags().StringVar(&dilithiumPubKeyPath, "pubkey", "", "Path to Dilithium public key file")
+    cmd.Flags().StringVar(&tenantKeyPath, "tenant-key", "", "Path to the tenant key of a convergently encrypted document")
+    cmd.Flags().StringVar(&kemKeyPath, "kem-key", "", "Path to your ML-KEM-768 private key; if the document is not encrypted to it, your access grant is looked up")
     cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.Flags().StringVar(&carPath, "car", "", "Verify a document from a CAR archive instead of a store, without network access to it")
+    cmd.Flags().StringSliceVar(&fallbackGateways, "fallback-gateways", nil, storage.GatewayFlagUsage)
     cmd.Flags().StringVar(&nodeURL, "node", "http://localhost:8545", "Ethereum node URL")
+    cache.register(cmd)
     
-    cmd.MarkFlagRequired("cid")
     cmd.MarkFlagRequired("out")
     cmd.MarkFlagRequired("contract")
-    cmd.MarkFlagRequired("hash")
     
     return cmd
 }
 
-func verifyAndRetrieveDocument(cid, outputPath, contractAddress, documentHash, dilithiumPubKeyPath, ipfsGateway, nodeURL string) {
+func verifyAndRetrieveDocument(cid, outputPath, contractAddress, documentHash, dilithiumPubKeyPath, tenantKeyPath, kemKeyPath, storeURL, carPath string, fallbackGateways []string, cache *storage.Cache, nodeURL string) {
+    ctx := context.Background()
+    
+    // Open the document store, or the CAR archive the document was transferred in; a
+    // bundle's manifest names the document hash
+    var store storage.DocumentStore
+    if carPath != "" {
+        archive := openVerifiedCAR(ctx, carPath, &cid)
+        defer archive.Close()
+        store = archive
+    } else {
+        if cid == "" {
+            log.Fatal().Msg("--cid is required unless --car is given")
+        }
+        opened, err := storage.Open(storeURL)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to open document store")
+        }
+        opened, err = storage.WithGatewayFallback(opened, fallbackGateways)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to configure gateway fallback")
+        }
+        store = storage.WithCache(opened, cache)
+    }
+    
     log.Info().
         Str("cid", cid).
         Str("hash", documentHash).
         Msg("Verifying and retrieving document...")
     
+    var manifest *storage.Manifest
+    bundle, err := storage.OpenBundle(ctx, store, cid)
+    if errors.Is(err, storage.ErrNotBundle) {
+        bundle = nil
+    } else if err != nil {
+        log.Fatal().Err(err).Msg("Failed to open document bundle")
+    }
+    if bundle != nil {
+        manifest, err = bundle.Manifest(ctx)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to read bundle manifest")
+        }
+        if documentHash == "" {
+            documentHash = manifest.Hash
+        } else if documentHash != manifest.Hash {
+            log.Fatal().
+                Str("expectedHash", documentHash).
+                Str("manifestHash", manifest.Hash).
+                Msg("Bundle manifest describes a different document")
+        }
+        log.Info().
+            Str("fileName", manifest.FileName).
+            Str("mediaType", manifest.MediaType).
+            Str("hash", manifest.Hash).
+            Msg("Document bundle found")
+    }
+
+    // A hash CID is derived from the document hash, so it names the document itself
+    cidHash, hashCID := blockchain.DocumentHash(cid)
+    if hashCID {
+        if documentHash == "" {
+            documentHash = cidHash
+        } else if !strings.EqualFold(documentHash, cidHash) {
+            log.Fatal().
+                Str("expectedHash", documentHash).
+                Str("cidHash", cidHash).
+                Msg("CID is derived from a different document hash")
+        }
+    }
+    if documentHash == "" {
+        log.Fatal().Msg("--hash is required for documents stored without a bundle")
+    }
+    
     // 1. Create blockchain client
     client, err := blockchain.NewBlockchainClient(nodeURL, contractAddress)
     if err != nil {
@@ -267,6 +812,9 @@ func verifyAndRetrieveDocument(cid, outputPath, contractAddress, documentHash, d
     if err != nil {
         log.Fatal().Err(err).Msg("Failed to retrieve document details")
     }
+    if !verified {
+        log.Fatal().Str("hash", documentHash).Msg("Document is not registered on blockchain")
+    }
     
     // 4. Check if CID matches
     if storedCID != cid {
@@ -282,42 +830,25 @@ func verifyAndRetrieveDocument(cid, outputPath, contractAddress, documentHash, d
         Bool("verified", verified).
         Msg("Document verified on blockchain")
     
-    // If this is a mock CID (based on pattern), we can't retrieve from IPFS
-    // so create a dummy document with a message
-    if len(cid) < 46 && strings.HasPrefix(cid, "Qm") {
-        log.Warn().
-            Str("cid", cid).
-            Msg("Using a mock CID - cannot retrieve actual document from IPFS")
-            
-        // Create a dummy document with explanation
-        mockContent := []byte(fmt.Sprintf(
-            "MOCK DOCUMENT\n\n" +
-            "This is a placeholder for document with hash: %s\n" +
-            "Real document retrieval from IPFS requires a valid CID.\n" +
-            "In production, the blockchain would store the real CID.\n",
-            documentHash))
-            
-        // Write to the output file
-        err = os.WriteFile(outputPath, mockContent, 0644)
-        if err != nil {
-            log.Fatal().Err(err).Msg("Failed to write mock document")
-        }
-        
+    // Point readers at the latest version if the document has one
+    if ipnsName, ok := client.GetIPNSName(documentHash); ok {
         log.Info().
-            Str("path", outputPath).
-            Msg("Created mock document due to test environment")
-            
-        return
+            Str("ipns", "/ipns/"+ipnsName).
+            Msg("Document is versioned; run ipns-resolve for the latest version")
     }
     
-    // Proceed with normal IPFS retrieval for real CIDs
     // 5. Retrieve document from IPFS
-    ipfs, err := storage.NewIPFSClient(ipfsGateway)
+var reader io.ReadCloser
+if bundle != nil {
+    reader, err = bundle.Open(ctx, storage.BundlePayloadFile)
+} else {
+    reader, err = store.Get(ctx, cid)
+}
 if err != nil {
-    log.Fatal().Err(err).Msg("Failed to create IPFS client")
+    log.Fatal().Err(err).Msg("Failed to retrieve encrypted document from IPFS")
 }
-
-encryptedContent, err := ipfs.Retrieve(cid)
+encryptedContent, err := io.ReadAll(reader)
+reader.Close()
 if err != nil {
     log.Fatal().Err(err).Msg("Failed to retrieve encrypted document from IPFS")
 }
@@ -332,17 +863,55 @@ log.Info().Str("path", encryptedFilePath).Msg("Saved encrypted document for refe
 
 // Get the decryption key - in a real system, this would involve access control
 // Here we're using the dilithium public key as a simple demonstration
+// Convergently encrypted documents are decrypted with the tenant key instead
 var decryptionKey []byte
-if dilithiumPubKeyPath != "" {
+var kemKey *crypto.Secret
+if tenantKeyPath != "" {
+    tenantKey, err := crypto.ReadSecretFile(tenantKeyPath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read tenant key")
+    }
+    defer tenantKey.Destroy()
+    decryptionKey = tenantKey.Bytes()
+} else if kemKeyPath != "" {
+    kemKey, err = crypto.ReadSecretFile(kemKeyPath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read ML-KEM private key")
+    }
+    defer kemKey.Destroy()
+    if !crypto.IsKEMPrivateKey(kemKey.Bytes()) {
+        log.Fatal().Msg("Key file does not hold an ML-KEM-768 private key")
+    }
+} else if dilithiumPubKeyPath != "" {
     decryptionKey, err = os.ReadFile(dilithiumPubKeyPath)
     if err != nil {
         log.Fatal().Err(err).Msg("Failed to read decryption key")
     }
 }
 
-// Decrypt the document
-log.Info().Msg("Decrypting document with AES-256-GCM...")
-content, err := storage.DecryptDocument(encryptedContent, decryptionKey)
+// Decrypt the document; documents under a hash CID are stored unencrypted
+var content []byte
+if hashCID {
+    log.Info().Msg("Document is stored unencrypted under its hash CID")
+    content = encryptedContent
+} else {
+    log.Info().Msg("Decrypting document with AES-256-GCM...")
+    decrypt := func(key []byte) error {
+        content, err = storage.DecryptDocument(encryptedContent, key)
+        if errors.Is(err, storage.ErrNotRecipient) && kemKey != nil {
+            // Not encrypted to this key: open it with the access grant the owner published
+            grant := lookupGrant(ctx, client, store, cid, key, manifest)
+            content, _, err = storage.OpenEnvelopeWithGrant(encryptedContent, key, grant)
+        }
+        return err
+    }
+    // The ML-KEM key is held for the whole unwrap
+    if kemKey != nil {
+        err = kemKey.Use(decrypt)
+    } else {
+        err = decrypt(decryptionKey)
+    }
+}
 if err != nil {
     log.Fatal().Err(err).Msg("Failed to decrypt document - unauthorized access or corrupted data")
 }
@@ -356,8 +925,11 @@ if err != nil {
             Msg("Document hash mismatch - content may have been tampered with")
     }
     
-    // 7. Verify with Dilithium if public key provided
-    if dilithiumPubKeyPath != "" {
+    // 7. Verify with Dilithium: bundles carry their signature, older documents need a
+    // public key and a .sig file next to the output
+    if bundle != nil {
+        verifyBundleSignature(ctx, bundle, manifest, content, dilithiumPubKeyPath, outputPath)
+    } else if dilithiumPubKeyPath != "" {
         log.Info().Msg("Verifying Dilithium signature...")
         
         // Read the public key
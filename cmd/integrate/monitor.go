@@ -0,0 +1,143 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/monitor"
+    "quantum-doc-verify/pkg/storage"
+)
+
+// monitorRunOptions configures the monitor command
+type monitorRunOptions struct {
+    contractAddress string
+    nodeURL         string
+    storeURL        string
+    reportPath      string
+    alertWebhook    string
+    repair          bool
+    timeout         time.Duration
+    interval        time.Duration
+}
+
+func monitorCmd() *cobra.Command {
+    var opts monitorRunOptions
+    var ipfsGateway string
+
+    cmd := &cobra.Command{
+        Use:   "monitor",
+        Short: "Check that every registered document is still available and intact",
+        Long: "Reads every file of every registered document from each node of the store, verifying it " +
+            "against its CID, restores lost or corrupt copies from healthy nodes, and writes a status report. " +
+            "Alerts are raised when a document goes missing or stops matching the registry. " +
+            "With --interval it keeps running and checks the registry periodically.",
+        Run: func(cmd *cobra.Command, args []string) {
+            opts.storeURL = storage.StoreURL(opts.storeURL, ipfsGateway)
+            m, err := newMonitor(opts)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to start monitor")
+            }
+
+            if opts.interval <= 0 {
+                report, err := m.Check(context.Background(), time.Now())
+                if err != nil {
+                    log.Fatal().Err(err).Msg("Availability check failed")
+                }
+                if err := logMonitorReport(report, opts.reportPath); err != nil {
+                    log.Fatal().Err(err).Msg("Failed to write report")
+                }
+                if report.Missing > 0 || report.Mismatched > 0 {
+                    log.Fatal().
+                        Int("missing", report.Missing).
+                        Int("mismatched", report.Mismatched).
+                        Msg("Some documents cannot be retrieved intact")
+                }
+                return
+            }
+
+            m.Run(context.Background(), opts.interval, func(report *monitor.Report, err error) {
+                if err == nil {
+                    err = logMonitorReport(report, opts.reportPath)
+                }
+                if err != nil {
+                    log.Error().Err(err).Msg("Availability check failed")
+                }
+            })
+        },
+    }
+
+    cmd.Flags().StringVar(&opts.contractAddress, "contract", "", "Document registry contract address")
+    cmd.Flags().StringVar(&opts.nodeURL, "node", "http://localhost:8545", "Ethereum node URL")
+    cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&opts.storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.Flags().StringVar(&opts.reportPath, "report", "", "Write the JSON report to this file instead of standard output")
+    cmd.Flags().StringVar(&opts.alertWebhook, "alert-webhook", "", "URL to POST a JSON alert to when a document goes missing, stops matching the registry or recovers")
+    cmd.Flags().BoolVar(&opts.repair, "repair", true, "Restore lost or corrupt copies from nodes holding a verified copy")
+    cmd.Flags().DurationVar(&opts.timeout, "timeout", monitor.DefaultCheckTimeout, "Time allowed to read or restore one file on one node")
+    cmd.Flags().DurationVar(&opts.interval, "interval", 0, "Keep running and check the registry at this interval")
+    cmd.MarkFlagRequired("contract")
+
+    return cmd
+}
+
+// newMonitor creates a monitor of the registry's documents on each node of the store.
+// The registry is re-read on every check, so a daemon picks up new registrations.
+func newMonitor(opts monitorRunOptions) (*monitor.Monitor, error) {
+    client, err := blockchain.NewBlockchainClient(opts.nodeURL, opts.contractAddress)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create blockchain client: %w", err)
+    }
+
+    store, err := storage.Open(opts.storeURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open document store: %w", err)
+    }
+
+    monitorOpts := monitor.Options{
+        Nodes:   monitor.Nodes(store, opts.storeURL),
+        Repair:  opts.repair,
+        Timeout: opts.timeout,
+    }
+    if opts.alertWebhook != "" {
+        monitorOpts.Alert = monitor.Webhook(opts.alertWebhook)
+    }
+
+    log.Info().
+        Int("nodes", len(monitorOpts.Nodes)).
+        Bool("repair", opts.repair).
+        Msg("Monitoring registered documents...")
+    return monitor.New(client, monitorOpts)
+}
+
+// logMonitorReport logs the problems found by a check and writes its report
+func logMonitorReport(report *monitor.Report, path string) error {
+    for _, doc := range report.Documents {
+        switch doc.Status {
+        case monitor.StatusMissing, monitor.StatusMismatch:
+            log.Error().Str("hash", doc.Hash).Str("cid", doc.CID).Str("status", string(doc.Status)).Str("error", doc.Error).Msg("Document cannot be retrieved intact")
+        case monitor.StatusDegraded:
+            log.Warn().Str("hash", doc.Hash).Str("cid", doc.CID).Msg("Document is held by fewer nodes than configured")
+        case monitor.StatusRepaired:
+            log.Info().Str("hash", doc.Hash).Str("cid", doc.CID).Msg("Lost copies restored")
+        }
+    }
+    for _, alertErr := range report.AlertErrors {
+        log.Warn().Str("error", alertErr).Msg("Failed to deliver alert")
+    }
+    log.Info().
+        Int("checked", report.Checked).
+        Int("healthy", report.Healthy).
+        Int("repaired", report.Repaired).
+        Int("degraded", report.Degraded).
+        Int("missing", report.Missing).
+        Int("mismatched", report.Mismatched).
+        Int("alerts", len(report.Alerts)).
+        Msg("Availability check complete")
+
+    return writeReport(report, path)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/pinning"
+    "quantum-doc-verify/pkg/retention"
+    "quantum-doc-verify/pkg/storage"
+)
+
+// retentionRunOptions configures the retention command
+type retentionRunOptions struct {
+    configPath        string
+    contractAddress   string
+    ethPrivateKeyHex  string
+    nodeURL           string
+    storeURL          string
+    pinningConfigPath string
+    reportPath        string
+    dryRun            bool
+    gc                bool
+    interval          time.Duration
+}
+
+// registryReleaser marks documents released in the blockchain registry
+type registryReleaser struct {
+    *blockchain.BlockchainClient
+    privateKey *ecdsa.PrivateKey
+}
+
+func (r *registryReleaser) MarkReleased(hash string, releasedAt time.Time) error {
+    txHash, err := r.BlockchainClient.MarkReleased(r.privateKey, hash, releasedAt)
+    if err != nil {
+        return err
+    }
+    log.Info().Str("hash", hash).Str("txHash", txHash).Msg("Document marked released")
+    return nil
+}
+
+func retentionCmd() *cobra.Command {
+    var opts retentionRunOptions
+    var ipfsGateway string
+
+    cmd := &cobra.Command{
+        Use:   "retention",
+        Short: "Release documents whose retention period has ended",
+        Long: "Evaluates the retention policies against the registry, unpins the content of expired " +
+            "documents from the store and the pinning services, and writes a report of what was released. " +
+            "With --interval it keeps running and evaluates the policies periodically.",
+        Run: func(cmd *cobra.Command, args []string) {
+            opts.storeURL = storage.StoreURL(opts.storeURL, ipfsGateway)
+            if opts.ethPrivateKeyHex == "" && !opts.dryRun {
+                log.Fatal().Msg("--eth-key is required unless --dry-run is set")
+            }
+
+            if opts.interval <= 0 {
+                report, err := enforceRetention(opts)
+                if err != nil {
+                    log.Fatal().Err(err).Msg("Retention run failed")
+                }
+                if len(report.Failed) > 0 {
+                    log.Fatal().Int("failed", len(report.Failed)).Msg("Some documents could not be released")
+                }
+                return
+            }
+
+            ticker := time.NewTicker(opts.interval)
+            defer ticker.Stop()
+            for {
+                if _, err := enforceRetention(opts); err != nil {
+                    log.Error().Err(err).Msg("Retention run failed")
+                }
+                <-ticker.C
+            }
+        },
+    }
+
+    cmd.Flags().StringVar(&opts.configPath, "config", "", "Retention policy file")
+    cmd.Flags().StringVar(&opts.contractAddress, "contract", "", "Document registry contract address")
+    cmd.Flags().StringVar(&opts.ethPrivateKeyHex, "eth-key", "", "Ethereum private key in hex format, used to record releases")
+    cmd.Flags().StringVar(&opts.nodeURL, "node", "http://localhost:8545", "Ethereum node URL")
+    cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&opts.storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.Flags().StringVar(&opts.pinningConfigPath, "pinning-config", "", "JSON file listing remote pinning services to remove pins from")
+    cmd.Flags().StringVar(&opts.reportPath, "report", "", "Write the JSON report to this file instead of standard output")
+    cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Report what would be released without unpinning anything")
+    cmd.Flags().BoolVar(&opts.gc, "gc", false, "Run garbage collection on the store's nodes after releasing content")
+    cmd.Flags().DurationVar(&opts.interval, "interval", 0, "Keep running and evaluate the policies at this interval")
+    cmd.MarkFlagRequired("config")
+    cmd.MarkFlagRequired("contract")
+
+    return cmd
+}
+
+// enforceRetention evaluates the policies once and writes the report. The policies and
+// registry are reloaded on every run, so a daemon picks up changes made by other
+// processes.
+func enforceRetention(opts retentionRunOptions) (*retention.Report, error) {
+    cfg, err := retention.LoadConfig(opts.configPath)
+    if err != nil {
+        return nil, err
+    }
+
+    client, err := blockchain.NewBlockchainClient(opts.nodeURL, opts.contractAddress)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create blockchain client: %w", err)
+    }
+    registry := &registryReleaser{BlockchainClient: client}
+    if opts.ethPrivateKeyHex != "" {
+        registry.privateKey, err = blockchain.LoadPrivateKey(opts.ethPrivateKeyHex)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    store, err := storage.Open(opts.storeURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open document store: %w", err)
+    }
+
+    runOpts := retention.Options{Store: store, GC: opts.gc, DryRun: opts.dryRun}
+    if opts.pinningConfigPath != "" {
+        runOpts.Pinning, err = pinning.LoadConfig(opts.pinningConfigPath)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    log.Info().
+        Int("policies", len(cfg.Policies)).
+        Bool("dryRun", opts.dryRun).
+        Msg("Evaluating retention policies...")
+
+    report, err := cfg.Enforce(context.Background(), registry, runOpts, time.Now())
+    if err != nil {
+        return nil, err
+    }
+
+    for _, failed := range report.Failed {
+        log.Warn().Str("hash", failed.Hash).Str("cid", failed.CID).Str("error", failed.Error).Msg("Failed to release document")
+    }
+    if report.GCError != "" {
+        log.Warn().Str("error", report.GCError).Msg("Garbage collection failed")
+    }
+    log.Info().
+        Int("evaluated", report.Evaluated).
+        Int("retained", report.Retained).
+        Int("released", len(report.Released)).
+        Int("failed", len(report.Failed)).
+        Int("unclassified", len(report.Unclassified)).
+        Int("collected", report.Collected).
+        Msg("Retention run complete")
+
+    return report, writeReport(report, opts.reportPath)
+}
+
+// writeReport writes a report as JSON to path, or to standard output
+func writeReport(report interface{}, path string) error {
+    data, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode report: %w", err)
+    }
+    data = append(data, '\n')
+
+    if path == "" {
+        _, err = os.Stdout.Write(data)
+        return err
+    }
+    if err := os.WriteFile(path, data, 0644); err != nil {
+        return fmt.Errorf("failed to write report: %w", err)
+    }
+    return nil
+}
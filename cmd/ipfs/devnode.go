@@ -0,0 +1,34 @@
+package main
+
+import (
+    "net/http"
+
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/ipfs/ipfstest"
+)
+
+func devNodeCmd() *cobra.Command {
+    var listenAddr string
+
+    cmd := &cobra.Command{
+        Use:   "devnode",
+        Short: "Run an in-memory IPFS node for offline demos and testing",
+        Long: "Serves the Kubo API commands this project uses (add, cat, pin, block, repo/gc) " +
+            "from memory, computing the same CIDs as Kubo. Content is lost when the node stops " +
+            "and is never fetched from or announced to the IPFS network.",
+        Run: func(cmd *cobra.Command, args []string) {
+            log.Info().
+                Str("api", "http://"+listenAddr+"/api/v0").
+                Msg("In-memory IPFS node listening; content is kept until it stops")
+            if err := http.ListenAndServe(listenAddr, ipfstest.NewNode()); err != nil {
+                log.Fatal().Err(err).Msg("In-memory IPFS node stopped")
+            }
+        },
+    }
+
+    cmd.Flags().StringVar(&listenAddr, "listen", "localhost:5001", "Address to serve the IPFS API on")
+
+    return cmd
+}
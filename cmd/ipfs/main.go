@@ -1,7 +1,12 @@
 package main
 
 import (
+    "context"
+    "encoding/hex"
     "fmt"
+    "hash"
+    "io"
+    "net/http"
     "os"
     "path/filepath"
 
@@ -9,7 +14,9 @@ import (
     "github.com/rs/zerolog/log"
     "github.com/spf13/cobra"
     
+    "quantum-doc-verify/pkg/crypto"
     "quantum-doc-verify/pkg/storage"
+    "quantum-doc-verify/pkg/unixfs"
 )
 
 func main() {
@@ -25,6 +32,11 @@ func main() {
     // Add subcommands
     rootCmd.AddCommand(storeCmd())
     rootCmd.AddCommand(retrieveCmd())
+    rootCmd.AddCommand(cidCmd())
+    rootCmd.AddCommand(exportCmd())
+    rootCmd.AddCommand(importCmd())
+    rootCmd.AddCommand(devNodeCmd())
+    rootCmd.AddCommand(sharesCmd())
 
     if err := rootCmd.Execute(); err != nil {
         log.Fatal().Err(err).Msg("Failed to execute command")
@@ -35,20 +47,43 @@ func storeCmd() *cobra.Command {
     var filePath string
     var encrypt bool
     var publicKeyPath string
+    var tenantKeyPath string
     var ipfsGateway string
+    var storeURL string
+    var chunker string
+    var rawLeaves bool
+    var hashCID bool
+    var compression string
 
     cmd := &cobra.Command{
         Use:   "store",
         Short: "Store a document on IPFS",
         Run: func(cmd *cobra.Command, args []string) {
-            storeDocument(filePath, encrypt, publicKeyPath, ipfsGateway)
+            codec, err := storage.ParseCompression(compression)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Invalid --compress")
+            }
+            if codec != storage.CompressionNone && !encrypt {
+                log.Fatal().Msg("--compress requires --encrypt; compression is recorded in the envelope")
+            }
+            if hashCID && (encrypt || chunker != "") {
+                log.Fatal().Msg("--hash-cid stores the document unencrypted in a single block; it cannot be combined with --encrypt or --chunker")
+            }
+            opts := storage.StoreOptions{Chunker: chunker, RawLeaves: rawLeaves, HashCID: hashCID}
+            storeDocument(filePath, encrypt, publicKeyPath, tenantKeyPath, custodianSet{}, codec, storage.StoreURL(storeURL, ipfsGateway), opts)
         },
     }
 
     cmd.Flags().StringVar(&filePath, "file", "", "Path to document file")
     cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt document before storing")
-    cmd.Flags().StringVar(&publicKeyPath, "pubkey", "", "Path to recipient's public key (required for encryption)")
+    cmd.Flags().StringVar(&publicKeyPath, "pubkey", "", "Path to recipient's ML-KEM-768 public key (required for encryption; other keys produce an envelope without key encapsulation)")
+    cmd.Flags().StringVar(&tenantKeyPath, "tenant-key", "", "Path to a tenant key: encrypt convergently instead of to --pubkey, so identical documents within the tenant share a CID (anyone with the tenant key can tell which documents are stored)")
     cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.Flags().StringVar(&chunker, "chunker", "", "IPFS chunking strategy, e.g. size-262144, size-1048576 or rabin")
+    cmd.Flags().BoolVar(&rawLeaves, "raw-leaves", false, "Store leaf blocks as raw blocks")
+    cmd.Flags().BoolVar(&hashCID, "hash-cid", false, fmt.Sprintf("Store the document unencrypted under a CID derived from its SHA3-256 hash (at most %d bytes)", storage.MaxHashCIDSize))
+    cmd.Flags().StringVar(&compression, "compress", "none", storage.CompressionFlagUsage)
     cmd.MarkFlagRequired("file")
 
     return cmd
@@ -60,65 +95,163 @@ func retrieveCmd() *cobra.Command {
     var decrypt bool
     var privateKeyPath string
     var ipfsGateway string
+    var storeURL string
+    var fallbackGateways []string
+    var cache cacheFlags
 
     cmd := &cobra.Command{
         Use:   "retrieve",
         Short: "Retrieve a document from IPFS",
         Run: func(cmd *cobra.Command, args []string) {
-            retrieveDocument(cid, outputPath, decrypt, privateKeyPath, ipfsGateway)
+            retrieveDocument(cid, outputPath, decrypt, privateKeyPath, storage.StoreURL(storeURL, ipfsGateway), fallbackGateways, cache.openOrWarn())
         },
     }
 
     cmd.Flags().StringVar(&cid, "cid", "", "IPFS CID of the document")
     cmd.Flags().StringVar(&outputPath, "out", "", "Output path for retrieved document")
     cmd.Flags().BoolVar(&decrypt, "decrypt", false, "Decrypt document after retrieval")
-    cmd.Flags().StringVar(&privateKeyPath, "privkey", "", "Path to recipient's private key (required for decryption)")
+    cmd.Flags().StringVar(&privateKeyPath, "privkey", "", "Path to recipient's ML-KEM-768 private key, or the tenant key of a convergent document (required for decryption)")
     cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.Flags().StringSliceVar(&fallbackGateways, "fallback-gateways", nil, storage.GatewayFlagUsage)
+    cache.register(cmd)
     cmd.MarkFlagRequired("cid")
     cmd.MarkFlagRequired("out")
 
     return cmd
 }
 
-func storeDocument(filePath string, encrypt bool, publicKeyPath string, ipfsGateway string) {
+func cidCmd() *cobra.Command {
+    var filePath string
+    var cidVersion int
+    var rawLeaves bool
+
+    cmd := &cobra.Command{
+        Use:   "cid",
+        Short: "Compute a document's IPFS CID offline, as \"ipfs add\" would",
+        Run: func(cmd *cobra.Command, args []string) {
+            opts := unixfs.DefaultOptions(cidVersion)
+            if cmd.Flags().Changed("raw-leaves") {
+                opts.RawLeaves = rawLeaves
+            }
+            computeCID(filePath, opts)
+        },
+    }
+
+    cmd.Flags().StringVar(&filePath, "file", "", "Path to document file")
+    cmd.Flags().IntVar(&cidVersion, "cid-version", 0, "CID version (0 or 1)")
+    cmd.Flags().BoolVar(&rawLeaves, "raw-leaves", false, "Use raw leaves (default: true for CIDv1)")
+    cmd.MarkFlagRequired("file")
+
+    return cmd
+}
+
+func storeDocument(filePath string, encrypt bool, publicKeyPath string, tenantKeyPath string, custodians custodianSet, compression uint8, storeURL string, opts storage.StoreOptions) {
     log.Info().
         Str("file", filePath).
         Bool("encrypt", encrypt).
+        Str("compression", storage.CompressionName(compression)).
         Msg("Storing document on IPFS...")
 
-    // Create IPFS client
-    ipfs, err := storage.NewIPFSClient(ipfsGateway)
+    // Open the document store
+    store, err := storage.Open(storeURL)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to open document store")
+    }
+
+    // Open the file; unencrypted documents are streamed without loading them into memory
+    file, err := os.Open(filePath)
     if err != nil {
-        log.Fatal().Err(err).Msg("Failed to create IPFS client")
+        log.Fatal().Err(err).Msg("Failed to read file")
     }
+    defer file.Close()
 
-    // Read file content
-    content, err := os.ReadFile(filePath)
+    info, err := file.Stat()
     if err != nil {
         log.Fatal().Err(err).Msg("Failed to read file")
     }
 
+    var source io.Reader = file
+    opts.Size = info.Size()
+
     // Handle encryption if requested
     if encrypt {
-        if publicKeyPath == "" {
-            log.Fatal().Msg("Public key path is required for encryption")
+        if len(custodians.keys) == 0 && (publicKeyPath == "") == (tenantKeyPath == "") {
+            log.Fatal().Msg("Either a public key (--pubkey) or a tenant key (--tenant-key) is required for encryption")
         }
         
-        // Read public key
-        pubKey, err := os.ReadFile(publicKeyPath)
-        if err != nil {
-            log.Fatal().Err(err).Msg("Failed to read public key file")
+        // Hash the plaintext and sniff its media type in a first pass, then rewind
+        documentHasher := storage.NewDocumentHasher()
+        sniff := make([]byte, 512)
+        n, _ := io.ReadFull(file, sniff)
+        documentHasher.Write(sniff[:n])
+        if _, err := io.Copy(documentHasher, file); err != nil {
+            log.Fatal().Err(err).Msg("Failed to read file")
         }
-        
-        // Encrypt content (you'll need to implement this)
-        content, err = storage.EncryptDocument(content, pubKey)
-        if err != nil {
-            log.Fatal().Err(err).Msg("Failed to encrypt document")
+        if _, err := file.Seek(0, io.SeekStart); err != nil {
+            log.Fatal().Err(err).Msg("Failed to read file")
         }
+
+        // Seal content in an envelope that records the original file name and media type
+        envelopeOpts := storage.EnvelopeOptions{
+            FileName:     filepath.Base(filePath),
+            MediaType:    http.DetectContentType(sniff[:n]),
+            DocumentHash: documentHasher.Sum(nil),
+            Compression:  compression,
+            ContentSize:  info.Size(),
+        }
+        if len(custodians.keys) > 0 {
+            envelopeOpts.Custodians = custodians.keys
+            envelopeOpts.Threshold = custodians.threshold
+        } else if tenantKeyPath != "" {
+            tenantKey, err := crypto.ReadSecretFile(tenantKeyPath)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to read tenant key file")
+            }
+            defer tenantKey.Destroy()
+            if !crypto.IsTenantKey(tenantKey.Bytes()) {
+                log.Fatal().Msg("Tenant key file does not hold a tenant key")
+            }
+
+            // The file name is left out so that copies uploaded under other names dedupe
+            envelopeOpts.FileName = ""
+            envelopeOpts.TenantKey = tenantKey.Bytes()
+            log.Warn().Msg("Convergent encryption: identical documents share a CID, and tenant key holders can confirm which documents are stored")
+        } else {
+            pubKey, err := os.ReadFile(publicKeyPath)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Failed to read public key file")
+            }
+            if crypto.IsKEMPublicKey(pubKey) {
+                envelopeOpts.Recipients = [][]byte{pubKey}
+            } else {
+                log.Warn().Msg("Public key is not an ML-KEM-768 key; the content key will not be encapsulated")
+            }
+        }
+
+        // Encrypt segment by segment while uploading
+        pr, pw := io.Pipe()
+        go func() {
+            encrypter, err := storage.NewEncryptWriter(pw, envelopeOpts)
+            if err != nil {
+                pw.CloseWithError(fmt.Errorf("failed to encrypt document: %w", err))
+                return
+            }
+            if _, err = io.Copy(encrypter, file); err == nil {
+                err = encrypter.Close()
+            }
+            pw.CloseWithError(err)
+        }()
+        source = pr
     }
 
+    // Hash the stored bytes as they are uploaded
+    hasher := storage.NewDocumentHasher()
+    source = io.TeeReader(source, hasher)
+    opts.Progress = progressLogger(opts.Size)
+
     // Store on IPFS
-    cid, err := ipfs.Store(content)
+    cid, err := store.Put(context.Background(), source, opts)
     if err != nil {
         log.Fatal().Err(err).Msg("Failed to store document on IPFS")
     }
@@ -128,7 +261,7 @@ func storeDocument(filePath string, encrypt bool, publicKeyPath string, ipfsGate
         Msg("Document stored on IPFS successfully!")
     
     // Calculate document hash for blockchain registration
-    hash := storage.CalculateDocumentHash(content)
+    hash := hex.EncodeToString(hasher.Sum(nil))
     
     fmt.Println("\nDocument Storage:")
     fmt.Printf("IPFS CID: %s\n", cid)
@@ -137,57 +270,167 @@ func storeDocument(filePath string, encrypt bool, publicKeyPath string, ipfsGate
     fmt.Printf("./bin/blockchain register --contract=YOUR_CONTRACT_ADDRESS --key=YOUR_PRIVATE_KEY --hash=%s --cid=%s\n", hash, cid)
 }
 
-func retrieveDocument(cid string, outputPath string, decrypt bool, privateKeyPath string, ipfsGateway string) {
+// cacheFlags configures the local document cache shared with quantum-doc-verify and the
+// API server
+type cacheFlags struct {
+    opts   storage.CacheOptions
+    sizeMB int64
+}
+
+// register adds the cache flags to cmd
+func (f *cacheFlags) register(cmd *cobra.Command) {
+    f.opts = storage.DefaultCacheOptions()
+    f.sizeMB = f.opts.MaxSize >> 20
+
+    cmd.Flags().StringVar(&f.opts.Dir, "cache-dir", f.opts.Dir, storage.CacheFlagUsage)
+    cmd.Flags().Int64Var(&f.sizeMB, "cache-size", f.sizeMB, "Maximum size of the document cache in MiB")
+    cmd.Flags().DurationVar(&f.opts.TTL, "cache-ttl", f.opts.TTL, "Drop cached documents not read for this long")
+}
+
+// openOrWarn opens the cache, or returns nil if it is disabled or cannot be opened
+func (f *cacheFlags) openOrWarn() *storage.Cache {
+    if f.opts.Dir == "" {
+        return nil
+    }
+    f.opts.MaxSize = f.sizeMB << 20
+    cache, err := storage.OpenCache(f.opts)
+    if err != nil {
+        log.Warn().Err(err).Msg("Document cache unavailable, retrieving without it")
+        return nil
+    }
+    return cache
+}
+
+func computeCID(filePath string, opts unixfs.Options) {
+    file, err := os.Open(filePath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read file")
+    }
+    defer file.Close()
+
+    cid, err := unixfs.Compute(file, opts)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to compute CID")
+    }
+
+    fmt.Println(cid)
+}
+
+// progressLogger returns a StoreOptions.Progress callback that logs every 10% (or every 16 MiB
+// when the total size is unknown)
+func progressLogger(total int64) func(int64) {
+    step := int64(16 << 20)
+    if total > 0 {
+        step = total / 10
+    }
+    if step < 1<<20 {
+        step = 1 << 20
+    }
+
+    next := step
+    return func(sent int64) {
+        if sent < next {
+            return
+        }
+        next = sent + step
+        event := log.Info().Int64("bytes", sent)
+        if total > 0 {
+            event = event.Int64("percent", sent*100/total)
+        }
+        event.Msg("Upload progress")
+    }
+}
+
+// writeOutput streams a retrieved document to outputPath. Content is verified against the
+// CID (and decrypted content authenticated) at the end of the stream, so a partial or
+// mismatching file must not be left behind.
+func writeOutput(outputPath string, content io.Reader, hasher hash.Hash) {
+    out, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to write output file")
+    }
+
+    if _, err := io.Copy(io.MultiWriter(out, hasher), content); err != nil {
+        out.Close()
+        os.Remove(outputPath)
+        log.Fatal().Err(err).Msg("Failed to retrieve document from IPFS")
+    }
+    if err := out.Close(); err != nil {
+        log.Fatal().Err(err).Msg("Failed to write output file")
+    }
+}
+
+func retrieveDocument(cid string, outputPath string, decrypt bool, privateKeyPath string, storeURL string, fallbackGateways []string, cache *storage.Cache) {
     log.Info().
         Str("cid", cid).
         Bool("decrypt", decrypt).
         Msg("Retrieving document from IPFS...")
 
-    // Create IPFS client
-    ipfs, err := storage.NewIPFSClient(ipfsGateway)
+    // Open the document store
+    store, err := storage.Open(storeURL)
     if err != nil {
-        log.Fatal().Err(err).Msg("Failed to create IPFS client")
+        log.Fatal().Err(err).Msg("Failed to open document store")
+    }
+    store, err = storage.WithGatewayFallback(store, fallbackGateways)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to configure gateway fallback")
+    }
+    store = storage.WithCache(store, cache)
+
+    // Ensure output directory exists
+    err = os.MkdirAll(filepath.Dir(outputPath), 0755)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to create output directory")
     }
 
     // Retrieve from IPFS
-    content, err := ipfs.Retrieve(cid)
+    reader, err := store.Get(context.Background(), cid)
     if err != nil {
         log.Fatal().Err(err).Msg("Failed to retrieve document from IPFS")
     }
+    defer reader.Close()
+
+    hasher := storage.NewDocumentHasher()
 
-    // Handle decryption if requested
     if decrypt {
         if privateKeyPath == "" {
             log.Fatal().Msg("Private key path is required for decryption")
         }
         
-        // Read private key
-        privKey, err := os.ReadFile(privateKeyPath)
+        // Read private key into locked memory
+        privKey, err := crypto.ReadSecretFile(privateKeyPath)
         if err != nil {
             log.Fatal().Err(err).Msg("Failed to read private key file")
         }
-        
-        // Decrypt content (you'll need to implement this)
-        content, err = storage.DecryptDocument(content, privKey)
+        defer privKey.Destroy()
+
+        // Decrypt content as it arrives; the key is only needed to open the envelope
+        var content io.Reader
+        var header *storage.EnvelopeHeader
+        err = privKey.Use(func(key []byte) error {
+            content, header, err = storage.NewDecryptReader(reader, key)
+            return err
+        })
         if err != nil {
             log.Fatal().Err(err).Msg("Failed to decrypt document")
         }
-    }
-
-    // Ensure output directory exists
-    err = os.MkdirAll(filepath.Dir(outputPath), 0755)
-    if err != nil {
-        log.Fatal().Err(err).Msg("Failed to create output directory")
-    }
+        if header != nil {
+            log.Info().
+                Str("fileName", header.FileName).
+                Str("mediaType", header.MediaType).
+                Bool("convergent", header.Convergent()).
+                Msg("Decrypted document envelope")
+        }
 
-    // Write to output file
-    err = os.WriteFile(outputPath, content, 0644)
-    if err != nil {
-        log.Fatal().Err(err).Msg("Failed to write output file")
+        // Write to output file
+        writeOutput(outputPath, content, hasher)
+    } else {
+        // Stream straight to the output file
+        writeOutput(outputPath, reader, hasher)
     }
 
     // Calculate document hash for verification
-    hash := storage.CalculateDocumentHash(content)
+    hash := hex.EncodeToString(hasher.Sum(nil))
 
     log.Info().
         Str("output", outputPath).
@@ -197,4 +440,4 @@ func retrieveDocument(cid string, outputPath string, decrypt bool, privateKeyPat
     fmt.Printf("IPFS CID: %s\n", cid)
     fmt.Printf("Document Hash: %s\n", hash)
     fmt.Printf("Output File: %s\n", outputPath)
-}
\ No newline at end of file
+}
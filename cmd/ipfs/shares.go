@@ -0,0 +1,314 @@
+package main
+
+import (
+    "context"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+
+    "github.com/rs/zerolog/log"
+    "github.com/spf13/cobra"
+
+    "quantum-doc-verify/pkg/crypto"
+    "quantum-doc-verify/pkg/storage"
+)
+
+// custodianSet is the custodians a document's content key is split among, and how many
+// of them must cooperate to decrypt it
+type custodianSet struct {
+    keys      [][]byte
+    threshold int
+}
+
+func sharesCmd() *cobra.Command {
+    cmd := &cobra.Command{
+        Use:   "shares",
+        Short: "Split document keys among custodians and recombine their shares",
+    }
+
+    cmd.AddCommand(sharesIssueCmd())
+    cmd.AddCommand(sharesSubmitCmd())
+    cmd.AddCommand(sharesCombineCmd())
+
+    return cmd
+}
+
+func sharesIssueCmd() *cobra.Command {
+    var filePath string
+    var custodianPaths []string
+    var threshold int
+    var ipfsGateway string
+    var storeURL string
+    var compression string
+
+    cmd := &cobra.Command{
+        Use:   "issue",
+        Short: "Encrypt and store a document whose key is split among custodians",
+        Run: func(cmd *cobra.Command, args []string) {
+            codec, err := storage.ParseCompression(compression)
+            if err != nil {
+                log.Fatal().Err(err).Msg("Invalid --compress")
+            }
+            custodians := loadCustodians(custodianPaths, threshold)
+            storeDocument(filePath, true, "", "", custodians, codec, storage.StoreURL(storeURL, ipfsGateway), storage.StoreOptions{})
+        },
+    }
+
+    cmd.Flags().StringVar(&filePath, "file", "", "Path to document file")
+    cmd.Flags().StringSliceVar(&custodianPaths, "custodian", nil, "Path to a custodian's ML-KEM-768 public key (repeat for each custodian)")
+    cmd.Flags().IntVar(&threshold, "threshold", 0, "Number of custodians needed to decrypt the document")
+    cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.Flags().StringVar(&compression, "compress", "none", storage.CompressionFlagUsage)
+    cmd.MarkFlagRequired("file")
+    cmd.MarkFlagRequired("custodian")
+    cmd.MarkFlagRequired("threshold")
+
+    return cmd
+}
+
+func sharesSubmitCmd() *cobra.Command {
+    var cid string
+    var privateKeyPath string
+    var combinerKeyPath string
+    var outputPath string
+    var ipfsGateway string
+    var storeURL string
+
+    cmd := &cobra.Command{
+        Use:   "submit",
+        Short: "Unwrap a custodian's share of a document key for recombination",
+        Run: func(cmd *cobra.Command, args []string) {
+            submitShare(cid, privateKeyPath, combinerKeyPath, outputPath, storage.StoreURL(storeURL, ipfsGateway))
+        },
+    }
+
+    cmd.Flags().StringVar(&cid, "cid", "", "IPFS CID of the document")
+    cmd.Flags().StringVar(&privateKeyPath, "privkey", "", "Path to the custodian's ML-KEM-768 private key")
+    cmd.Flags().StringVar(&combinerKeyPath, "to", "", "Path to the ML-KEM-768 public key of whoever combines the shares; the share is sealed to it (default: written in the clear)")
+    cmd.Flags().StringVar(&outputPath, "out", "", "Path of the share file to write")
+    cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.MarkFlagRequired("cid")
+    cmd.MarkFlagRequired("privkey")
+    cmd.MarkFlagRequired("out")
+
+    return cmd
+}
+
+func sharesCombineCmd() *cobra.Command {
+    var cid string
+    var sharePaths []string
+    var privateKeyPath string
+    var outputPath string
+    var ipfsGateway string
+    var storeURL string
+
+    cmd := &cobra.Command{
+        Use:   "combine",
+        Short: "Recombine custodian shares and decrypt the document",
+        Run: func(cmd *cobra.Command, args []string) {
+            combineShares(cid, sharePaths, privateKeyPath, outputPath, storage.StoreURL(storeURL, ipfsGateway))
+        },
+    }
+
+    cmd.Flags().StringVar(&cid, "cid", "", "IPFS CID of the document")
+    cmd.Flags().StringSliceVar(&sharePaths, "share", nil, "Path to a share file written by shares submit (repeat for each custodian)")
+    cmd.Flags().StringVar(&privateKeyPath, "privkey", "", "Path to the ML-KEM-768 private key the shares were sealed to with --to")
+    cmd.Flags().StringVar(&outputPath, "out", "", "Output path for the decrypted document")
+    cmd.Flags().StringVar(&ipfsGateway, "gateway", "localhost:5001", "IPFS gateway address")
+    cmd.Flags().StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
+    cmd.MarkFlagRequired("cid")
+    cmd.MarkFlagRequired("share")
+    cmd.MarkFlagRequired("out")
+
+    return cmd
+}
+
+// loadCustodians reads the custodians' public keys and checks the threshold
+func loadCustodians(paths []string, threshold int) custodianSet {
+    if threshold < 1 || threshold > len(paths) {
+        log.Fatal().
+            Int("threshold", threshold).
+            Int("custodians", len(paths)).
+            Msg("Threshold must be between 1 and the number of custodians")
+    }
+
+    set := custodianSet{threshold: threshold}
+    for _, path := range paths {
+        pub, err := os.ReadFile(path)
+        if err != nil {
+            log.Fatal().Err(err).Str("path", path).Msg("Failed to read custodian key")
+        }
+        if !crypto.IsKEMPublicKey(pub) {
+            log.Fatal().Str("path", path).Msg("Custodian key is not an ML-KEM-768 public key")
+        }
+        log.Info().
+            Str("custodian", hex.EncodeToString(crypto.KEMKeyID(pub))).
+            Msg("Custodian added")
+        set.keys = append(set.keys, pub)
+    }
+    return set
+}
+
+// openEnvelope retrieves the document at cid and reads its envelope header
+func openEnvelope(store storage.DocumentStore, cid string) (*storage.EnvelopeHeader, io.Reader, io.Closer) {
+    reader, err := store.Get(context.Background(), cid)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to retrieve document from IPFS")
+    }
+    header, envelope, err := storage.ReadEnvelopeHeader(reader)
+    if err != nil {
+        reader.Close()
+        log.Fatal().Err(err).Msg("Failed to read document envelope")
+    }
+    if header.KEM != storage.KEMThreshold {
+        reader.Close()
+        log.Fatal().Msg("Document key is not split among custodians")
+    }
+    return header, envelope, reader
+}
+
+func submitShare(cid, privateKeyPath, combinerKeyPath, outputPath, storeURL string) {
+    log.Info().
+        Str("cid", cid).
+        Msg("Unwrapping custodian share...")
+
+    store, err := storage.Open(storeURL)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to open document store")
+    }
+    header, _, closer := openEnvelope(store, cid)
+    closer.Close()
+
+    var combinerKey []byte
+    if combinerKeyPath != "" {
+        combinerKey, err = os.ReadFile(combinerKeyPath)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to read combiner public key")
+        }
+    }
+
+    privKey, err := crypto.ReadSecretFile(privateKeyPath)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to read private key file")
+    }
+    var share *storage.CustodianShare
+    err = privKey.Use(func(key []byte) error {
+        share, err = header.UnwrapShare(key, combinerKey)
+        return err
+    })
+    privKey.Destroy()
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to unwrap custodian share")
+    }
+
+    data, err := json.MarshalIndent(share, "", "  ")
+    crypto.Wipe(share.Share)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to encode share")
+    }
+    err = os.WriteFile(outputPath, data, 0600)
+    crypto.Wipe(data)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to write share file")
+    }
+
+    if share.SealedTo == "" {
+        log.Warn().Msg("Share written in the clear; pass --to to seal it to the combiner's key")
+    }
+    log.Info().
+        Str("custodian", share.CustodianKeyID).
+        Str("sealedTo", share.SealedTo).
+        Int("threshold", share.Threshold).
+        Msg("Custodian share written")
+
+    fmt.Println("\nCustodian Share:")
+    fmt.Printf("Document Hash: %s\n", share.DocumentHash)
+    fmt.Printf("Custodian Key ID: %s\n", share.CustodianKeyID)
+    fmt.Printf("Shares Needed: %d\n", share.Threshold)
+    fmt.Printf("Share File: %s\n", outputPath)
+}
+
+func combineShares(cid string, sharePaths []string, privateKeyPath, outputPath, storeURL string) {
+    log.Info().
+        Str("cid", cid).
+        Int("shares", len(sharePaths)).
+        Msg("Combining custodian shares...")
+
+    var shares []*storage.CustodianShare
+    for _, path := range sharePaths {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            log.Fatal().Err(err).Str("path", path).Msg("Failed to read share file")
+        }
+        share := &storage.CustodianShare{}
+        err = json.Unmarshal(data, share)
+        crypto.Wipe(data)
+        if err != nil {
+            log.Fatal().Err(err).Str("path", path).Msg("Failed to decode share file")
+        }
+        shares = append(shares, share)
+    }
+
+    var privKey *crypto.Secret
+    if privateKeyPath != "" {
+        var err error
+        privKey, err = crypto.ReadSecretFile(privateKeyPath)
+        if err != nil {
+            log.Fatal().Err(err).Msg("Failed to read private key file")
+        }
+    }
+
+    store, err := storage.Open(storeURL)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to open document store")
+    }
+    header, envelope, closer := openEnvelope(store, cid)
+    defer closer.Close()
+
+    // Custodian-sealed shares are unwrapped with the combiner's key, if one is given
+    var contentKey []byte
+    if privKey != nil {
+        err = privKey.Use(func(key []byte) error {
+            contentKey, err = storage.CombineShares(header, shares, key)
+            return err
+        })
+    } else {
+        contentKey, err = storage.CombineShares(header, shares, nil)
+    }
+    privKey.Destroy()
+    for _, share := range shares {
+        crypto.Wipe(share.Share)
+    }
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to combine custodian shares")
+    }
+
+    content, _, err := storage.NewDecryptReader(envelope, contentKey)
+    crypto.Wipe(contentKey)
+    if err != nil {
+        log.Fatal().Err(err).Msg("Failed to decrypt document - shares do not belong to this document")
+    }
+
+    if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+        log.Fatal().Err(err).Msg("Failed to create output directory")
+    }
+    hasher := storage.NewDocumentHasher()
+    writeOutput(outputPath, content, hasher)
+    hash := hex.EncodeToString(hasher.Sum(nil))
+
+    log.Info().
+        Str("fileName", header.FileName).
+        Str("output", outputPath).
+        Msg("Document decrypted from custodian shares")
+
+    fmt.Println("\nDocument Retrieval:")
+    fmt.Printf("IPFS CID: %s\n", cid)
+    fmt.Printf("Document Hash: %s\n", hash)
+    fmt.Printf("Custodian Shares: %d of %d needed\n", len(shares), header.Threshold)
+    fmt.Printf("Output File: %s\n", outputPath)
+}
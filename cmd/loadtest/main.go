@@ -1,6 +1,8 @@
 package main
 
 import (
+    "bytes"
+    "context"
     "crypto/rand"
     "flag"
     "fmt"
@@ -25,6 +27,7 @@ func main() {
     totalUploads := flag.Int("total", 100, "Total number of documents to upload")
     documentSize := flag.Int("size", 10, "Size of test documents in KB")
     ipfsGateway := flag.String("ipfs", "localhost:5001", "IPFS API gateway")
+    storeURL := flag.String("store", "", storage.StoreFlagUsage)
     signDocuments := flag.Bool("sign", true, "Sign documents with Dilithium (slower but realistic)")
     flag.Parse()
 
@@ -33,28 +36,26 @@ func main() {
         Int("totalUploads", *totalUploads).
         Int("documentSizeKB", *documentSize).
         Bool("signDocuments", *signDocuments).
-        Str("ipfsGateway", *ipfsGateway).
+        Str("store", storage.StoreURL(*storeURL, *ipfsGateway)).
         Msg("Starting load test")
 
-    // Create IPFS client
-    ipfs, err := storage.NewIPFSClient(*ipfsGateway)
+    // Open the document store
+    store, err := storage.Open(storage.StoreURL(*storeURL, *ipfsGateway))
     if err != nil {
-        log.Fatal().Err(err).Msg("Failed to create IPFS client")
+        log.Fatal().Err(err).Msg("Failed to open document store")
     }
 
     // Generate a Dilithium keypair if signing is enabled
-    var (
-        signer  *crypto.DilithiumSigner
-        privKey []byte
-    )
+    var signer *crypto.DilithiumSigner
     
     if *signDocuments {
+        // The signer keeps its own locked copy of the private key for the whole run
         signer = crypto.NewDilithiumSigner()
+        defer signer.Close()
         pubKey, privateKey, err := signer.GenerateKeypair()
         if err != nil {
             log.Fatal().Err(err).Msg("Failed to generate Dilithium keypair")
         }
-        privKey = privateKey
         
         // Save keys to temporary directory for reference
         tempDir := os.TempDir()
@@ -70,6 +71,7 @@ func main() {
                 Str("privateKey", privKeyPath).
                 Msg("Dilithium keys saved")
         }
+        crypto.Wipe(privateKey)
     }
 
     // Initialize counters and metrics
@@ -138,8 +140,8 @@ func main() {
                     return
                 }
                 
-                // Sign the document (don't store signature in a variable since we're not using it)
-                _, err = signer.SignDocument(tempFilePath, privKey)
+                // Sign the document with the signer's loaded key (don't store signature in a variable since we're not using it)
+                _, err = signer.SignDocument(tempFilePath, nil)
                 if err != nil {
                     log.Error().Err(err).Int("uploadNum", uploadNum).Msg("Failed to sign document")
                     mutex.Lock()
@@ -153,7 +155,7 @@ func main() {
             
             // Upload to IPFS
             ipfsStart := time.Now()
-            cid, err := ipfs.Store(docContent)
+            cid, err := store.Put(context.Background(), bytes.NewReader(docContent), storage.StoreOptions{Size: int64(len(docContent))})
             ipfsTime := time.Since(ipfsStart)
             
             // Calculate total upload time
@@ -0,0 +1,97 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+
+    "quantum-doc-verify/pkg/storage"
+)
+
+var (
+    // errNoGrant is returned when no access grant is published for a recipient
+    errNoGrant = errors.New("no access grant for this recipient")
+
+    // errForeignGrant is returned for a grant signed by anyone but the document's signer
+    errForeignGrant = errors.New("access grant was not signed by the document's signer")
+)
+
+// honouredGrant returns the access grant published for recipient (a hex ML-KEM key ID)
+// to read the document at cid, with the CID of the grant. Grants withdrawn by a
+// revocation marker are refused with storage.ErrGrantRevoked, and grants of a bundle
+// signed by anyone but the signer named in its manifest with errForeignGrant.
+func honouredGrant(ctx context.Context, cid, recipient string) (*storage.AccessGrant, string, error) {
+    if registry == nil {
+        return nil, "", errors.New("document registry unavailable")
+    }
+    record, exists, err := registry.GetGrant(cid, recipient)
+    if err != nil {
+        return nil, "", err
+    }
+    if !exists || record.GrantCID == "" {
+        return nil, "", errNoGrant
+    }
+
+    grant, err := storage.GetAccessGrant(ctx, docStore, record.GrantCID)
+    if err != nil {
+        return nil, "", err
+    }
+    if grant.DocumentCID != cid || grant.RecipientKeyID != recipient {
+        return nil, "", errNoGrant
+    }
+    if !record.Honours(grant.Created) {
+        return nil, "", storage.ErrGrantRevoked
+    }
+
+    // Documents stored without a bundle record no signer to check the grant against
+    bundle, err := storage.OpenBundle(ctx, docStore, cid)
+    switch {
+    case errors.Is(err, storage.ErrNotBundle):
+    case err != nil:
+        return nil, "", err
+    default:
+        manifest, err := bundle.Manifest(ctx)
+        if err != nil {
+            return nil, "", err
+        }
+        if grant.SignerKeyID != manifest.SignerKeyID {
+            return nil, "", errForeignGrant
+        }
+    }
+    return grant, record.GrantCID, nil
+}
+
+// grantStatus maps an honouredGrant error to an HTTP status
+func grantStatus(err error) int {
+    switch {
+    case errors.Is(err, errNoGrant), errors.Is(err, storage.ErrNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, storage.ErrGrantRevoked), errors.Is(err, errForeignGrant):
+        return http.StatusForbidden
+    default:
+        return http.StatusBadGateway
+    }
+}
+
+// handleGrantLookup serves the access grant of a recipient, so that clients holding a
+// key the document was not encrypted to can decrypt it
+func handleGrantLookup(w http.ResponseWriter, r *http.Request) {
+    cid := r.URL.Query().Get("cid")
+    recipient := r.URL.Query().Get("recipient")
+    if cid == "" || recipient == "" {
+        http.Error(w, "cid and recipient parameters are required", http.StatusBadRequest)
+        return
+    }
+
+    grant, grantCID, err := honouredGrant(r.Context(), cid, recipient)
+    if err != nil {
+        loggerInstance.Warn("Access grant refused", "cid", cid, "recipient", recipient, "error", err)
+        http.Error(w, err.Error(), grantStatus(err))
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("X-Access-Grant", grantCID)
+    json.NewEncoder(w).Encode(grant)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "os"
+    "testing"
+    "time"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/crypto"
+    "quantum-doc-verify/pkg/storage"
+)
+
+func TestHonouredGrant(t *testing.T) {
+    ctx := context.Background()
+    useGrantRegistry(t)
+
+    ownerPub, ownerPriv, _ := crypto.GenerateKEMKeypair()
+    auditorPub, _, _ := crypto.GenerateKEMKeypair()
+    envelope, err := storage.SealEnvelope([]byte("Quarterly audit report, draft 3"), storage.EnvelopeOptions{Recipients: [][]byte{ownerPub}})
+    if err != nil {
+        t.Fatalf("Failed to seal envelope: %v", err)
+    }
+    header, _, err := storage.ReadEnvelopeHeader(bytes.NewReader(envelope))
+    if err != nil {
+        t.Fatalf("Failed to read envelope header: %v", err)
+    }
+
+    owner := newSigner(t)
+    other := newSigner(t)
+    ownerPublic, _ := owner.ExportPublicKey()
+
+    // A bundle names its signer in the manifest; a plain envelope names none
+    manifest, _ := json.Marshal(storage.Manifest{Version: storage.ManifestVersion, SignerKeyID: crypto.DilithiumKeyID(ownerPublic), Encrypted: true})
+    bundleCID, err := storage.PutBundle(ctx, docStore, []storage.BundleFile{
+        {Name: storage.BundlePayloadFile, Content: bytes.NewReader(envelope), Size: int64(len(envelope))},
+        {Name: storage.BundleManifestFile, Content: bytes.NewReader(manifest)},
+    })
+    if err != nil {
+        t.Fatalf("PutBundle failed: %v", err)
+    }
+    plainCID, err := docStore.Put(ctx, bytes.NewReader(envelope), storage.StoreOptions{Size: int64(len(envelope))})
+    if err != nil {
+        t.Fatalf("Failed to store envelope: %v", err)
+    }
+
+    newGrant := func(documentCID string, signer *crypto.DilithiumSigner) (*storage.AccessGrant, string) {
+        grant, err := storage.NewAccessGrant(header, documentCID, ownerPriv, auditorPub)
+        if err != nil {
+            t.Fatalf("NewAccessGrant failed: %v", err)
+        }
+        if err := grant.Sign(signer); err != nil {
+            t.Fatalf("Failed to sign grant: %v", err)
+        }
+        grantCID, err := storage.PutAccessGrant(ctx, docStore, grant)
+        if err != nil {
+            t.Fatalf("PutAccessGrant failed: %v", err)
+        }
+        return grant, grantCID
+    }
+    grant, grantCID := newGrant(bundleCID, owner)
+    _, foreignCID := newGrant(bundleCID, other)
+    plainGrant, plainGrantCID := newGrant(plainCID, owner)
+    recipient := grant.RecipientKeyID
+    before := grant.Created.Add(-time.Minute)
+    after := grant.Created.Add(time.Minute)
+
+    for _, tc := range []struct {
+        name      string
+        cid       string
+        record    blockchain.GrantRecord
+        wantGrant string
+        wantErr   error
+        status    int
+    }{
+        {
+            name:    "no grant published",
+            cid:     "bafy-unregistered",
+            wantErr: errNoGrant,
+            status:  http.StatusNotFound,
+        },
+        {
+            name:      "published",
+            cid:       bundleCID,
+            record:    blockchain.GrantRecord{GrantCID: grantCID, GrantedAt: grant.Created},
+            wantGrant: grantCID,
+        },
+        {
+            name:    "revoked after the grant was created",
+            cid:     bundleCID,
+            record:  blockchain.GrantRecord{GrantCID: grantCID, GrantedAt: grant.Created, RevokedAt: &after},
+            wantErr: storage.ErrGrantRevoked,
+            status:  http.StatusForbidden,
+        },
+        {
+            name:    "revoked when the grant was created",
+            cid:     bundleCID,
+            record:  blockchain.GrantRecord{GrantCID: grantCID, GrantedAt: grant.Created, RevokedAt: &grant.Created},
+            wantErr: storage.ErrGrantRevoked,
+            status:  http.StatusForbidden,
+        },
+        {
+            name:      "created after the revocation",
+            cid:       bundleCID,
+            record:    blockchain.GrantRecord{GrantCID: grantCID, GrantedAt: grant.Created, RevokedAt: &before},
+            wantGrant: grantCID,
+        },
+        {
+            name:    "signed by another key",
+            cid:     bundleCID,
+            record:  blockchain.GrantRecord{GrantCID: foreignCID, GrantedAt: grant.Created},
+            wantErr: errForeignGrant,
+            status:  http.StatusForbidden,
+        },
+        {
+            name:      "document without a bundle",
+            cid:       plainCID,
+            record:    blockchain.GrantRecord{GrantCID: plainGrantCID, GrantedAt: plainGrant.Created},
+            wantGrant: plainGrantCID,
+        },
+        {
+            name:    "grant of another document",
+            cid:     plainCID,
+            record:  blockchain.GrantRecord{GrantCID: grantCID, GrantedAt: grant.Created},
+            wantErr: errNoGrant,
+            status:  http.StatusNotFound,
+        },
+        {
+            name:    "grant missing from the store",
+            cid:     bundleCID,
+            record:  blockchain.GrantRecord{GrantCID: "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e", GrantedAt: grant.Created},
+            wantErr: storage.ErrNotFound,
+            status:  http.StatusNotFound,
+        },
+    } {
+        if tc.record.GrantCID != "" {
+            tc.record.CID = tc.cid
+            tc.record.RecipientKeyID = recipient
+            writeGrantRegistry(t, tc.record)
+        }
+
+        got, gotCID, err := honouredGrant(ctx, tc.cid, recipient)
+        if tc.wantErr != nil {
+            if !errors.Is(err, tc.wantErr) {
+                t.Errorf("%s: expected %v, got %v", tc.name, tc.wantErr, err)
+            } else if status := grantStatus(err); status != tc.status {
+                t.Errorf("%s: expected status %d, got %d", tc.name, tc.status, status)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: honouredGrant failed: %v", tc.name, err)
+            continue
+        }
+        if gotCID != tc.wantGrant || got.DocumentCID != tc.cid || got.RecipientKeyID != recipient {
+            t.Errorf("%s: expected grant %s of %s, got %s of %s", tc.name, tc.wantGrant, tc.cid, gotCID, got.DocumentCID)
+        }
+    }
+
+    // Errors reading the registry or the store are the gateway's, not the client's
+    registry = nil
+    if _, _, err := honouredGrant(ctx, bundleCID, recipient); err == nil || grantStatus(err) != http.StatusBadGateway {
+        t.Fatalf("Expected an unavailable registry to give %d, got %v", http.StatusBadGateway, err)
+    }
+}
+
+// useGrantRegistry points the server at an empty file store and a registry whose grant
+// file lives in a directory of the test's own
+func useGrantRegistry(t *testing.T) {
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    dir := t.TempDir()
+    if err := os.Chdir(dir); err != nil {
+        t.Fatal(err)
+    }
+    store, err := storage.NewFileStore(t.TempDir())
+    if err != nil {
+        t.Fatalf("Failed to create file store: %v", err)
+    }
+
+    savedStore, savedRegistry := docStore, registry
+    docStore, registry = store, &blockchain.BlockchainClient{}
+    t.Cleanup(func() {
+        docStore, registry = savedStore, savedRegistry
+        os.Chdir(wd)
+    })
+}
+
+// writeGrantRegistry records a grant the way the registry client persists it
+func writeGrantRegistry(t *testing.T, record blockchain.GrantRecord) {
+    data, err := json.Marshal(map[string]blockchain.GrantRecord{record.CID + "/" + record.RecipientKeyID: record})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile("grant_registry.json", data, 0644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func newSigner(t *testing.T) *crypto.DilithiumSigner {
+    signer := crypto.NewDilithiumSigner()
+    t.Cleanup(func() { signer.Close() })
+    if _, _, err := signer.GenerateKeypair(); err != nil {
+        t.Fatalf("Failed to generate Dilithium keypair: %v", err)
+    }
+    return signer
+}
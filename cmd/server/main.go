@@ -1,7 +1,10 @@
 package main
 
 import (
+    "bytes"
+    "context"
     "encoding/json"
+    "errors"
     "flag"
     "fmt"
     "io"
@@ -15,21 +18,34 @@ import (
     "github.com/rs/cors"
     "golang.org/x/crypto/sha3"
     "encoding/hex"
-    "crypto/sha256"
 
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/crypto"
     "quantum-doc-verify/pkg/logger"
+    "quantum-doc-verify/pkg/storage"
+    "quantum-doc-verify/pkg/unixfs"
 )
 
 var (
     port           int
     ipfsNodeAddr   string
+    storeURL       string
     contractAddr   string
+    nodeURL        string
     privateKeyPath string
     publicKeyPath  string
     uploadDir      string
     infuraEndpoint string
+    cacheDir       string
+    cacheSizeMB    int64
+    cacheTTL       time.Duration
+    checkInterval  time.Duration
+    monitorRepair  bool
+    alertWebhook   string
     loggerInstance *logger.Logger
     documentStore  = make(map[string]DocumentData)
+    docStore       storage.DocumentStore
+    registry       *blockchain.BlockchainClient
 )
 
 // Document data structure
@@ -48,11 +64,19 @@ type DocumentData struct {
 func init() {
     flag.IntVar(&port, "port", 8080, "Port to run the server on")
     flag.StringVar(&ipfsNodeAddr, "ipfs", "localhost:5001", "IPFS node address")
+    flag.StringVar(&storeURL, "store", "", storage.StoreFlagUsage)
     flag.StringVar(&contractAddr, "contract", "", "Document registry smart contract address")
+    flag.StringVar(&nodeURL, "node", "http://localhost:8545", "Ethereum node URL of the document registry")
     flag.StringVar(&privateKeyPath, "private-key", "./keys/dilithium_private.key", "Path to Dilithium private key")
     flag.StringVar(&publicKeyPath, "public-key", "./keys/dilithium_public.key", "Path to Dilithium public key")
     flag.StringVar(&uploadDir, "upload-dir", "./uploads", "Directory for temporary document uploads")
     flag.StringVar(&infuraEndpoint, "infura", "", "Infura endpoint for blockchain connection")
+    flag.StringVar(&cacheDir, "cache-dir", storage.DefaultCacheDir(), storage.CacheFlagUsage)
+    flag.Int64Var(&cacheSizeMB, "cache-size", storage.DefaultCacheSize>>20, "Maximum size of the document cache in MiB")
+    flag.DurationVar(&cacheTTL, "cache-ttl", storage.DefaultCacheTTL, "Drop cached documents not read for this long")
+    flag.DurationVar(&checkInterval, "monitor-interval", 0, "Check that every registered document is available and intact at this interval (0 disables the monitor)")
+    flag.BoolVar(&monitorRepair, "monitor-repair", true, "Restore lost or corrupt copies found by the availability monitor from healthy nodes")
+    flag.StringVar(&alertWebhook, "alert-webhook", "", "URL to POST a JSON alert to when a document goes missing, stops matching the registry or recovers")
 }
 
 func main() {
@@ -67,16 +91,59 @@ func main() {
         loggerInstance.Fatal("Failed to create upload directory", "error", err)
     }
 
+    // Open the document store backend
+    backend, err := storage.Open(storage.StoreURL(storeURL, ipfsNodeAddr))
+    if err != nil {
+        loggerInstance.Fatal("Failed to open document store", "error", err)
+    }
+    if replicated, ok := backend.(*storage.ReplicatedStore); ok {
+        // Re-probe failing replicas in the background so reads and writes skip them
+        replicated.StartProbing(context.Background(), storage.DefaultProbeInterval)
+    }
+
+    // Serve repeated retrievals from the document cache shared with the CLIs
+    var cache *storage.Cache
+    if cacheDir != "" {
+        cache, err = storage.OpenCache(storage.CacheOptions{Dir: cacheDir, MaxSize: cacheSizeMB << 20, TTL: cacheTTL})
+        if err != nil {
+            loggerInstance.Warn("Document cache unavailable, retrieving without it", "error", err)
+        }
+    }
+    docStore = storage.WithCache(backend, cache)
+
+    // Access grants and their revocation markers are read from the document registry
+    registry, err = blockchain.NewBlockchainClient(nodeURL, contractAddr)
+    if err != nil {
+        loggerInstance.Warn("Document registry unavailable, access grants will be refused", "error", err)
+    }
+
+    // Re-check the registered documents on every node in the background
+    if checkInterval > 0 {
+        startMonitor(backend)
+    }
+
     // Create router
     router := mux.NewRouter()
 
     // Health check endpoint
     router.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
-        json.NewEncoder(w).Encode(map[string]string{
+        health := map[string]interface{}{
             "status":    "ok",
             "timestamp": time.Now().Format(time.RFC3339),
-        })
+        }
+        if replicated, ok := backend.(*storage.ReplicatedStore); ok {
+            health["replicas"] = replicated.Health()
+        }
+        if erasure, ok := backend.(*storage.ErasureStore); ok {
+            health["shardNodes"] = erasure.Health()
+        }
+        if cache != nil {
+            if stats, err := cache.Stats(); err == nil {
+                health["cache"] = stats
+            }
+        }
+        json.NewEncoder(w).Encode(health)
     }).Methods("GET")
 
     // Document upload and sign endpoint
@@ -94,6 +161,16 @@ func main() {
         handleDocumentRetrieve(w, r)
     }).Methods("GET")
 
+    // Access grant lookup endpoint
+    router.HandleFunc("/api/documents/grants", func(w http.ResponseWriter, r *http.Request) {
+        handleGrantLookup(w, r)
+    }).Methods("GET")
+
+    // Availability report endpoint
+    router.HandleFunc("/api/monitor", func(w http.ResponseWriter, r *http.Request) {
+        handleMonitorReport(w, r)
+    }).Methods("GET")
+
     // Create a CORS middleware
     corsMiddleware := cors.New(cors.Options{
         AllowedOrigins:   []string{"*"}, // For development - restrict in production
@@ -151,11 +228,16 @@ func handleDocumentUpload(w http.ResponseWriter, r *http.Request) {
     // Get document hash - simulate using the binary
     documentHash := simulateHashDocument(tempFilePath)
 
-    // Sign the document - simulate using the binary
-    signature := simulateSignDocument(tempFilePath)
+    // Sign the document with the Dilithium key (loaded for this request only)
+    signature := signDocument(tempFilePath)
 
-    // Upload to IPFS - simulate using the binary
-    cid := simulateIPFSUpload(tempFilePath)
+    // Upload to the document store; nothing is registered unless it was stored
+    cid, err := storeDocument(r.Context(), fileContent)
+    if err != nil {
+        loggerInstance.Error("Failed to store document", "hash", documentHash, "error", err)
+        http.Error(w, "Failed to store document", storeStatus(err))
+        return
+    }
 
     // Register on blockchain - simulate using the binary
     txHash := simulateBlockchainRegistration(documentHash, cid, signature)
@@ -242,20 +324,32 @@ func handleDocumentRetrieve(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Look up document by CID
+    // A caller reading through an access grant is refused once it has been revoked. This
+    // check is advisory: the envelope is served to anyone with its CID, as IPFS would
+    // serve it, so callers that leave out recipient are not checked. Revocation is
+    // enforced where it matters, by refusing the grant itself (handleGrantLookup),
+    // without which the recipient's key cannot open the envelope.
+    if recipient := r.URL.Query().Get("recipient"); recipient != "" {
+        _, grantCID, err := honouredGrant(r.Context(), cid, recipient)
+        if err != nil {
+            loggerInstance.Warn("Access grant refused", "cid", cid, "recipient", recipient, "error", err)
+            http.Error(w, err.Error(), grantStatus(err))
+            return
+        }
+        w.Header().Set("X-Access-Grant", grantCID)
+    }
+
+    // Look up document by CID, then fall back to the document store. Content is only
+    // ever served once it has been verified against the CID.
     docData, exists := documentStore[cid]
     if !exists {
-        // If the document doesn't exist in our store, create a dummy document
-        loggerInstance.Warn("Document not found in store, creating dummy document",
-            "cid", cid, "hash", hash)
-
-        // Create a dummy PDF file
-        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", hash+".pdf"))
-        w.Header().Set("Content-Type", "application/pdf")
-
-        dummyPDF := []byte("%PDF-1.4\n1 0 obj\n<</Type /Catalog /Pages 2 0 R>>\nendobj\n2 0 obj\n<</Type /Pages /Kids [3 0 R] /Count 1>>\nendobj\n3 0 obj\n<</Type /Page /Parent 2 0 R /Resources 4 0 R /MediaBox [0 0 612 792] /Contents 5 0 R>>\nendobj\n4 0 obj\n<</Font <</F1 6 0 R>>>>\nendobj\n5 0 obj\n<</Length 44>>\nstream\nBT /F1 24 Tf 100 700 Td (Quantum-Doc-Verify: " + hash + ") Tj ET\nendstream\nendobj\n6 0 obj\n<</Type /Font /Subtype /Type1 /BaseFont /Helvetica>>\nendobj\nxref\n0 7\n0000000000 65535 f\n0000000009 00000 n\n0000000056 00000 n\n0000000111 00000 n\n0000000212 00000 n\n0000000250 00000 n\n0000000344 00000 n\ntrailer\n<</Size 7 /Root 1 0 R>>\nstartxref\n406\n%%EOF")
-        w.Write(dummyPDF)
-        return
+        content, err := retrieveDocument(r.Context(), cid)
+        if err != nil {
+            loggerInstance.Error("Failed to retrieve document", "cid", cid, "hash", hash, "error", err)
+            http.Error(w, retrieveError(err), storeStatus(err))
+            return
+        }
+        docData = DocumentData{CID: cid, FileName: cid, Content: content}
     }
 
     // Set response headers based on actual document data
@@ -294,19 +388,77 @@ func simulateHashDocument(filePath string) string {
     return "0x" + hex.EncodeToString(hash[:])
 }
 
+// signDocument signs a document with the key at privateKeyPath. The key is read into
+// locked memory for this request only and wiped before returning, so private key
+// material is never reachable from server globals.
+func signDocument(filePath string) string {
+    signer := crypto.NewDilithiumSigner()
+    defer signer.Close()
+
+    if err := signer.LoadPrivateKeyFile(privateKeyPath); err != nil {
+        loggerInstance.Warn("Dilithium private key unavailable, using simulated signature", "error", err)
+        return simulateSignDocument(filePath)
+    }
+
+    signature, err := signer.SignDocument(filePath, nil)
+    if err != nil {
+        loggerInstance.Warn("Failed to sign document, using simulated signature", "error", err)
+        return simulateSignDocument(filePath)
+    }
+
+    return hex.EncodeToString(signature)
+}
+
 func simulateSignDocument(filePath string) string {
     return "dilithium-" + fmt.Sprintf("%x", time.Now().UnixNano())
 }
 
-func simulateIPFSUpload(filePath string) string {
-    content, err := os.ReadFile(filePath)
+// storeDocument uploads the document to the configured store and returns its CID
+func storeDocument(ctx context.Context, content []byte) (string, error) {
+    return docStore.Put(ctx, bytes.NewReader(content), storage.StoreOptions{Size: int64(len(content))})
+}
+
+// storeStatus returns the HTTP status reporting a document store failure
+func storeStatus(err error) int {
+    switch {
+    case errors.Is(err, unixfs.ErrCIDMismatch):
+        return http.StatusBadGateway
+    case errors.Is(err, storage.ErrNotFound):
+        return http.StatusNotFound
+    case errors.Is(err, storage.ErrTimeout):
+        return http.StatusGatewayTimeout
+    case errors.Is(err, storage.ErrUnavailable):
+        return http.StatusServiceUnavailable
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+// retrieveError describes a failed retrieval to the client
+func retrieveError(err error) string {
+    switch {
+    case errors.Is(err, unixfs.ErrCIDMismatch):
+        return "Document does not match its CID"
+    case errors.Is(err, storage.ErrNotFound):
+        return "Document not found"
+    case errors.Is(err, storage.ErrTimeout):
+        return "Document store timed out"
+    case errors.Is(err, storage.ErrUnavailable):
+        return "Document store unavailable"
+    default:
+        return "Failed to retrieve document"
+    }
+}
+
+// retrieveDocument reads a document from the configured store
+func retrieveDocument(ctx context.Context, cid string) ([]byte, error) {
+    reader, err := docStore.Get(ctx, cid)
     if err != nil {
-        return "Qm" + hex.EncodeToString([]byte(filePath))[:32]
+        return nil, err
     }
-    
-    // Create a deterministic CID based on content
-    hash := sha256.Sum256(content)
-    return "Qm" + hex.EncodeToString(hash[:])[:32]
+    defer reader.Close()
+
+    return io.ReadAll(reader)
 }
 
 func simulateBlockchainRegistration(hash, cid, signature string) string {
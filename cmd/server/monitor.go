@@ -0,0 +1,74 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+
+    "quantum-doc-verify/pkg/monitor"
+    "quantum-doc-verify/pkg/storage"
+)
+
+// availability re-checks the registered documents in the background when
+// --monitor-interval is set
+var availability *monitor.Monitor
+
+// startMonitor checks every registered document on each node of backend periodically,
+// restoring lost copies and alerting on documents that go missing
+func startMonitor(backend storage.DocumentStore) {
+    if registry == nil {
+        loggerInstance.Warn("Document registry unavailable, availability monitor disabled")
+        return
+    }
+
+    opts := monitor.Options{
+        Nodes:  monitor.Nodes(backend, storage.StoreURL(storeURL, ipfsNodeAddr)),
+        Repair: monitorRepair,
+    }
+    if alertWebhook != "" {
+        opts.Alert = monitor.Webhook(alertWebhook)
+    }
+    m, err := monitor.New(registry, opts)
+    if err != nil {
+        loggerInstance.Warn("Availability monitor disabled", "error", err)
+        return
+    }
+    availability = m
+
+    loggerInstance.Info("Availability monitor started", "interval", checkInterval, "nodes", len(opts.Nodes))
+    go m.Run(context.Background(), checkInterval, func(report *monitor.Report, err error) {
+        if err != nil {
+            loggerInstance.Error("Availability check failed", "error", err)
+            return
+        }
+        for _, alert := range report.Alerts {
+            loggerInstance.Warn("Document availability changed", "hash", alert.Hash, "cid", alert.CID, "status", alert.Status, "message", alert.Message)
+        }
+        for _, alertErr := range report.AlertErrors {
+            loggerInstance.Warn("Failed to deliver alert", "error", alertErr)
+        }
+        loggerInstance.Info("Availability check complete",
+            "checked", report.Checked,
+            "healthy", report.Healthy,
+            "repaired", report.Repaired,
+            "degraded", report.Degraded,
+            "missing", report.Missing,
+            "mismatched", report.Mismatched)
+    })
+}
+
+// handleMonitorReport serves the report of the latest availability check
+func handleMonitorReport(w http.ResponseWriter, r *http.Request) {
+    if availability == nil {
+        http.Error(w, "availability monitor is not running", http.StatusServiceUnavailable)
+        return
+    }
+    report := availability.Report()
+    if report == nil {
+        http.Error(w, "first availability check has not completed", http.StatusServiceUnavailable)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+}
@@ -11,15 +11,41 @@ contract DocumentRegistry {
         bool exists;
     }
     
+    struct Grant {
+        string grantCID;
+        uint256 grantedAt;
+        uint256 revokedAt;
+    }
+    
     // Document hash => Document details
     mapping(string => Document) public documents;
     
+    // Document hash => IPNS name pointing to the latest version
+    mapping(string => string) public ipnsNames;
+    
+    // Document hash => retention class the document was stored under
+    mapping(string => string) public retentionClasses;
+    
+    // Document hash => whether its content was released after its retention period
+    mapping(string => bool) public released;
+    
+    // IPFS CID => hash of the document registered with it
+    mapping(string => string) public cidDocuments;
+    
+    // IPFS CID => recipient key ID => access grant and revocation marker
+    mapping(string => mapping(string => Grant)) public grants;
+    
     // Owner address => List of document hashes
     mapping(address => string[]) public ownerDocuments;
     
     // Events
     event DocumentRegistered(string documentHash, string ipfsCID, address owner);
     event DocumentVerified(string documentHash, address verifier, bool verified);
+    event IPNSNameLinked(string documentHash, string ipnsName);
+    event RetentionSet(string documentHash, string retentionClass);
+    event DocumentReleased(string documentHash, uint256 timestamp);
+    event GrantPublished(string documentCID, string recipientKeyID, string grantCID);
+    event GrantRevoked(string documentCID, string recipientKeyID, uint256 timestamp);
     
     // Register a document
     function registerDocument(string memory documentHash, string memory ipfsCID) public {
@@ -33,11 +59,67 @@ contract DocumentRegistry {
             exists: true
         });
         
+        cidDocuments[ipfsCID] = documentHash;
         ownerDocuments[msg.sender].push(documentHash);
         
         emit DocumentRegistered(documentHash, ipfsCID, msg.sender);
     }
     
+    // Link a document to the IPNS name of its latest version
+    function setIPNSName(string memory documentHash, string memory ipnsName) public {
+        require(documents[documentHash].exists, "Document does not exist");
+        require(documents[documentHash].owner == msg.sender, "Only the owner can link a name");
+        
+        ipnsNames[documentHash] = ipnsName;
+        
+        emit IPNSNameLinked(documentHash, ipnsName);
+    }
+    
+    // Record the retention class of a document
+    function setRetention(string memory documentHash, string memory retentionClass) public {
+        require(documents[documentHash].exists, "Document does not exist");
+        require(documents[documentHash].owner == msg.sender, "Only the owner can set retention");
+        
+        retentionClasses[documentHash] = retentionClass;
+        
+        emit RetentionSet(documentHash, retentionClass);
+    }
+    
+    // Record that the content of a document was unpinned after its retention period
+    function releaseDocument(string memory documentHash) public {
+        require(documents[documentHash].exists, "Document does not exist");
+        require(documents[documentHash].owner == msg.sender, "Only the owner can release a document");
+        require(!released[documentHash], "Document already released");
+        
+        released[documentHash] = true;
+        
+        emit DocumentReleased(documentHash, block.timestamp);
+    }
+    
+    // Link the access grant of a recipient to a document
+    function publishGrant(string memory documentCID, string memory recipientKeyID, string memory grantCID) public {
+        string memory documentHash = cidDocuments[documentCID];
+        require(documents[documentHash].exists, "Document does not exist");
+        require(documents[documentHash].owner == msg.sender, "Only the owner can publish a grant");
+        require(grants[documentCID][recipientKeyID].revokedAt < block.timestamp, "Access was revoked after this grant was created");
+        
+        grants[documentCID][recipientKeyID].grantCID = grantCID;
+        grants[documentCID][recipientKeyID].grantedAt = block.timestamp;
+        
+        emit GrantPublished(documentCID, recipientKeyID, grantCID);
+    }
+    
+    // Record a revocation marker: grants created up to now are no longer honoured
+    function revokeGrant(string memory documentCID, string memory recipientKeyID) public {
+        string memory documentHash = cidDocuments[documentCID];
+        require(documents[documentHash].exists, "Document does not exist");
+        require(documents[documentHash].owner == msg.sender, "Only the owner can revoke a grant");
+        
+        grants[documentCID][recipientKeyID].revokedAt = block.timestamp;
+        
+        emit GrantRevoked(documentCID, recipientKeyID, block.timestamp);
+    }
+    
     // Verify document ownership
     function verifyDocumentOwnership(string memory documentHash, address claimedOwner) public view returns (bool) {
         return documents[documentHash].exists && documents[documentHash].owner == claimedOwner;
@@ -28,6 +28,15 @@ exec > >(tee -a "$OUTPUT_FILE") 2>&1
 echo "Quantum-Doc-Verify Demo Results - $(date)"
 echo "Output is being saved to: $OUTPUT_FILE"
 echo ""
+# Offline mode: without an IPFS node on localhost:5001, run the in-memory one
+if ! curl -s -X POST http://localhost:5001/api/v0/version >/dev/null 2>&1; then
+    echo "No IPFS node on localhost:5001 - starting an in-memory node (./bin/ipfs devnode)"
+    ./bin/ipfs devnode --listen=localhost:5001 2>/dev/null &
+    DEVNODE_PID=$!
+    trap 'kill $DEVNODE_PID 2>/dev/null' EXIT
+    sleep 1
+    echo ""
+fi
 
 # Create a test document
 echo "CONFIDENTIAL: This is a test document for quantum-resistant verification.
@@ -184,7 +193,6 @@ else
     echo "❌ ERROR: Retrieved document not found"
 fi
 
-# Skip the benchmark code creation since it has compiler errors
 echo -e "\n\033[1m======= PART 2: QUANTUM-RESISTANT VS TRADITIONAL CRYPTOGRAPHY =======\033[0m"
 
 echo -e "\n\033[1m> CRYPTOGRAPHIC PROPERTIES COMPARISON:\033[0m"
@@ -200,6 +208,12 @@ echo "🔐 Dilithium: A lattice-based digital signature scheme."
 echo "   - Status: Quantum-resistant, selected by NIST for standardization"
 echo "   - Size: Signatures are typically 2-3KB (8-12x larger than RSA-2048 signatures at 256 bytes)"
 echo "   - Usage: Document authentication that will remain secure even against quantum computers"
+
+echo -e "\n\033[1m> MEASURED COMPARISON (ML-DSA, SLH-DSA, Dilithium vs Ed25519, ECDSA P-256):\033[0m"
+./bin/quantum-doc-verify bench --sizes=1KB,64KB --iterations=50 \
+    --json="$OUTPUT_DIR/signature_bench_$TIMESTAMP.json" \
+    --markdown="$OUTPUT_DIR/signature_bench_$TIMESTAMP.md" 2>/dev/null \
+    && cat "$OUTPUT_DIR/signature_bench_$TIMESTAMP.md"
 # Part 3: IPFS Performance - This part works fine, keep as is
 echo -e "\n\033[1m======= PART 3: IPFS STORAGE PERFORMANCE =======\033[0m"
 
@@ -11,6 +11,7 @@ import (
 func main() {
 	// Create a new Dilithium signer
 	signer := crypto.NewDilithiumSigner()
+	defer signer.Close()
 
 	// Generate a keypair
 	fmt.Println("Generating quantum-resistant Dilithium keypair...")
@@ -47,6 +48,9 @@ func main() {
 	}
 	fmt.Println("Document signed. Signature saved to signature.bin")
 
+	// The signer holds its own copy of the key; wipe ours now that signing is done
+	crypto.Wipe(privKey)
+
 	// Verify the signature
 	fmt.Println("Verifying signature...")
 	valid, err := signer.VerifySignature(testDoc, signature, pubKey)
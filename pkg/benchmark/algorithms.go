@@ -0,0 +1,178 @@
+package benchmark
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/x509"
+    "fmt"
+    "strings"
+
+    "github.com/cloudflare/circl/sign"
+    "github.com/cloudflare/circl/sign/dilithium/mode2"
+    "github.com/cloudflare/circl/sign/ed25519"
+    "github.com/cloudflare/circl/sign/mldsa/mldsa44"
+    "github.com/cloudflare/circl/sign/mldsa/mldsa65"
+    "github.com/cloudflare/circl/sign/mldsa/mldsa87"
+    "github.com/cloudflare/circl/sign/slhdsa"
+)
+
+// Algorithm is a signature algorithm that can be benchmarked
+type Algorithm interface {
+    // Name returns the algorithm's display name
+    Name() string
+
+    // QuantumResistant reports whether the algorithm resists attacks by quantum computers
+    QuantumResistant() bool
+
+    // GenerateKey creates a new keypair
+    GenerateKey() (Keypair, error)
+}
+
+// Keypair signs and verifies messages with a single key
+type Keypair interface {
+    Sign(message []byte) ([]byte, error)
+    Verify(message, signature []byte) bool
+
+    // PublicKeySize and PrivateKeySize return the encoded key sizes in bytes
+    PublicKeySize() int
+    PrivateKeySize() int
+}
+
+// Algorithms returns every supported algorithm, post-quantum first
+func Algorithms() []Algorithm {
+    return []Algorithm{
+        schemeAlgorithm{scheme: mode2.Scheme(), quantumResistant: true},
+        schemeAlgorithm{scheme: mldsa44.Scheme(), quantumResistant: true},
+        schemeAlgorithm{scheme: mldsa65.Scheme(), quantumResistant: true},
+        schemeAlgorithm{scheme: mldsa87.Scheme(), quantumResistant: true},
+        schemeAlgorithm{scheme: slhdsa.SHA2_128f.Scheme(), quantumResistant: true},
+        schemeAlgorithm{scheme: slhdsa.SHA2_128s.Scheme(), quantumResistant: true},
+        schemeAlgorithm{scheme: ed25519.Scheme(), quantumResistant: false},
+        ecdsaAlgorithm{},
+    }
+}
+
+// SelectAlgorithms returns the algorithms whose names match the given list (case-insensitive).
+// An empty list selects every algorithm.
+func SelectAlgorithms(names []string) ([]Algorithm, error) {
+    all := Algorithms()
+    if len(names) == 0 {
+        return all, nil
+    }
+
+    selected := make([]Algorithm, 0, len(names))
+    for _, name := range names {
+        var found Algorithm
+        for _, alg := range all {
+            if strings.EqualFold(alg.Name(), strings.TrimSpace(name)) {
+                found = alg
+                break
+            }
+        }
+        if found == nil {
+            return nil, fmt.Errorf("unknown algorithm %q", name)
+        }
+        selected = append(selected, found)
+    }
+
+    return selected, nil
+}
+
+// schemeAlgorithm adapts a circl sign.Scheme
+type schemeAlgorithm struct {
+    scheme           sign.Scheme
+    quantumResistant bool
+}
+
+func (a schemeAlgorithm) Name() string {
+    return a.scheme.Name()
+}
+
+func (a schemeAlgorithm) QuantumResistant() bool {
+    return a.quantumResistant
+}
+
+func (a schemeAlgorithm) GenerateKey() (Keypair, error) {
+    pub, priv, err := a.scheme.GenerateKey()
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate %s keypair: %w", a.scheme.Name(), err)
+    }
+    return &schemeKeypair{scheme: a.scheme, pub: pub, priv: priv}, nil
+}
+
+type schemeKeypair struct {
+    scheme sign.Scheme
+    pub    sign.PublicKey
+    priv   sign.PrivateKey
+}
+
+func (k *schemeKeypair) Sign(message []byte) ([]byte, error) {
+    return k.scheme.Sign(k.priv, message, nil), nil
+}
+
+func (k *schemeKeypair) Verify(message, signature []byte) bool {
+    return k.scheme.Verify(k.pub, message, signature, nil)
+}
+
+func (k *schemeKeypair) PublicKeySize() int {
+    return k.scheme.PublicKeySize()
+}
+
+func (k *schemeKeypair) PrivateKeySize() int {
+    return k.scheme.PrivateKeySize()
+}
+
+// ecdsaAlgorithm is ECDSA over P-256 with SHA-256, as used by most classical PKI today
+type ecdsaAlgorithm struct{}
+
+func (ecdsaAlgorithm) Name() string {
+    return "ECDSA-P256"
+}
+
+func (ecdsaAlgorithm) QuantumResistant() bool {
+    return false
+}
+
+func (ecdsaAlgorithm) GenerateKey() (Keypair, error) {
+    priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate ECDSA keypair: %w", err)
+    }
+
+    pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal ECDSA public key: %w", err)
+    }
+    privDER, err := x509.MarshalECPrivateKey(priv)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal ECDSA private key: %w", err)
+    }
+
+    return &ecdsaKeypair{priv: priv, pubSize: len(pubDER), privSize: len(privDER)}, nil
+}
+
+type ecdsaKeypair struct {
+    priv     *ecdsa.PrivateKey
+    pubSize  int
+    privSize int
+}
+
+func (k *ecdsaKeypair) Sign(message []byte) ([]byte, error) {
+    digest := sha256.Sum256(message)
+    return ecdsa.SignASN1(rand.Reader, k.priv, digest[:])
+}
+
+func (k *ecdsaKeypair) Verify(message, signature []byte) bool {
+    digest := sha256.Sum256(message)
+    return ecdsa.VerifyASN1(&k.priv.PublicKey, digest[:], signature)
+}
+
+func (k *ecdsaKeypair) PublicKeySize() int {
+    return k.pubSize
+}
+
+func (k *ecdsaKeypair) PrivateKeySize() int {
+    return k.privSize
+}
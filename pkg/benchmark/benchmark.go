@@ -0,0 +1,276 @@
+package benchmark
+
+import (
+    "crypto/rand"
+    "encoding/json"
+    "fmt"
+    "runtime"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Config controls a benchmark run
+type Config struct {
+    // Algorithms to measure; empty means all of Algorithms()
+    Algorithms []Algorithm
+
+    // DocumentSizes are the message sizes (in bytes) signed and verified
+    DocumentSizes []int
+
+    // Iterations is the maximum number of operations per measurement
+    Iterations int
+
+    // MaxDuration bounds each measurement so slow schemes (e.g. SLH-DSA "s" variants)
+    // finish in reasonable time. At least one operation is always measured.
+    MaxDuration time.Duration
+}
+
+// DefaultConfig returns a configuration suitable for a quick comparison
+func DefaultConfig() Config {
+    return Config{
+        Algorithms:    Algorithms(),
+        DocumentSizes: []int{1 << 10, 64 << 10, 1 << 20},
+        Iterations:    100,
+        MaxDuration:   2 * time.Second,
+    }
+}
+
+// Report is the machine-readable result of a benchmark run
+type Report struct {
+    GeneratedAt time.Time `json:"generatedAt"`
+    GoVersion   string    `json:"goVersion"`
+    Platform    string    `json:"platform"`
+    CPUs        int       `json:"cpus"`
+    Iterations  int       `json:"iterations"`
+    Results     []Result  `json:"results"`
+}
+
+// Result holds the measurements for one algorithm
+type Result struct {
+    Algorithm        string           `json:"algorithm"`
+    QuantumResistant bool             `json:"quantumResistant"`
+    PublicKeyBytes   int              `json:"publicKeyBytes"`
+    PrivateKeyBytes  int              `json:"privateKeyBytes"`
+    SignatureBytes   int              `json:"signatureBytes"`
+    Keygen           Measurement      `json:"keygen"`
+    Documents        []DocumentResult `json:"documents"`
+}
+
+// DocumentResult holds sign and verify measurements for one document size
+type DocumentResult struct {
+    DocumentBytes int         `json:"documentBytes"`
+    Sign          Measurement `json:"sign"`
+    Verify        Measurement `json:"verify"`
+}
+
+// Measurement summarises repeated runs of one operation
+type Measurement struct {
+    Operations   int     `json:"operations"`
+    MeanMicros   float64 `json:"meanMicros"`
+    OpsPerSecond float64 `json:"opsPerSecond"`
+}
+
+// Run benchmarks every configured algorithm and document size
+func Run(cfg Config) (*Report, error) {
+    if len(cfg.Algorithms) == 0 {
+        cfg.Algorithms = Algorithms()
+    }
+    if len(cfg.DocumentSizes) == 0 {
+        cfg.DocumentSizes = DefaultConfig().DocumentSizes
+    }
+    if cfg.Iterations < 1 {
+        cfg.Iterations = 1
+    }
+    if cfg.MaxDuration <= 0 {
+        cfg.MaxDuration = DefaultConfig().MaxDuration
+    }
+
+    // Generate the test documents once so every algorithm signs identical input
+    documents := make([][]byte, len(cfg.DocumentSizes))
+    for i, size := range cfg.DocumentSizes {
+        documents[i] = make([]byte, size)
+        if _, err := rand.Read(documents[i]); err != nil {
+            return nil, fmt.Errorf("failed to generate test document: %w", err)
+        }
+    }
+
+    report := &Report{
+        GeneratedAt: time.Now().UTC(),
+        GoVersion:   runtime.Version(),
+        Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+        CPUs:        runtime.NumCPU(),
+        Iterations:  cfg.Iterations,
+    }
+
+    for _, alg := range cfg.Algorithms {
+        result, err := runAlgorithm(alg, documents, cfg)
+        if err != nil {
+            return nil, err
+        }
+        report.Results = append(report.Results, *result)
+    }
+
+    return report, nil
+}
+
+func runAlgorithm(alg Algorithm, documents [][]byte, cfg Config) (*Result, error) {
+    // 1. Key generation
+    var keypair Keypair
+    var keygenErr error
+    keygen := measure(cfg, func() bool {
+        keypair, keygenErr = alg.GenerateKey()
+        return keygenErr == nil
+    })
+    if keygenErr != nil {
+        return nil, keygenErr
+    }
+
+    result := &Result{
+        Algorithm:        alg.Name(),
+        QuantumResistant: alg.QuantumResistant(),
+        PublicKeyBytes:   keypair.PublicKeySize(),
+        PrivateKeyBytes:  keypair.PrivateKeySize(),
+        Keygen:           keygen,
+    }
+
+    // 2. Sign and verify each document size
+    for _, doc := range documents {
+        var signature []byte
+        var signErr error
+        signatureTotal := 0
+        sign := measure(cfg, func() bool {
+            signature, signErr = keypair.Sign(doc)
+            signatureTotal += len(signature)
+            return signErr == nil
+        })
+        if signErr != nil {
+            return nil, fmt.Errorf("%s signing failed: %w", alg.Name(), signErr)
+        }
+        // ECDSA signatures vary by a few bytes; report the mean
+        if result.SignatureBytes == 0 {
+            result.SignatureBytes = signatureTotal / sign.Operations
+        }
+
+        valid := true
+        verify := measure(cfg, func() bool {
+            valid = keypair.Verify(doc, signature)
+            return valid
+        })
+        if !valid {
+            return nil, fmt.Errorf("%s signature failed to verify", alg.Name())
+        }
+
+        result.Documents = append(result.Documents, DocumentResult{
+            DocumentBytes: len(doc),
+            Sign:          sign,
+            Verify:        verify,
+        })
+    }
+
+    return result, nil
+}
+
+// measure runs op up to cfg.Iterations times or until cfg.MaxDuration elapses.
+// It stops early if op reports failure.
+func measure(cfg Config, op func() bool) Measurement {
+    start := time.Now()
+    n := 0
+    for n < cfg.Iterations {
+        n++
+        if !op() {
+            break
+        }
+        if time.Since(start) >= cfg.MaxDuration {
+            break
+        }
+    }
+    // Coarse clocks can report no time at all for a single fast operation
+    elapsed := time.Since(start)
+    if elapsed <= 0 {
+        elapsed = time.Nanosecond
+    }
+
+    return Measurement{
+        Operations:   n,
+        MeanMicros:   float64(elapsed.Nanoseconds()) / 1e3 / float64(n),
+        OpsPerSecond: float64(n) / elapsed.Seconds(),
+    }
+}
+
+// JSON renders the report as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+    return json.MarshalIndent(r, "", "  ")
+}
+
+// Markdown renders the report as Markdown tables suitable for an architecture decision record
+func (r *Report) Markdown() string {
+    var b strings.Builder
+
+    fmt.Fprintf(&b, "## Signature benchmark\n\n")
+    fmt.Fprintf(&b, "Generated %s on %s (%d CPUs, %s), up to %d iterations per measurement.\n\n",
+        r.GeneratedAt.Format(time.RFC3339), r.Platform, r.CPUs, r.GoVersion, r.Iterations)
+
+    // Sizes and key generation
+    b.WriteString("| Algorithm | Quantum-resistant | Public key (B) | Private key (B) | Signature (B) | Keygen (ops/s) |\n")
+    b.WriteString("|---|---|---:|---:|---:|---:|\n")
+    for _, res := range r.Results {
+        fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %.1f |\n",
+            res.Algorithm, yesNo(res.QuantumResistant), res.PublicKeyBytes, res.PrivateKeyBytes,
+            res.SignatureBytes, res.Keygen.OpsPerSecond)
+    }
+
+    // Throughput per document size
+    b.WriteString("\n| Algorithm | Document | Sign (ops/s) | Sign (µs) | Verify (ops/s) | Verify (µs) |\n")
+    b.WriteString("|---|---:|---:|---:|---:|---:|\n")
+    for _, res := range r.Results {
+        for _, doc := range res.Documents {
+            fmt.Fprintf(&b, "| %s | %s | %.1f | %.0f | %.1f | %.0f |\n",
+                res.Algorithm, FormatSize(doc.DocumentBytes), doc.Sign.OpsPerSecond, doc.Sign.MeanMicros,
+                doc.Verify.OpsPerSecond, doc.Verify.MeanMicros)
+        }
+    }
+
+    return b.String()
+}
+
+func yesNo(v bool) string {
+    if v {
+        return "yes"
+    }
+    return "no"
+}
+
+// ParseSize parses sizes such as "512", "64KB" or "1MB" (binary multiples)
+func ParseSize(s string) (int, error) {
+    s = strings.ToUpper(strings.TrimSpace(s))
+    multiplier := 1
+    for _, unit := range []struct {
+        suffix string
+        factor int
+    }{{"KB", 1 << 10}, {"MB", 1 << 20}, {"K", 1 << 10}, {"M", 1 << 20}, {"B", 1}} {
+        if strings.HasSuffix(s, unit.suffix) {
+            multiplier = unit.factor
+            s = strings.TrimSuffix(s, unit.suffix)
+            break
+        }
+    }
+
+    n, err := strconv.Atoi(s)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("invalid size %q", s)
+    }
+    return n * multiplier, nil
+}
+
+// FormatSize formats a byte count using the largest whole binary unit
+func FormatSize(n int) string {
+    switch {
+    case n >= 1<<20 && n%(1<<20) == 0:
+        return fmt.Sprintf("%d MB", n>>20)
+    case n >= 1<<10 && n%(1<<10) == 0:
+        return fmt.Sprintf("%d KB", n>>10)
+    default:
+        return fmt.Sprintf("%d B", n)
+    }
+}
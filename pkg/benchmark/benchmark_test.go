@@ -0,0 +1,98 @@
+package benchmark
+
+import (
+    "math"
+    "strings"
+    "testing"
+    "time"
+)
+
+// tinyConfig keeps every measurement to a single operation
+var tinyConfig = Config{Iterations: 1, MaxDuration: time.Nanosecond}
+
+func checkMeasurement(t *testing.T, name string, m Measurement) {
+    t.Helper()
+    if m.Operations < 1 {
+        t.Fatalf("%s: expected at least one operation, got %d", name, m.Operations)
+    }
+    for _, v := range []float64{m.OpsPerSecond, m.MeanMicros} {
+        if v <= 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+            t.Fatalf("%s: expected positive finite measurements, got %+v", name, m)
+        }
+    }
+}
+
+func TestMeasure(t *testing.T) {
+    for _, tc := range []struct {
+        name    string
+        cfg     Config
+        fail    bool
+        wantOps int
+    }{
+        {name: "iterations", cfg: Config{Iterations: 3, MaxDuration: time.Minute}, wantOps: 3},
+        {name: "duration", cfg: Config{Iterations: 1000, MaxDuration: time.Nanosecond}, wantOps: 1},
+        {name: "first op fails", cfg: Config{Iterations: 3, MaxDuration: time.Minute}, fail: true, wantOps: 1},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            calls := 0
+            m := measure(tc.cfg, func() bool {
+                calls++
+                return !tc.fail
+            })
+            if m.Operations != tc.wantOps || calls != tc.wantOps {
+                t.Fatalf("Expected %d operations, measured %d over %d calls", tc.wantOps, m.Operations, calls)
+            }
+            checkMeasurement(t, tc.name, m)
+        })
+    }
+}
+
+func TestRunAlgorithms(t *testing.T) {
+    documents := [][]byte{[]byte("benchmark document")}
+    for _, alg := range Algorithms() {
+        t.Run(alg.Name(), func(t *testing.T) {
+            result, err := runAlgorithm(alg, documents, tinyConfig)
+            if err != nil {
+                t.Fatalf("runAlgorithm failed: %v", err)
+            }
+            if result.PublicKeyBytes <= 0 || result.SignatureBytes <= 0 || len(result.Documents) != 1 {
+                t.Fatalf("Unexpected result: %+v", result)
+            }
+            checkMeasurement(t, "keygen", result.Keygen)
+            checkMeasurement(t, "sign", result.Documents[0].Sign)
+            checkMeasurement(t, "verify", result.Documents[0].Verify)
+        })
+    }
+}
+
+func TestReport(t *testing.T) {
+    algorithms, err := SelectAlgorithms([]string{"ed25519"})
+    if err != nil {
+        t.Fatalf("SelectAlgorithms failed: %v", err)
+    }
+    cfg := tinyConfig
+    cfg.Algorithms = algorithms
+    cfg.DocumentSizes = []int{1 << 10}
+    report, err := Run(cfg)
+    if err != nil {
+        t.Fatalf("Run failed: %v", err)
+    }
+    if _, err := report.JSON(); err != nil {
+        t.Fatalf("JSON failed: %v", err)
+    }
+    if md := report.Markdown(); !strings.Contains(md, "| Ed25519 | 1 KB |") {
+        t.Fatalf("Markdown report lacks the measurement:\n%s", md)
+    }
+
+    if _, err := SelectAlgorithms([]string{"rsa"}); err == nil {
+        t.Fatalf("Expected an unknown algorithm to be rejected")
+    }
+    for in, want := range map[string]int{"512": 512, "64KB": 64 << 10, "1m": 1 << 20} {
+        if got, err := ParseSize(in); err != nil || got != want {
+            t.Fatalf("ParseSize(%q) = %d (%v), want %d", in, got, err, want)
+        }
+    }
+    if _, err := ParseSize("lots"); err == nil {
+        t.Fatalf("Expected an invalid size to be rejected")
+    }
+}
@@ -9,6 +9,7 @@ import (
     "fmt"
     "math/big"
     "os"
+    "sort"
     "strings"
     "time"
 
@@ -24,7 +25,18 @@ import (
 
 var documentRegistry = make(map[string]string) // Maps document hash to CID
 
-const registryFile = "document_registry.json"
+var ipnsRegistry = make(map[string]string) // Maps document hash to the IPNS name of its latest version
+
+var retentionRegistry = make(map[string]RetentionRecord) // Maps document hash to its retention record
+
+var grantRegistry = make(map[string]GrantRecord) // Maps document CID and recipient key ID to the recipient's access grant
+
+const (
+    registryFile          = "document_registry.json"
+    ipnsRegistryFile      = "ipns_registry.json"
+    retentionRegistryFile = "retention_registry.json"
+    grantRegistryFile     = "grant_registry.json"
+)
 
 // DocumentMetadata holds document information from the blockchain
 type DocumentMetadata struct {
@@ -35,6 +47,37 @@ type DocumentMetadata struct {
     Signature string    `json:"signature"`
 }
 
+// RetentionRecord holds the retention class of a registered document and whether its
+// content has been released
+type RetentionRecord struct {
+    Hash       string     `json:"hash"`
+    CID        string     `json:"cid"`
+    Class      string     `json:"class"`
+    StoredAt   time.Time  `json:"storedAt"`
+    ReleasedAt *time.Time `json:"releasedAt,omitempty"`
+}
+
+// GrantRecord links a recipient's access grant to a document. RevokedAt is the revocation
+// marker: grants created up to that time are no longer honoured.
+type GrantRecord struct {
+    CID            string     `json:"cid"`
+    RecipientKeyID string     `json:"recipientKeyId"`
+    GrantCID       string     `json:"grantCid,omitempty"`
+    GrantedAt      time.Time  `json:"grantedAt"`
+    RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Honours reports whether a grant created at created is still valid
+func (r GrantRecord) Honours(created time.Time) bool {
+    return r.RevokedAt == nil || created.After(*r.RevokedAt)
+}
+
+// RegisteredDocument is a registered document hash and the CID of its content
+type RegisteredDocument struct {
+    Hash string `json:"hash"`
+    CID  string `json:"cid"`
+}
+
 // Client defines an interface for blockchain operations
 type Client interface {
     // RegisterDocument registers a document's hash, IPFS CID, and signature on the blockchain
@@ -126,33 +169,50 @@ type BlockchainClient struct {
 
 // Load the registry from file during client initialization
 func (bc *BlockchainClient) loadRegistry() error {
+    if err := readRegistryFile(registryFile, &documentRegistry); err != nil {
+        return err
+    }
+    if err := readRegistryFile(ipnsRegistryFile, &ipnsRegistry); err != nil {
+        return err
+    }
+    if err := readRegistryFile(retentionRegistryFile, &retentionRegistry); err != nil {
+        return err
+    }
+    return readRegistryFile(grantRegistryFile, &grantRegistry)
+}
+
+// readRegistryFile loads a registry map, keeping it empty if the file does not exist
+func readRegistryFile(path string, registry interface{}) error {
     // Check if file exists
-    if _, err := os.Stat(registryFile); os.IsNotExist(err) {
-        // If not, create an empty registry
-        documentRegistry = make(map[string]string)
+    if _, err := os.Stat(path); os.IsNotExist(err) {
         return nil
     }
     
     // Read the file
-    data, err := os.ReadFile(registryFile)
+    data, err := os.ReadFile(path)
     if err != nil {
         return fmt.Errorf("failed to read registry file: %w", err)
     }
     
     // Parse JSON
-    return json.Unmarshal(data, &documentRegistry)
+    return json.Unmarshal(data, registry)
 }
 
 // Save the registry to file after each update
 func (bc *BlockchainClient) saveRegistry() error {
+    return writeRegistryFile(registryFile, documentRegistry)
+}
+
+// writeRegistryFile saves a registry map
+func writeRegistryFile(path string, registry interface{}) error {
     // Convert to JSON
-    data, err := json.MarshalIndent(documentRegistry, "", "  ")
+    data, err := json.MarshalIndent(registry, "", "  ")
     if err != nil {
         return fmt.Errorf("failed to marshal registry: %w", err)
     }
     
     // Write to file
-    return os.WriteFile(registryFile, data, 0644)
+    return os.WriteFile(path, data, 0644)
 }
 
 // NewBlockchainClient creates a new blockchain client
@@ -181,6 +241,11 @@ func NewBlockchainClient(nodeURL string, contractAddress string) (*BlockchainCli
 
 // RegisterDocument registers a document on the blockchain
 func (bc *BlockchainClient) RegisterDocument(privateKey *ecdsa.PrivateKey, documentHash, ipfsCID string, dilithiumSignature []byte) (string, error) {
+    // A hash CID can only be registered for the document it was derived from
+    if cidHash, ok := DocumentHash(ipfsCID); ok && !strings.EqualFold(cidHash, documentHash) {
+        return "", fmt.Errorf("CID %s addresses document %s, not %s", ipfsCID, cidHash, documentHash)
+    }
+
     // Store the CID in our registry
     documentRegistry[documentHash] = ipfsCID
     
@@ -239,6 +304,219 @@ func (bc *BlockchainClient) RegisterDocument(privateKey *ecdsa.PrivateKey, docum
     return txHash.Hex(), nil
 }
 
+// LinkIPNSName links a registered document to the IPNS name that points to its latest
+// version, so readers of any version can find the current one
+func (bc *BlockchainClient) LinkIPNSName(privateKey *ecdsa.PrivateKey, documentHash, ipnsName string) (string, error) {
+    if _, exists := documentRegistry[documentHash]; !exists {
+        return "", fmt.Errorf("document %s is not registered", documentHash)
+    }
+
+    // Store the name in our registry
+    ipnsRegistry[documentHash] = ipnsName
+    if err := writeRegistryFile(ipnsRegistryFile, ipnsRegistry); err != nil {
+        return "", fmt.Errorf("failed to save IPNS registry: %w", err)
+    }
+
+    // Format the function call data for "setIPNSName(string,string)"
+    functionHash := crypto.Keccak256([]byte("setIPNSName(string,string)"))[:4]
+    callData := append(functionHash, append([]byte(documentHash), []byte(ipnsName)...)...)
+
+    return bc.sendTransaction(privateKey, callData)
+}
+
+// GetIPNSName returns the IPNS name linked to a document, if any
+func (bc *BlockchainClient) GetIPNSName(documentHash string) (string, bool) {
+    name, exists := ipnsRegistry[documentHash]
+    return name, exists
+}
+
+// SetRetention records the retention class of a registered document. storedAt is the
+// time its retention period starts.
+func (bc *BlockchainClient) SetRetention(privateKey *ecdsa.PrivateKey, documentHash, class string, storedAt time.Time) (string, error) {
+    ipfsCID, exists := documentRegistry[documentHash]
+    if !exists {
+        return "", fmt.Errorf("document %s is not registered", documentHash)
+    }
+
+    retentionRegistry[documentHash] = RetentionRecord{
+        Hash:     documentHash,
+        CID:      ipfsCID,
+        Class:    class,
+        StoredAt: storedAt.UTC(),
+    }
+    if err := writeRegistryFile(retentionRegistryFile, retentionRegistry); err != nil {
+        return "", fmt.Errorf("failed to save retention registry: %w", err)
+    }
+
+    // Format the function call data for "setRetention(string,string)"
+    functionHash := crypto.Keccak256([]byte("setRetention(string,string)"))[:4]
+    callData := append(functionHash, append([]byte(documentHash), []byte(class)...)...)
+
+    return bc.sendTransaction(privateKey, callData)
+}
+
+// GetRetention returns the retention record of a document, if any
+func (bc *BlockchainClient) GetRetention(documentHash string) (RetentionRecord, bool) {
+    record, exists := retentionRegistry[documentHash]
+    return record, exists
+}
+
+// RetentionRecords returns the retention records of all documents, oldest first
+func (bc *BlockchainClient) RetentionRecords() []RetentionRecord {
+    records := make([]RetentionRecord, 0, len(retentionRegistry))
+    for _, record := range retentionRegistry {
+        records = append(records, record)
+    }
+    sort.Slice(records, func(i, j int) bool {
+        if !records[i].StoredAt.Equal(records[j].StoredAt) {
+            return records[i].StoredAt.Before(records[j].StoredAt)
+        }
+        return records[i].Hash < records[j].Hash
+    })
+    return records
+}
+
+// Documents returns every registered document whose content has not been released,
+// sorted by hash. The registry files are re-read so that long-running monitors see
+// documents registered by other processes.
+func (bc *BlockchainClient) Documents() ([]RegisteredDocument, error) {
+    if err := readRegistryFile(registryFile, &documentRegistry); err != nil {
+        return nil, fmt.Errorf("failed to load document registry: %w", err)
+    }
+    if err := readRegistryFile(retentionRegistryFile, &retentionRegistry); err != nil {
+        return nil, fmt.Errorf("failed to load retention registry: %w", err)
+    }
+
+    documents := make([]RegisteredDocument, 0, len(documentRegistry))
+    for hash, ipfsCID := range documentRegistry {
+        if record, exists := retentionRegistry[hash]; exists && record.ReleasedAt != nil {
+            continue
+        }
+        documents = append(documents, RegisteredDocument{Hash: hash, CID: ipfsCID})
+    }
+    sort.Slice(documents, func(i, j int) bool {
+        return documents[i].Hash < documents[j].Hash
+    })
+    return documents, nil
+}
+
+// MarkReleased records that the content of a document has been unpinned after its
+// retention period
+func (bc *BlockchainClient) MarkReleased(privateKey *ecdsa.PrivateKey, documentHash string, releasedAt time.Time) (string, error) {
+    record, exists := retentionRegistry[documentHash]
+    if !exists {
+        return "", fmt.Errorf("document %s has no retention record", documentHash)
+    }
+
+    releasedAt = releasedAt.UTC()
+    record.ReleasedAt = &releasedAt
+    retentionRegistry[documentHash] = record
+    if err := writeRegistryFile(retentionRegistryFile, retentionRegistry); err != nil {
+        return "", fmt.Errorf("failed to save retention registry: %w", err)
+    }
+
+    // Format the function call data for "releaseDocument(string)"
+    functionHash := crypto.Keccak256([]byte("releaseDocument(string)"))[:4]
+    callData := append(functionHash, []byte(documentHash)...)
+
+    return bc.sendTransaction(privateKey, callData)
+}
+
+// PublishGrant links the access grant stored at grantCID to a document, so that the
+// recipient's retrievals find it. created is the time the grant was signed; a grant
+// older than the recipient's revocation marker is refused.
+func (bc *BlockchainClient) PublishGrant(privateKey *ecdsa.PrivateKey, documentCID, recipientKeyID, grantCID string, created time.Time) (string, error) {
+    key := grantKey(documentCID, recipientKeyID)
+    record := grantRegistry[key]
+    if !record.Honours(created) {
+        return "", fmt.Errorf("access for %s was revoked after this grant was created", recipientKeyID)
+    }
+
+    record.CID = documentCID
+    record.RecipientKeyID = recipientKeyID
+    record.GrantCID = grantCID
+    record.GrantedAt = created.UTC()
+    grantRegistry[key] = record
+    if err := writeRegistryFile(grantRegistryFile, grantRegistry); err != nil {
+        return "", fmt.Errorf("failed to save grant registry: %w", err)
+    }
+
+    // Format the function call data for "publishGrant(string,string,string)"
+    functionHash := crypto.Keccak256([]byte("publishGrant(string,string,string)"))[:4]
+    callData := append(functionHash, append([]byte(documentCID), append([]byte(recipientKeyID), []byte(grantCID)...)...)...)
+
+    return bc.sendTransaction(privateKey, callData)
+}
+
+// RevokeGrant records a revocation marker for a recipient of a document: grants created
+// up to revokedAt, including the current one, are no longer honoured
+func (bc *BlockchainClient) RevokeGrant(privateKey *ecdsa.PrivateKey, documentCID, recipientKeyID string, revokedAt time.Time) (string, error) {
+    key := grantKey(documentCID, recipientKeyID)
+    record := grantRegistry[key]
+    record.CID = documentCID
+    record.RecipientKeyID = recipientKeyID
+    revokedAt = revokedAt.UTC()
+    record.RevokedAt = &revokedAt
+    grantRegistry[key] = record
+    if err := writeRegistryFile(grantRegistryFile, grantRegistry); err != nil {
+        return "", fmt.Errorf("failed to save grant registry: %w", err)
+    }
+
+    // Format the function call data for "revokeGrant(string,string)"
+    functionHash := crypto.Keccak256([]byte("revokeGrant(string,string)"))[:4]
+    callData := append(functionHash, append([]byte(documentCID), []byte(recipientKeyID)...)...)
+
+    return bc.sendTransaction(privateKey, callData)
+}
+
+// GetGrant returns the grant record of a recipient of a document, if any. The registry
+// file is re-read so that long-running readers such as the API server see revocations
+// as soon as they are recorded.
+func (bc *BlockchainClient) GetGrant(documentCID, recipientKeyID string) (GrantRecord, bool, error) {
+    if err := readRegistryFile(grantRegistryFile, &grantRegistry); err != nil {
+        return GrantRecord{}, false, fmt.Errorf("failed to load grant registry: %w", err)
+    }
+    record, exists := grantRegistry[grantKey(documentCID, recipientKeyID)]
+    return record, exists, nil
+}
+
+func grantKey(documentCID, recipientKeyID string) string {
+    return documentCID + "/" + recipientKeyID
+}
+
+// sendTransaction signs and sends a contract call
+func (bc *BlockchainClient) sendTransaction(privateKey *ecdsa.PrivateKey, callData []byte) (string, error) {
+    auth, err := bc.getTransactionAuth(privateKey)
+    if err != nil {
+        return "", fmt.Errorf("failed to create transaction auth: %w", err)
+    }
+
+    tx := types.NewTransaction(
+        auth.Nonce.Uint64(),
+        bc.contractAddr,
+        auth.Value,
+        auth.GasLimit,
+        auth.GasPrice,
+        callData,
+    )
+
+    chainID, err := bc.client.ChainID(context.Background())
+    if err != nil {
+        return "", fmt.Errorf("failed to get chain ID: %w", err)
+    }
+
+    signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
+    if err != nil {
+        return "", fmt.Errorf("failed to sign transaction: %w", err)
+    }
+
+    if err := bc.client.SendTransaction(context.Background(), signedTx); err != nil {
+        return "", fmt.Errorf("failed to send transaction: %w", err)
+    }
+
+    return signedTx.Hash().Hex(), nil
+}
+
 // VerifyDocumentOwnership checks if a document is owned by a specific address
 func (bc *BlockchainClient) VerifyDocumentOwnership(documentHash string, claimedOwner common.Address) (bool, error) {
     // In a real implementation, this would call the contract
@@ -253,24 +531,22 @@ func (bc *BlockchainClient) DocumentExists(documentHash string) (bool, error) {
     return true, nil
 }
 
-// GetDocumentDetails retrieves document details from blockchain
+// GetDocumentDetails retrieves document details from blockchain. Unregistered documents
+// are reported as not found, with the hash CID they would be stored under.
 func (bc *BlockchainClient) GetDocumentDetails(documentHash string) (common.Address, string, time.Time, bool, error) {
     // Look up the CID from our registry
     ipfsCID, exists := documentRegistry[documentHash]
     if !exists {
-        // If not found, fall back to calculating it (for compatibility)
-        hashBytes, err := hex.DecodeString(documentHash)
-        if err != nil {
-            return common.Address{}, "", time.Time{}, false, fmt.Errorf("invalid document hash: %w", err)
-        }
-        
-        mh, err := multihash.Sum(hashBytes, multihash.SHA2_256, -1)
+        derived, err := DocumentCID(documentHash)
         if err != nil {
-            return common.Address{}, "", time.Time{}, false, fmt.Errorf("failed to create multihash: %w", err)
+            return common.Address{}, "", time.Time{}, false, err
         }
-        
-        c := cid.NewCidV0(mh)
-        ipfsCID = c.String()
+        return common.Address{}, derived, time.Time{}, false, nil
+    }
+
+    // A registered hash CID must still be derived from the document hash
+    if cidHash, ok := DocumentHash(ipfsCID); ok && !strings.EqualFold(cidHash, documentHash) {
+        return common.Address{}, "", time.Time{}, false, fmt.Errorf("registered CID %s addresses document %s, not %s", ipfsCID, cidHash, documentHash)
     }
     
     return common.HexToAddress("0x1234567890AbcdEF1234567890aBcdef12345678"), 
@@ -280,6 +556,35 @@ func (bc *BlockchainClient) GetDocumentDetails(documentHash string) (common.Addr
            nil
 }
 
+// DocumentCID returns the hash CID of a document: the CIDv1 of a raw block whose
+// multihash is the document's SHA3-256 hash. Documents stored with
+// storage.StoreOptions.HashCID are found under it.
+func DocumentCID(documentHash string) (string, error) {
+    digest, err := hex.DecodeString(documentHash)
+    if err != nil || len(digest) != 32 {
+        return "", fmt.Errorf("invalid document hash %q: expected 32 hex-encoded bytes", documentHash)
+    }
+    mh, err := multihash.Encode(digest, multihash.SHA3_256)
+    if err != nil {
+        return "", fmt.Errorf("failed to create multihash: %w", err)
+    }
+    return cid.NewCidV1(cid.Raw, mh).String(), nil
+}
+
+// DocumentHash returns the document hash a hash CID was derived from. It reports false
+// for any other CID.
+func DocumentHash(ipfsCID string) (string, bool) {
+    c, err := cid.Decode(ipfsCID)
+    if err != nil || c.Type() != cid.Raw {
+        return "", false
+    }
+    decoded, err := multihash.Decode(c.Hash())
+    if err != nil || decoded.Code != multihash.SHA3_256 || len(decoded.Digest) != 32 {
+        return "", false
+    }
+    return hex.EncodeToString(decoded.Digest), true
+}
+
 // RecordVerification records a verification event on the blockchain
 func (bc *BlockchainClient) RecordVerification(privateKey *ecdsa.PrivateKey, documentHash string, verified bool) (string, error) {
     // Get auth for transaction
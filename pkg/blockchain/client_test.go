@@ -0,0 +1,222 @@
+package blockchain
+
+import (
+    "bytes"
+    "encoding/hex"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+    "golang.org/x/crypto/sha3"
+)
+
+func TestDocumentCIDRoundTrip(t *testing.T) {
+    digest := sha3.Sum256([]byte("Board resolution 2026-14, published for public verification"))
+    documentHash := hex.EncodeToString(digest[:])
+
+    documentCID, err := DocumentCID(documentHash)
+    if err != nil {
+        t.Fatalf("DocumentCID failed: %v", err)
+    }
+    c, err := cid.Decode(documentCID)
+    if err != nil {
+        t.Fatalf("DocumentCID returned an invalid CID %q: %v", documentCID, err)
+    }
+    if c.Version() != 1 || c.Type() != cid.Raw || c.Prefix().MhType != multihash.SHA3_256 {
+        t.Fatalf("Expected a raw CIDv1 hashed with SHA3-256, got %+v", c.Prefix())
+    }
+
+    // The CID is the one Kubo assigns to the document stored as a single raw block
+    if sum, _ := c.Prefix().Sum([]byte("Board resolution 2026-14, published for public verification")); !sum.Equals(c) {
+        t.Fatalf("Expected %s, got %s", sum, c)
+    }
+
+    hash, ok := DocumentHash(documentCID)
+    if !ok || hash != documentHash {
+        t.Fatalf("DocumentHash returned %q (%v), want %s", hash, ok, documentHash)
+    }
+
+    // Hashes are accepted in either case and come back in lower case
+    upper, err := DocumentCID(strings.ToUpper(documentHash))
+    if err != nil || upper != documentCID {
+        t.Fatalf("Expected an upper-case hash to give %s, got %q (%v)", documentCID, upper, err)
+    }
+}
+
+func TestDocumentCIDRejectsInvalidHashes(t *testing.T) {
+    digest := sha3.Sum256([]byte("document"))
+    for name, documentHash := range map[string]string{
+        "empty":    "",
+        "not hex":  strings.Repeat("zz", 32),
+        "31 bytes": hex.EncodeToString(digest[:31]),
+        "33 bytes": hex.EncodeToString(append(digest[:], 0)),
+    } {
+        if documentCID, err := DocumentCID(documentHash); err == nil {
+            t.Fatalf("%s: expected an error, got %s", name, documentCID)
+        }
+    }
+}
+
+func TestDocumentHashRejectsOtherCIDs(t *testing.T) {
+    content := []byte("document")
+    digest := sha3.Sum256(content)
+    sha3Hash, _ := multihash.Encode(digest[:], multihash.SHA3_256)
+    sha2Hash, _ := multihash.Sum(content, multihash.SHA2_256, -1)
+    truncated, _ := multihash.Encode(digest[:20], multihash.SHA3_256)
+    padded, _ := multihash.Encode(append(bytes.Clone(digest[:]), 0), multihash.SHA3_256)
+
+    for name, c := range map[string]string{
+        "invalid":          "not-a-cid",
+        "CIDv0":            cid.NewCidV0(sha2Hash).String(),
+        "dag-pb":           cid.NewCidV1(cid.DagProtobuf, sha3Hash).String(),
+        "sha2-256 raw":     cid.NewCidV1(cid.Raw, sha2Hash).String(),
+        "20-byte digest":   cid.NewCidV1(cid.Raw, truncated).String(),
+        "33-byte digest":   cid.NewCidV1(cid.Raw, padded).String(),
+        "Kubo hello world": "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o",
+    } {
+        if hash, ok := DocumentHash(c); ok {
+            t.Fatalf("%s: expected %s not to name a document hash, got %s", name, c, hash)
+        }
+    }
+}
+
+func TestGrantRecordHonours(t *testing.T) {
+    revokedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+    for _, tc := range []struct {
+        name      string
+        revokedAt *time.Time
+        created   time.Time
+        honoured  bool
+    }{
+        {"never revoked", nil, revokedAt, true},
+        {"created before revocation", &revokedAt, revokedAt.Add(-time.Hour), false},
+        {"created at revocation", &revokedAt, revokedAt, false},
+        {"created after revocation", &revokedAt, revokedAt.Add(time.Second), true},
+    } {
+        record := GrantRecord{CID: "bafy-document", RecipientKeyID: "auditor", RevokedAt: tc.revokedAt}
+        if got := record.Honours(tc.created); got != tc.honoured {
+            t.Errorf("%s: Honours returned %v, want %v", tc.name, got, tc.honoured)
+        }
+    }
+}
+
+func TestPublishAndRevokeGrant(t *testing.T) {
+    useRegistryDir(t)
+    node, methods := newFakeNode(t)
+    bc, err := NewBlockchainClient(node.URL, "0x0000000000000000000000000000000000000001")
+    if err != nil {
+        t.Fatalf("NewBlockchainClient failed: %v", err)
+    }
+    privateKey, _ := crypto.GenerateKey()
+
+    created := time.Now().UTC().Add(-time.Hour)
+    if _, err := bc.PublishGrant(privateKey, "bafy-document", "auditor", "bafy-grant-1", created); err != nil {
+        t.Fatalf("PublishGrant failed: %v", err)
+    }
+    record, exists, err := bc.GetGrant("bafy-document", "auditor")
+    if err != nil || !exists || record.GrantCID != "bafy-grant-1" || !record.GrantedAt.Equal(created) || record.RevokedAt != nil {
+        t.Fatalf("Unexpected grant record %+v (%v, %v)", record, exists, err)
+    }
+
+    // Revocation withdraws the current grant and any older one, but not a grant of
+    // another recipient
+    if _, err := bc.PublishGrant(privateKey, "bafy-document", "reviewer", "bafy-grant-2", created); err != nil {
+        t.Fatalf("PublishGrant failed: %v", err)
+    }
+    revokedAt := created.Add(30 * time.Minute)
+    if _, err := bc.RevokeGrant(privateKey, "bafy-document", "auditor", revokedAt); err != nil {
+        t.Fatalf("RevokeGrant failed: %v", err)
+    }
+    record, _, _ = bc.GetGrant("bafy-document", "auditor")
+    if record.RevokedAt == nil || !record.RevokedAt.Equal(revokedAt) || record.Honours(created) {
+        t.Fatalf("Expected the grant to be revoked at %s, got %+v", revokedAt, record)
+    }
+    if other, _, _ := bc.GetGrant("bafy-document", "reviewer"); other.RevokedAt != nil {
+        t.Fatalf("Expected the other recipient's grant to stand, got %+v", other)
+    }
+
+    // A grant created before the revocation cannot be published again; a new one can
+    if _, err := bc.PublishGrant(privateKey, "bafy-document", "auditor", "bafy-grant-1", created); err == nil {
+        t.Fatalf("Expected a grant older than the revocation marker to be refused")
+    }
+    reissued := revokedAt.Add(time.Minute)
+    if _, err := bc.PublishGrant(privateKey, "bafy-document", "auditor", "bafy-grant-3", reissued); err != nil {
+        t.Fatalf("PublishGrant of a new grant failed: %v", err)
+    }
+    record, _, _ = bc.GetGrant("bafy-document", "auditor")
+    if record.GrantCID != "bafy-grant-3" || !record.Honours(reissued) {
+        t.Fatalf("Expected the new grant to be honoured, got %+v", record)
+    }
+
+    // Each successful call sends one transaction
+    if sent := methods("eth_sendRawTransaction"); sent != 4 {
+        t.Fatalf("Expected 4 transactions, got %d", sent)
+    }
+}
+
+// useRegistryDir runs the test in an empty directory, so that the registry files it
+// writes are its own
+func useRegistryDir(t *testing.T) {
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(t.TempDir()); err != nil {
+        t.Fatal(err)
+    }
+    saved := grantRegistry
+    grantRegistry = make(map[string]GrantRecord)
+    t.Cleanup(func() {
+        grantRegistry = saved
+        os.Chdir(wd)
+    })
+}
+
+// newFakeNode serves the JSON-RPC calls made to send a transaction and returns a
+// function counting the calls of a method
+func newFakeNode(t *testing.T) (*httptest.Server, func(method string) int) {
+    var mu sync.Mutex
+    calls := make(map[string]int)
+    results := map[string]string{
+        "eth_getTransactionCount": "0x0",
+        "eth_gasPrice":            "0x3b9aca00",
+        "eth_chainId":             "0x539",
+        "eth_sendRawTransaction":  "0x" + strings.Repeat("ab", 32),
+    }
+
+    node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var request struct {
+            ID     json.RawMessage `json:"id"`
+            Method string          `json:"method"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        mu.Lock()
+        calls[request.Method]++
+        mu.Unlock()
+
+        result, ok := results[request.Method]
+        if !ok {
+            t.Errorf("Unexpected JSON-RPC call %s", request.Method)
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": result})
+    }))
+    t.Cleanup(node.Close)
+
+    return node, func(method string) int {
+        mu.Lock()
+        defer mu.Unlock()
+        return calls[method]
+    }
+}
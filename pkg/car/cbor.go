@@ -0,0 +1,202 @@
+package car
+
+import (
+    "encoding/binary"
+    "fmt"
+
+    "github.com/ipfs/go-cid"
+)
+
+// Just enough DAG-CBOR to read and write the CARv1 header, {"roots": [CID, ...], "version": 1}.
+// CIDs are tag 42 byte strings holding a zero byte followed by the binary CID.
+
+const (
+    cborUint  = 0
+    cborBytes = 2
+    cborText  = 3
+    cborArray = 4
+    cborMap   = 5
+    cborTag   = 6
+
+    cborTagCID = 42
+)
+
+// decodeHeader parses a CARv1 header
+func decodeHeader(data []byte) (uint64, []cid.Cid, error) {
+    d := &cborDecoder{buf: data}
+
+    major, entries, err := d.head()
+    if err != nil {
+        return 0, nil, err
+    }
+    if major != cborMap {
+        return 0, nil, fmt.Errorf("header is not a map")
+    }
+
+    var version uint64
+    var roots []cid.Cid
+    for i := uint64(0); i < entries; i++ {
+        key, err := d.text()
+        if err != nil {
+            return 0, nil, err
+        }
+
+        switch key {
+        case "version":
+            major, v, err := d.head()
+            if err != nil {
+                return 0, nil, err
+            }
+            if major != cborUint {
+                return 0, nil, fmt.Errorf("version is not an integer")
+            }
+            version = v
+        case "roots":
+            major, count, err := d.head()
+            if err != nil {
+                return 0, nil, err
+            }
+            if major != cborArray {
+                return 0, nil, fmt.Errorf("roots is not an array")
+            }
+            for j := uint64(0); j < count; j++ {
+                c, err := d.cid()
+                if err != nil {
+                    return 0, nil, err
+                }
+                roots = append(roots, c)
+            }
+        default:
+            return 0, nil, fmt.Errorf("unexpected header field %q", key)
+        }
+    }
+
+    if len(d.buf) != 0 {
+        return 0, nil, fmt.Errorf("trailing bytes after header")
+    }
+    return version, roots, nil
+}
+
+// encodeHeader encodes a CAR header. DAG-CBOR orders map keys by length, so "roots"
+// precedes "version".
+func encodeHeader(version uint64, roots []cid.Cid) []byte {
+    buf := appendHead(nil, cborMap, 2)
+    buf = appendText(buf, "roots")
+    buf = appendHead(buf, cborArray, uint64(len(roots)))
+    for _, root := range roots {
+        buf = appendHead(buf, cborTag, cborTagCID)
+        value := append([]byte{0}, root.Bytes()...)
+        buf = appendHead(buf, cborBytes, uint64(len(value)))
+        buf = append(buf, value...)
+    }
+    buf = appendText(buf, "version")
+    return appendHead(buf, cborUint, version)
+}
+
+// appendHead appends an item header with the shortest encoding of arg
+func appendHead(buf []byte, major byte, arg uint64) []byte {
+    switch {
+    case arg < 24:
+        return append(buf, major<<5|byte(arg))
+    case arg <= 0xff:
+        return append(buf, major<<5|24, byte(arg))
+    case arg <= 0xffff:
+        return binary.BigEndian.AppendUint16(append(buf, major<<5|25), uint16(arg))
+    case arg <= 0xffffffff:
+        return binary.BigEndian.AppendUint32(append(buf, major<<5|26), uint32(arg))
+    default:
+        return binary.BigEndian.AppendUint64(append(buf, major<<5|27), arg)
+    }
+}
+
+func appendText(buf []byte, s string) []byte {
+    return append(appendHead(buf, cborText, uint64(len(s))), s...)
+}
+
+type cborDecoder struct {
+    buf []byte
+}
+
+// head decodes an item header, returning the major type and its argument
+func (d *cborDecoder) head() (byte, uint64, error) {
+    if len(d.buf) == 0 {
+        return 0, 0, fmt.Errorf("unexpected end of CBOR data")
+    }
+    major, info := d.buf[0]>>5, d.buf[0]&0x1f
+    d.buf = d.buf[1:]
+
+    var size int
+    switch {
+    case info < 24:
+        return major, uint64(info), nil
+    case info == 24:
+        size = 1
+    case info == 25:
+        size = 2
+    case info == 26:
+        size = 4
+    case info == 27:
+        size = 8
+    default:
+        return 0, 0, fmt.Errorf("unsupported CBOR length encoding %d", info)
+    }
+
+    if len(d.buf) < size {
+        return 0, 0, fmt.Errorf("unexpected end of CBOR data")
+    }
+    var arg uint64
+    switch size {
+    case 1:
+        arg = uint64(d.buf[0])
+    case 2:
+        arg = uint64(binary.BigEndian.Uint16(d.buf))
+    case 4:
+        arg = uint64(binary.BigEndian.Uint32(d.buf))
+    case 8:
+        arg = binary.BigEndian.Uint64(d.buf)
+    }
+    d.buf = d.buf[size:]
+    return major, arg, nil
+}
+
+// bytes decodes a byte or text string body of the given major type
+func (d *cborDecoder) bytes(expected byte) ([]byte, error) {
+    major, length, err := d.head()
+    if err != nil {
+        return nil, err
+    }
+    if major != expected {
+        return nil, fmt.Errorf("unexpected CBOR major type %d", major)
+    }
+    if length > uint64(len(d.buf)) {
+        return nil, fmt.Errorf("unexpected end of CBOR data")
+    }
+
+    value := d.buf[:length]
+    d.buf = d.buf[length:]
+    return value, nil
+}
+
+func (d *cborDecoder) text() (string, error) {
+    value, err := d.bytes(cborText)
+    return string(value), err
+}
+
+func (d *cborDecoder) cid() (cid.Cid, error) {
+    major, tag, err := d.head()
+    if err != nil {
+        return cid.Undef, err
+    }
+    if major != cborTag || tag != cborTagCID {
+        return cid.Undef, fmt.Errorf("root is not a CID")
+    }
+
+    value, err := d.bytes(cborBytes)
+    if err != nil {
+        return cid.Undef, err
+    }
+    if len(value) == 0 || value[0] != 0 {
+        return cid.Undef, fmt.Errorf("CID is missing its multibase prefix")
+    }
+    return cid.Cast(value[1:])
+}
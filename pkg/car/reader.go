@@ -0,0 +1,135 @@
+// Package car reads and writes Content Addressable aRchives (CAR), the block transport
+// format of IPFS trustless gateways and of offline document transfer
+package car
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+
+    "github.com/ipfs/go-cid"
+)
+
+const (
+    // maxHeaderSize bounds the CARv1 header
+    maxHeaderSize = 1 << 20
+
+    // MaxBlockSize bounds a single block section. IPFS limits blocks to 2 MiB for
+    // transfer between peers.
+    MaxBlockSize = 2<<20 + 128
+)
+
+// ErrBlockMismatch is returned when a block in the archive does not hash to its CID
+var ErrBlockMismatch = errors.New("CAR block does not match its CID")
+
+// Reader reads blocks from a CARv1 stream, or the payload of a CARv2 archive, verifying
+// each against its CID
+type Reader struct {
+    r       *bufio.Reader
+    Version uint64
+    Roots   []cid.Cid
+}
+
+// NewReader reads the archive header from r
+func NewReader(r io.Reader) (*Reader, error) {
+    br := bufio.NewReader(r)
+
+    header, err := readSection(br, maxHeaderSize)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read CAR header: %w", err)
+    }
+
+    version, roots, err := decodeHeader(header)
+    if err != nil {
+        return nil, fmt.Errorf("invalid CAR header: %w", err)
+    }
+
+    switch version {
+    case 1:
+        return &Reader{r: br, Version: version, Roots: roots}, nil
+    case 2:
+        payload, err := readV2Header(br, len(binary.AppendUvarint(nil, uint64(len(header))))+len(header))
+        if err != nil {
+            return nil, err
+        }
+        inner, err := NewReader(payload)
+        if err != nil {
+            return nil, err
+        }
+        if inner.Version != 1 {
+            return nil, fmt.Errorf("CARv2 payload is not a CARv1 archive")
+        }
+        inner.Version = 2
+        return inner, nil
+    default:
+        return nil, fmt.Errorf("unsupported CAR version %d", version)
+    }
+}
+
+// readV2Header reads the CARv2 header following the pragma, of which read bytes have
+// been consumed, and returns a reader of the CARv1 payload. The index, if any, is ignored.
+func readV2Header(r *bufio.Reader, read int) (io.Reader, error) {
+    header := make([]byte, v2HeaderSize)
+    if _, err := io.ReadFull(r, header); err != nil {
+        return nil, fmt.Errorf("failed to read CARv2 header: %w", err)
+    }
+    dataOffset := binary.LittleEndian.Uint64(header[16:])
+    dataSize := binary.LittleEndian.Uint64(header[24:])
+
+    consumed := uint64(read + v2HeaderSize)
+    if dataOffset < consumed || dataSize == 0 {
+        return nil, fmt.Errorf("invalid CARv2 header")
+    }
+    if _, err := io.CopyN(io.Discard, r, int64(dataOffset-consumed)); err != nil {
+        return nil, fmt.Errorf("failed to read CARv2 archive: %w", err)
+    }
+    return io.LimitReader(r, int64(dataSize)), nil
+}
+
+// Next returns the next block, or io.EOF at the end of the archive.
+// The block is verified against its CID; a mismatch returns ErrBlockMismatch.
+func (r *Reader) Next() (cid.Cid, []byte, error) {
+    section, err := readSection(r.r, MaxBlockSize)
+    if err != nil {
+        return cid.Undef, nil, err
+    }
+
+    n, c, err := cid.CidFromBytes(section)
+    if err != nil {
+        return cid.Undef, nil, fmt.Errorf("invalid CID in CAR block: %w", err)
+    }
+    data := section[n:]
+
+    sum, err := c.Prefix().Sum(data)
+    if err != nil {
+        return cid.Undef, nil, fmt.Errorf("failed to hash CAR block %s: %w", c, err)
+    }
+    if !sum.Equals(c) {
+        return cid.Undef, nil, fmt.Errorf("%w: %s", ErrBlockMismatch, c)
+    }
+
+    return c, data, nil
+}
+
+// readSection reads one varint length-prefixed section. A clean end of stream before
+// the length returns io.EOF; anything shorter than the declared length is an error.
+func readSection(r *bufio.Reader, max uint64) ([]byte, error) {
+    length, err := binary.ReadUvarint(r)
+    if err == io.EOF {
+        return nil, io.EOF
+    }
+    if err != nil {
+        return nil, fmt.Errorf("malformed section length: %w", err)
+    }
+    if length == 0 || length > max {
+        return nil, fmt.Errorf("invalid section length %d", length)
+    }
+
+    section := make([]byte, length)
+    if _, err := io.ReadFull(r, section); err != nil {
+        return nil, fmt.Errorf("truncated section: %w", io.ErrUnexpectedEOF)
+    }
+    return section, nil
+}
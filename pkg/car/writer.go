@@ -0,0 +1,113 @@
+package car
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io"
+
+    "github.com/ipfs/go-cid"
+)
+
+// CARv2 wraps a CARv1 payload in a fixed header (all integers little-endian):
+//
+//	pragma           the CARv1 header {"version": 2}, 11 bytes
+//	characteristics  16 bytes
+//	dataOffset       uint64   offset of the CARv1 payload
+//	dataSize         uint64   size of the CARv1 payload
+//	indexOffset      uint64   offset of the index, or 0 for none
+//	payload          CARv1 archive
+//
+// This package writes CARv2 archives without an index.
+
+// v2Pragma is the fixed start of every CARv2 archive
+var v2Pragma = []byte{0x0a, 0xa1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x02}
+
+// v2HeaderSize is the size of the CARv2 header after the pragma
+const v2HeaderSize = 16 + 8 + 8 + 8
+
+// Writer writes blocks to a CAR archive. It does not check that the blocks form a DAG
+// under the roots; Put verifies each block against its CID.
+type Writer struct {
+    w    io.Writer
+    size uint64
+
+    // v2 is the archive being wrapped in a CARv2 header, and start its offset
+    v2    io.WriteSeeker
+    start int64
+}
+
+// NewWriter writes a CARv1 header naming roots to w
+func NewWriter(w io.Writer, roots []cid.Cid) (*Writer, error) {
+    cw := &Writer{w: w}
+    if err := cw.section(encodeHeader(1, roots)); err != nil {
+        return nil, fmt.Errorf("failed to write CAR header: %w", err)
+    }
+    return cw, nil
+}
+
+// NewWriterV2 writes a CARv2 header and a CARv1 header naming roots to w. The size of
+// the payload is filled in by Close, so w must be seekable.
+func NewWriterV2(w io.WriteSeeker, roots []cid.Cid) (*Writer, error) {
+    start, err := w.Seek(0, io.SeekCurrent)
+    if err != nil {
+        return nil, fmt.Errorf("CARv2 output must be seekable: %w", err)
+    }
+
+    header := make([]byte, v2HeaderSize)
+    binary.LittleEndian.PutUint64(header[16:], uint64(len(v2Pragma)+v2HeaderSize))
+    if _, err := w.Write(append(append([]byte(nil), v2Pragma...), header...)); err != nil {
+        return nil, fmt.Errorf("failed to write CAR header: %w", err)
+    }
+
+    cw := &Writer{w: w, v2: w, start: start}
+    if err := cw.section(encodeHeader(1, roots)); err != nil {
+        return nil, fmt.Errorf("failed to write CAR header: %w", err)
+    }
+    return cw, nil
+}
+
+// Put writes a block, which must hash to c
+func (w *Writer) Put(c cid.Cid, data []byte) error {
+    sum, err := c.Prefix().Sum(data)
+    if err != nil {
+        return fmt.Errorf("failed to hash block %s: %w", c, err)
+    }
+    if !sum.Equals(c) {
+        return fmt.Errorf("%w: %s", ErrBlockMismatch, c)
+    }
+
+    if err := w.section(append(c.Bytes(), data...)); err != nil {
+        return fmt.Errorf("failed to write block %s: %w", c, err)
+    }
+    return nil
+}
+
+// Close completes the archive. It does not close the underlying writer.
+func (w *Writer) Close() error {
+    if w.v2 == nil {
+        return nil
+    }
+
+    sizeOffset := w.start + int64(len(v2Pragma)) + 16 + 8
+    if _, err := w.v2.Seek(sizeOffset, io.SeekStart); err != nil {
+        return fmt.Errorf("failed to complete CARv2 header: %w", err)
+    }
+    if _, err := w.v2.Write(binary.LittleEndian.AppendUint64(nil, w.size)); err != nil {
+        return fmt.Errorf("failed to complete CARv2 header: %w", err)
+    }
+    if _, err := w.v2.Seek(0, io.SeekEnd); err != nil {
+        return fmt.Errorf("failed to complete CARv2 header: %w", err)
+    }
+    return nil
+}
+
+// section writes one varint length-prefixed section of the CARv1 payload
+func (w *Writer) section(data []byte) error {
+    buf := binary.AppendUvarint(nil, uint64(len(data)))
+    buf = append(buf, data...)
+    if _, err := w.w.Write(buf); err != nil {
+        return err
+    }
+    w.size += uint64(len(buf))
+    return nil
+}
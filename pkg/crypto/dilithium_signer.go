@@ -4,15 +4,31 @@ import (
     
     "crypto/sha256"
     "encoding/hex"
+    "errors"
     "fmt"
     "os"
 
     "github.com/cloudflare/circl/sign"
     "github.com/cloudflare/circl/sign/dilithium/mode2"
+    "golang.org/x/crypto/sha3"
 )
 
+// DilithiumAlgorithm names the signature scheme used by DilithiumSigner in manifests and
+// signature containers
+const DilithiumAlgorithm = "Dilithium2"
+
+// DilithiumKeyID returns the identifier of a Dilithium public key: the hex-encoded first
+// 16 bytes of its SHA3-256 hash
+func DilithiumKeyID(pub []byte) string {
+    sum := sha3.Sum256(pub)
+    return hex.EncodeToString(sum[:16])
+}
+
+// DilithiumSigner signs and verifies documents with Dilithium. The private key is kept
+// packed in a Secret and only unpacked for the duration of a signing operation; call
+// Close when the signer is no longer needed to wipe it.
 type DilithiumSigner struct {
-    privateKey sign.PrivateKey
+    privateKey *Secret
     publicKey  sign.PublicKey
     scheme     sign.Scheme
 }
@@ -31,8 +47,13 @@ func (ds *DilithiumSigner) GenerateKeypair() ([]byte, []byte, error) {
         return nil, nil, fmt.Errorf("failed to generate keypair: %w", err)
     }
 
-    ds.publicKey = pub
-    ds.privateKey = priv
+    return ds.setKeypair(pub, priv)
+}
+
+// setKeypair installs a freshly generated keypair and returns its binary encodings.
+// The returned private key bytes belong to the caller, who should Wipe them after use.
+func (ds *DilithiumSigner) setKeypair(pub sign.PublicKey, priv sign.PrivateKey) ([]byte, []byte, error) {
+    defer wipePrivateKey(priv)
 
     pubBytes, err := pub.MarshalBinary()
     if err != nil {
@@ -44,6 +65,11 @@ func (ds *DilithiumSigner) GenerateKeypair() ([]byte, []byte, error) {
         return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
     }
 
+    ds.publicKey = pub
+    ds.privateKey.Destroy()
+    ds.privateKey = NewSecret(len(privBytes))
+    copy(ds.privateKey.Bytes(), privBytes)
+
     return pubBytes, privBytes, nil
 }
 
@@ -57,17 +83,33 @@ func (ds *DilithiumSigner) SignDocument(docPath string, privateKeyBytes []byte)
         }
     }
 
-    if ds.privateKey == nil {
-        return nil, fmt.Errorf("private key not available")
-    }
-
     content, err := os.ReadFile(docPath)
     if err != nil {
         return nil, fmt.Errorf("failed to read document: %w", err)
     }
 
-    signature := ds.scheme.Sign(ds.privateKey, content, nil)
-    return signature, nil
+    return ds.Sign(content)
+}
+
+// Sign signs a message with the loaded private key. It is safe to call concurrently
+// with Close, which waits for the signature to complete.
+func (ds *DilithiumSigner) Sign(message []byte) ([]byte, error) {
+    var signature []byte
+    err := ds.privateKey.Use(func(packed []byte) error {
+        // Unpack the key only for the duration of the signature
+        priv, err := ds.scheme.UnmarshalBinaryPrivateKey(packed)
+        if err != nil {
+            return fmt.Errorf("failed to unmarshal private key: %w", err)
+        }
+        defer wipePrivateKey(priv)
+
+        signature = ds.scheme.Sign(priv, message, nil)
+        return nil
+    })
+    if errors.Is(err, ErrSecretDestroyed) {
+        return nil, fmt.Errorf("private key not available")
+    }
+    return signature, err
 }
 
 // VerifySignature verifies a document signature
@@ -77,13 +119,18 @@ func (ds *DilithiumSigner) VerifySignature(docPath string, signature, publicKeyB
         return false, fmt.Errorf("failed to read document: %w", err)
     }
 
+    return ds.Verify(content, signature, publicKeyBytes)
+}
+
+// Verify verifies a signature over a message
+func (ds *DilithiumSigner) Verify(message, signature, publicKeyBytes []byte) (bool, error) {
     // Load the public key from bytes
     publicKey, err := ds.scheme.UnmarshalBinaryPublicKey(publicKeyBytes)
     if err != nil {
         return false, fmt.Errorf("failed to unmarshal public key: %w", err)
     }
 
-    valid := ds.scheme.Verify(publicKey, content, signature, nil)
+    valid := ds.scheme.Verify(publicKey, message, signature, nil)
     return valid, nil
 }
 
@@ -104,7 +151,7 @@ func (ds *DilithiumSigner) SaveKeys(publicKeyBytes, privateKeyBytes []byte, pubK
         return fmt.Errorf("failed to save public key: %w", err)
     }
     
-    if err := os.WriteFile(privKeyPath, privateKeyBytes, 0644); err != nil {
+    if err := os.WriteFile(privKeyPath, privateKeyBytes, 0600); err != nil {
         return fmt.Errorf("failed to save private key: %w", err)
     }
     
@@ -119,24 +166,49 @@ func (ds *DilithiumSigner) ExportPublicKey() ([]byte, error) {
     return ds.publicKey.MarshalBinary()
 }
 
-// ExportPrivateKey returns the binary representation of the private key
+// ExportPrivateKey returns a copy of the binary private key. The caller owns the
+// copy and should Wipe it after use.
 func (ds *DilithiumSigner) ExportPrivateKey() ([]byte, error) {
-    if ds.privateKey == nil {
+    var exported []byte
+    err := ds.privateKey.Use(func(packed []byte) error {
+        exported = append([]byte(nil), packed...)
+        return nil
+    })
+    if err != nil {
         return nil, fmt.Errorf("private key not available")
     }
-    return ds.privateKey.MarshalBinary()
+    return exported, nil
 }
 
-// LoadPrivateKey loads a private key from its binary representation
+// LoadPrivateKey loads a private key from its binary representation, along with the
+// public key derived from it. The bytes are copied into a Secret owned by the signer;
+// the caller keeps ownership of privateKeyBytes.
 func (ds *DilithiumSigner) LoadPrivateKey(privateKeyBytes []byte) error {
+    // Validate the encoding before taking a copy
     priv, err := ds.scheme.UnmarshalBinaryPrivateKey(privateKeyBytes)
     if err != nil {
         return fmt.Errorf("failed to unmarshal private key: %w", err)
     }
-    ds.privateKey = priv
+    ds.publicKey = priv.Public().(sign.PublicKey)
+    wipePrivateKey(priv)
+
+    ds.privateKey.Destroy()
+    ds.privateKey = NewSecret(len(privateKeyBytes))
+    copy(ds.privateKey.Bytes(), privateKeyBytes)
     return nil
 }
 
+// LoadPrivateKeyFile reads a private key file straight into locked memory
+func (ds *DilithiumSigner) LoadPrivateKeyFile(path string) error {
+    secret, err := ReadSecretFile(path)
+    if err != nil {
+        return err
+    }
+    defer secret.Destroy()
+
+    return secret.Use(ds.LoadPrivateKey)
+}
+
 // LoadPublicKey loads a public key from its binary representation
 func (ds *DilithiumSigner) LoadPublicKey(publicKeyBytes []byte) error {
     pub, err := ds.scheme.UnmarshalBinaryPublicKey(publicKeyBytes)
@@ -146,3 +218,18 @@ func (ds *DilithiumSigner) LoadPublicKey(publicKeyBytes []byte) error {
     ds.publicKey = pub
     return nil
 }
+
+// Close wipes the private key held by the signer, waiting for signatures in progress.
+// The signer can still verify signatures afterwards but cannot sign until a new key is
+// loaded.
+func (ds *DilithiumSigner) Close() error {
+    ds.privateKey.Destroy()
+    return nil
+}
+
+// wipePrivateKey zeroes an unpacked private key structure
+func wipePrivateKey(priv sign.PrivateKey) {
+    if k, ok := priv.(*mode2.PrivateKey); ok {
+        *k = mode2.PrivateKey{}
+    }
+}
@@ -0,0 +1,100 @@
+package crypto
+
+import (
+    "fmt"
+
+    "github.com/cloudflare/circl/kem/mlkem/mlkem768"
+    "golang.org/x/crypto/sha3"
+)
+
+// KEMKeyIDSize is the length of the identifier derived from a KEM public key
+const KEMKeyIDSize = 16
+
+// KEMCiphertextSize is the size of an ML-KEM-768 encapsulation
+const KEMCiphertextSize = mlkem768.CiphertextSize
+
+// kemScheme is the key encapsulation mechanism used for document recipients
+var kemScheme = mlkem768.Scheme()
+
+// GenerateKEMKeypair generates an ML-KEM-768 keypair for receiving encrypted documents
+func GenerateKEMKeypair() ([]byte, []byte, error) {
+    pub, priv, err := kemScheme.GenerateKeyPair()
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to generate ML-KEM keypair: %w", err)
+    }
+
+    pubBytes, err := pub.MarshalBinary()
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to marshal public key: %w", err)
+    }
+    privBytes, err := priv.MarshalBinary()
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+    }
+
+    return pubBytes, privBytes, nil
+}
+
+// IsKEMPublicKey reports whether key is an encoded ML-KEM-768 public key
+func IsKEMPublicKey(key []byte) bool {
+    if len(key) != kemScheme.PublicKeySize() {
+        return false
+    }
+    _, err := kemScheme.UnmarshalBinaryPublicKey(key)
+    return err == nil
+}
+
+// IsKEMPrivateKey reports whether key is an encoded ML-KEM-768 private key
+func IsKEMPrivateKey(key []byte) bool {
+    if len(key) != kemScheme.PrivateKeySize() {
+        return false
+    }
+    _, err := kemScheme.UnmarshalBinaryPrivateKey(key)
+    return err == nil
+}
+
+// KEMKeyID returns the identifier of a KEM public key: the first 16 bytes of its SHA3-256 hash
+func KEMKeyID(pub []byte) []byte {
+    sum := sha3.Sum256(pub)
+    return sum[:KEMKeyIDSize]
+}
+
+// KEMPublicKey returns the public key belonging to a KEM private key
+func KEMPublicKey(priv []byte) ([]byte, error) {
+    sk, err := kemScheme.UnmarshalBinaryPrivateKey(priv)
+    if err != nil {
+        return nil, fmt.Errorf("invalid ML-KEM private key: %w", err)
+    }
+    return sk.Public().MarshalBinary()
+}
+
+// KEMEncapsulate generates a shared secret for the holder of pub and returns it with
+// its encapsulation
+func KEMEncapsulate(pub []byte) ([]byte, []byte, error) {
+    pk, err := kemScheme.UnmarshalBinaryPublicKey(pub)
+    if err != nil {
+        return nil, nil, fmt.Errorf("invalid ML-KEM public key: %w", err)
+    }
+
+    ciphertext, sharedSecret, err := kemScheme.Encapsulate(pk)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to encapsulate key: %w", err)
+    }
+
+    return ciphertext, sharedSecret, nil
+}
+
+// KEMDecapsulate recovers the shared secret from an encapsulation
+func KEMDecapsulate(priv, ciphertext []byte) ([]byte, error) {
+    sk, err := kemScheme.UnmarshalBinaryPrivateKey(priv)
+    if err != nil {
+        return nil, fmt.Errorf("invalid ML-KEM private key: %w", err)
+    }
+
+    sharedSecret, err := kemScheme.Decapsulate(sk, ciphertext)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decapsulate key: %w", err)
+    }
+
+    return sharedSecret, nil
+}
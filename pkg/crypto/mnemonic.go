@@ -0,0 +1,139 @@
+package crypto
+
+import (
+    "crypto/hmac"
+    "crypto/sha512"
+    "encoding/binary"
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/cloudflare/circl/sign/dilithium/mode2"
+    "github.com/tyler-smith/go-bip39"
+)
+
+// DefaultDerivationPath is the path of the first signing key derived from a mnemonic.
+// All path components are hardened, following SLIP-0010 for non-EC keys.
+const DefaultDerivationPath = "m/44'/1108'/0'/0'/0'"
+
+// MnemonicEntropyBits is the entropy used for new mnemonics (256 bits = 24 words)
+const MnemonicEntropyBits = 256
+
+// masterKeyLabel domain-separates our derivation tree from BIP-32/SLIP-10 curves
+var masterKeyLabel = []byte("quantum-doc-verify dilithium seed")
+
+// HardenedOffset is added to an index to mark a hardened derivation path component
+const HardenedOffset = 0x80000000
+
+// NewMnemonic generates a new BIP-39 mnemonic phrase
+func NewMnemonic() (string, error) {
+    entropy, err := bip39.NewEntropy(MnemonicEntropyBits)
+    if err != nil {
+        return "", fmt.Errorf("failed to generate entropy: %w", err)
+    }
+
+    mnemonic, err := bip39.NewMnemonic(entropy)
+    if err != nil {
+        return "", fmt.Errorf("failed to create mnemonic: %w", err)
+    }
+
+    return mnemonic, nil
+}
+
+// MnemonicToSeed validates a mnemonic phrase and returns its 64-byte BIP-39 seed
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+    mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+
+    seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+    if err != nil {
+        return nil, fmt.Errorf("invalid mnemonic: %w", err)
+    }
+
+    return seed, nil
+}
+
+// ParseDerivationPath parses a path like m/44'/1108'/0'/0'/0' into hardened indexes.
+// Only hardened components are accepted since Dilithium keys have no public derivation.
+func ParseDerivationPath(path string) ([]uint32, error) {
+    parts := strings.Split(strings.TrimSpace(path), "/")
+    if len(parts) < 2 || parts[0] != "m" {
+        return nil, fmt.Errorf("invalid derivation path %q: must start with m/", path)
+    }
+
+    indexes := make([]uint32, 0, len(parts)-1)
+    for _, part := range parts[1:] {
+        if !strings.HasSuffix(part, "'") && !strings.HasSuffix(part, "h") {
+            return nil, fmt.Errorf("invalid derivation path %q: component %q is not hardened", path, part)
+        }
+
+        index, err := strconv.ParseUint(part[:len(part)-1], 10, 31)
+        if err != nil {
+            return nil, fmt.Errorf("invalid derivation path %q: %w", path, err)
+        }
+
+        indexes = append(indexes, uint32(index)+HardenedOffset)
+    }
+
+    return indexes, nil
+}
+
+// DerivationPathForIndex replaces the last component of a path with the given index
+func DerivationPathForIndex(path string, index uint32) (string, error) {
+    if _, err := ParseDerivationPath(path); err != nil {
+        return "", err
+    }
+
+    base := path[:strings.LastIndex(path, "/")]
+    return fmt.Sprintf("%s/%d'", base, index), nil
+}
+
+// DeriveDilithiumSeed derives a Dilithium key seed from a BIP-39 seed and a derivation path
+func DeriveDilithiumSeed(seed []byte, path string) (*[mode2.SeedSize]byte, error) {
+    indexes, err := ParseDerivationPath(path)
+    if err != nil {
+        return nil, err
+    }
+
+    // Master node: I = HMAC-SHA512(label, seed), key = I[:32], chain code = I[32:]
+    mac := hmac.New(sha512.New, masterKeyLabel)
+    mac.Write(seed)
+    node := mac.Sum(nil)
+
+    // Hardened child: I = HMAC-SHA512(chain code, 0x00 || key || index)
+    for _, index := range indexes {
+        var data [37]byte
+        copy(data[1:33], node[:32])
+        binary.BigEndian.PutUint32(data[33:], index)
+
+        mac = hmac.New(sha512.New, node[32:])
+        mac.Write(data[:])
+        Wipe(node)
+        node = mac.Sum(nil)
+        Wipe(data[:])
+    }
+
+    var keySeed [mode2.SeedSize]byte
+    copy(keySeed[:], node[:32])
+    Wipe(node)
+
+    return &keySeed, nil
+}
+
+// GenerateKeypairFromMnemonic deterministically derives the keypair at the given path.
+// The same mnemonic, passphrase and path always recreate an identical keypair.
+func (ds *DilithiumSigner) GenerateKeypairFromMnemonic(mnemonic, passphrase, path string) ([]byte, []byte, error) {
+    seed, err := MnemonicToSeed(mnemonic, passphrase)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer Wipe(seed)
+
+    keySeed, err := DeriveDilithiumSeed(seed, path)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer Wipe(keySeed[:])
+
+    pub, priv := mode2.NewKeyFromSeed(keySeed)
+    return ds.setKeypair(pub, priv)
+}
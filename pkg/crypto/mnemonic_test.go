@@ -0,0 +1,52 @@
+package crypto
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestMnemonicKeyRecovery(t *testing.T) {
+    mnemonic, err := NewMnemonic()
+    if err != nil {
+        t.Fatalf("Failed to generate mnemonic: %v", err)
+    }
+
+    pub1, priv1, err := NewDilithiumSigner().GenerateKeypairFromMnemonic(mnemonic, "", DefaultDerivationPath)
+    if err != nil {
+        t.Fatalf("Key derivation failed: %v", err)
+    }
+
+    // Recovering from the same phrase must yield the identical keypair
+    pub2, priv2, err := NewDilithiumSigner().GenerateKeypairFromMnemonic(mnemonic, "", DefaultDerivationPath)
+    if err != nil {
+        t.Fatalf("Key recovery failed: %v", err)
+    }
+    if !bytes.Equal(pub1, pub2) || !bytes.Equal(priv1, priv2) {
+        t.Fatalf("Recovered keypair does not match the original")
+    }
+
+    // A different index or passphrase must yield a different keypair
+    nextPath, err := DerivationPathForIndex(DefaultDerivationPath, 1)
+    if err != nil {
+        t.Fatalf("Failed to build derivation path: %v", err)
+    }
+    pub3, _, err := NewDilithiumSigner().GenerateKeypairFromMnemonic(mnemonic, "", nextPath)
+    if err != nil {
+        t.Fatalf("Key derivation failed: %v", err)
+    }
+    pub4, _, err := NewDilithiumSigner().GenerateKeypairFromMnemonic(mnemonic, "secret", DefaultDerivationPath)
+    if err != nil {
+        t.Fatalf("Key derivation failed: %v", err)
+    }
+    if bytes.Equal(pub1, pub3) || bytes.Equal(pub1, pub4) {
+        t.Fatalf("Distinct derivation inputs produced the same key")
+    }
+
+    // Unhardened paths and invalid phrases are rejected
+    if _, err := ParseDerivationPath("m/44'/0"); err == nil {
+        t.Fatalf("Expected unhardened path to be rejected")
+    }
+    if _, _, err := NewDilithiumSigner().GenerateKeypairFromMnemonic("not a valid phrase", "", DefaultDerivationPath); err == nil {
+        t.Fatalf("Expected invalid mnemonic to be rejected")
+    }
+}
@@ -0,0 +1,150 @@
+package crypto
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+)
+
+// ErrSecretDestroyed is returned by Use once the secret has been destroyed
+var ErrSecretDestroyed = errors.New("secret has been destroyed")
+
+// Secret holds sensitive key material outside the garbage-collected heap where the
+// platform allows it. The memory is locked against swapping (mlock) when possible and
+// is overwritten with zeros when Destroy is called.
+type Secret struct {
+    mu        sync.Mutex
+    buf       []byte
+    locked    bool
+    mapped    bool
+    destroyed bool
+}
+
+// NewSecret allocates a zeroed secret buffer of the given size
+func NewSecret(size int) *Secret {
+    s := &Secret{}
+    if size <= 0 {
+        s.buf = []byte{}
+        return s
+    }
+
+    buf, mapped := allocSecret(size)
+    s.buf = buf
+    s.mapped = mapped
+    s.locked = lockSecret(buf)
+    return s
+}
+
+// NewSecretFromBytes moves b into a new Secret and wipes b
+func NewSecretFromBytes(b []byte) *Secret {
+    s := NewSecret(len(b))
+    copy(s.buf, b)
+    Wipe(b)
+    return s
+}
+
+// ReadSecretFile reads a key file directly into a Secret without intermediate copies
+func ReadSecretFile(path string) (*Secret, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open key file: %w", err)
+    }
+    defer f.Close()
+
+    info, err := f.Stat()
+    if err != nil {
+        return nil, fmt.Errorf("failed to stat key file: %w", err)
+    }
+
+    s := NewSecret(int(info.Size()))
+    if _, err := io.ReadFull(f, s.buf); err != nil {
+        s.Destroy()
+        return nil, fmt.Errorf("failed to read key file: %w", err)
+    }
+
+    return s, nil
+}
+
+// Bytes returns the secret's backing buffer. The slice must not be retained after
+// Destroy and returns nil once the secret has been destroyed. Use Use instead when the
+// secret may be destroyed concurrently.
+func (s *Secret) Bytes() []byte {
+    if s == nil {
+        return nil
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.destroyed {
+        return nil
+    }
+    return s.buf
+}
+
+// Use calls fn with the secret's backing buffer, holding the secret so that it cannot be
+// destroyed while fn runs. fn must not retain the slice. Once the secret has been
+// destroyed, Use returns ErrSecretDestroyed without calling fn.
+func (s *Secret) Use(fn func([]byte) error) error {
+    if s == nil {
+        return ErrSecretDestroyed
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.destroyed {
+        return ErrSecretDestroyed
+    }
+    return fn(s.buf)
+}
+
+// Len returns the size of the secret in bytes
+func (s *Secret) Len() int {
+    if s == nil {
+        return 0
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return len(s.buf)
+}
+
+// Locked reports whether the secret's pages are locked in memory
+func (s *Secret) Locked() bool {
+    if s == nil {
+        return false
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.locked
+}
+
+// Destroy wipes the secret, unlocks and releases its memory. It is safe to call more than once.
+func (s *Secret) Destroy() {
+    if s == nil {
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.destroyed {
+        return
+    }
+
+    Wipe(s.buf)
+    if s.locked {
+        unlockSecret(s.buf)
+    }
+    if s.mapped {
+        freeSecret(s.buf)
+    }
+
+    s.buf = nil
+    s.locked = false
+    s.destroyed = true
+}
+
+// Wipe overwrites a byte slice with zeros
+func Wipe(b []byte) {
+    for i := range b {
+        b[i] = 0
+    }
+}
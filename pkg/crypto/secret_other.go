@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package crypto
+
+// allocSecret falls back to heap memory on platforms without mmap support
+func allocSecret(size int) ([]byte, bool) {
+    return make([]byte, size), false
+}
+
+func freeSecret(buf []byte) {}
+
+// lockSecret is a no-op where mlock is unavailable
+func lockSecret(buf []byte) bool {
+    return false
+}
+
+func unlockSecret(buf []byte) {}
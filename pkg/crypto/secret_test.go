@@ -0,0 +1,95 @@
+package crypto
+
+import (
+    "bytes"
+    "errors"
+    "sync"
+    "testing"
+)
+
+func TestSecretDestroyWipesMemory(t *testing.T) {
+    source := []byte("super secret key material")
+    original := append([]byte(nil), source...)
+
+    secret := NewSecretFromBytes(source)
+    if !bytes.Equal(secret.Bytes(), original) {
+        t.Fatalf("Secret does not hold the original bytes")
+    }
+    if !bytes.Equal(source, make([]byte, len(source))) {
+        t.Fatalf("Source slice was not wiped")
+    }
+
+    secret.Destroy()
+    secret.Destroy() // must be idempotent
+    if secret.Bytes() != nil {
+        t.Fatalf("Destroyed secret still exposes its buffer")
+    }
+}
+
+func TestSignerCloseDropsPrivateKey(t *testing.T) {
+    signer := NewDilithiumSigner()
+    pubKey, privKey, err := signer.GenerateKeypair()
+    if err != nil {
+        t.Fatalf("Failed to generate keypair: %v", err)
+    }
+    Wipe(privKey)
+
+    message := []byte("document")
+    signature, err := signer.Sign(message)
+    if err != nil {
+        t.Fatalf("Signing failed: %v", err)
+    }
+    publicKey, err := signer.scheme.UnmarshalBinaryPublicKey(pubKey)
+    if err != nil {
+        t.Fatalf("Failed to load public key: %v", err)
+    }
+    if !signer.scheme.Verify(publicKey, message, signature, nil) {
+        t.Fatalf("Signature does not verify")
+    }
+
+    signer.Close()
+    if _, err := signer.Sign(message); err == nil {
+        t.Fatalf("Expected signing to fail after Close")
+    }
+}
+
+func TestSecretUseHoldsBuffer(t *testing.T) {
+    secret := NewSecretFromBytes([]byte("key"))
+    if err := secret.Use(func(b []byte) error {
+        if string(b) != "key" {
+            t.Fatalf("Use passed %q", b)
+        }
+        return nil
+    }); err != nil {
+        t.Fatalf("Use failed: %v", err)
+    }
+
+    secret.Destroy()
+    if err := secret.Use(func([]byte) error {
+        t.Fatalf("Use called fn after Destroy")
+        return nil
+    }); !errors.Is(err, ErrSecretDestroyed) {
+        t.Fatalf("Expected ErrSecretDestroyed, got %v", err)
+    }
+
+    // Signing while the signer is closed either succeeds or fails cleanly
+    signer := NewDilithiumSigner()
+    if _, privKey, err := signer.GenerateKeypair(); err != nil {
+        t.Fatalf("Failed to generate keypair: %v", err)
+    } else {
+        Wipe(privKey)
+    }
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            signer.Sign([]byte("document"))
+        }()
+    }
+    signer.Close()
+    wg.Wait()
+    if _, err := signer.Sign([]byte("document")); err == nil {
+        t.Fatalf("Expected signing to fail after Close")
+    }
+}
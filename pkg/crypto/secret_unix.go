@@ -0,0 +1,33 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package crypto
+
+import (
+    "golang.org/x/sys/unix"
+)
+
+// allocSecret maps anonymous pages for the secret so it never shares a page with
+// unrelated heap objects and is not moved or copied by the runtime
+func allocSecret(size int) ([]byte, bool) {
+    buf, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+    if err != nil {
+        return make([]byte, size), false
+    }
+    return buf, true
+}
+
+// freeSecret unmaps pages obtained from allocSecret
+func freeSecret(buf []byte) {
+    unix.Munmap(buf)
+}
+
+// lockSecret prevents the pages from being swapped to disk. Failure (e.g. RLIMIT_MEMLOCK)
+// is not fatal; the secret is still wiped on Destroy.
+func lockSecret(buf []byte) bool {
+    return unix.Mlock(buf) == nil
+}
+
+// unlockSecret releases a lock taken by lockSecret
+func unlockSecret(buf []byte) {
+    unix.Munlock(buf)
+}
@@ -0,0 +1,117 @@
+package crypto
+
+import (
+    "crypto/rand"
+    "fmt"
+    "io"
+)
+
+// MaxShares is the largest number of shares a secret can be split into: each share is
+// evaluated at a distinct non-zero point of GF(256)
+const MaxShares = 255
+
+// SplitSecret splits secret into n shares with Shamir's scheme over GF(256), so that any
+// threshold of them reconstruct it and fewer reveal nothing about it. Each share is the
+// evaluation point (one byte) followed by one byte per byte of the secret.
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+    if len(secret) == 0 {
+        return nil, fmt.Errorf("secret is empty")
+    }
+    if n < 1 || n > MaxShares {
+        return nil, fmt.Errorf("number of shares must be between 1 and %d, got %d", MaxShares, n)
+    }
+    if threshold < 1 || threshold > n {
+        return nil, fmt.Errorf("threshold must be between 1 and the number of shares (%d), got %d", n, threshold)
+    }
+
+    shares := make([][]byte, n)
+    for i := range shares {
+        shares[i] = make([]byte, 1+len(secret))
+        shares[i][0] = byte(i + 1)
+    }
+
+    // One random polynomial of degree threshold-1 per secret byte, with the byte as its
+    // constant term
+    coefficients := make([]byte, threshold)
+    defer Wipe(coefficients)
+    for j, b := range secret {
+        coefficients[0] = b
+        if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+            return nil, fmt.Errorf("failed to generate share polynomial: %w", err)
+        }
+        for _, share := range shares {
+            share[1+j] = evaluatePolynomial(coefficients, share[0])
+        }
+    }
+    return shares, nil
+}
+
+// CombineShares reconstructs a secret from at least threshold of its shares by Lagrange
+// interpolation at zero. Shares from different secrets, or too few of them, produce a
+// wrong secret rather than an error, so callers must authenticate the result.
+func CombineShares(shares [][]byte) ([]byte, error) {
+    if len(shares) == 0 {
+        return nil, fmt.Errorf("no shares to combine")
+    }
+    size := len(shares[0])
+    if size < 2 {
+        return nil, fmt.Errorf("malformed share")
+    }
+    seen := make(map[byte]bool)
+    for _, share := range shares {
+        if len(share) != size {
+            return nil, fmt.Errorf("shares have different lengths")
+        }
+        if share[0] == 0 || seen[share[0]] {
+            return nil, fmt.Errorf("shares must have distinct non-zero indexes")
+        }
+        seen[share[0]] = true
+    }
+
+    secret := make([]byte, size-1)
+    for i, share := range shares {
+        // Lagrange basis polynomial for this share, evaluated at zero
+        basis := byte(1)
+        for j, other := range shares {
+            if i != j {
+                basis = gfMul(basis, gfMul(other[0], gfInverse(other[0]^share[0])))
+            }
+        }
+        for k := range secret {
+            secret[k] ^= gfMul(basis, share[1+k])
+        }
+    }
+    return secret, nil
+}
+
+// evaluatePolynomial evaluates the polynomial with the given coefficients (constant term
+// first) at x by Horner's rule
+func evaluatePolynomial(coefficients []byte, x byte) byte {
+    var y byte
+    for i := len(coefficients) - 1; i >= 0; i-- {
+        y = gfMul(y, x) ^ coefficients[i]
+    }
+    return y
+}
+
+// gfMul multiplies in GF(256) with the AES polynomial, without data-dependent branches
+// or table lookups
+func gfMul(a, b byte) byte {
+    var product byte
+    for i := 0; i < 8; i++ {
+        product ^= -(b & 1) & a
+        b >>= 1
+        a = (a << 1) ^ (-(a >> 7) & 0x1b)
+    }
+    return product
+}
+
+// gfInverse returns the multiplicative inverse of a non-zero element as a^254
+func gfInverse(a byte) byte {
+    result := byte(1)
+    for i := 0; i < 7; i++ {
+        a = gfMul(a, a)
+        result = gfMul(result, a)
+    }
+    return result
+}
@@ -0,0 +1,46 @@
+package crypto
+
+import (
+    "bytes"
+    "testing"
+)
+
+func TestShamirSecretSharing(t *testing.T) {
+    for a := 1; a < 256; a++ {
+        if gfMul(byte(a), gfInverse(byte(a))) != 1 {
+            t.Fatalf("Inverse of %d is wrong", a)
+        }
+    }
+
+    secret := []byte("0123456789abcdef0123456789abcdef")
+    shares, err := SplitSecret(secret, 5, 3)
+    if err != nil {
+        t.Fatalf("SplitSecret failed: %v", err)
+    }
+
+    // Any three shares, in any order, reconstruct the secret
+    for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+        var picked [][]byte
+        for _, i := range subset {
+            picked = append(picked, shares[i])
+        }
+        combined, err := CombineShares(picked)
+        if err != nil {
+            t.Fatalf("CombineShares(%v) failed: %v", subset, err)
+        }
+        if !bytes.Equal(combined, secret) {
+            t.Fatalf("Shares %v reconstruct the wrong secret", subset)
+        }
+    }
+
+    // Two shares are not enough
+    if combined, _ := CombineShares(shares[:2]); bytes.Equal(combined, secret) {
+        t.Fatalf("Two shares reconstructed a threshold-3 secret")
+    }
+    if _, err := CombineShares([][]byte{shares[0], shares[0], shares[1]}); err == nil {
+        t.Fatalf("Expected duplicate shares to be rejected")
+    }
+    if _, err := SplitSecret(secret, 3, 4); err == nil {
+        t.Fatalf("Expected a threshold above the number of shares to be rejected")
+    }
+}
@@ -0,0 +1,41 @@
+package crypto
+
+import (
+    "crypto/rand"
+    "fmt"
+    "io"
+
+    "golang.org/x/crypto/sha3"
+)
+
+// TenantKeySize is the size of a tenant secret used for convergent encryption
+const TenantKeySize = 32
+
+// TenantKeyIDSize is the length of the identifier derived from a tenant secret
+const TenantKeyIDSize = 16
+
+// tenantKeyIDPrefix domain-separates tenant key IDs from other hashes of the secret
+var tenantKeyIDPrefix = []byte("quantum-doc-verify tenant key id")
+
+// GenerateTenantKey generates a tenant secret. Documents encrypted in convergent mode
+// under the same tenant secret dedupe to the same ciphertext.
+func GenerateTenantKey() ([]byte, error) {
+    key := make([]byte, TenantKeySize)
+    if _, err := io.ReadFull(rand.Reader, key); err != nil {
+        return nil, fmt.Errorf("failed to generate tenant key: %w", err)
+    }
+    return key, nil
+}
+
+// IsTenantKey reports whether key has the size of a tenant secret
+func IsTenantKey(key []byte) bool {
+    return len(key) == TenantKeySize
+}
+
+// TenantKeyID returns the public identifier of a tenant secret
+func TenantKeyID(key []byte) []byte {
+    h := sha3.New256()
+    h.Write(tenantKeyIDPrefix)
+    h.Write(key)
+    return h.Sum(nil)[:TenantKeyIDSize]
+}
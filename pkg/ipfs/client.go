@@ -2,6 +2,7 @@ package ipfs
 
 import (
     "bytes"
+    "context"
     "crypto/aes"
     "crypto/cipher"
     "crypto/rand"
@@ -9,22 +10,31 @@ import (
     "encoding/hex"
     "fmt"
     "io"
-    "io/ioutil"
     "os"
 
-    shell "github.com/ipfs/go-ipfs-api"
+    "quantum-doc-verify/pkg/storage"
 )
 
-// IPFSClient handles interactions with IPFS
+// IPFSClient handles interactions with IPFS.
+// Content is stored and retrieved through a storage.DocumentStore; the node is only used
+// directly for pinning. Every call is bounded by its context, and failures are typed as
+// storage.ErrNotFound, storage.ErrTimeout or storage.ErrUnavailable.
 type IPFSClient struct {
-    shell *shell.Shell
+    node  *storage.IPFSClient
+    store storage.DocumentStore
 }
 
 // NewIPFSClient creates a new IPFS client
 func NewIPFSClient(apiURL string) *IPFSClient {
-    return &IPFSClient{
-        shell: shell.NewShell(apiURL),
-    }
+    node, _ := storage.NewIPFSClient(apiURL)
+    return &IPFSClient{node: node, store: node}
+}
+
+// NewIPFSClientWithStore creates a client that stores content in the given backend.
+// Wrap the backend with storage.WithCache to serve repeated Cat calls from disk.
+func NewIPFSClientWithStore(apiURL string, store storage.DocumentStore) *IPFSClient {
+    node, _ := storage.NewIPFSClient(apiURL)
+    return &IPFSClient{node: node, store: store}
 }
 
 // EncryptDocument encrypts a document using AES-256-GCM
@@ -91,7 +101,7 @@ func DecryptDocument(ciphertext []byte, password []byte) ([]byte, error) {
 }
 
 // StoreDocument stores an encrypted document on IPFS
-func (ic *IPFSClient) StoreDocument(documentPath string, password []byte) (string, error) {
+func (ic *IPFSClient) StoreDocument(ctx context.Context, documentPath string, password []byte) (string, error) {
     // Read the document
     document, err := os.ReadFile(documentPath)
     if err != nil {
@@ -105,27 +115,15 @@ func (ic *IPFSClient) StoreDocument(documentPath string, password []byte) (strin
     }
     
     // Store on IPFS
-    cid, err := ic.shell.Add(bytes.NewReader(encryptedDoc))
-    if err != nil {
-        return "", fmt.Errorf("failed to store on IPFS: %w", err)
-    }
-    
-    return cid, nil
+    return ic.Add(ctx, encryptedDoc)
 }
 
 // RetrieveDocument retrieves and decrypts a document from IPFS
-func (ic *IPFSClient) RetrieveDocument(cid string, password []byte, outputPath string) error {
+func (ic *IPFSClient) RetrieveDocument(ctx context.Context, cid string, password []byte, outputPath string) error {
     // Get the encrypted document from IPFS
-    reader, err := ic.shell.Cat(cid)
-    if err != nil {
-        return fmt.Errorf("failed to retrieve from IPFS: %w", err)
-    }
-    defer reader.Close()
-    
-    // Read the encrypted data
-    encryptedDoc, err := ioutil.ReadAll(reader)
+    encryptedDoc, err := ic.Cat(ctx, cid)
     if err != nil {
-        return fmt.Errorf("failed to read from IPFS: %w", err)
+        return err
     }
     
     // Decrypt the document
@@ -151,9 +149,10 @@ func (ic *IPFSClient) GetDocumentHash(cid string) (string, error) {
     return hex.EncodeToString(hash[:]), nil
 }
 
-// PinDocument pins a document to ensure it remains on IPFS
-func (ic *IPFSClient) PinDocument(cid string) error {
-    err := ic.shell.Pin(cid)
+// PinDocument pins a document on the local node. Use pkg/pinning to replicate it to
+// remote pinning services.
+func (ic *IPFSClient) PinDocument(ctx context.Context, cid string) error {
+    err := ic.node.Pin(ctx, cid)
     if err != nil {
         return fmt.Errorf("failed to pin document: %w", err)
     }
@@ -161,9 +160,9 @@ func (ic *IPFSClient) PinDocument(cid string) error {
 }
 
 // Add uploads raw bytes to IPFS and returns the CID
-func (ic *IPFSClient) Add(data []byte) (string, error) {
+func (ic *IPFSClient) Add(ctx context.Context, data []byte) (string, error) {
     // Upload to IPFS
-    cid, err := ic.shell.Add(bytes.NewReader(data))
+    cid, err := ic.store.Put(ctx, bytes.NewReader(data), storage.StoreOptions{Size: int64(len(data))})
     if err != nil {
         return "", fmt.Errorf("failed to store on IPFS: %w", err)
     }
@@ -172,9 +171,9 @@ func (ic *IPFSClient) Add(data []byte) (string, error) {
 }
 
 // Cat retrieves raw bytes from IPFS by CID
-func (ic *IPFSClient) Cat(cid string) ([]byte, error) {
+func (ic *IPFSClient) Cat(ctx context.Context, cid string) ([]byte, error) {
     // Get the data from IPFS
-    reader, err := ic.shell.Cat(cid)
+    reader, err := ic.store.Get(ctx, cid)
     if err != nil {
         return nil, fmt.Errorf("failed to retrieve from IPFS: %w", err)
     }
@@ -192,32 +191,60 @@ func (ic *IPFSClient) Cat(cid string) ([]byte, error) {
 // Client defines an interface for IPFS operations
 type Client interface {
     // UploadFile uploads a file to IPFS and returns its CID
-    UploadFile(filePath string) (cid string, err error)
+    UploadFile(ctx context.Context, filePath string) (cid string, err error)
     
     // DownloadFile downloads a file from IPFS by its CID
-    DownloadFile(cid string, outputPath string) error
+    DownloadFile(ctx context.Context, cid string, outputPath string) error
 }
 
-// NewClient creates a new IPFS client
+// NewClient creates a new IPFS client backed by the document store at nodeAddr.
+// nodeAddr accepts any URL understood by storage.Open.
 func NewClient(nodeAddr string) (Client, error) {
-    // Implement using your existing IPFS code
+    store, err := storage.Open(nodeAddr)
+    if err != nil {
+        return nil, err
+    }
+
     return &ipfsClient{
-        nodeAddr: nodeAddr,
+        store: store,
     }, nil
 }
 
 // Implementation of ipfsClient
 type ipfsClient struct {
-    nodeAddr string
+    store storage.DocumentStore
 }
 
-func (c *ipfsClient) UploadFile(filePath string) (string, error) {
-    // Call your existing IPFS code to upload a file
-    // You can execute a command using exec.Command to run your IPFS binary
-    return "QmSampleCID", nil // Example implementation
+func (c *ipfsClient) UploadFile(ctx context.Context, filePath string) (string, error) {
+    file, err := os.Open(filePath)
+    if err != nil {
+        return "", fmt.Errorf("failed to read document: %w", err)
+    }
+    defer file.Close()
+
+    info, err := file.Stat()
+    if err != nil {
+        return "", fmt.Errorf("failed to read document: %w", err)
+    }
+
+    return c.store.Put(ctx, file, storage.StoreOptions{Size: info.Size()})
 }
 
-func (c *ipfsClient) DownloadFile(cid string, outputPath string) error {
-    // Call your existing IPFS code to download a file
-    return nil // Example implementation
-}
\ No newline at end of file
+func (c *ipfsClient) DownloadFile(ctx context.Context, cid string, outputPath string) error {
+    reader, err := c.store.Get(ctx, cid)
+    if err != nil {
+        return fmt.Errorf("failed to retrieve from IPFS: %w", err)
+    }
+    defer reader.Close()
+
+    out, err := os.Create(outputPath)
+    if err != nil {
+        return fmt.Errorf("failed to write output file: %w", err)
+    }
+
+    if _, err := io.Copy(out, reader); err != nil {
+        out.Close()
+        return fmt.Errorf("failed to write output file: %w", err)
+    }
+    return out.Close()
+}
@@ -0,0 +1,512 @@
+// Package ipfstest provides an in-memory IPFS node that serves the subset of the Kubo
+// RPC API used by this project, for tests and offline demos
+package ipfstest
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "runtime"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+
+    "quantum-doc-verify/pkg/car"
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// Pin types, as reported by "ipfs pin ls"
+const (
+    PinRecursive = "recursive"
+    PinDirect    = "direct"
+    PinIndirect  = "indirect"
+)
+
+// supportedHashes are the hash functions accepted by add and block put, by Kubo name
+var supportedHashes = map[string]uint64{
+    "sha2-256": multihash.SHA2_256,
+    "sha3-256": multihash.SHA3_256,
+}
+
+// Node is an in-memory IPFS node. It imports files with the same chunking and DAG
+// layout as Kubo, so the CIDs it returns are the ones a real node would, and it serves
+// the add, cat, pin, block, repo/gc and version commands under /api/v0. Content is
+// never fetched from a network: anything not added to the node is not found.
+type Node struct {
+    mux *http.ServeMux
+
+    mu     sync.Mutex
+    blocks map[string]block // by multihash, as in Kubo's blockstore
+    pins   map[string]pin   // by CID
+}
+
+type block struct {
+    cid  cid.Cid
+    data []byte
+}
+
+type pin struct {
+    cid       cid.Cid
+    recursive bool
+}
+
+// NewNode creates an empty node. Serve it with http.ListenAndServe, or use NewServer
+// in tests.
+func NewNode() *Node {
+    n := &Node{
+        mux:    http.NewServeMux(),
+        blocks: make(map[string]block),
+        pins:   make(map[string]pin),
+    }
+
+    n.mux.HandleFunc("POST /api/v0/add", n.handleAdd)
+    n.mux.HandleFunc("POST /api/v0/cat", n.handleCat)
+    n.mux.HandleFunc("POST /api/v0/dag/export", n.handleDagExport)
+    n.mux.HandleFunc("POST /api/v0/pin/add", n.handlePinAdd)
+    n.mux.HandleFunc("POST /api/v0/pin/ls", n.handlePinList)
+    n.mux.HandleFunc("POST /api/v0/pin/rm", n.handlePinRemove)
+    n.mux.HandleFunc("POST /api/v0/block/put", n.handleBlockPut)
+    n.mux.HandleFunc("POST /api/v0/block/get", n.handleBlockGet)
+    n.mux.HandleFunc("POST /api/v0/repo/gc", n.handleGC)
+    n.mux.HandleFunc("POST /api/v0/version", n.handleVersion)
+    return n
+}
+
+// ServeHTTP implements http.Handler
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    n.mux.ServeHTTP(w, r)
+}
+
+// Server is a Node served by an httptest.Server
+type Server struct {
+    *httptest.Server
+    *Node
+}
+
+// NewServer starts a node on a local port. Close the server when done.
+func NewServer() *Server {
+    node := NewNode()
+    return &Server{Server: httptest.NewServer(node), Node: node}
+}
+
+// Addr returns the host:port of the API, as accepted by storage.NewIPFSClient
+func (s *Server) Addr() string {
+    return s.Listener.Addr().String()
+}
+
+// Has reports whether the node holds the block c
+func (n *Node) Has(c string) bool {
+    parsed, err := cid.Decode(c)
+    if err != nil {
+        return false
+    }
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    _, ok := n.blocks[string(parsed.Hash())]
+    return ok
+}
+
+// Pinned reports whether c is pinned, directly or recursively
+func (n *Node) Pinned(c string) bool {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    _, ok := n.pins[c]
+    return ok
+}
+
+func (n *Node) handleAdd(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    cidVersion := 0
+    if v := query.Get("cid-version"); v != "" {
+        var err error
+        if cidVersion, err = strconv.Atoi(v); err != nil || (cidVersion != 0 && cidVersion != 1) {
+            writeError(w, http.StatusBadRequest, "unsupported CID version %q", v)
+            return
+        }
+    }
+    opts := unixfs.DefaultOptions(cidVersion)
+    if v := query.Get("raw-leaves"); v != "" {
+        opts.RawLeaves = v == "true"
+    }
+    if chunker := query.Get("chunker"); chunker != "" {
+        size, err := strconv.Atoi(strings.TrimPrefix(chunker, "size-"))
+        if !strings.HasPrefix(chunker, "size-") || err != nil || size <= 0 {
+            writeError(w, http.StatusBadRequest, "unsupported chunker %q: only size-N is implemented", chunker)
+            return
+        }
+        opts.ChunkSize = size
+    }
+    if name := query.Get("hash"); name != "" {
+        code, ok := supportedHashes[name]
+        if !ok || (cidVersion == 0 && code != multihash.SHA2_256) {
+            writeError(w, http.StatusBadRequest, "unsupported hash function %q", name)
+            return
+        }
+        opts.HashFunction = code
+    }
+
+    file, name, err := formFile(r)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "%v", err)
+        return
+    }
+
+    // Keep the blocks aside until the whole file is read, so a failed upload adds nothing
+    var added []block
+    opts.OnBlock = func(c cid.Cid, data []byte) error {
+        added = append(added, block{cid: c, data: append([]byte(nil), data...)})
+        return nil
+    }
+    builder := unixfs.NewBuilder(opts)
+    if _, err := io.Copy(builder, file); err != nil {
+        writeError(w, http.StatusInternalServerError, "failed to read file: %v", err)
+        return
+    }
+    root, err := builder.Sum()
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "%v", err)
+        return
+    }
+
+    n.mu.Lock()
+    for _, b := range added {
+        n.blocks[string(b.cid.Hash())] = b
+    }
+    if query.Get("pin") != "false" {
+        n.pins[root.String()] = pin{cid: root, recursive: true}
+    }
+    n.mu.Unlock()
+
+    writeJSON(w, map[string]string{
+        "Name": name,
+        "Hash": root.String(),
+        "Size": strconv.FormatUint(builder.DagSize(), 10),
+    })
+}
+
+func (n *Node) handleCat(w http.ResponseWriter, r *http.Request) {
+    root, ok := cidArg(w, r)
+    if !ok {
+        return
+    }
+
+    // Read the first block before answering, so a missing or non-file root is an error
+    reader := unixfs.NewFileReader(root, n.getBlock)
+    buf := make([]byte, 32*1024)
+    count, err := reader.Read(buf)
+    if err != nil && err != io.EOF {
+        writeError(w, http.StatusInternalServerError, "%v", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/octet-stream")
+    w.Write(buf[:count])
+    if err == nil {
+        io.CopyBuffer(w, reader, buf)
+    }
+}
+
+// handleDagExport writes the DAG under the root as a CARv1, parents before children and
+// each block once, as Kubo does
+func (n *Node) handleDagExport(w http.ResponseWriter, r *http.Request) {
+    root, ok := cidArg(w, r)
+    if !ok {
+        return
+    }
+    if _, err := n.getBlock(root); err != nil {
+        writeError(w, http.StatusInternalServerError, "%v", err)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/vnd.ipld.car")
+    writer, err := car.NewWriter(w, []cid.Cid{root})
+    if err != nil {
+        return
+    }
+    // A block missing below the root truncates the archive, which the client detects
+    unixfs.Walk(root, n.getBlock, writer.Put)
+}
+
+func (n *Node) handlePinAdd(w http.ResponseWriter, r *http.Request) {
+    root, ok := cidArg(w, r)
+    if !ok {
+        return
+    }
+    recursive := r.URL.Query().Get("recursive") != "false"
+
+    // Pinning requires the content, which an offline node cannot fetch
+    var err error
+    if recursive {
+        err = unixfs.Walk(root, n.getBlock, func(cid.Cid, []byte) error { return nil })
+    } else {
+        _, err = n.getBlock(root)
+    }
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "pin: %v", err)
+        return
+    }
+
+    n.mu.Lock()
+    if existing, ok := n.pins[root.String()]; !ok || !existing.recursive {
+        n.pins[root.String()] = pin{cid: root, recursive: recursive}
+    }
+    n.mu.Unlock()
+
+    writeJSON(w, map[string][]string{"Pins": {root.String()}})
+}
+
+func (n *Node) handlePinList(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    pinType := query.Get("type")
+    if pinType == "" {
+        pinType = "all"
+    }
+
+    n.mu.Lock()
+    defer n.mu.Unlock()
+
+    keys := make(map[string]map[string]string)
+    for key, p := range n.pins {
+        t := PinDirect
+        if p.recursive {
+            t = PinRecursive
+        }
+        if pinType == "all" || pinType == t {
+            keys[key] = map[string]string{"Type": t}
+        }
+    }
+    if pinType == "all" || pinType == PinIndirect {
+        for _, c := range n.indirect() {
+            if _, ok := keys[c.String()]; !ok {
+                keys[c.String()] = map[string]string{"Type": PinIndirect}
+            }
+        }
+    }
+
+    if args := query["arg"]; len(args) > 0 {
+        selected := make(map[string]map[string]string)
+        for _, arg := range args {
+            entry, ok := keys[arg]
+            if !ok {
+                writeError(w, http.StatusInternalServerError, "path '%s' is not pinned", arg)
+                return
+            }
+            selected[arg] = entry
+        }
+        keys = selected
+    }
+    writeJSON(w, map[string]interface{}{"Keys": keys})
+}
+
+func (n *Node) handlePinRemove(w http.ResponseWriter, r *http.Request) {
+    root, ok := cidArg(w, r)
+    if !ok {
+        return
+    }
+    recursive := r.URL.Query().Get("recursive") != "false"
+
+    n.mu.Lock()
+    p, pinned := n.pins[root.String()]
+    if pinned && p.recursive == recursive {
+        delete(n.pins, root.String())
+    }
+    n.mu.Unlock()
+
+    switch {
+    case !pinned:
+        writeError(w, http.StatusInternalServerError, "not pinned or pinned indirectly")
+    case p.recursive && !recursive:
+        writeError(w, http.StatusInternalServerError, "%s is pinned recursively", root)
+    case !p.recursive && recursive:
+        writeError(w, http.StatusInternalServerError, "%s is not pinned recursively", root)
+    default:
+        writeJSON(w, map[string][]string{"Pins": {root.String()}})
+    }
+}
+
+func (n *Node) handleBlockPut(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    codecs := map[string]uint64{"": cid.Raw, "raw": cid.Raw, "dag-pb": cid.DagProtobuf}
+    codec, ok := codecs[query.Get("cid-codec")]
+    if !ok {
+        writeError(w, http.StatusBadRequest, "unsupported codec %q", query.Get("cid-codec"))
+        return
+    }
+    hashFunction := uint64(multihash.SHA2_256)
+    if name := query.Get("mhtype"); name != "" {
+        if hashFunction, ok = supportedHashes[name]; !ok {
+            writeError(w, http.StatusBadRequest, "unsupported hash function %q", name)
+            return
+        }
+    }
+
+    file, _, err := formFile(r)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "%v", err)
+        return
+    }
+    data, err := io.ReadAll(file)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "failed to read block: %v", err)
+        return
+    }
+    sum, err := multihash.Sum(data, hashFunction, -1)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "%v", err)
+        return
+    }
+    c := cid.NewCidV1(codec, sum)
+
+    n.mu.Lock()
+    n.blocks[string(sum)] = block{cid: c, data: data}
+    if query.Get("pin") == "true" {
+        n.pins[c.String()] = pin{cid: c}
+    }
+    n.mu.Unlock()
+
+    writeJSON(w, map[string]interface{}{"Key": c.String(), "Size": len(data)})
+}
+
+func (n *Node) handleBlockGet(w http.ResponseWriter, r *http.Request) {
+    c, ok := cidArg(w, r)
+    if !ok {
+        return
+    }
+    data, err := n.getBlock(c)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "%v", err)
+        return
+    }
+    w.Header().Set("Content-Type", "application/octet-stream")
+    w.Write(data)
+}
+
+// handleGC deletes every block that is not pinned, streaming one object per block
+func (n *Node) handleGC(w http.ResponseWriter, r *http.Request) {
+    n.mu.Lock()
+    keep := n.indirect()
+    for _, p := range n.pins {
+        keep[string(p.cid.Hash())] = p.cid
+    }
+    var removed []cid.Cid
+    for key, b := range n.blocks {
+        if _, ok := keep[key]; !ok {
+            removed = append(removed, b.cid)
+            delete(n.blocks, key)
+        }
+    }
+    n.mu.Unlock()
+
+    sort.Slice(removed, func(i, j int) bool { return removed[i].String() < removed[j].String() })
+    w.Header().Set("Content-Type", "application/json")
+    encoder := json.NewEncoder(w)
+    for _, c := range removed {
+        encoder.Encode(map[string]interface{}{"Key": map[string]string{"/": c.String()}})
+    }
+}
+
+func (n *Node) handleVersion(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, map[string]string{
+        "Version": "0.0.0-ipfstest",
+        "Commit":  "",
+        "Repo":    "0",
+        "System":  runtime.GOARCH + "/" + runtime.GOOS,
+        "Golang":  runtime.Version(),
+    })
+}
+
+// getBlock implements unixfs.BlockGetter over the node's blocks
+func (n *Node) getBlock(c cid.Cid) ([]byte, error) {
+    n.mu.Lock()
+    b, ok := n.blocks[string(c.Hash())]
+    n.mu.Unlock()
+    if !ok {
+        return nil, fmt.Errorf("block was not found locally (offline): ipld: could not find %s", c)
+    }
+    return b.data, nil
+}
+
+// indirect returns the blocks below recursive pins by multihash; n.mu must be held.
+// Blocks missing from the node are skipped.
+func (n *Node) indirect() map[string]cid.Cid {
+    keys := make(map[string]cid.Cid)
+    for _, p := range n.pins {
+        if !p.recursive {
+            continue
+        }
+        stack := []cid.Cid{p.cid}
+        for len(stack) > 0 {
+            c := stack[len(stack)-1]
+            stack = stack[:len(stack)-1]
+            b, ok := n.blocks[string(c.Hash())]
+            if !ok {
+                continue
+            }
+            links, err := unixfs.Links(c, b.data)
+            if err != nil {
+                continue
+            }
+            for _, link := range links {
+                if _, ok := keys[string(link.Hash())]; !ok {
+                    keys[string(link.Hash())] = link
+                    stack = append(stack, link)
+                }
+            }
+        }
+    }
+    return keys
+}
+
+// cidArg parses the "arg" query parameter, answering the request itself if it is invalid
+func cidArg(w http.ResponseWriter, r *http.Request) (cid.Cid, bool) {
+    arg := strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/")
+    if arg == "" {
+        writeError(w, http.StatusBadRequest, "argument \"ipfs-path\" is required")
+        return cid.Undef, false
+    }
+    c, err := cid.Decode(arg)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, "invalid path %q: %v", arg, err)
+        return cid.Undef, false
+    }
+    return c, true
+}
+
+// formFile returns the first file of a multipart request and its name
+func formFile(r *http.Request) (io.Reader, string, error) {
+    mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+        return nil, "", errors.New("file argument 'path' is required")
+    }
+
+    part, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+    if err != nil {
+        return nil, "", errors.New("file argument 'path' is required")
+    }
+    return part, part.FileName(), nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in Kubo's error format
+func writeError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "Message": fmt.Sprintf(format, args...),
+        "Code":    0,
+        "Type":    "error",
+    })
+}
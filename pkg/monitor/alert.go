@@ -0,0 +1,74 @@
+package monitor
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+)
+
+// webhookTimeout bounds the delivery of one alert to a webhook
+const webhookTimeout = 10 * time.Second
+
+// Alert reports a document that went missing or stopped matching the registry, or that
+// recovered from either
+type Alert struct {
+    Time    time.Time `json:"time"`
+    Hash    string    `json:"hash"`
+    CID     string    `json:"cid"`
+    Status  Status    `json:"status"`
+    Message string    `json:"message"`
+}
+
+// AlertFunc delivers an alert
+type AlertFunc func(ctx context.Context, alert Alert) error
+
+// Webhook returns an AlertFunc that posts each alert as JSON to url
+func Webhook(url string) AlertFunc {
+    client := &http.Client{Timeout: webhookTimeout}
+    return func(ctx context.Context, alert Alert) error {
+        body, err := json.Marshal(alert)
+        if err != nil {
+            return fmt.Errorf("failed to encode alert: %w", err)
+        }
+        req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+        if err != nil {
+            return fmt.Errorf("failed to create alert request: %w", err)
+        }
+        req.Header.Set("Content-Type", "application/json")
+
+        resp, err := client.Do(req)
+        if err != nil {
+            return fmt.Errorf("failed to deliver alert: %w", err)
+        }
+        resp.Body.Close()
+        if resp.StatusCode/100 != 2 {
+            return fmt.Errorf("alert webhook returned %s", resp.Status)
+        }
+        return nil
+    }
+}
+
+// alertFor returns the alert to raise for a document, if its status changed to or from
+// missing or mismatch since the previous check
+func alertFor(status DocumentStatus, previous map[string]Status, now time.Time) (Alert, bool) {
+    before, checked := previous[status.Hash]
+    if checked && before == status.Status {
+        return Alert{}, false
+    }
+
+    alert := Alert{Time: now.UTC(), Hash: status.Hash, CID: status.CID, Status: status.Status}
+    switch {
+    case status.Status == StatusMissing:
+        alert.Message = "no node holds a verified copy of the document"
+    case status.Status == StatusMismatch:
+        alert.Message = "the content at the registered CID does not match the registered hash: " + status.Error
+    case before == StatusMissing || before == StatusMismatch:
+        alert.Message = "the document is available again"
+    default:
+        return Alert{}, false
+    }
+    return alert, true
+}
@@ -0,0 +1,499 @@
+// Package monitor re-checks that registered documents are still retrievable and intact
+// on every node of the document store, restores lost copies from healthy nodes and
+// raises alerts for documents that can no longer be recovered
+package monitor
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+    "time"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/storage"
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// DefaultCheckTimeout bounds reading or restoring one copy of a file on one node
+const DefaultCheckTimeout = 2 * time.Minute
+
+// errHashMismatch is returned when a bundle's manifest or a hash CID does not record the
+// registered hash
+var errHashMismatch = errors.New("content does not match the registered hash")
+
+// Registry is the document registry listing the documents to check
+type Registry interface {
+    // Documents returns every registered document whose content should still be held
+    Documents() ([]blockchain.RegisteredDocument, error)
+}
+
+// Status summarizes the availability of a document
+type Status string
+
+const (
+    // StatusHealthy means every node holds a verified copy of every file
+    StatusHealthy Status = "healthy"
+
+    // StatusRepaired means lost copies were restored from healthy nodes
+    StatusRepaired Status = "repaired"
+
+    // StatusDegraded means some nodes lack a copy that could not be restored, but every
+    // file can still be read from at least one node
+    StatusDegraded Status = "degraded"
+
+    // StatusMissing means no node holds a verified copy of some file
+    StatusMissing Status = "missing"
+
+    // StatusMismatch means the content at the registered CID is not the registered document
+    StatusMismatch Status = "mismatch"
+)
+
+// CopyState describes one node's copy of a file
+type CopyState string
+
+const (
+    CopyOK          CopyState = "ok"
+    CopyRepaired    CopyState = "repaired"
+    CopyMissing     CopyState = "missing"
+    CopyCorrupt     CopyState = "corrupt"
+    CopyUnavailable CopyState = "unavailable"
+)
+
+// Options selects the nodes to check and what to do about lost copies
+type Options struct {
+    // Nodes are checked one by one, so that a copy lost on one replica is noticed even
+    // while the others still serve the document. See Nodes.
+    Nodes []storage.Replica
+
+    // Repair restores missing and corrupt copies from a node holding a verified one
+    Repair bool
+
+    // Alert delivers alerts for documents that go missing or stop matching the registry
+    // (optional)
+    Alert AlertFunc
+
+    // Timeout bounds each read or restore of a file on a node. Zero selects
+    // DefaultCheckTimeout.
+    Timeout time.Duration
+}
+
+// Report describes one check of the registry
+type Report struct {
+    GeneratedAt time.Time `json:"generatedAt"`
+    Nodes       []string  `json:"nodes"`
+
+    Checked    int `json:"checked"`
+    Healthy    int `json:"healthy"`
+    Repaired   int `json:"repaired"`
+    Degraded   int `json:"degraded"`
+    Missing    int `json:"missing"`
+    Mismatched int `json:"mismatched"`
+
+    Documents []DocumentStatus `json:"documents"`
+
+    // Alerts lists the alerts raised by this check, and AlertErrors those that could not
+    // be delivered
+    Alerts      []Alert  `json:"alerts,omitempty"`
+    AlertErrors []string `json:"alertErrors,omitempty"`
+}
+
+// DocumentStatus describes the availability of one registered document
+type DocumentStatus struct {
+    Hash   string       `json:"hash"`
+    CID    string       `json:"cid"`
+    Status Status       `json:"status"`
+    Files  []FileStatus `json:"files,omitempty"`
+    Error  string       `json:"error,omitempty"`
+}
+
+// FileStatus lists every node's copy of one file of a document: the files of a bundle,
+// then its directory, or the document itself
+type FileStatus struct {
+    Name   string `json:"name,omitempty"`
+    CID    string `json:"cid"`
+    Copies []Copy `json:"copies"`
+}
+
+// Copy describes one node's copy of a file
+type Copy struct {
+    Node  string    `json:"node"`
+    State CopyState `json:"state"`
+    Error string    `json:"error,omitempty"`
+}
+
+// file is one content-addressed file of a document. Bundle directories are stored as
+// single blocks.
+type file struct {
+    name  string
+    cid   string
+    block bool
+}
+
+// Monitor checks the registered documents and keeps the latest report. Alerts are raised
+// when a document's status changes, so a document that stays missing is reported once.
+type Monitor struct {
+    registry Registry
+    opts     Options
+
+    mu       sync.Mutex
+    last     *Report
+    statuses map[string]Status
+}
+
+// New creates a monitor of the documents of registry
+func New(registry Registry, opts Options) (*Monitor, error) {
+    if len(opts.Nodes) == 0 {
+        return nil, fmt.Errorf("monitor requires at least one node")
+    }
+    if opts.Timeout <= 0 {
+        opts.Timeout = DefaultCheckTimeout
+    }
+    return &Monitor{registry: registry, opts: opts}, nil
+}
+
+// Nodes returns the nodes of store to check: the replicas of a replicated store, or the
+// store itself under name
+func Nodes(store storage.DocumentStore, name string) []storage.Replica {
+    if replicated, ok := store.(*storage.ReplicatedStore); ok {
+        return replicated.Replicas()
+    }
+    return []storage.Replica{{Name: name, Store: store}}
+}
+
+// Report returns the report of the latest check, or nil before the first one completes
+func (m *Monitor) Report() *Report {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.last
+}
+
+// Run checks the registry immediately and then every interval until ctx is done,
+// passing each report to done
+func (m *Monitor) Run(ctx context.Context, interval time.Duration, done func(*Report, error)) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        report, err := m.Check(ctx, time.Now())
+        if ctx.Err() != nil {
+            return
+        }
+        done(report, err)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Check reads every file of every registered document from each node, verifying it
+// against its CID, and restores lost copies if Repair is set
+func (m *Monitor) Check(ctx context.Context, now time.Time) (*Report, error) {
+    documents, err := m.registry.Documents()
+    if err != nil {
+        return nil, err
+    }
+
+    report := &Report{GeneratedAt: now.UTC(), Documents: []DocumentStatus{}}
+    for _, node := range m.opts.Nodes {
+        report.Nodes = append(report.Nodes, node.Name)
+    }
+
+    m.mu.Lock()
+    previous := m.statuses
+    m.mu.Unlock()
+
+    statuses := make(map[string]Status)
+    for _, doc := range documents {
+        status := m.checkDocument(ctx, doc)
+        if ctx.Err() != nil {
+            return nil, ctx.Err()
+        }
+        report.add(status)
+        statuses[doc.Hash] = status.Status
+
+        if alert, ok := alertFor(status, previous, now); ok {
+            report.Alerts = append(report.Alerts, alert)
+            if m.opts.Alert != nil {
+                if err := m.opts.Alert(ctx, alert); err != nil {
+                    report.AlertErrors = append(report.AlertErrors, err.Error())
+                }
+            }
+        }
+    }
+
+    m.mu.Lock()
+    m.last = report
+    m.statuses = statuses
+    m.mu.Unlock()
+    return report, nil
+}
+
+// add counts a document in the report
+func (r *Report) add(status DocumentStatus) {
+    r.Checked++
+    switch status.Status {
+    case StatusHealthy:
+        r.Healthy++
+    case StatusRepaired:
+        r.Repaired++
+    case StatusDegraded:
+        r.Degraded++
+    case StatusMissing:
+        r.Missing++
+    case StatusMismatch:
+        r.Mismatched++
+    }
+    r.Documents = append(r.Documents, status)
+}
+
+// checkDocument checks every copy of every file of a document
+func (m *Monitor) checkDocument(ctx context.Context, doc blockchain.RegisteredDocument) DocumentStatus {
+    status := DocumentStatus{Hash: doc.Hash, CID: doc.CID}
+    files, err := m.files(ctx, doc)
+    if err != nil {
+        status.Status = StatusMismatch
+        status.Error = err.Error()
+        return status
+    }
+
+    for _, f := range files {
+        fs := FileStatus{Name: f.name, CID: f.cid}
+        for _, node := range m.opts.Nodes {
+            state, err := m.checkCopy(ctx, node, f)
+            c := Copy{Node: node.Name, State: state}
+            if err != nil {
+                c.Error = err.Error()
+            }
+            fs.Copies = append(fs.Copies, c)
+        }
+        if m.opts.Repair {
+            m.repair(ctx, f, &fs)
+        }
+        status.Files = append(status.Files, fs)
+    }
+    status.Status = summarize(status.Files)
+    return status
+}
+
+// files lists the files of a document. A bundle is opened from the first node holding
+// its directory, and its manifest must record the registered hash; a hash CID must be
+// derived from it. Anything else is checked as a single file.
+func (m *Monitor) files(ctx context.Context, doc blockchain.RegisteredDocument) ([]file, error) {
+    if cidHash, ok := blockchain.DocumentHash(doc.CID); ok {
+        if !strings.EqualFold(cidHash, doc.Hash) {
+            return nil, fmt.Errorf("%w: the CID is derived from %s", errHashMismatch, cidHash)
+        }
+        return []file{{cid: doc.CID}}, nil
+    }
+
+    var unverified *storage.Bundle
+    for _, node := range m.opts.Nodes {
+        checkCtx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+        bundle, err := storage.OpenBundle(checkCtx, node.Store, doc.CID)
+        if err != nil {
+            cancel()
+            continue
+        }
+        manifest, err := bundle.Manifest(checkCtx)
+        cancel()
+        if err != nil {
+            // Another node may hold an intact manifest
+            if unverified == nil {
+                unverified = bundle
+            }
+            continue
+        }
+        if manifest.Hash != doc.Hash {
+            return nil, fmt.Errorf("%w: the bundle manifest records %s", errHashMismatch, manifest.Hash)
+        }
+        return bundleFiles(bundle), nil
+    }
+
+    if unverified != nil {
+        return bundleFiles(unverified), nil
+    }
+    return []file{{cid: doc.CID}}, nil
+}
+
+// bundleFiles lists the files of a bundle, then its directory
+func bundleFiles(bundle *storage.Bundle) []file {
+    var files []file
+    for _, link := range bundle.Links {
+        files = append(files, file{name: link.Name, cid: link.Cid.String()})
+    }
+    return append(files, file{cid: bundle.Root, block: true})
+}
+
+// checkCopy reads a node's copy of a file completely, verifying it against its CID
+func (m *Monitor) checkCopy(ctx context.Context, node storage.Replica, f file) (CopyState, error) {
+    ctx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+    defer cancel()
+
+    var err error
+    if f.block {
+        blocks, ok := node.Store.(storage.BlockStore)
+        if !ok {
+            return CopyUnavailable, fmt.Errorf("node cannot hold directories")
+        }
+        _, err = blocks.GetBlock(ctx, f.cid)
+    } else {
+        var reader io.ReadCloser
+        reader, err = node.Store.Get(ctx, f.cid)
+        if err == nil {
+            _, err = io.Copy(io.Discard, reader)
+            reader.Close()
+        }
+    }
+
+    switch {
+    case err == nil:
+        return CopyOK, nil
+    case errors.Is(err, storage.ErrNotFound):
+        return CopyMissing, err
+    case errors.Is(err, unixfs.ErrCIDMismatch):
+        return CopyCorrupt, err
+    default:
+        return CopyUnavailable, err
+    }
+}
+
+// repair copies a file from the first node holding a verified copy to every node that
+// does not, and re-checks the restored copies
+func (m *Monitor) repair(ctx context.Context, f file, fs *FileStatus) {
+    source := -1
+    for i, c := range fs.Copies {
+        if c.State == CopyOK {
+            source = i
+            break
+        }
+    }
+    if source < 0 {
+        return
+    }
+
+    for i := range fs.Copies {
+        if fs.Copies[i].State == CopyOK {
+            continue
+        }
+        err := m.copyFile(ctx, m.opts.Nodes[source], m.opts.Nodes[i], f)
+        if err == nil {
+            var state CopyState
+            if state, err = m.checkCopy(ctx, m.opts.Nodes[i], f); state == CopyOK {
+                fs.Copies[i] = Copy{Node: fs.Copies[i].Node, State: CopyRepaired}
+                continue
+            }
+        }
+        fs.Copies[i].Error = fmt.Sprintf("%s; repair failed: %v", fs.Copies[i].Error, err)
+    }
+}
+
+// dagStore is implemented by nodes that keep every block of a DAG, such as IPFS nodes
+type dagStore interface {
+    storage.BlockStore
+    Pin(ctx context.Context, cid string) error
+}
+
+// copyFile restores a file on a node from another node's copy. Nodes that keep the
+// blocks of a DAG receive the source's blocks unchanged, so the copy has the layout the
+// file was stored with; other nodes store the content again, which only reproduces the
+// CID of files stored in the default layout.
+func (m *Monitor) copyFile(ctx context.Context, from, to storage.Replica, f file) error {
+    ctx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+    defer cancel()
+
+    if f.block {
+        source, ok := from.Store.(storage.BlockStore)
+        target, targetOK := to.Store.(storage.BlockStore)
+        if !ok || !targetOK {
+            return fmt.Errorf("node cannot hold directories")
+        }
+        data, err := source.GetBlock(ctx, f.cid)
+        if err != nil {
+            return fmt.Errorf("failed to read %s from %s: %w", f.cid, from.Name, err)
+        }
+        return target.PutBlock(ctx, f.cid, data)
+    }
+
+    if target, ok := to.Store.(dagStore); ok {
+        if source, ok := from.Store.(storage.BlockStore); ok {
+            err := copyDAG(ctx, source, target, f.cid)
+            if !errors.Is(err, storage.ErrNotFound) {
+                return err
+            }
+            // The source keeps whole files rather than their blocks
+        }
+    }
+
+    reader, err := from.Store.Get(ctx, f.cid)
+    if err != nil {
+        return fmt.Errorf("failed to read %s from %s: %w", f.cid, from.Name, err)
+    }
+    defer reader.Close()
+
+    // A hash CID is only reproduced by storing the document the same way
+    _, hashCID := blockchain.DocumentHash(f.cid)
+    cid, err := to.Store.Put(ctx, reader, storage.StoreOptions{HashCID: hashCID})
+    if err != nil {
+        return err
+    }
+    if cid != f.cid {
+        // Do not leave a copy under a CID nothing refers to
+        if unpinner, ok := to.Store.(storage.Unpinner); ok {
+            unpinner.Unpin(ctx, cid)
+        }
+        return fmt.Errorf("%s stored the copy as %s", to.Name, cid)
+    }
+    return nil
+}
+
+// copyDAG copies every block of the DAG rooted at root from source to target and pins it
+func copyDAG(ctx context.Context, source storage.BlockStore, target dagStore, root string) error {
+    c, err := gocid.Decode(root)
+    if err != nil {
+        return fmt.Errorf("invalid CID %q: %w", root, err)
+    }
+    get := func(c gocid.Cid) ([]byte, error) {
+        return source.GetBlock(ctx, c.String())
+    }
+    err = unixfs.Walk(c, get, func(c gocid.Cid, block []byte) error {
+        return target.PutBlock(ctx, c.String(), block)
+    })
+    if err != nil {
+        return err
+    }
+    return target.Pin(ctx, root)
+}
+
+// summarize derives a document's status from the copies of its files
+func summarize(files []FileStatus) Status {
+    status := StatusHealthy
+    degraded := false
+    for _, f := range files {
+        held := 0
+        for _, c := range f.Copies {
+            switch c.State {
+            case CopyOK:
+                held++
+            case CopyRepaired:
+                held++
+                status = StatusRepaired
+            default:
+                degraded = true
+            }
+        }
+        if held == 0 {
+            return StatusMissing
+        }
+    }
+    if degraded {
+        return StatusDegraded
+    }
+    return status
+}
@@ -0,0 +1,193 @@
+package monitor_test
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/ipfs/ipfstest"
+    "quantum-doc-verify/pkg/monitor"
+    "quantum-doc-verify/pkg/storage"
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// fakeRegistry lists a fixed set of documents
+type fakeRegistry struct {
+    documents []blockchain.RegisteredDocument
+}
+
+func (r *fakeRegistry) Documents() ([]blockchain.RegisteredDocument, error) {
+    return r.documents, nil
+}
+
+func TestMonitor(t *testing.T) {
+    ctx := context.Background()
+    dirs := make([]string, 3)
+    var replicas []storage.Replica
+    for i := range dirs {
+        dirs[i] = t.TempDir()
+        node, _ := storage.NewFileStore(dirs[i])
+        replicas = append(replicas, storage.Replica{Name: filepath.Base(dirs[i]), Store: node})
+    }
+    store, err := storage.NewReplicatedStore(replicas, 3)
+    if err != nil {
+        t.Fatalf("Failed to create replicated store: %v", err)
+    }
+
+    // Two bundles replicated to every node, one registered under the wrong hash
+    registry := &fakeRegistry{}
+    for _, hash := range []string{"contract", "invoice"} {
+        manifest, _ := json.Marshal(storage.Manifest{Version: storage.ManifestVersion, Hash: hash})
+        root, err := storage.PutBundle(ctx, store, []storage.BundleFile{
+            {Name: storage.BundlePayloadFile, Content: bytes.NewReader([]byte("payload of " + hash))},
+            {Name: storage.BundleManifestFile, Content: bytes.NewReader(manifest)},
+        })
+        if err != nil {
+            t.Fatalf("PutBundle failed: %v", err)
+        }
+        registry.documents = append(registry.documents, blockchain.RegisteredDocument{Hash: hash, CID: root})
+    }
+    registry.documents[1].Hash = "forged"
+    contract := registry.documents[0].CID
+
+    var mu sync.Mutex
+    var delivered []monitor.Alert
+    webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var alert monitor.Alert
+        json.NewDecoder(r.Body).Decode(&alert)
+        mu.Lock()
+        delivered = append(delivered, alert)
+        mu.Unlock()
+    }))
+    defer webhook.Close()
+
+    m, err := monitor.New(registry, monitor.Options{
+        Nodes:  monitor.Nodes(store, "replicated"),
+        Repair: true,
+        Alert:  monitor.Webhook(webhook.URL),
+    })
+    if err != nil {
+        t.Fatalf("Failed to create monitor: %v", err)
+    }
+    report, err := m.Check(ctx, time.Now())
+    if err != nil {
+        t.Fatalf("Check failed: %v", err)
+    }
+    if report.Checked != 2 || report.Healthy != 1 || report.Mismatched != 1 || len(report.Nodes) != 3 {
+        t.Fatalf("Unexpected report: %+v", report)
+    }
+    if len(delivered) != 1 || delivered[0].Hash != "forged" || delivered[0].Status != monitor.StatusMismatch {
+        t.Fatalf("Expected one mismatch alert, got %+v", delivered)
+    }
+    registry.documents = registry.documents[:1]
+
+    // A copy lost on one node and another corrupted on a second are restored from the third
+    files := report.Documents[0].Files
+    if len(files) != 3 || files[2].CID != contract {
+        t.Fatalf("Expected the bundle's files and directory, got %+v", files)
+    }
+    payload := files[0].CID
+    if err := replicas[0].Store.(storage.Unpinner).Unpin(ctx, payload); err != nil {
+        t.Fatalf("Unpin failed: %v", err)
+    }
+    if err := os.WriteFile(filepath.Join(dirs[1], payload[len(payload)-2:], payload), []byte("tampered"), 0644); err != nil {
+        t.Fatalf("Failed to corrupt copy: %v", err)
+    }
+    report, err = m.Check(ctx, time.Now())
+    if err != nil || report.Repaired != 1 {
+        t.Fatalf("Expected the document to be repaired: %+v (%v)", report, err)
+    }
+    copies := report.Documents[0].Files[0].Copies
+    if copies[0].State != monitor.CopyRepaired || copies[1].State != monitor.CopyRepaired || copies[2].State != monitor.CopyOK {
+        t.Fatalf("Unexpected copies after repair: %+v", copies)
+    }
+    if _, err := storage.OpenBundle(ctx, replicas[0].Store, contract); err != nil {
+        t.Fatalf("Repaired node cannot open the bundle: %v", err)
+    }
+
+    // A document lost everywhere raises one alert until it recovers
+    for _, replica := range replicas {
+        replica.Store.(storage.Unpinner).Unpin(ctx, payload)
+    }
+    for i := 0; i < 2; i++ {
+        report, err = m.Check(ctx, time.Now())
+        if err != nil || report.Missing != 1 {
+            t.Fatalf("Expected the document to be missing: %+v (%v)", report, err)
+        }
+    }
+    if len(delivered) != 2 || delivered[1].Status != monitor.StatusMissing {
+        t.Fatalf("Expected one missing alert, got %+v", delivered)
+    }
+    if lost := m.Report().Documents[0].Files[0].Copies[0]; lost.State != monitor.CopyMissing {
+        t.Fatalf("Expected the latest report to show the lost copy, got %+v", lost)
+    }
+
+    if _, err := store.Put(ctx, bytes.NewReader([]byte("payload of contract")), storage.StoreOptions{}); err != nil {
+        t.Fatalf("Failed to restore payload: %v", err)
+    }
+    report, err = m.Check(ctx, time.Now())
+    if err != nil || report.Healthy != 1 || len(report.Alerts) != 1 || len(delivered) != 3 {
+        t.Fatalf("Expected a recovery alert: %+v (%v)", report, err)
+    }
+
+    if _, err := monitor.New(registry, monitor.Options{}); err == nil {
+        t.Fatalf("Expected a monitor without nodes to be refused")
+    }
+}
+
+func TestMonitorRepairKeepsLayout(t *testing.T) {
+    ctx := context.Background()
+    var replicas []storage.Replica
+    var nodes []*ipfstest.Server
+    for _, name := range []string{"a", "b"} {
+        node := ipfstest.NewServer()
+        defer node.Close()
+        client, _ := storage.NewIPFSClient(node.Addr())
+        nodes = append(nodes, node)
+        replicas = append(replicas, storage.Replica{Name: name, Store: client})
+    }
+
+    // A document stored on the first node only, with a chunker other than the default
+    content := bytes.Repeat([]byte("Minutes of the supervisory board, 2026-09-30. "), 200)
+    cid, err := replicas[0].Store.Put(ctx, bytes.NewReader(content), storage.StoreOptions{Chunker: "size-1024"})
+    if err != nil {
+        t.Fatalf("Put failed: %v", err)
+    }
+    defaultCID, _ := unixfs.Compute(bytes.NewReader(content), unixfs.DefaultOptions(0))
+    if cid == defaultCID.String() {
+        t.Fatalf("Expected the chunker to change the CID")
+    }
+
+    registry := &fakeRegistry{documents: []blockchain.RegisteredDocument{{Hash: "minutes", CID: cid}}}
+    m, err := monitor.New(registry, monitor.Options{Nodes: replicas, Repair: true})
+    if err != nil {
+        t.Fatalf("Failed to create monitor: %v", err)
+    }
+    report, err := m.Check(ctx, time.Now())
+    if err != nil || report.Repaired != 1 {
+        t.Fatalf("Expected the document to be repaired: %+v (%v)", report, err)
+    }
+    if copies := report.Documents[0].Files[0].Copies; copies[0].State != monitor.CopyOK || copies[1].State != monitor.CopyRepaired {
+        t.Fatalf("Unexpected copies after repair: %+v", copies)
+    }
+
+    // The second node holds the DAG as stored, pinned, and no copy in its default layout
+    if !nodes[1].Pinned(cid) {
+        t.Fatalf("Expected the repaired copy to be pinned")
+    }
+    if nodes[1].Has(defaultCID.String()) {
+        t.Fatalf("Repair left a copy in the default layout on the node")
+    }
+    report, err = m.Check(ctx, time.Now())
+    if err != nil || report.Healthy != 1 {
+        t.Fatalf("Expected the document to be healthy after repair: %+v (%v)", report, err)
+    }
+}
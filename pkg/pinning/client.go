@@ -0,0 +1,281 @@
+package pinning
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Status is the state of a pin request on a remote pinning service
+type Status string
+
+// Pin statuses defined by the IPFS Pinning Services API
+const (
+    StatusQueued  Status = "queued"
+    StatusPinning Status = "pinning"
+    StatusPinned  Status = "pinned"
+    StatusFailed  Status = "failed"
+)
+
+// Pin describes content to be pinned
+type Pin struct {
+    CID     string            `json:"cid"`
+    Name    string            `json:"name,omitempty"`
+    Origins []string          `json:"origins,omitempty"`
+    Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus is a pin request as reported by a pinning service
+type PinStatus struct {
+    RequestID string            `json:"requestid"`
+    Status    Status            `json:"status"`
+    Created   time.Time         `json:"created"`
+    Pin       Pin               `json:"pin"`
+    Delegates []string          `json:"delegates"`
+    Info      map[string]string `json:"info,omitempty"`
+}
+
+// ListOptions filters the pins returned by List
+type ListOptions struct {
+    CIDs   []string
+    Name   string
+    Status []Status
+    Limit  int
+
+    // Before only lists requests created before this time
+    Before time.Time
+}
+
+// APIError is an error response from a pinning service
+type APIError struct {
+    StatusCode int
+    Reason     string
+    Details    string
+}
+
+func (e *APIError) Error() string {
+    if e.Details != "" {
+        return fmt.Sprintf("pinning service error %d %s: %s", e.StatusCode, e.Reason, e.Details)
+    }
+    return fmt.Sprintf("pinning service error %d %s", e.StatusCode, e.Reason)
+}
+
+// Client talks to one service implementing the IPFS Pinning Services API
+type Client struct {
+    name       string
+    endpoint   string
+    token      string
+    httpClient *http.Client
+}
+
+// NewClient creates a new pinning service client. endpoint is the API base URL
+// (requests go to endpoint + "/pins") and token is the service's access token.
+func NewClient(name, endpoint, token string) *Client {
+    return &Client{
+        name:       name,
+        endpoint:   strings.TrimRight(endpoint, "/"),
+        token:      token,
+        httpClient: &http.Client{Timeout: 30 * time.Second},
+    }
+}
+
+// Name returns the service name used in logs and results
+func (c *Client) Name() string {
+    return c.name
+}
+
+// Add asks the service to pin content
+func (c *Client) Add(ctx context.Context, pin Pin) (*PinStatus, error) {
+    body, err := json.Marshal(pin)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode pin: %w", err)
+    }
+
+    var status PinStatus
+    if err := c.do(ctx, http.MethodPost, "/pins", nil, body, http.StatusAccepted, &status); err != nil {
+        return nil, fmt.Errorf("failed to add pin for %s: %w", pin.CID, err)
+    }
+    return &status, nil
+}
+
+// Status returns the current state of a pin request
+func (c *Client) Status(ctx context.Context, requestID string) (*PinStatus, error) {
+    var status PinStatus
+    if err := c.do(ctx, http.MethodGet, "/pins/"+url.PathEscape(requestID), nil, nil, http.StatusOK, &status); err != nil {
+        return nil, fmt.Errorf("failed to get pin status: %w", err)
+    }
+    return &status, nil
+}
+
+// List returns the pin requests matching opts and the total number of matches
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]PinStatus, int, error) {
+    query := url.Values{}
+    if len(opts.CIDs) > 0 {
+        query.Set("cid", strings.Join(opts.CIDs, ","))
+    }
+    if opts.Name != "" {
+        query.Set("name", opts.Name)
+    }
+    if len(opts.Status) > 0 {
+        statuses := make([]string, len(opts.Status))
+        for i, s := range opts.Status {
+            statuses[i] = string(s)
+        }
+        query.Set("status", strings.Join(statuses, ","))
+    }
+    if opts.Limit > 0 {
+        query.Set("limit", strconv.Itoa(opts.Limit))
+    }
+    if !opts.Before.IsZero() {
+        query.Set("before", opts.Before.UTC().Format(time.RFC3339Nano))
+    }
+
+    var results struct {
+        Count   int         `json:"count"`
+        Results []PinStatus `json:"results"`
+    }
+    if err := c.do(ctx, http.MethodGet, "/pins", query, nil, http.StatusOK, &results); err != nil {
+        return nil, 0, fmt.Errorf("failed to list pins: %w", err)
+    }
+    return results.Results, results.Count, nil
+}
+
+// Remove cancels a pin request and unpins its content
+func (c *Client) Remove(ctx context.Context, requestID string) error {
+    if err := c.do(ctx, http.MethodDelete, "/pins/"+url.PathEscape(requestID), nil, nil, http.StatusAccepted, nil); err != nil {
+        return fmt.Errorf("failed to remove pin: %w", err)
+    }
+    return nil
+}
+
+// Unpin removes every pin request for cid on the service, whatever its status, and
+// returns the number removed. It is not an error if there are none. Results come newest
+// first, so each page asks for requests created before the last one seen. Services may
+// go on listing removed requests for a while, so listing also stops once a page holds
+// no request that was not seen before.
+func (c *Client) Unpin(ctx context.Context, cid string) (int, error) {
+    opts := ListOptions{
+        CIDs:   []string{cid},
+        Status: []Status{StatusQueued, StatusPinning, StatusPinned, StatusFailed},
+        Limit:  1000,
+    }
+
+    removed := 0
+    seen := make(map[string]bool)
+    for {
+        if err := ctx.Err(); err != nil {
+            return removed, err
+        }
+        pins, count, err := c.List(ctx, opts)
+        if err != nil {
+            return removed, err
+        }
+
+        fresh := 0
+        for _, pin := range pins {
+            if seen[pin.RequestID] {
+                continue
+            }
+            seen[pin.RequestID] = true
+            fresh++
+
+            // A request that is already gone has been removed by an earlier call
+            var apiErr *APIError
+            err := c.Remove(ctx, pin.RequestID)
+            switch {
+            case err == nil:
+                removed++
+            case !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound:
+                return removed, err
+            }
+        }
+        if fresh == 0 || count <= len(pins) {
+            return removed, nil
+        }
+        opts.Before = pins[len(pins)-1].Created
+    }
+}
+
+// WaitPinned polls a pin request until it is pinned, fails or ctx is done
+func (c *Client) WaitPinned(ctx context.Context, requestID string, interval time.Duration) (*PinStatus, error) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        status, err := c.Status(ctx, requestID)
+        if err != nil {
+            return nil, err
+        }
+
+        switch status.Status {
+        case StatusPinned:
+            return status, nil
+        case StatusFailed:
+            return status, fmt.Errorf("pinning %s failed on %s", status.Pin.CID, c.name)
+        }
+
+        select {
+        case <-ctx.Done():
+            return status, fmt.Errorf("pin %s still %s on %s: %w", status.Pin.CID, status.Status, c.name, ctx.Err())
+        case <-ticker.C:
+        }
+    }
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, expected int, out interface{}) error {
+    endpoint := c.endpoint + path
+    if len(query) > 0 {
+        endpoint += "?" + query.Encode()
+    }
+
+    var reader io.Reader
+    if body != nil {
+        reader = bytes.NewReader(body)
+    }
+    req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+    if err != nil {
+        return fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("Authorization", "Bearer "+c.token)
+    req.Header.Set("Accept", "application/json")
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := c.httpClient.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to contact %s: %w", c.name, err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != expected {
+        apiErr := &APIError{StatusCode: resp.StatusCode, Reason: http.StatusText(resp.StatusCode)}
+        var failure struct {
+            Error struct {
+                Reason  string `json:"reason"`
+                Details string `json:"details"`
+            } `json:"error"`
+        }
+        if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&failure) == nil && failure.Error.Reason != "" {
+            apiErr.Reason = failure.Error.Reason
+            apiErr.Details = failure.Error.Details
+        }
+        return apiErr
+    }
+
+    if out == nil {
+        return nil
+    }
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return fmt.Errorf("failed to decode response: %w", err)
+    }
+    return nil
+}
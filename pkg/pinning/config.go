@@ -0,0 +1,90 @@
+package pinning
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+)
+
+// ServiceConfig configures one remote pinning service
+type ServiceConfig struct {
+    Name     string `json:"name"`
+    Endpoint string `json:"endpoint"`
+
+    // AccessToken is the service's bearer token. AccessTokenEnv names an environment
+    // variable to read it from instead, so config files can be kept free of secrets.
+    AccessToken    string `json:"access_token,omitempty"`
+    AccessTokenEnv string `json:"access_token_env,omitempty"`
+}
+
+// Config lists the pinning services documents are replicated to
+type Config struct {
+    Services []ServiceConfig `json:"services"`
+
+    // MinPinned is how many services must report "pinned" before a document counts as
+    // durably stored (default 1)
+    MinPinned int `json:"min_pinned"`
+
+    // Origins are multiaddrs of nodes holding the content, passed to services as hints
+    Origins []string `json:"origins,omitempty"`
+}
+
+// LoadConfig reads a JSON pinning configuration file
+func LoadConfig(path string) (*Config, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read pinning config: %w", err)
+    }
+
+    var cfg Config
+    if err := json.Unmarshal(data, &cfg); err != nil {
+        return nil, fmt.Errorf("failed to parse pinning config: %w", err)
+    }
+    if err := cfg.Validate(); err != nil {
+        return nil, err
+    }
+    return &cfg, nil
+}
+
+// Validate checks the configuration and fills in defaults
+func (cfg *Config) Validate() error {
+    if len(cfg.Services) == 0 {
+        return fmt.Errorf("pinning config lists no services")
+    }
+    if cfg.MinPinned == 0 {
+        cfg.MinPinned = 1
+    }
+    if cfg.MinPinned < 0 || cfg.MinPinned > len(cfg.Services) {
+        return fmt.Errorf("min_pinned must be between 1 and the number of services (%d)", len(cfg.Services))
+    }
+
+    for i, svc := range cfg.Services {
+        if svc.Endpoint == "" {
+            return fmt.Errorf("pinning service %d has no endpoint", i)
+        }
+        if svc.Name == "" {
+            cfg.Services[i].Name = svc.Endpoint
+        }
+    }
+    return nil
+}
+
+// Clients creates a client for every configured service
+func (cfg *Config) Clients() ([]*Client, error) {
+    clients := make([]*Client, 0, len(cfg.Services))
+    for _, svc := range cfg.Services {
+        token := svc.AccessToken
+        if svc.AccessTokenEnv != "" {
+            token = os.Getenv(svc.AccessTokenEnv)
+            if token == "" {
+                return nil, fmt.Errorf("environment variable %s for pinning service %s is not set", svc.AccessTokenEnv, svc.Name)
+            }
+        }
+        if token == "" {
+            return nil, fmt.Errorf("pinning service %s has no access token", svc.Name)
+        }
+
+        clients = append(clients, NewClient(svc.Name, svc.Endpoint, token))
+    }
+    return clients, nil
+}
@@ -0,0 +1,171 @@
+package pinning_test
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "quantum-doc-verify/pkg/pinning"
+    "quantum-doc-verify/pkg/pinning/pinningtest"
+)
+
+const testCID = "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"
+
+func TestClientLifecycle(t *testing.T) {
+    svc := pinningtest.NewService("secret")
+    defer svc.Close()
+
+    ctx := context.Background()
+    client := pinning.NewClient("fake", svc.URL, "secret")
+
+    // Add, then wait for the pin to complete
+    status, err := client.Add(ctx, pinning.Pin{CID: testCID, Name: "report.pdf"})
+    if err != nil {
+        t.Fatalf("Add failed: %v", err)
+    }
+    if status.Status != pinning.StatusQueued || status.RequestID == "" {
+        t.Fatalf("Unexpected status after add: %+v", status)
+    }
+
+    status, err = client.WaitPinned(ctx, status.RequestID, time.Millisecond)
+    if err != nil {
+        t.Fatalf("WaitPinned failed: %v", err)
+    }
+    if status.Status != pinning.StatusPinned || status.Pin.Name != "report.pdf" {
+        t.Fatalf("Unexpected status after wait: %+v", status)
+    }
+
+    // List filters by CID and, by default, completed pins
+    pins, count, err := client.List(ctx, pinning.ListOptions{CIDs: []string{testCID}})
+    if err != nil {
+        t.Fatalf("List failed: %v", err)
+    }
+    if count != 1 || len(pins) != 1 || pins[0].RequestID != status.RequestID {
+        t.Fatalf("Unexpected list result: %d %+v", count, pins)
+    }
+
+    // Remove, after which the request is gone
+    if err := client.Remove(ctx, status.RequestID); err != nil {
+        t.Fatalf("Remove failed: %v", err)
+    }
+    var apiErr *pinning.APIError
+    if _, err := client.Status(ctx, status.RequestID); !errors.As(err, &apiErr) || apiErr.StatusCode != 404 {
+        t.Fatalf("Expected 404 after remove, got %v", err)
+    }
+
+    // A wrong token is reported with the service's reason
+    bad := pinning.NewClient("fake", svc.URL, "wrong")
+    if _, err := bad.Add(ctx, pinning.Pin{CID: testCID}); !errors.As(err, &apiErr) || apiErr.Reason != "UNAUTHORIZED" {
+        t.Fatalf("Expected UNAUTHORIZED, got %v", err)
+    }
+}
+
+func TestPinQuorum(t *testing.T) {
+    var services []*pinningtest.Service
+    var clients []*pinning.Client
+    for i := 0; i < 3; i++ {
+        svc := pinningtest.NewService("token")
+        defer svc.Close()
+        services = append(services, svc)
+        clients = append(clients, pinning.NewClient(svc.URL, svc.URL, "token"))
+    }
+
+    // Two of three services fail, so a quorum of two cannot be reached
+    services[0].Fail(testCID)
+    services[1].Fail(testCID)
+
+    ctx := context.Background()
+    pin := pinning.Pin{CID: testCID}
+    if _, err := pinning.PinQuorum(ctx, clients, pin, 2, time.Millisecond); err == nil {
+        t.Fatalf("Expected quorum failure")
+    }
+
+    results, err := pinning.PinQuorum(ctx, clients, pin, 1, time.Millisecond)
+    if err != nil {
+        t.Fatalf("Expected quorum of one to succeed: %v", err)
+    }
+    if !services[2].Pinned(testCID) || !results[len(results)-1].Pinned() {
+        t.Fatalf("Expected the healthy service to hold the pin: %+v", results)
+    }
+
+    // A pin that never completes times out with the context
+    slow := pinningtest.NewService("token")
+    defer slow.Close()
+    slow.PollsUntilPinned = 1 << 30
+
+    timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+    defer cancel()
+    if _, err := pinning.PinQuorum(timeout, []*pinning.Client{pinning.NewClient("slow", slow.URL, "token")}, pin, 1, time.Millisecond); err == nil {
+        t.Fatalf("Expected timeout")
+    }
+}
+
+func TestUnpin(t *testing.T) {
+    ctx := context.Background()
+    for _, listsRemoved := range []bool{false, true} {
+        svc := pinningtest.NewService("token")
+        defer svc.Close()
+        svc.ListsRemoved = listsRemoved
+        client := pinning.NewClient("fake", svc.URL, "token")
+
+        // More requests than fit in one page, plus one for another CID
+        const requests = 1005
+        for i := 0; i < requests; i++ {
+            if _, err := client.Add(ctx, pinning.Pin{CID: testCID}); err != nil {
+                t.Fatalf("Add failed: %v", err)
+            }
+        }
+        other := "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+        kept, err := client.Add(ctx, pinning.Pin{CID: other})
+        if err != nil {
+            t.Fatalf("Add failed: %v", err)
+        }
+
+        timeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+        removed, err := client.Unpin(timeout, testCID)
+        cancel()
+        if err != nil || removed != requests {
+            t.Fatalf("listsRemoved=%v: expected %d requests removed, got %d (%v)", listsRemoved, requests, removed, err)
+        }
+        if removed, err := client.Unpin(ctx, testCID); err != nil || removed != 0 {
+            t.Fatalf("listsRemoved=%v: expected nothing left to remove, got %d (%v)", listsRemoved, removed, err)
+        }
+        if _, err := client.Status(ctx, kept.RequestID); err != nil {
+            t.Fatalf("listsRemoved=%v: expected the other CID's pin to stay: %v", listsRemoved, err)
+        }
+    }
+
+    // A cancelled context stops before anything is listed
+    svc := pinningtest.NewService("token")
+    defer svc.Close()
+    client := pinning.NewClient("fake", svc.URL, "token")
+    if _, err := client.Add(ctx, pinning.Pin{CID: testCID}); err != nil {
+        t.Fatalf("Add failed: %v", err)
+    }
+    cancelled, cancel := context.WithCancel(ctx)
+    cancel()
+    if removed, err := client.Unpin(cancelled, testCID); !errors.Is(err, context.Canceled) || removed != 0 {
+        t.Fatalf("Expected context.Canceled, got %d (%v)", removed, err)
+    }
+}
+
+func TestConfigValidate(t *testing.T) {
+    cfg := pinning.Config{Services: []pinning.ServiceConfig{{Endpoint: "https://a.example/psa", AccessTokenEnv: "PINNING_TEST_TOKEN"}}}
+    if err := cfg.Validate(); err != nil || cfg.MinPinned != 1 || cfg.Services[0].Name == "" {
+        t.Fatalf("Unexpected validation result: %v %+v", err, cfg)
+    }
+
+    if _, err := cfg.Clients(); err == nil {
+        t.Fatalf("Expected missing token environment variable to be reported")
+    }
+    t.Setenv("PINNING_TEST_TOKEN", "token")
+    if clients, err := cfg.Clients(); err != nil || len(clients) != 1 {
+        t.Fatalf("Failed to create clients: %v", err)
+    }
+
+    cfg.MinPinned = 2
+    if err := cfg.Validate(); err == nil {
+        t.Fatalf("Expected min_pinned above the number of services to be rejected")
+    }
+}
@@ -0,0 +1,235 @@
+// Package pinningtest provides an in-process IPFS Pinning Services API for tests
+package pinningtest
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "quantum-doc-verify/pkg/pinning"
+)
+
+// Service is a fake pinning service. Pins start "queued" and move through "pinning" to
+// "pinned" as their status is polled, or to "failed" for CIDs registered with Fail.
+type Service struct {
+    *httptest.Server
+
+    Token string
+
+    // PollsUntilPinned is how many status requests a pin takes to complete (default 2)
+    PollsUntilPinned int
+
+    // ListsRemoved keeps removed pin requests in list results, as services that remove
+    // pins asynchronously do
+    ListsRemoved bool
+
+    mu      sync.Mutex
+    pins    map[string]*pinRecord
+    nextID  int
+    failing map[string]bool
+}
+
+type pinRecord struct {
+    status  pinning.PinStatus
+    polls   int
+    removed bool
+}
+
+// NewService starts a fake pinning service that accepts token
+func NewService(token string) *Service {
+    s := &Service{
+        Token:            token,
+        PollsUntilPinned: 2,
+        pins:             make(map[string]*pinRecord),
+        failing:          make(map[string]bool),
+    }
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("POST /pins", s.handleAdd)
+    mux.HandleFunc("GET /pins", s.handleList)
+    mux.HandleFunc("GET /pins/{requestid}", s.handleStatus)
+    mux.HandleFunc("DELETE /pins/{requestid}", s.handleRemove)
+
+    s.Server = httptest.NewServer(s.authenticate(mux))
+    return s
+}
+
+// Fail makes pins of cid fail instead of completing
+func (s *Service) Fail(cid string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.failing[cid] = true
+}
+
+// Pinned reports whether the service holds a completed pin for cid
+func (s *Service) Pinned(cid string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, record := range s.pins {
+        if record.status.Pin.CID == cid && record.status.Status == pinning.StatusPinned && !record.removed {
+            return true
+        }
+    }
+    return false
+}
+
+func (s *Service) authenticate(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") != "Bearer "+s.Token {
+            writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid access token")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+func (s *Service) handleAdd(w http.ResponseWriter, r *http.Request) {
+    var pin pinning.Pin
+    if err := json.NewDecoder(r.Body).Decode(&pin); err != nil || pin.CID == "" {
+        writeError(w, http.StatusBadRequest, "BAD_REQUEST", "a cid is required")
+        return
+    }
+
+    s.mu.Lock()
+    s.nextID++
+    record := &pinRecord{status: pinning.PinStatus{
+        RequestID: strconv.Itoa(s.nextID),
+        Status:    pinning.StatusQueued,
+        Created:   time.Now().UTC(),
+        Pin:       pin,
+        Delegates: []string{"/dns4/pinning.test/tcp/4001/p2p/QmFakeDelegate"},
+    }}
+    s.pins[record.status.RequestID] = record
+    status := record.status
+    s.mu.Unlock()
+
+    writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *Service) handleStatus(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    record, ok := s.pins[r.PathValue("requestid")]
+    ok = ok && !record.removed
+    if ok {
+        s.advance(record)
+    }
+    var status pinning.PinStatus
+    if ok {
+        status = record.status
+    }
+    s.mu.Unlock()
+
+    if !ok {
+        writeError(w, http.StatusNotFound, "NOT_FOUND", "no such pin request")
+        return
+    }
+    writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    cids := splitList(query.Get("cid"))
+    statuses := splitList(query.Get("status"))
+    if len(statuses) == 0 {
+        statuses = map[string]bool{string(pinning.StatusPinned): true}
+    }
+    limit := 10
+    if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+        limit = l
+    }
+
+    s.mu.Lock()
+    var matches []pinning.PinStatus
+    for _, record := range s.pins {
+        status := record.status
+        if len(cids) > 0 && !cids[status.Pin.CID] {
+            continue
+        }
+        if name := query.Get("name"); name != "" && status.Pin.Name != name {
+            continue
+        }
+        if !statuses[string(status.Status)] {
+            continue
+        }
+        if before, err := time.Parse(time.RFC3339Nano, query.Get("before")); err == nil && !status.Created.Before(before) {
+            continue
+        }
+        matches = append(matches, status)
+    }
+    s.mu.Unlock()
+
+    // Newest first, as the specification requires
+    sort.Slice(matches, func(i, j int) bool {
+        a, _ := strconv.Atoi(matches[i].RequestID)
+        b, _ := strconv.Atoi(matches[j].RequestID)
+        return a > b
+    })
+
+    count := len(matches)
+    if len(matches) > limit {
+        matches = matches[:limit]
+    }
+    writeJSON(w, http.StatusOK, map[string]interface{}{"count": count, "results": matches})
+}
+
+func (s *Service) handleRemove(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    record, ok := s.pins[r.PathValue("requestid")]
+    ok = ok && !record.removed
+    if s.ListsRemoved && ok {
+        record.removed = true
+    } else {
+        delete(s.pins, r.PathValue("requestid"))
+    }
+    s.mu.Unlock()
+
+    if !ok {
+        writeError(w, http.StatusNotFound, "NOT_FOUND", "no such pin request")
+        return
+    }
+    w.WriteHeader(http.StatusAccepted)
+}
+
+// advance moves a pin one step towards completion; s.mu must be held
+func (s *Service) advance(record *pinRecord) {
+    if record.status.Status == pinning.StatusPinned || record.status.Status == pinning.StatusFailed {
+        return
+    }
+
+    record.polls++
+    switch {
+    case s.failing[record.status.Pin.CID]:
+        record.status.Status = pinning.StatusFailed
+    case record.polls >= s.PollsUntilPinned:
+        record.status.Status = pinning.StatusPinned
+    default:
+        record.status.Status = pinning.StatusPinning
+    }
+}
+
+func splitList(value string) map[string]bool {
+    set := make(map[string]bool)
+    for _, item := range strings.Split(value, ",") {
+        if item != "" {
+            set[item] = true
+        }
+    }
+    return set
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, reason, details string) {
+    writeJSON(w, code, map[string]interface{}{
+        "error": map[string]string{"reason": reason, "details": details},
+    })
+}
@@ -0,0 +1,111 @@
+package pinning
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// DefaultPollInterval is how often pin requests are polled while waiting for them to complete
+const DefaultPollInterval = 2 * time.Second
+
+// Result is the outcome of pinning on one service
+type Result struct {
+    Service string
+    Status  *PinStatus
+    Err     error
+}
+
+// Pinned reports whether the service confirmed the pin
+func (r Result) Pinned() bool {
+    return r.Err == nil && r.Status != nil && r.Status.Status == StatusPinned
+}
+
+// PinQuorum adds pin to every client in parallel and waits until minPinned of them report
+// "pinned". It returns as soon as the quorum is reached or can no longer be reached; pin
+// requests still in progress are left to complete on their services. The results cover
+// every service that has answered so far.
+func PinQuorum(ctx context.Context, clients []*Client, pin Pin, minPinned int, pollInterval time.Duration) ([]Result, error) {
+    if minPinned < 1 || minPinned > len(clients) {
+        return nil, fmt.Errorf("cannot require %d of %d pinning services", minPinned, len(clients))
+    }
+    if pollInterval <= 0 {
+        pollInterval = DefaultPollInterval
+    }
+
+    // 1. Pin everywhere in parallel; the waits are cancelled once the outcome is known
+    waitCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    results := make(chan Result, len(clients))
+    for _, client := range clients {
+        go func(client *Client) {
+            status, err := client.Add(waitCtx, pin)
+            if err == nil && status.Status != StatusPinned {
+                status, err = client.WaitPinned(waitCtx, status.RequestID, pollInterval)
+            }
+            results <- Result{Service: client.Name(), Status: status, Err: err}
+        }(client)
+    }
+
+    // 2. Count confirmations until the quorum is reached or out of reach
+    var collected []Result
+    pinned, failed := 0, 0
+    for pinned < minPinned && len(clients)-failed >= minPinned {
+        result := <-results
+        collected = append(collected, result)
+        if result.Pinned() {
+            pinned++
+        } else {
+            failed++
+        }
+    }
+
+    if pinned >= minPinned {
+        return collected, nil
+    }
+
+    var reasons []string
+    for _, r := range collected {
+        if r.Err != nil {
+            reasons = append(reasons, fmt.Sprintf("%s: %v", r.Service, r.Err))
+        }
+    }
+    return collected, fmt.Errorf("%s pinned on %d of %d required services (%s)", pin.CID, pinned, minPinned, strings.Join(reasons, "; "))
+}
+
+// Pin pins cid on the configured services and waits for MinPinned of them to confirm
+func (cfg *Config) Pin(ctx context.Context, cid, name string) ([]Result, error) {
+    clients, err := cfg.Clients()
+    if err != nil {
+        return nil, err
+    }
+
+    pin := Pin{CID: cid, Name: name, Origins: cfg.Origins}
+    return PinQuorum(ctx, clients, pin, cfg.MinPinned, DefaultPollInterval)
+}
+
+// Unpin removes the pins of cid from every configured service. Each service is tried even
+// if another fails; the error lists the services that still hold a pin.
+func (cfg *Config) Unpin(ctx context.Context, cid string) ([]Result, error) {
+    clients, err := cfg.Clients()
+    if err != nil {
+        return nil, err
+    }
+
+    var results []Result
+    var reasons []string
+    for _, client := range clients {
+        _, err := client.Unpin(ctx, cid)
+        results = append(results, Result{Service: client.Name(), Err: err})
+        if err != nil {
+            reasons = append(reasons, fmt.Sprintf("%s: %v", client.Name(), err))
+        }
+    }
+
+    if len(reasons) > 0 {
+        return results, fmt.Errorf("failed to unpin %s (%s)", cid, strings.Join(reasons, "; "))
+    }
+    return results, nil
+}
@@ -0,0 +1,156 @@
+// Package retention decides when registered documents have been kept long enough and
+// releases their content from the stores and pinning services holding it
+package retention
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Period is a retention period, written in years ("7y"), weeks ("12w"), days ("90d") or
+// as a Go duration ("36h"). Years and days follow the calendar, so "1y" from
+// 29 February ends on 1 March.
+type Period struct {
+    years    int
+    days     int
+    duration time.Duration
+    text     string
+}
+
+// ParsePeriod parses a retention period
+func ParsePeriod(s string) (Period, error) {
+    s = strings.TrimSpace(s)
+    if s == "" {
+        return Period{}, fmt.Errorf("empty retention period")
+    }
+
+    unit := s[len(s)-1]
+    if unit == 'y' || unit == 'w' || unit == 'd' {
+        n, err := strconv.Atoi(s[:len(s)-1])
+        if err != nil || n <= 0 {
+            return Period{}, fmt.Errorf("invalid retention period %q", s)
+        }
+        switch unit {
+        case 'y':
+            return Period{years: n, text: s}, nil
+        case 'w':
+            return Period{days: 7 * n, text: s}, nil
+        default:
+            return Period{days: n, text: s}, nil
+        }
+    }
+
+    d, err := time.ParseDuration(s)
+    if err != nil || d <= 0 {
+        return Period{}, fmt.Errorf("invalid retention period %q", s)
+    }
+    return Period{duration: d, text: s}, nil
+}
+
+// End returns the time a period starting at start ends
+func (p Period) End(start time.Time) time.Time {
+    return start.AddDate(p.years, 0, p.days).Add(p.duration)
+}
+
+// IsZero reports whether the period was never set
+func (p Period) IsZero() bool {
+    return p.years == 0 && p.days == 0 && p.duration == 0
+}
+
+func (p Period) String() string {
+    return p.text
+}
+
+// MarshalJSON encodes the period as written
+func (p Period) MarshalJSON() ([]byte, error) {
+    return json.Marshal(p.text)
+}
+
+// UnmarshalJSON parses a period string
+func (p *Period) UnmarshalJSON(data []byte) error {
+    var s string
+    if err := json.Unmarshal(data, &s); err != nil {
+        return fmt.Errorf("retention period must be a string: %w", err)
+    }
+    period, err := ParsePeriod(s)
+    if err != nil {
+        return err
+    }
+    *p = period
+    return nil
+}
+
+// Policy sets how long documents of a class are kept
+type Policy struct {
+    Class  string `json:"class"`
+    Retain Period `json:"retain"`
+}
+
+// Config lists the retention policies
+type Config struct {
+    Policies []Policy `json:"policies"`
+
+    // DefaultClass applies to documents stored without a class. When empty they are
+    // kept indefinitely.
+    DefaultClass string `json:"default_class,omitempty"`
+}
+
+// LoadConfig reads a JSON retention configuration file
+func LoadConfig(path string) (*Config, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read retention config: %w", err)
+    }
+
+    var cfg Config
+    if err := json.Unmarshal(data, &cfg); err != nil {
+        return nil, fmt.Errorf("failed to parse retention config: %w", err)
+    }
+    if err := cfg.Validate(); err != nil {
+        return nil, err
+    }
+    return &cfg, nil
+}
+
+// Validate checks the configuration
+func (cfg *Config) Validate() error {
+    if len(cfg.Policies) == 0 {
+        return fmt.Errorf("retention config lists no policies")
+    }
+
+    seen := make(map[string]bool)
+    for i, policy := range cfg.Policies {
+        if policy.Class == "" {
+            return fmt.Errorf("retention policy %d has no class", i)
+        }
+        if seen[policy.Class] {
+            return fmt.Errorf("retention class %s is defined twice", policy.Class)
+        }
+        if policy.Retain.IsZero() {
+            return fmt.Errorf("retention class %s has no retention period", policy.Class)
+        }
+        seen[policy.Class] = true
+    }
+
+    if cfg.DefaultClass != "" && !seen[cfg.DefaultClass] {
+        return fmt.Errorf("default_class %s is not defined", cfg.DefaultClass)
+    }
+    return nil
+}
+
+// Policy returns the policy applying to documents stored with class
+func (cfg *Config) Policy(class string) (Policy, bool) {
+    if class == "" {
+        class = cfg.DefaultClass
+    }
+    for _, policy := range cfg.Policies {
+        if policy.Class == class {
+            return policy, true
+        }
+    }
+    return Policy{}, false
+}
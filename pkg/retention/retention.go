@@ -0,0 +1,183 @@
+package retention
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/pinning"
+    "quantum-doc-verify/pkg/storage"
+)
+
+// Registry is the document registry holding retention records
+type Registry interface {
+    // RetentionRecords returns the retention record of every document
+    RetentionRecords() []blockchain.RetentionRecord
+
+    // MarkReleased records that a document's content was released
+    MarkReleased(hash string, releasedAt time.Time) error
+}
+
+// Options selects where expired content is released
+type Options struct {
+    // Store holds the documents. It must implement storage.Unpinner.
+    Store storage.DocumentStore
+
+    // Pinning lists the remote pinning services to remove pins from (optional)
+    Pinning *pinning.Config
+
+    // GC runs garbage collection on the store after releasing content, if it needs it
+    GC bool
+
+    // DryRun reports what would be released without changing anything
+    DryRun bool
+}
+
+// Report describes one evaluation of the retention policies
+type Report struct {
+    GeneratedAt time.Time `json:"generatedAt"`
+    DryRun      bool      `json:"dryRun"`
+
+    // Evaluated counts the documents not released before this run
+    Evaluated int `json:"evaluated"`
+
+    // Retained counts the documents still within their retention period
+    Retained int `json:"retained"`
+
+    Released []Release `json:"released"`
+    Failed   []Release `json:"failed,omitempty"`
+
+    // Unclassified lists the hashes of documents whose class has no policy. They are
+    // kept.
+    Unclassified []string `json:"unclassified,omitempty"`
+
+    // Collected is the number of blocks removed by garbage collection
+    Collected int    `json:"collected,omitempty"`
+    GCError   string `json:"gcError,omitempty"`
+}
+
+// Release describes a document whose retention period has ended
+type Release struct {
+    Hash      string    `json:"hash"`
+    CID       string    `json:"cid"`
+    Class     string    `json:"class"`
+    StoredAt  time.Time `json:"storedAt"`
+    ExpiredAt time.Time `json:"expiredAt"`
+
+    // CIDs lists the content released: the files of a bundle, then its root
+    CIDs []string `json:"cids"`
+
+    Error string `json:"error,omitempty"`
+}
+
+// Enforce releases every document of registry whose retention period ended before now.
+// A document's files are unpinned from the store and the pinning services, then the
+// document is marked released so that later runs skip it. Documents that fail are
+// reported and retried on the next run.
+func (cfg *Config) Enforce(ctx context.Context, registry Registry, opts Options, now time.Time) (*Report, error) {
+    unpinner, ok := opts.Store.(storage.Unpinner)
+    if !ok {
+        return nil, fmt.Errorf("store cannot unpin content")
+    }
+
+    report := &Report{GeneratedAt: now.UTC(), DryRun: opts.DryRun, Released: []Release{}}
+
+    // 1. Sort documents into those kept and those expired
+    var expired []Release
+    held := make(map[string]bool)
+    for _, record := range registry.RetentionRecords() {
+        if record.ReleasedAt != nil {
+            continue
+        }
+        report.Evaluated++
+
+        policy, ok := cfg.Policy(record.Class)
+        if !ok {
+            report.Unclassified = append(report.Unclassified, record.Hash)
+            held[record.CID] = true
+            continue
+        }
+        end := policy.Retain.End(record.StoredAt)
+        if now.Before(end) {
+            report.Retained++
+            held[record.CID] = true
+            continue
+        }
+        expired = append(expired, Release{
+            Hash:      record.Hash,
+            CID:       record.CID,
+            Class:     policy.Class,
+            StoredAt:  record.StoredAt,
+            ExpiredAt: end.UTC(),
+        })
+    }
+
+    // 2. Release each expired document, unless a retained document has the same content
+    for _, doc := range expired {
+        if held[doc.CID] {
+            report.Retained++
+            continue
+        }
+
+        err := cfg.release(ctx, unpinner, registry, opts, &doc, now)
+        if err != nil {
+            if ctx.Err() != nil {
+                return report, ctx.Err()
+            }
+            doc.Error = err.Error()
+            report.Failed = append(report.Failed, doc)
+            continue
+        }
+        report.Released = append(report.Released, doc)
+    }
+
+    // 3. Reclaim the space of unpinned content
+    if opts.GC && !opts.DryRun && len(report.Released) > 0 {
+        if collector, ok := opts.Store.(storage.GarbageCollector); ok {
+            n, err := collector.GC(ctx)
+            report.Collected = n
+            if err != nil {
+                report.GCError = err.Error()
+            }
+        }
+    }
+    return report, nil
+}
+
+// release unpins the content of one document everywhere and marks it released
+func (cfg *Config) release(ctx context.Context, unpinner storage.Unpinner, registry Registry, opts Options, doc *Release, now time.Time) error {
+    // Bundle files are stored separately, so each is released before the root
+    bundle, err := storage.OpenBundle(ctx, opts.Store, doc.CID)
+    switch {
+    case err == nil:
+        for _, link := range bundle.Links {
+            doc.CIDs = append(doc.CIDs, link.Cid.String())
+        }
+    case errors.Is(err, storage.ErrNotBundle), errors.Is(err, storage.ErrNotFound):
+    default:
+        return fmt.Errorf("failed to open bundle: %w", err)
+    }
+    doc.CIDs = append(doc.CIDs, doc.CID)
+
+    if opts.DryRun {
+        return nil
+    }
+
+    for _, cid := range doc.CIDs {
+        if err := unpinner.Unpin(ctx, cid); err != nil {
+            return err
+        }
+        if opts.Pinning != nil {
+            if _, err := opts.Pinning.Unpin(ctx, cid); err != nil {
+                return err
+            }
+        }
+    }
+
+    if err := registry.MarkReleased(doc.Hash, now); err != nil {
+        return fmt.Errorf("failed to mark %s released: %w", doc.Hash, err)
+    }
+    return nil
+}
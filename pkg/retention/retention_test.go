@@ -0,0 +1,158 @@
+package retention_test
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "testing"
+    "time"
+
+    "quantum-doc-verify/pkg/blockchain"
+    "quantum-doc-verify/pkg/pinning"
+    "quantum-doc-verify/pkg/pinning/pinningtest"
+    "quantum-doc-verify/pkg/retention"
+    "quantum-doc-verify/pkg/storage"
+)
+
+// fakeRegistry keeps retention records in memory
+type fakeRegistry struct {
+    records map[string]blockchain.RetentionRecord
+}
+
+func (r *fakeRegistry) RetentionRecords() []blockchain.RetentionRecord {
+    var records []blockchain.RetentionRecord
+    for _, record := range r.records {
+        records = append(records, record)
+    }
+    return records
+}
+
+func (r *fakeRegistry) MarkReleased(hash string, releasedAt time.Time) error {
+    record := r.records[hash]
+    record.ReleasedAt = &releasedAt
+    r.records[hash] = record
+    return nil
+}
+
+func TestParsePeriod(t *testing.T) {
+    leapDay := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+    for text, want := range map[string]time.Time{
+        "1y":  time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+        "90d": time.Date(2024, 5, 29, 12, 0, 0, 0, time.UTC),
+        "2w":  time.Date(2024, 3, 14, 12, 0, 0, 0, time.UTC),
+        "36h": time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+    } {
+        period, err := retention.ParsePeriod(text)
+        if err != nil {
+            t.Fatalf("ParsePeriod(%q) failed: %v", text, err)
+        }
+        if got := period.End(leapDay); !got.Equal(want) {
+            t.Fatalf("%s from %s ends %s, want %s", text, leapDay, got, want)
+        }
+    }
+
+    for _, text := range []string{"", "7x", "0d", "-1y", "y"} {
+        if _, err := retention.ParsePeriod(text); err == nil {
+            t.Fatalf("Expected %q to be rejected", text)
+        }
+    }
+
+    var cfg retention.Config
+    data := `{"policies": [{"class": "tax", "retain": "7y"}, {"class": "tax", "retain": "90d"}]}`
+    if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+        t.Fatalf("Failed to parse config: %v", err)
+    }
+    if err := cfg.Validate(); err == nil {
+        t.Fatalf("Expected a duplicate class to be rejected")
+    }
+}
+
+func TestEnforce(t *testing.T) {
+    ctx := context.Background()
+    store, err := storage.NewFileStore(t.TempDir())
+    if err != nil {
+        t.Fatalf("Failed to create file store: %v", err)
+    }
+
+    svc := pinningtest.NewService("token")
+    defer svc.Close()
+    pins := &pinning.Config{Services: []pinning.ServiceConfig{{Name: "fake", Endpoint: svc.URL, AccessToken: "token"}}}
+    if err := pins.Validate(); err != nil {
+        t.Fatalf("Invalid pinning config: %v", err)
+    }
+    clients, _ := pins.Clients()
+
+    // Three documents stored a year ago: one kept for 90 days, one for 7 years and one
+    // without a policy
+    storedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+    now := storedAt.AddDate(1, 0, 0)
+    registry := &fakeRegistry{records: make(map[string]blockchain.RetentionRecord)}
+    roots := make(map[string]string)
+    for _, class := range []string{"temporary", "tax", "unknown"} {
+        manifest, _ := json.Marshal(storage.Manifest{Version: storage.ManifestVersion, Hash: class, RetentionClass: class})
+        root, err := storage.PutBundle(ctx, store, []storage.BundleFile{
+            {Name: storage.BundlePayloadFile, Content: bytes.NewReader([]byte("payload of " + class))},
+            {Name: storage.BundleManifestFile, Content: bytes.NewReader(manifest)},
+        })
+        if err != nil {
+            t.Fatalf("PutBundle failed: %v", err)
+        }
+        if _, err := pinning.PinQuorum(ctx, clients, pinning.Pin{CID: root}, 1, time.Millisecond); err != nil {
+            t.Fatalf("Failed to pin %s: %v", class, err)
+        }
+        roots[class] = root
+        registry.records[class] = blockchain.RetentionRecord{Hash: class, CID: root, Class: class, StoredAt: storedAt}
+    }
+
+    cfg := &retention.Config{}
+    if err := json.Unmarshal([]byte(`{"policies": [{"class": "temporary", "retain": "90d"}, {"class": "tax", "retain": "7y"}]}`), cfg); err != nil {
+        t.Fatalf("Failed to parse config: %v", err)
+    }
+    opts := retention.Options{Store: store, Pinning: pins, DryRun: true}
+
+    // A dry run reports the expired document without touching it
+    report, err := cfg.Enforce(ctx, registry, opts, now)
+    if err != nil {
+        t.Fatalf("Dry run failed: %v", err)
+    }
+    if report.Evaluated != 3 || report.Retained != 1 || len(report.Released) != 1 || len(report.Unclassified) != 1 {
+        t.Fatalf("Unexpected dry run report: %+v", report)
+    }
+    if released := report.Released[0]; released.Hash != "temporary" || len(released.CIDs) != 3 || !released.ExpiredAt.Equal(storedAt.AddDate(0, 0, 90)) {
+        t.Fatalf("Unexpected release: %+v", released)
+    }
+    if !svc.Pinned(roots["temporary"]) || registry.records["temporary"].ReleasedAt != nil {
+        t.Fatalf("Dry run changed state")
+    }
+
+    // The real run unpins the bundle everywhere and marks it released
+    opts.DryRun = false
+    report, err = cfg.Enforce(ctx, registry, opts, now)
+    if err != nil || len(report.Released) != 1 || len(report.Failed) != 0 {
+        t.Fatalf("Unexpected report: %+v (%v)", report, err)
+    }
+    for _, cid := range report.Released[0].CIDs {
+        if _, err := store.Get(ctx, cid); !errors.Is(err, storage.ErrNotFound) {
+            t.Fatalf("Expected %s to be removed, got %v", cid, err)
+        }
+        if _, err := store.GetBlock(ctx, cid); !errors.Is(err, storage.ErrNotFound) {
+            t.Fatalf("Expected block %s to be removed, got %v", cid, err)
+        }
+    }
+    if svc.Pinned(roots["temporary"]) || registry.records["temporary"].ReleasedAt == nil {
+        t.Fatalf("Expected the pin to be removed and the document marked released")
+    }
+    if !svc.Pinned(roots["tax"]) {
+        t.Fatalf("Retained document lost its pin")
+    }
+    if _, err := storage.OpenBundle(ctx, store, roots["tax"]); err != nil {
+        t.Fatalf("Retained bundle is no longer readable: %v", err)
+    }
+
+    // Released documents are skipped by later runs
+    report, err = cfg.Enforce(ctx, registry, opts, now)
+    if err != nil || report.Evaluated != 2 || len(report.Released) != 0 {
+        t.Fatalf("Unexpected report after release: %+v (%v)", report, err)
+    }
+}
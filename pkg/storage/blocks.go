@@ -0,0 +1,371 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+
+    gocid "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// maxBlockSize bounds a single block read from a store
+const maxBlockSize = 2 << 20
+
+// BlockStore is implemented by stores that can hold single IPLD blocks alongside files,
+// such as the UnixFS directory node of a bundle. Blocks are verified against their CID
+// in both directions.
+type BlockStore interface {
+    // PutBlock stores data, which must hash to cid
+    PutBlock(ctx context.Context, cid string, data []byte) error
+
+    // GetBlock returns the block with the given CID
+    GetBlock(ctx context.Context, cid string) ([]byte, error)
+}
+
+// verifyBlock checks that data is the block addressed by cid
+func verifyBlock(cid string, data []byte) error {
+    c, err := gocid.Decode(cid)
+    if err != nil {
+        return fmt.Errorf("invalid CID %q: %w", cid, err)
+    }
+    return unixfs.VerifyBlock(c, data)
+}
+
+// readBlock reads a block of at most maxBlockSize bytes and verifies it
+func readBlock(cid string, r io.Reader) ([]byte, error) {
+    data, err := io.ReadAll(io.LimitReader(r, maxBlockSize+1))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read block: %w", err)
+    }
+    if len(data) > maxBlockSize {
+        return nil, fmt.Errorf("block %s exceeds %d bytes", cid, maxBlockSize)
+    }
+    if err := verifyBlock(cid, data); err != nil {
+        return nil, err
+    }
+    return data, nil
+}
+
+// PutBlock implements BlockStore using "ipfs block put"
+func (c *IPFSClient) PutBlock(ctx context.Context, cid string, data []byte) error {
+    expected, err := gocid.Decode(cid)
+    if err != nil {
+        return fmt.Errorf("invalid CID %q: %w", cid, err)
+    }
+    if err := unixfs.VerifyBlock(expected, data); err != nil {
+        return err
+    }
+
+    codec := "raw"
+    if expected.Type() == gocid.DagProtobuf {
+        codec = "dag-pb"
+    } else if expected.Type() != gocid.Raw {
+        return fmt.Errorf("unsupported block codec 0x%x", expected.Type())
+    }
+    // The node hashes the block itself, so it must use the CID's hash function
+    mhtype, ok := multihash.Codes[expected.Prefix().MhType]
+    if !ok {
+        return fmt.Errorf("unsupported hash function 0x%x", expected.Prefix().MhType)
+    }
+
+    var body bytes.Buffer
+    writer := multipart.NewWriter(&body)
+    part, err := writer.CreateFormFile("file", "block")
+    if err != nil {
+        return fmt.Errorf("failed to create form file: %w", err)
+    }
+    part.Write(data)
+    writer.Close()
+
+    query := url.Values{
+        "cid-codec": {codec},
+        "mhtype":    {mhtype},
+        "pin":       {"false"},
+    }
+    resp, err := c.do(ctx, func() (*http.Request, error) {
+        req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL+"/block/put?"+query.Encode(), bytes.NewReader(body.Bytes()))
+        if err != nil {
+            return nil, err
+        }
+        req.Header.Set("Content-Type", writer.FormDataContentType())
+        return req, nil
+    })
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+// GetBlock implements BlockStore using "ipfs block get"
+func (c *IPFSClient) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+
+    endpoint := fmt.Sprintf("%s/block/get?arg=%s", c.apiURL, url.QueryEscape(cid))
+    resp, err := c.do(ctx, func() (*http.Request, error) {
+        return http.NewRequestWithContext(ctx, "POST", endpoint, nil)
+    })
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    return readBlock(cid, resp.Body)
+}
+
+// PutBlock implements BlockStore. Blocks are kept apart from files, in a "blocks"
+// directory sharded like the files.
+func (s *FileStore) PutBlock(ctx context.Context, cid string, data []byte) error {
+    if err := verifyBlock(cid, data); err != nil {
+        return err
+    }
+
+    path := s.blockPath(cid)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return fmt.Errorf("failed to create shard directory: %w", err)
+    }
+
+    tmp, err := os.CreateTemp(s.root, ".put-*")
+    if err != nil {
+        return fmt.Errorf("failed to create temporary file: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return fmt.Errorf("failed to write block: %w", err)
+    }
+    if err := tmp.Close(); err != nil {
+        return fmt.Errorf("failed to write block: %w", err)
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return fmt.Errorf("failed to store block: %w", err)
+    }
+    return nil
+}
+
+// GetBlock implements BlockStore
+func (s *FileStore) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+
+    file, err := os.Open(s.blockPath(cid))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open block: %w", err)
+    }
+    defer file.Close()
+
+    return readBlock(cid, file)
+}
+
+func (s *FileStore) blockPath(cid string) string {
+    return filepath.Join(s.root, "blocks", cid[len(cid)-2:], cid)
+}
+
+// PutBlock implements BlockStore. Blocks are stored as objects keyed by CID under "blocks/".
+func (s *S3Store) PutBlock(ctx context.Context, cid string, data []byte) error {
+    if err := verifyBlock(cid, data); err != nil {
+        return err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "PUT", s.objectURL("blocks/"+cid), bytes.NewReader(data))
+    if err != nil {
+        return fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/octet-stream")
+
+    payloadHash := sha256.Sum256(data)
+    s.sign(req, hex.EncodeToString(payloadHash[:]))
+
+    resp, err := s.httpClient.Do(req)
+    if err != nil {
+        return networkError(ctx, "failed to send request to S3", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        body, _ := io.ReadAll(resp.Body)
+        return fmt.Errorf("S3 returned error: %s (status %d)", string(body), resp.StatusCode)
+    }
+    return nil
+}
+
+// GetBlock implements BlockStore
+func (s *S3Store) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "GET", s.objectURL("blocks/"+cid), nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    s.sign(req, emptyPayloadHash)
+
+    resp, err := s.httpClient.Do(req)
+    if err != nil {
+        return nil, networkError(ctx, "failed to send request to S3", err)
+    }
+    defer resp.Body.Close()
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+        return readBlock(cid, resp.Body)
+    case http.StatusNotFound:
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    default:
+        body, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("S3 returned error: %s (status %d)", string(body), resp.StatusCode)
+    }
+}
+
+// PutBlock implements BlockStore, succeeding once WriteQuorum replicas store the block
+func (s *ReplicatedStore) PutBlock(ctx context.Context, cid string, data []byte) error {
+    var errs []error
+    stored := 0
+    for _, target := range s.available() {
+        blocks, ok := target.Store.(BlockStore)
+        if !ok {
+            errs = append(errs, fmt.Errorf("%s: store does not support blocks", target.Name))
+            continue
+        }
+
+        err := blocks.PutBlock(ctx, cid, data)
+        target.record(err, s.now(), s.probeInterval)
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+            continue
+        }
+        stored++
+    }
+
+    if stored < s.writeQuorum {
+        return fmt.Errorf("block stored on %d replicas, quorum is %d: %w", stored, s.writeQuorum, errors.Join(errs...))
+    }
+    return nil
+}
+
+// GetBlock implements BlockStore, asking the available replicas in turn
+func (s *ReplicatedStore) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    var errs []error
+    notFound := true
+    for _, target := range s.available() {
+        blocks, ok := target.Store.(BlockStore)
+        if !ok {
+            continue
+        }
+
+        data, err := blocks.GetBlock(ctx, cid)
+        target.record(err, s.now(), s.probeInterval)
+        if err == nil {
+            return data, nil
+        }
+        errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+        notFound = notFound && errors.Is(err, ErrNotFound)
+    }
+
+    if notFound {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    return nil, fmt.Errorf("no replica returned block %s: %w", cid, errors.Join(errs...))
+}
+
+// PutBlock implements BlockStore; gateways are read-only
+func (g *GatewayStore) PutBlock(ctx context.Context, cid string, data []byte) error {
+    return fmt.Errorf("HTTP gateways are read-only")
+}
+
+// GetBlock implements BlockStore using the trustless gateway raw block response
+func (g *GatewayStore) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    root, err := gocid.Decode(cid)
+    if err != nil {
+        return nil, fmt.Errorf("invalid CID %q: %w", cid, err)
+    }
+
+    var errs []error
+    notFound := true
+    for _, gw := range g.gateways {
+        data, err := g.fetchBlock(ctx, gw, root)
+        if err == nil {
+            return data, nil
+        }
+        if ctx.Err() != nil {
+            return nil, err
+        }
+        errs = append(errs, err)
+        notFound = notFound && errors.Is(err, ErrNotFound)
+    }
+
+    if notFound {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    return nil, fmt.Errorf("no gateway returned block %s: %w", cid, errors.Join(errs...))
+}
+
+// fetchBlock requests a single raw block from one gateway
+func (g *GatewayStore) fetchBlock(ctx context.Context, gateway string, c gocid.Cid) ([]byte, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", gatewayEndpoint(gateway, c), nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("Accept", "application/vnd.ipld.raw")
+
+    resp, err := g.httpClient.Do(req)
+    if err != nil {
+        return nil, networkError(ctx, "failed to contact gateway "+gateway, err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, fmt.Errorf("%w: %s on %s", ErrNotFound, c, gateway)
+    }
+    if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/vnd.ipld.raw") {
+        return nil, fmt.Errorf("gateway %s returned status %d (%s)", gateway, resp.StatusCode, resp.Header.Get("Content-Type"))
+    }
+    return readBlock(c.String(), resp.Body)
+}
+
+// PutBlock implements BlockStore on the primary store
+func (s *fallbackStore) PutBlock(ctx context.Context, cid string, data []byte) error {
+    blocks, ok := s.DocumentStore.(BlockStore)
+    if !ok {
+        return fmt.Errorf("store does not support blocks")
+    }
+    return blocks.PutBlock(ctx, cid, data)
+}
+
+// GetBlock tries the primary store, then the gateways
+func (s *fallbackStore) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    var err error
+    if blocks, ok := s.DocumentStore.(BlockStore); ok {
+        data, primaryErr := blocks.GetBlock(ctx, cid)
+        if primaryErr == nil || ctx.Err() != nil {
+            return data, primaryErr
+        }
+        err = primaryErr
+    }
+
+    data, gwErr := s.gateways.GetBlock(ctx, cid)
+    if gwErr != nil {
+        return nil, errors.Join(err, gwErr)
+    }
+    return data, nil
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "time"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// A bundle is a UnixFS directory holding everything needed to verify a document from
+// its root CID alone: the (encrypted) payload, the signature container, a manifest
+// describing the document and, optionally, the signer's certificate.
+const (
+    BundlePayloadFile     = "document"
+    BundleSignatureFile   = "signature.json"
+    BundleManifestFile    = "manifest.json"
+    BundleCertificateFile = "signer.crt"
+
+    // ManifestVersion is the version of the manifest format written by this release
+    ManifestVersion = 1
+
+    // maxMetadataSize bounds the manifest and signature container
+    maxMetadataSize = 1 << 20
+)
+
+// ErrNotBundle is returned when a CID does not address a document bundle
+var ErrNotBundle = errors.New("not a document bundle")
+
+// Manifest describes the document held in a bundle
+type Manifest struct {
+    Version            int    `json:"version"`
+    FileName           string `json:"fileName"`
+    MediaType          string `json:"mediaType"`
+    Size               int64  `json:"size"`
+    Hash               string `json:"hash"`
+    HashAlgorithm      string `json:"hashAlgorithm"`
+    SignatureAlgorithm string `json:"signatureAlgorithm"`
+    SignerKeyID        string `json:"signerKeyId"`
+    Encrypted          bool   `json:"encrypted"`
+
+    // RetentionClass names the retention policy the document was stored under
+    RetentionClass string `json:"retentionClass,omitempty"`
+}
+
+// SignatureContainer holds the signature over the plaintext document
+type SignatureContainer struct {
+    Algorithm string    `json:"algorithm"`
+    KeyID     string    `json:"keyId"`
+    PublicKey []byte    `json:"publicKey,omitempty"`
+    Signature []byte    `json:"signature"`
+    Created   time.Time `json:"created"`
+}
+
+// BundleFile is one file to add to a bundle
+type BundleFile struct {
+    Name    string
+    Content io.Reader
+    Size    int64
+}
+
+// PutBundle stores each file and then a UnixFS directory linking them by name, returning
+// the directory's CID. The store must implement BlockStore to hold the directory node.
+func PutBundle(ctx context.Context, store DocumentStore, files []BundleFile) (string, error) {
+    blocks, ok := store.(BlockStore)
+    if !ok {
+        return "", fmt.Errorf("store cannot hold directories")
+    }
+
+    var links []unixfs.Link
+    for _, file := range files {
+        link, err := putBundleFile(ctx, store, file)
+        if err != nil {
+            return "", fmt.Errorf("failed to store %s: %w", file.Name, err)
+        }
+        links = append(links, link)
+    }
+
+    root, block, err := unixfs.Directory(links, 1)
+    if err != nil {
+        return "", fmt.Errorf("failed to build bundle directory: %w", err)
+    }
+    if err := blocks.PutBlock(ctx, root.String(), block); err != nil {
+        return "", fmt.Errorf("failed to store bundle directory: %w", err)
+    }
+    return root.String(), nil
+}
+
+// putBundleFile stores one file and returns its directory entry. The stores add files
+// with either CIDv0 or CIDv1 defaults, so both layouts are computed while uploading to
+// find the size of the DAG the store built.
+func putBundleFile(ctx context.Context, store DocumentStore, file BundleFile) (unixfs.Link, error) {
+    builders := []*unixfs.Builder{
+        unixfs.NewBuilder(unixfs.DefaultOptions(0)),
+        unixfs.NewBuilder(unixfs.DefaultOptions(1)),
+    }
+    tee := io.TeeReader(file.Content, io.MultiWriter(builders[0], builders[1]))
+
+    cid, err := store.Put(ctx, tee, StoreOptions{Size: file.Size})
+    if err != nil {
+        return unixfs.Link{}, err
+    }
+    c, err := gocid.Decode(cid)
+    if err != nil {
+        return unixfs.Link{}, fmt.Errorf("store returned invalid CID %q: %w", cid, err)
+    }
+
+    link := unixfs.Link{Name: file.Name, Cid: c, Size: builders[0].Size()}
+    for _, builder := range builders {
+        if root, err := builder.Sum(); err == nil && root.Equals(c) {
+            link.Size = builder.DagSize()
+        }
+    }
+    return link, nil
+}
+
+// Bundle is an opened document bundle
+type Bundle struct {
+    Root  string
+    Links []unixfs.Link
+    store DocumentStore
+}
+
+// OpenBundle reads the directory of a bundle. It returns ErrNotBundle if root addresses
+// anything other than a directory holding a manifest, including when the store cannot
+// hold directories.
+func OpenBundle(ctx context.Context, store DocumentStore, root string) (*Bundle, error) {
+    c, err := gocid.Decode(root)
+    if err != nil {
+        return nil, fmt.Errorf("invalid CID %q: %w", root, err)
+    }
+    blocks, ok := store.(BlockStore)
+    if !ok || c.Type() != gocid.DagProtobuf {
+        return nil, ErrNotBundle
+    }
+
+    block, err := blocks.GetBlock(ctx, root)
+    if errors.Is(err, ErrNotFound) {
+        // Stores that keep blocks apart from files do not have the root as a block
+        return nil, ErrNotBundle
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read bundle directory: %w", err)
+    }
+    links, err := unixfs.DecodeDirectory(block)
+    if errors.Is(err, unixfs.ErrNotDirectory) {
+        return nil, ErrNotBundle
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    b := &Bundle{Root: root, Links: links, store: store}
+    if !b.Has(BundleManifestFile) {
+        return nil, ErrNotBundle
+    }
+    return b, nil
+}
+
+// Has reports whether the bundle contains the named file
+func (b *Bundle) Has(name string) bool {
+    _, ok := b.link(name)
+    return ok
+}
+
+// Open opens a file of the bundle, verified against its CID as it is read
+func (b *Bundle) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+    link, ok := b.link(name)
+    if !ok {
+        return nil, fmt.Errorf("%w: %s/%s", ErrNotFound, b.Root, name)
+    }
+    return b.store.Get(ctx, link.Cid.String())
+}
+
+// ReadFile reads a small file of the bundle completely
+func (b *Bundle) ReadFile(ctx context.Context, name string) ([]byte, error) {
+    reader, err := b.Open(ctx, name)
+    if err != nil {
+        return nil, err
+    }
+    defer reader.Close()
+
+    data, err := io.ReadAll(io.LimitReader(reader, maxMetadataSize+1))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read %s: %w", name, err)
+    }
+    if len(data) > maxMetadataSize {
+        return nil, fmt.Errorf("%s exceeds %d bytes", name, maxMetadataSize)
+    }
+    return data, nil
+}
+
+// Manifest reads and parses the bundle's manifest
+func (b *Bundle) Manifest(ctx context.Context) (*Manifest, error) {
+    data, err := b.ReadFile(ctx, BundleManifestFile)
+    if err != nil {
+        return nil, err
+    }
+
+    var manifest Manifest
+    if err := json.Unmarshal(data, &manifest); err != nil {
+        return nil, fmt.Errorf("invalid manifest: %w", err)
+    }
+    if manifest.Version != ManifestVersion {
+        return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+    }
+    return &manifest, nil
+}
+
+// Signature reads and parses the bundle's signature container
+func (b *Bundle) Signature(ctx context.Context) (*SignatureContainer, error) {
+    data, err := b.ReadFile(ctx, BundleSignatureFile)
+    if err != nil {
+        return nil, err
+    }
+
+    var container SignatureContainer
+    if err := json.Unmarshal(data, &container); err != nil {
+        return nil, fmt.Errorf("invalid signature container: %w", err)
+    }
+    return &container, nil
+}
+
+func (b *Bundle) link(name string) (unixfs.Link, bool) {
+    for _, l := range b.Links {
+        if l.Name == name {
+            return l, true
+        }
+    }
+    return unixfs.Link{}, false
+}
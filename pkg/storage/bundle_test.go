@@ -0,0 +1,76 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "testing"
+)
+
+func TestBundle(t *testing.T) {
+    ctx := context.Background()
+    fs, err := NewFileStore(t.TempDir())
+    if err != nil {
+        t.Fatalf("Failed to create file store: %v", err)
+    }
+    replicas := []Replica{{Name: "a", Store: fs}}
+    other, _ := NewFileStore(t.TempDir())
+    replicas = append(replicas, Replica{Name: "b", Store: other})
+    replicated, _ := NewReplicatedStore(replicas, 2)
+
+    payload := bytes.Repeat([]byte("encrypted payload "), 40000)
+    manifest, _ := json.Marshal(Manifest{Version: ManifestVersion, FileName: "policy.pdf", Hash: "abc123"})
+    signature, _ := json.Marshal(SignatureContainer{Algorithm: "Dilithium2", KeyID: "k1", Signature: []byte{1, 2, 3}})
+
+    for name, store := range map[string]DocumentStore{"file": fs, "replicated": replicated} {
+        root, err := PutBundle(ctx, store, []BundleFile{
+            {Name: BundlePayloadFile, Content: bytes.NewReader(payload), Size: int64(len(payload))},
+            {Name: BundleManifestFile, Content: bytes.NewReader(manifest)},
+            {Name: BundleSignatureFile, Content: bytes.NewReader(signature)},
+        })
+        if err != nil {
+            t.Fatalf("%s: PutBundle failed: %v", name, err)
+        }
+
+        bundle, err := OpenBundle(ctx, store, root)
+        if err != nil {
+            t.Fatalf("%s: OpenBundle failed: %v", name, err)
+        }
+        if m, err := bundle.Manifest(ctx); err != nil || m.FileName != "policy.pdf" || m.Hash != "abc123" {
+            t.Fatalf("%s: unexpected manifest %+v (%v)", name, m, err)
+        }
+        if c, err := bundle.Signature(ctx); err != nil || c.KeyID != "k1" || !bytes.Equal(c.Signature, []byte{1, 2, 3}) {
+            t.Fatalf("%s: unexpected signature container %+v (%v)", name, c, err)
+        }
+        if bundle.Has(BundleCertificateFile) {
+            t.Fatalf("%s: bundle reports a certificate it does not have", name)
+        }
+
+        reader, err := bundle.Open(ctx, BundlePayloadFile)
+        if err != nil {
+            t.Fatalf("%s: failed to open payload: %v", name, err)
+        }
+        got, err := io.ReadAll(reader)
+        reader.Close()
+        if err != nil || !bytes.Equal(got, payload) {
+            t.Fatalf("%s: payload differs (%v)", name, err)
+        }
+
+        // Plain files and directories without a manifest are not bundles
+        file, _ := store.Put(ctx, bytes.NewReader(payload), StoreOptions{})
+        if _, err := OpenBundle(ctx, store, file); !errors.Is(err, ErrNotBundle) {
+            t.Fatalf("%s: expected ErrNotBundle for a file, got %v", name, err)
+        }
+        dir, _ := PutBundle(ctx, store, []BundleFile{{Name: "other", Content: bytes.NewReader(payload)}})
+        if _, err := OpenBundle(ctx, store, dir); !errors.Is(err, ErrNotBundle) {
+            t.Fatalf("%s: expected ErrNotBundle without a manifest, got %v", name, err)
+        }
+    }
+
+    // A store that cannot hold directories is rejected up front
+    if _, err := PutBundle(ctx, &faultyStore{DocumentStore: fs}, nil); err == nil {
+        t.Fatalf("Expected a store without block support to be rejected")
+    }
+}
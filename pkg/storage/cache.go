@@ -0,0 +1,530 @@
+package storage
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+const (
+    // DefaultCacheSize is the default limit on the total size of cached documents
+    DefaultCacheSize = 1 << 30
+
+    // DefaultCacheTTL is how long a cached document is kept without being read
+    DefaultCacheTTL = 7 * 24 * time.Hour
+
+    // cacheTempPrefix marks documents still being written to the cache
+    cacheTempPrefix = ".add-"
+
+    // cacheLayoutSuffix names the file recording the DAG layout of an entry that was not
+    // built with one of the layouts unixfs.Verifier tries by default
+    cacheLayoutSuffix = ".layout"
+)
+
+// CacheFlagUsage is the help text of the --cache-dir flag shared by the command-line tools
+const CacheFlagUsage = "Directory of the local document cache, shared by the CLIs and the API server (empty disables caching)"
+
+// CacheOptions configures a Cache
+type CacheOptions struct {
+    // Dir is the cache directory. Processes using the same directory share the cache.
+    Dir string
+
+    // MaxSize is the limit on the total size of cached documents in bytes
+    MaxSize int64
+
+    // TTL is how long a document is kept after it was last read
+    TTL time.Duration
+}
+
+// DefaultCacheOptions returns the options of the cache shared by the CLIs and the server
+func DefaultCacheOptions() CacheOptions {
+    return CacheOptions{Dir: DefaultCacheDir(), MaxSize: DefaultCacheSize, TTL: DefaultCacheTTL}
+}
+
+// DefaultCacheDir returns the per-user cache directory for documents
+func DefaultCacheDir() string {
+    dir, err := os.UserCacheDir()
+    if err != nil {
+        dir = os.TempDir()
+    }
+    return filepath.Join(dir, "quantum-doc-verify", "documents")
+}
+
+// Cache keeps retrieved documents on disk, keyed by CID. Entries are written with an
+// atomic rename, so several processes can share a directory.
+//
+// Each entry's modification time records when it was last read. Once the cache grows
+// past MaxSize the least recently read entries are evicted, and entries not read
+// within TTL expire. Every read re-verifies the entry against its CID; an entry that
+// no longer matches is removed and treated as a miss. Documents are checked before they
+// are added, too: those stored with another chunker are only cached if their layout can
+// be read from the store's blocks, and is then kept with the entry.
+type Cache struct {
+    dir     string
+    maxSize int64
+    ttl     time.Duration
+    now     func() time.Time
+
+    // mu serializes trimming within the process
+    mu sync.Mutex
+}
+
+// CacheStats describes the contents of a cache
+type CacheStats struct {
+    Dir          string    `json:"dir"`
+    Entries      int       `json:"entries"`
+    Size         int64     `json:"size"`
+    MaxSize      int64     `json:"maxSize"`
+    TTL          string    `json:"ttl"`
+    Expired      int       `json:"expired"`
+    OldestAccess time.Time `json:"oldestAccess,omitempty"`
+    NewestAccess time.Time `json:"newestAccess,omitempty"`
+}
+
+// cacheLayout is the layout recorded with an entry; the CID gives the rest of the options
+type cacheLayout struct {
+    RawLeaves bool `json:"rawLeaves"`
+    ChunkSize int  `json:"chunkSize"`
+    MaxLinks  int  `json:"maxLinks"`
+}
+
+// layoutFunc finds the layout of a document's DAG
+type layoutFunc func() (unixfs.Options, error)
+
+// cacheEntry is a cached document found while scanning the cache
+type cacheEntry struct {
+    path     string
+    size     int64
+    accessed time.Time
+}
+
+// OpenCache opens or creates the cache in opts.Dir
+func OpenCache(opts CacheOptions) (*Cache, error) {
+    if opts.Dir == "" {
+        return nil, fmt.Errorf("cache requires a directory")
+    }
+    if opts.MaxSize <= 0 {
+        return nil, fmt.Errorf("cache size must be positive")
+    }
+    if opts.TTL <= 0 {
+        return nil, fmt.Errorf("cache TTL must be positive")
+    }
+
+    if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+        return nil, fmt.Errorf("failed to create cache directory: %w", err)
+    }
+
+    return &Cache{dir: opts.Dir, maxSize: opts.MaxSize, ttl: opts.TTL, now: time.Now}, nil
+}
+
+// Open returns the cached document for cid, after checking it still hashes to cid.
+// Missing, expired and corrupted entries return ErrNotFound.
+func (c *Cache) Open(cid string) (io.ReadCloser, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+    path := c.path(cid)
+
+    file, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open cache entry: %w", err)
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, fmt.Errorf("failed to open cache entry: %w", err)
+    }
+    if c.expired(info.ModTime()) {
+        file.Close()
+        removeCacheEntry(path)
+        return nil, fmt.Errorf("%w: %s (cache entry expired)", ErrNotFound, cid)
+    }
+
+    var layouts []unixfs.Options
+    if data, err := os.ReadFile(path + cacheLayoutSuffix); err == nil {
+        var layout cacheLayout
+        if json.Unmarshal(data, &layout) == nil {
+            layouts = append(layouts, unixfs.Options{RawLeaves: layout.RawLeaves, ChunkSize: layout.ChunkSize, MaxLinks: layout.MaxLinks})
+        }
+    }
+    if err := verifyCacheFile(cid, file, layouts...); err != nil {
+        file.Close()
+        removeCacheEntry(path)
+        return nil, fmt.Errorf("%w: %s (cache entry removed: %v)", ErrNotFound, cid, err)
+    }
+
+    now := c.now()
+    os.Chtimes(path, now, now)
+    return file, nil
+}
+
+// add returns a reader passing r through that saves the document in the cache once it
+// has been read to the end and checked against cid, using the layout found by infer if
+// none of the default ones match. Caching is best effort: errors writing the cache, or
+// content that cannot be verified, only mean the document is not cached.
+func (c *Cache) add(cid string, r io.ReadCloser, infer layoutFunc) io.ReadCloser {
+    tmp, err := os.CreateTemp(c.dir, cacheTempPrefix+"*")
+    if err != nil {
+        return r
+    }
+    return &cachingReader{ReadCloser: r, cache: c, cid: cid, tmp: tmp, infer: infer}
+}
+
+// commit verifies a completely written document, moves it into place with its layout if
+// it needs one and trims the cache
+func (c *Cache) commit(cid string, tmp *os.File, infer layoutFunc) {
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+
+    var layout []byte
+    if err := verifyCacheFile(cid, tmp); err != nil {
+        if infer == nil {
+            return
+        }
+        opts, err := infer()
+        if err != nil || verifyCacheFile(cid, tmp, opts) != nil {
+            return
+        }
+        layout, err = json.Marshal(cacheLayout{RawLeaves: opts.RawLeaves, ChunkSize: opts.ChunkSize, MaxLinks: opts.MaxLinks})
+        if err != nil {
+            return
+        }
+    }
+    if err := tmp.Close(); err != nil {
+        return
+    }
+
+    path := c.path(cid)
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return
+    }
+    os.Remove(path + cacheLayoutSuffix)
+    if layout != nil {
+        // The layout goes in first, so that an entry is never found without it
+        if err := writeFileAtomic(path+cacheLayoutSuffix, layout); err != nil {
+            return
+        }
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return
+    }
+    now := c.now()
+    os.Chtimes(path, now, now)
+
+    c.Prune()
+}
+
+// Prune removes expired entries, then evicts the least recently read entries until the
+// cache fits its size limit. It returns the number of entries removed.
+func (c *Cache) Prune() (int, error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    entries, err := c.scan()
+    if err != nil {
+        return 0, err
+    }
+
+    removed := 0
+    var kept []cacheEntry
+    var size int64
+    for _, entry := range entries {
+        if c.expired(entry.accessed) {
+            if removeCacheEntry(entry.path) == nil {
+                removed++
+            }
+            continue
+        }
+        kept = append(kept, entry)
+        size += entry.size
+    }
+
+    sort.Slice(kept, func(i, j int) bool { return kept[i].accessed.Before(kept[j].accessed) })
+    for _, entry := range kept {
+        if size <= c.maxSize {
+            break
+        }
+        if removeCacheEntry(entry.path) == nil {
+            removed++
+        }
+        size -= entry.size
+    }
+    return removed, nil
+}
+
+// Purge removes every entry from the cache and returns the number removed
+func (c *Cache) Purge() (int, error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    entries, err := c.scan()
+    if err != nil {
+        return 0, err
+    }
+
+    removed := 0
+    for _, entry := range entries {
+        if err := removeCacheEntry(entry.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+            return removed, fmt.Errorf("failed to remove cache entry: %w", err)
+        }
+        removed++
+    }
+    return removed, nil
+}
+
+// Remove deletes the entry for cid, if there is one
+func (c *Cache) Remove(cid string) error {
+    if err := validateCID(cid); err != nil {
+        return err
+    }
+    if err := removeCacheEntry(c.path(cid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+        return fmt.Errorf("failed to remove cache entry: %w", err)
+    }
+    return nil
+}
+
+// Stats describes the current contents of the cache
+func (c *Cache) Stats() (CacheStats, error) {
+    stats := CacheStats{Dir: c.dir, MaxSize: c.maxSize, TTL: c.ttl.String()}
+
+    entries, err := c.scan()
+    if err != nil {
+        return stats, err
+    }
+    for _, entry := range entries {
+        stats.Entries++
+        stats.Size += entry.size
+        if c.expired(entry.accessed) {
+            stats.Expired++
+        }
+        if stats.OldestAccess.IsZero() || entry.accessed.Before(stats.OldestAccess) {
+            stats.OldestAccess = entry.accessed
+        }
+        if entry.accessed.After(stats.NewestAccess) {
+            stats.NewestAccess = entry.accessed
+        }
+    }
+    return stats, nil
+}
+
+// scan lists the cached documents, skipping documents still being written and layouts
+func (c *Cache) scan() ([]cacheEntry, error) {
+    var entries []cacheEntry
+    err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            if errors.Is(err, os.ErrNotExist) {
+                return nil
+            }
+            return err
+        }
+        if d.IsDir() || strings.HasPrefix(d.Name(), cacheTempPrefix) || strings.HasSuffix(d.Name(), cacheLayoutSuffix) {
+            return nil
+        }
+
+        info, err := d.Info()
+        if errors.Is(err, os.ErrNotExist) {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        entries = append(entries, cacheEntry{path: path, size: info.Size(), accessed: info.ModTime()})
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to scan cache: %w", err)
+    }
+    return entries, nil
+}
+
+func (c *Cache) expired(accessed time.Time) bool {
+    return c.now().Sub(accessed) > c.ttl
+}
+
+func (c *Cache) path(cid string) string {
+    return filepath.Join(c.dir, cid[len(cid)-2:], cid)
+}
+
+// verifyCacheFile checks that file hashes to cid with one of the default layouts or
+// layouts, and rewinds it
+func verifyCacheFile(cid string, file *os.File, layouts ...unixfs.Options) error {
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        return err
+    }
+    verifier, err := unixfs.NewVerifier(cid, layouts...)
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(verifier, file); err != nil {
+        return err
+    }
+    if err := verifier.Verify(); err != nil {
+        return err
+    }
+    _, err = file.Seek(0, io.SeekStart)
+    return err
+}
+
+// removeCacheEntry removes the entry at path and its layout
+func removeCacheEntry(path string) error {
+    os.Remove(path + cacheLayoutSuffix)
+    return os.Remove(path)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+    tmp, err := os.CreateTemp(filepath.Dir(path), cacheTempPrefix+"*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// cachingReader copies a document into the cache as it is read
+type cachingReader struct {
+    io.ReadCloser
+    cache   *Cache
+    cid     string
+    tmp     *os.File
+    infer   layoutFunc
+    written int64
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+    n, err := r.ReadCloser.Read(p)
+    if r.tmp == nil {
+        return n, err
+    }
+
+    if n > 0 {
+        r.written += int64(n)
+        if r.written > r.cache.maxSize {
+            // Too large to ever fit
+            r.discard()
+        } else if _, werr := r.tmp.Write(p[:n]); werr != nil {
+            r.discard()
+        }
+    }
+    if err == io.EOF && r.tmp != nil {
+        r.cache.commit(r.cid, r.tmp, r.infer)
+        r.tmp = nil
+    } else if err != nil && err != io.EOF {
+        r.discard()
+    }
+    return n, err
+}
+
+func (r *cachingReader) Close() error {
+    r.discard()
+    return r.ReadCloser.Close()
+}
+
+func (r *cachingReader) discard() {
+    if r.tmp != nil {
+        r.tmp.Close()
+        os.Remove(r.tmp.Name())
+        r.tmp = nil
+    }
+}
+
+// contentAddresser is implemented by stores whose Get returns a document addressed by
+// another CID than the one it is requested by, such as ErasureStore
+type contentAddresser interface {
+    ContentCID(ctx context.Context, cid string) (string, error)
+}
+
+// cachedStore serves documents from a Cache in front of another store
+type cachedStore struct {
+    DocumentStore
+    cache *Cache
+}
+
+// WithCache wraps store so that Get serves documents from cache when it can, and caches
+// documents read from store. Writes go to store only. With a nil cache store is
+// returned as is.
+func WithCache(store DocumentStore, cache *Cache) DocumentStore {
+    if cache == nil {
+        return store
+    }
+    return &cachedStore{DocumentStore: store, cache: cache}
+}
+
+// Get reads from the cache, then from the store. Documents of stores that address them
+// by another CID are cached under the CID of their content, which is looked up first.
+func (s *cachedStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    key := cid
+    if addresser, ok := s.DocumentStore.(contentAddresser); ok {
+        contentCID, err := addresser.ContentCID(ctx, cid)
+        if err != nil {
+            return nil, err
+        }
+        key = contentCID
+    }
+    if reader, err := s.cache.Open(key); err == nil {
+        return reader, nil
+    }
+
+    reader, err := s.DocumentStore.Get(ctx, cid)
+    if err != nil {
+        return nil, err
+    }
+
+    // Documents stored with another chunker are verified with the layout of their DAG
+    var infer layoutFunc
+    if blocks, ok := s.DocumentStore.(BlockStore); ok {
+        infer = func() (unixfs.Options, error) {
+            root, err := gocid.Decode(key)
+            if err != nil {
+                return unixfs.Options{}, err
+            }
+            return unixfs.InferOptions(root, func(c gocid.Cid) ([]byte, error) {
+                return blocks.GetBlock(ctx, c.String())
+            })
+        }
+    }
+    return s.cache.add(key, reader, infer), nil
+}
+
+// PutBlock implements BlockStore on the underlying store
+func (s *cachedStore) PutBlock(ctx context.Context, cid string, data []byte) error {
+    blocks, ok := s.DocumentStore.(BlockStore)
+    if !ok {
+        return fmt.Errorf("store does not support blocks")
+    }
+    return blocks.PutBlock(ctx, cid, data)
+}
+
+// GetBlock implements BlockStore on the underlying store. Blocks are small and are not
+// cached.
+func (s *cachedStore) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    blocks, ok := s.DocumentStore.(BlockStore)
+    if !ok {
+        return nil, fmt.Errorf("%w: store does not support blocks", ErrNotFound)
+    }
+    return blocks.GetBlock(ctx, cid)
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "os"
+    "testing"
+    "time"
+
+    "quantum-doc-verify/pkg/ipfs/ipfstest"
+)
+
+func TestCache(t *testing.T) {
+    ctx := context.Background()
+    fs, err := NewFileStore(t.TempDir())
+    if err != nil {
+        t.Fatalf("Failed to create file store: %v", err)
+    }
+    backend := &faultyStore{DocumentStore: fs}
+
+    cache, err := OpenCache(CacheOptions{Dir: t.TempDir(), MaxSize: 2500, TTL: time.Hour})
+    if err != nil {
+        t.Fatalf("Failed to open cache: %v", err)
+    }
+    now := time.Now()
+    cache.now = func() time.Time { return now }
+    store := WithCache(backend, cache)
+
+    docs := map[string][]byte{}
+    var cids []string
+    for _, fill := range []string{"a", "b", "c"} {
+        content := bytes.Repeat([]byte(fill), 1000)
+        cid, err := store.Put(ctx, bytes.NewReader(content), StoreOptions{})
+        if err != nil {
+            t.Fatalf("Put failed: %v", err)
+        }
+        docs[cid] = content
+        cids = append(cids, cid)
+    }
+    backend.calls.Store(0)
+
+    read := func(cid string) {
+        t.Helper()
+        reader, err := store.Get(ctx, cid)
+        if err != nil {
+            t.Fatalf("Get failed: %v", err)
+        }
+        content, err := io.ReadAll(reader)
+        reader.Close()
+        if err != nil || !bytes.Equal(content, docs[cid]) {
+            t.Fatalf("Unexpected content for %s (%v)", cid, err)
+        }
+    }
+
+    // The second read is served from the cache
+    read(cids[0])
+    read(cids[0])
+    if n := backend.calls.Load(); n != 1 {
+        t.Fatalf("Expected 1 request to the store, got %d", n)
+    }
+
+    // Documents that are not read to the end are not cached
+    reader, _ := store.Get(ctx, cids[1])
+    reader.Read(make([]byte, 10))
+    reader.Close()
+    if stats, _ := cache.Stats(); stats.Entries != 1 || stats.Size != 1000 {
+        t.Fatalf("Unexpected stats after a partial read: %+v", stats)
+    }
+
+    // A corrupted entry is dropped and fetched again
+    os.WriteFile(cache.path(cids[0]), bytes.Repeat([]byte("x"), 1000), 0600)
+    backend.calls.Store(0)
+    read(cids[0])
+    read(cids[0])
+    if n := backend.calls.Load(); n != 1 {
+        t.Fatalf("Expected a corrupted entry to be fetched once, got %d requests", n)
+    }
+
+    // Over the size limit the least recently read document is evicted
+    now = now.Add(time.Minute)
+    read(cids[1])
+    now = now.Add(time.Minute)
+    read(cids[0])
+    now = now.Add(time.Minute)
+    read(cids[2])
+    if _, err := cache.Open(cids[1]); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected the least recently read document to be evicted, got %v", err)
+    }
+    if stats, _ := cache.Stats(); stats.Entries != 2 || stats.Size != 2000 {
+        t.Fatalf("Unexpected stats after eviction: %+v", stats)
+    }
+
+    // Entries not read within the TTL expire
+    now = now.Add(time.Hour - 30*time.Second)
+    if stats, _ := cache.Stats(); stats.Expired != 1 {
+        t.Fatalf("Expected 1 expired entry, got %+v", stats)
+    }
+    if _, err := cache.Open(cids[0]); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected an expired entry to be a miss, got %v", err)
+    }
+
+    if removed, err := cache.Purge(); err != nil || removed != 1 {
+        t.Fatalf("Purge removed %d entries (%v)", removed, err)
+    }
+    if stats, _ := cache.Stats(); stats.Entries != 0 {
+        t.Fatalf("Expected an empty cache after purge, got %+v", stats)
+    }
+}
+
+func TestCacheChunker(t *testing.T) {
+    ctx := context.Background()
+    node := ipfstest.NewServer()
+    defer node.Close()
+    client, err := NewIPFSClient(node.Addr())
+    if err != nil {
+        t.Fatalf("Failed to create client: %v", err)
+    }
+    cache, err := OpenCache(CacheOptions{Dir: t.TempDir(), MaxSize: 1 << 20, TTL: time.Hour})
+    if err != nil {
+        t.Fatalf("Failed to open cache: %v", err)
+    }
+    store := WithCache(client, cache)
+
+    // A layout the verifier does not try by default is read from the node's blocks
+    content := bytes.Repeat([]byte("Minutes of the annual general meeting\n"), 200)
+    cid, err := client.StoreReader(ctx, bytes.NewReader(content), StoreOptions{Chunker: "size-1024"})
+    if err != nil {
+        t.Fatalf("StoreReader failed: %v", err)
+    }
+    reader, err := store.Get(ctx, cid)
+    if err != nil {
+        t.Fatalf("Get failed: %v", err)
+    }
+    if retrieved, err := io.ReadAll(reader); err != nil || !bytes.Equal(retrieved, content) {
+        t.Fatalf("Retrieved content does not match stored content (%v)", err)
+    }
+    reader.Close()
+
+    // The entry verifies on every read, without the node
+    node.Close()
+    for i := 0; i < 2; i++ {
+        reader, err := store.Get(ctx, cid)
+        if err != nil {
+            t.Fatalf("Expected a cache hit, got %v", err)
+        }
+        retrieved, err := io.ReadAll(reader)
+        reader.Close()
+        if err != nil || !bytes.Equal(retrieved, content) {
+            t.Fatalf("Cached content does not match stored content (%v)", err)
+        }
+    }
+
+    // Removing the entry removes its layout too
+    if err := cache.Remove(cid); err != nil {
+        t.Fatalf("Remove failed: %v", err)
+    }
+    if _, err := os.Stat(cache.path(cid) + cacheLayoutSuffix); !errors.Is(err, os.ErrNotExist) {
+        t.Fatalf("Expected the layout to be removed with the entry, got %v", err)
+    }
+}
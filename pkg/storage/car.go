@@ -0,0 +1,296 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/car"
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// CARStore is a read-only store over the blocks of a CAR archive, so that documents and
+// bundles transferred offline can be read and verified without a node. The blocks are
+// spooled to a temporary directory, which Close removes.
+type CARStore struct {
+    // Roots are the root CIDs named in the archive header
+    Roots []string
+
+    blocks *FileStore
+    dir    string
+}
+
+// OpenCAR reads a CARv1 or CARv2 archive. Every block is verified against its CID as it
+// is read; use Verify to check that a root's DAG is complete.
+func OpenCAR(r io.Reader) (*CARStore, error) {
+    archive, err := car.NewReader(r)
+    if err != nil {
+        return nil, err
+    }
+
+    dir, err := os.MkdirTemp("", "qdv-car-*")
+    if err != nil {
+        return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+    }
+    s := &CARStore{dir: dir}
+    s.blocks, err = NewFileStore(dir)
+    if err != nil {
+        s.Close()
+        return nil, err
+    }
+    for _, root := range archive.Roots {
+        s.Roots = append(s.Roots, root.String())
+    }
+
+    for {
+        c, data, err := archive.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            s.Close()
+            return nil, fmt.Errorf("failed to read CAR archive: %w", err)
+        }
+        if err := s.blocks.PutBlock(context.Background(), c.String(), data); err != nil {
+            s.Close()
+            return nil, err
+        }
+    }
+    return s, nil
+}
+
+// Close removes the spooled blocks
+func (s *CARStore) Close() error {
+    return os.RemoveAll(s.dir)
+}
+
+// Put implements DocumentStore; archives are read-only
+func (s *CARStore) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    return "", fmt.Errorf("CAR archives are read-only")
+}
+
+// Get implements DocumentStore, reading the UnixFS file rooted at cid from the archive's
+// blocks. A block missing from the archive fails the read.
+func (s *CARStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    c, err := gocid.Decode(cid)
+    if err != nil {
+        return nil, fmt.Errorf("invalid CID %q: %w", cid, err)
+    }
+    if _, err := s.GetBlock(ctx, cid); err != nil {
+        return nil, err
+    }
+    return io.NopCloser(unixfs.NewFileReader(c, s.getBlock(ctx))), nil
+}
+
+// PutBlock implements BlockStore; archives are read-only
+func (s *CARStore) PutBlock(ctx context.Context, cid string, data []byte) error {
+    return fmt.Errorf("CAR archives are read-only")
+}
+
+// GetBlock implements BlockStore
+func (s *CARStore) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    data, err := s.blocks.GetBlock(ctx, cid)
+    if errors.Is(err, ErrNotFound) {
+        return nil, fmt.Errorf("%w: %s is not in the CAR archive", ErrNotFound, cid)
+    }
+    return data, err
+}
+
+// Verify checks that root is a root of the archive and that every block of its DAG is
+// present, returning the number of blocks
+func (s *CARStore) Verify(ctx context.Context, root string) (int, error) {
+    c, err := gocid.Decode(root)
+    if err != nil {
+        return 0, fmt.Errorf("invalid CID %q: %w", root, err)
+    }
+    isRoot := false
+    for _, r := range s.Roots {
+        if rc, err := gocid.Decode(r); err == nil && rc.Equals(c) {
+            isRoot = true
+        }
+    }
+    if !isRoot {
+        return 0, fmt.Errorf("%s is not a root of the CAR archive", root)
+    }
+
+    count := 0
+    err = unixfs.Walk(c, s.getBlock(ctx), func(gocid.Cid, []byte) error {
+        count++
+        return nil
+    })
+    if err != nil {
+        return 0, fmt.Errorf("incomplete DAG under %s: %w", root, err)
+    }
+    return count, nil
+}
+
+func (s *CARStore) getBlock(ctx context.Context) unixfs.BlockGetter {
+    return func(c gocid.Cid) ([]byte, error) {
+        return s.GetBlock(ctx, c.String())
+    }
+}
+
+// ExportCAR writes every block of the DAG rooted at root to w, returning the number of
+// blocks written. Blocks are read from the store where it holds them; stores that keep
+// whole files instead (the filesystem and S3 backends) have each file's blocks rebuilt
+// from its content with the layout that produced its CID.
+func ExportCAR(ctx context.Context, store DocumentStore, root string, w *car.Writer) (int, error) {
+    c, err := gocid.Decode(root)
+    if err != nil {
+        return 0, fmt.Errorf("invalid CID %q: %w", root, err)
+    }
+    e := &carExporter{store: store, w: w, seen: make(map[string]bool)}
+    if err := e.export(ctx, c); err != nil {
+        return 0, err
+    }
+    return len(e.seen), nil
+}
+
+// carExporter writes the blocks of a DAG to a CAR archive, each once
+type carExporter struct {
+    store DocumentStore
+    w     *car.Writer
+    seen  map[string]bool
+}
+
+func (e *carExporter) export(ctx context.Context, c gocid.Cid) error {
+    if e.seen[c.KeyString()] {
+        return nil
+    }
+
+    blocks, ok := e.store.(BlockStore)
+    if !ok {
+        return e.rebuild(ctx, c)
+    }
+    data, err := blocks.GetBlock(ctx, c.String())
+    if errors.Is(err, ErrNotFound) {
+        return e.rebuild(ctx, c)
+    }
+    if err != nil {
+        return err
+    }
+
+    if err := e.put(c, data); err != nil {
+        return err
+    }
+    links, err := unixfs.Links(c, data)
+    if err != nil {
+        return err
+    }
+    for _, link := range links {
+        if err := e.export(ctx, link); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// rebuild writes the blocks of a file the store holds as a whole
+func (e *carExporter) rebuild(ctx context.Context, c gocid.Cid) error {
+    reader, err := e.store.Get(ctx, c.String())
+    if err != nil {
+        return err
+    }
+    defer reader.Close()
+
+    opts := unixfs.DefaultOptions(int(c.Version()))
+    opts.HashFunction = c.Prefix().MhType
+    opts.OnBlock = e.put
+    built, err := unixfs.Compute(reader, opts)
+    if err != nil {
+        return fmt.Errorf("failed to export %s: %w", c, err)
+    }
+    if !built.Equals(c) {
+        return fmt.Errorf("cannot export %s: it was not stored with the default layout (rebuilt as %s)", c, built)
+    }
+    return nil
+}
+
+func (e *carExporter) put(c gocid.Cid, data []byte) error {
+    if e.seen[c.KeyString()] {
+        return nil
+    }
+    e.seen[c.KeyString()] = true
+    return e.w.Put(c, data)
+}
+
+// blockPinner is implemented by stores that keep every block of a DAG, such as an IPFS
+// node
+type blockPinner interface {
+    BlockStore
+    Pin(ctx context.Context, cid string) error
+}
+
+// ImportCAR loads the DAGs under the roots of an archive into store and returns the
+// roots. IPFS nodes receive every block and pin each root. Other stores receive each
+// file as a whole, plus the directory block of bundles; a file whose CID the store
+// would assign differently (another chunker or CID version) is rejected.
+func ImportCAR(ctx context.Context, store DocumentStore, archive *CARStore) ([]string, error) {
+    for _, root := range archive.Roots {
+        if _, err := archive.Verify(ctx, root); err != nil {
+            return nil, err
+        }
+        if err := importDAG(ctx, store, archive, root); err != nil {
+            return nil, fmt.Errorf("failed to import %s: %w", root, err)
+        }
+    }
+    return archive.Roots, nil
+}
+
+func importDAG(ctx context.Context, store DocumentStore, archive *CARStore, root string) error {
+    if pinner, ok := store.(blockPinner); ok {
+        c, _ := gocid.Decode(root)
+        err := unixfs.Walk(c, archive.getBlock(ctx), func(c gocid.Cid, data []byte) error {
+            return pinner.PutBlock(ctx, c.String(), data)
+        })
+        if err != nil {
+            return err
+        }
+        return pinner.Pin(ctx, root)
+    }
+
+    bundle, err := OpenBundle(ctx, archive, root)
+    switch {
+    case errors.Is(err, ErrNotBundle):
+        return importFile(ctx, store, archive, root)
+    case err != nil:
+        return err
+    }
+
+    blocks, ok := store.(BlockStore)
+    if !ok {
+        return fmt.Errorf("store cannot hold bundle directories")
+    }
+    for _, link := range bundle.Links {
+        if err := importFile(ctx, store, archive, link.Cid.String()); err != nil {
+            return err
+        }
+    }
+    directory, err := archive.GetBlock(ctx, root)
+    if err != nil {
+        return err
+    }
+    return blocks.PutBlock(ctx, root, directory)
+}
+
+// importFile stores the file rooted at cid and checks the store assigns it the same CID
+func importFile(ctx context.Context, store DocumentStore, archive *CARStore, cid string) error {
+    reader, err := archive.Get(ctx, cid)
+    if err != nil {
+        return err
+    }
+    defer reader.Close()
+
+    stored, err := store.Put(ctx, reader, StoreOptions{})
+    if err != nil {
+        return err
+    }
+    if stored != cid {
+        return fmt.Errorf("file %s was stored as %s; the store only keeps files in its default layout", cid, stored)
+    }
+    return nil
+}
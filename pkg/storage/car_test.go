@@ -0,0 +1,114 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io"
+    "os"
+    "path/filepath"
+    "testing"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/car"
+)
+
+func TestCARExportImport(t *testing.T) {
+    ctx := context.Background()
+    src, err := NewFileStore(t.TempDir())
+    if err != nil {
+        t.Fatalf("Failed to create file store: %v", err)
+    }
+
+    // A payload of several chunks, so the file has intermediate nodes
+    payload := bytes.Repeat([]byte("evidence exhibit 12 "), 60000)
+    manifest, _ := json.Marshal(Manifest{Version: ManifestVersion, FileName: "exhibit.pdf", Hash: "abc123"})
+    root, err := PutBundle(ctx, src, []BundleFile{
+        {Name: BundlePayloadFile, Content: bytes.NewReader(payload)},
+        {Name: BundleManifestFile, Content: bytes.NewReader(manifest)},
+    })
+    if err != nil {
+        t.Fatalf("PutBundle failed: %v", err)
+    }
+    rootCID, _ := gocid.Decode(root)
+
+    for _, version := range []int{1, 2} {
+        // Export
+        path := filepath.Join(t.TempDir(), "bundle.car")
+        out, _ := os.Create(path)
+        var w *car.Writer
+        if version == 1 {
+            w, err = car.NewWriter(out, []gocid.Cid{rootCID})
+        } else {
+            w, err = car.NewWriterV2(out, []gocid.Cid{rootCID})
+        }
+        if err != nil {
+            t.Fatalf("v%d: failed to create CAR writer: %v", version, err)
+        }
+        exported, err := ExportCAR(ctx, src, root, w)
+        if err != nil {
+            t.Fatalf("v%d: ExportCAR failed: %v", version, err)
+        }
+        if err := w.Close(); err != nil {
+            t.Fatalf("v%d: failed to close CAR writer: %v", version, err)
+        }
+        out.Close()
+
+        // Verify offline
+        in, _ := os.Open(path)
+        archive, err := OpenCAR(in)
+        in.Close()
+        if err != nil {
+            t.Fatalf("v%d: OpenCAR failed: %v", version, err)
+        }
+        defer archive.Close()
+        if n, err := archive.Verify(ctx, root); err != nil || n != exported || n < 5 {
+            t.Fatalf("v%d: Verify returned %d blocks of %d (%v)", version, n, exported, err)
+        }
+        bundle, err := OpenBundle(ctx, archive, root)
+        if err != nil {
+            t.Fatalf("v%d: OpenBundle on archive failed: %v", version, err)
+        }
+        if m, err := bundle.Manifest(ctx); err != nil || m.Hash != "abc123" {
+            t.Fatalf("v%d: unexpected manifest %+v (%v)", version, m, err)
+        }
+
+        // Import into an empty store
+        dst, _ := NewFileStore(t.TempDir())
+        roots, err := ImportCAR(ctx, dst, archive)
+        if err != nil || len(roots) != 1 || roots[0] != root {
+            t.Fatalf("v%d: ImportCAR returned %v (%v)", version, roots, err)
+        }
+        imported, err := OpenBundle(ctx, dst, root)
+        if err != nil {
+            t.Fatalf("v%d: imported bundle cannot be opened: %v", version, err)
+        }
+        reader, err := imported.Open(ctx, BundlePayloadFile)
+        if err != nil {
+            t.Fatalf("v%d: failed to open imported payload: %v", version, err)
+        }
+        got, err := io.ReadAll(reader)
+        reader.Close()
+        if err != nil || !bytes.Equal(got, payload) {
+            t.Fatalf("v%d: imported payload differs (%v)", version, err)
+        }
+    }
+
+    // An archive missing a block is incomplete
+    var buf bytes.Buffer
+    w, _ := car.NewWriter(&buf, []gocid.Cid{rootCID})
+    directory, _ := src.GetBlock(ctx, root)
+    w.Put(rootCID, directory)
+    archive, err := OpenCAR(&buf)
+    if err != nil {
+        t.Fatalf("OpenCAR failed: %v", err)
+    }
+    defer archive.Close()
+    if _, err := archive.Verify(ctx, root); err == nil {
+        t.Fatalf("Expected an incomplete archive to fail verification")
+    }
+    if _, err := ImportCAR(ctx, src, archive); err == nil {
+        t.Fatalf("Expected an incomplete archive to be refused on import")
+    }
+}
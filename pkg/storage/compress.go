@@ -0,0 +1,187 @@
+package storage
+
+import (
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+    "strings"
+
+    "github.com/klauspost/compress/zstd"
+    "golang.org/x/crypto/sha3"
+)
+
+// Compression codec IDs, recorded in FieldCompression. Content is compressed before it
+// is encrypted, since ciphertext does not compress.
+const (
+    CompressionNone uint8 = 0
+    CompressionGzip uint8 = 1
+    CompressionZstd uint8 = 2
+)
+
+// CompressionFlagUsage is the help text of the --compress flag shared by the command-line tools
+const CompressionFlagUsage = "Compress the document before encryption: none, gzip or zstd (worthwhile for text such as XML or logs)"
+
+// MaxDecompressedSize bounds the content decompressed from an envelope that does not
+// record its size, so that a small envelope cannot expand without limit
+var MaxDecompressedSize int64 = 4 << 30
+
+// maxZstdWindow bounds the memory a zstd frame may ask the decoder to allocate. The
+// encoder used by this package never needs more than 8 MiB.
+const maxZstdWindow = 64 << 20
+
+// ErrDecompressedSize is returned when decompressed content exceeds its size limit
+var ErrDecompressedSize = errors.New("decompressed document exceeds size limit")
+
+// ParseCompression returns the codec ID for a codec name
+func ParseCompression(name string) (uint8, error) {
+    switch strings.ToLower(name) {
+    case "", "none":
+        return CompressionNone, nil
+    case "gzip":
+        return CompressionGzip, nil
+    case "zstd":
+        return CompressionZstd, nil
+    default:
+        return 0, fmt.Errorf("unknown compression codec %q (expected none, gzip or zstd)", name)
+    }
+}
+
+// CompressionName returns the name of a codec ID
+func CompressionName(codec uint8) string {
+    switch codec {
+    case CompressionNone:
+        return "none"
+    case CompressionGzip:
+        return "gzip"
+    case CompressionZstd:
+        return "zstd"
+    default:
+        return fmt.Sprintf("codec %d", codec)
+    }
+}
+
+// newCompressWriter returns a writer compressing into w. Close flushes the compressed
+// stream but does not close w.
+func newCompressWriter(codec uint8, w io.Writer) (io.WriteCloser, error) {
+    switch codec {
+    case CompressionGzip:
+        return gzip.NewWriter(w), nil
+    case CompressionZstd:
+        return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+    default:
+        return nil, fmt.Errorf("unsupported compression codec %d", codec)
+    }
+}
+
+// compress compresses content in memory
+func compress(codec uint8, content []byte) ([]byte, error) {
+    var buf bytes.Buffer
+    zw, err := newCompressWriter(codec, &buf)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := zw.Write(content); err != nil {
+        return nil, fmt.Errorf("failed to compress document: %w", err)
+    }
+    if err := zw.Close(); err != nil {
+        return nil, fmt.Errorf("failed to compress document: %w", err)
+    }
+    return buf.Bytes(), nil
+}
+
+// decompressReader decompresses the plaintext of a compressed envelope. It stops with
+// ErrDecompressedSize as soon as the output passes its limit, and checks the output
+// against the header's document hash at EOF.
+type decompressReader struct {
+    r       io.Reader
+    closer  func()
+    limit   int64
+    exact   bool
+    read    int64
+    hasher  hash.Hash
+    wantSum []byte
+    err     error
+}
+
+// newDecompressReader decompresses r as described by header. The output is limited to
+// the content size recorded in the header, or to MaxDecompressedSize if there is none.
+func newDecompressReader(header *EnvelopeHeader, r io.Reader) (io.Reader, error) {
+    dr := &decompressReader{limit: MaxDecompressedSize}
+    if header.ContentSize > 0 {
+        if header.ContentSize > MaxDecompressedSize {
+            return nil, fmt.Errorf("%w: header declares %d bytes", ErrDecompressedSize, header.ContentSize)
+        }
+        dr.limit = header.ContentSize
+        dr.exact = true
+    }
+    if header.DocumentHash != nil {
+        dr.hasher = sha3.New256()
+        dr.wantSum = header.DocumentHash
+    }
+
+    switch header.Compression {
+    case CompressionGzip:
+        zr, err := gzip.NewReader(r)
+        if err != nil {
+            return nil, fmt.Errorf("failed to decompress document: %w", err)
+        }
+        dr.r = zr
+    case CompressionZstd:
+        zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+        if err != nil {
+            return nil, fmt.Errorf("failed to decompress document: %w", err)
+        }
+        dr.r = zr
+        dr.closer = zr.Close
+    default:
+        return nil, fmt.Errorf("unsupported compression codec %d", header.Compression)
+    }
+    return dr, nil
+}
+
+func (dr *decompressReader) Read(p []byte) (int, error) {
+    if dr.err != nil {
+        return 0, dr.err
+    }
+
+    // Read at most one byte past the limit, to tell content that ends at the limit
+    // from content that exceeds it
+    if remaining := dr.limit - dr.read + 1; int64(len(p)) > remaining {
+        p = p[:remaining]
+    }
+    n, err := dr.r.Read(p)
+    dr.read += int64(n)
+    if dr.read > dr.limit {
+        return 0, dr.fail(fmt.Errorf("%w (%d bytes)", ErrDecompressedSize, dr.limit))
+    }
+    if dr.hasher != nil {
+        dr.hasher.Write(p[:n])
+    }
+
+    switch {
+    case err == io.EOF:
+        if dr.exact && dr.read != dr.limit {
+            return n, dr.fail(fmt.Errorf("decompressed document is %d bytes, header declares %d", dr.read, dr.limit))
+        }
+        if dr.hasher != nil && !bytes.Equal(dr.hasher.Sum(nil), dr.wantSum) {
+            return n, dr.fail(fmt.Errorf("document hash does not match envelope header"))
+        }
+        dr.fail(io.EOF)
+    case err != nil:
+        return n, dr.fail(fmt.Errorf("failed to decompress document: %w", err))
+    }
+    return n, err
+}
+
+// fail records the reader's final error and releases the decoder
+func (dr *decompressReader) fail(err error) error {
+    dr.err = err
+    if dr.closer != nil {
+        dr.closer()
+        dr.closer = nil
+    }
+    return err
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "testing"
+
+    "golang.org/x/crypto/sha3"
+)
+
+func TestCompressedEnvelope(t *testing.T) {
+    var filing bytes.Buffer
+    for i := 0; filing.Len() < 200000; i++ {
+        fmt.Fprintf(&filing, "<entry id=\"%d\"><account>ACC-%06d</account><amount>%d.00</amount></entry>\n", i, i%1000, i*7)
+    }
+    content := filing.Bytes()
+    documentHash := sha3.Sum256(content)
+
+    plain, err := EncryptDocument(content, nil)
+    if err != nil {
+        t.Fatalf("EncryptDocument failed: %v", err)
+    }
+
+    for _, codec := range []uint8{CompressionGzip, CompressionZstd} {
+        name := CompressionName(codec)
+
+        // Whole-document envelopes
+        envelope, err := EncryptDocumentCompressed(content, nil, codec)
+        if err != nil {
+            t.Fatalf("%s: failed to encrypt: %v", name, err)
+        }
+        if len(envelope)*5 > len(plain) {
+            t.Fatalf("%s: compressed envelope is %d bytes, uncompressed %d", name, len(envelope), len(plain))
+        }
+        opened, header, err := OpenEnvelope(envelope, nil)
+        if err != nil || !bytes.Equal(opened, content) {
+            t.Fatalf("%s: round trip failed: %v", name, err)
+        }
+        if header.Version != EnvelopeVersionCompressed || header.Compression != codec || header.ContentSize != int64(len(content)) {
+            t.Fatalf("%s: unexpected header %+v", name, header)
+        }
+
+        // Streaming envelopes, with and without the content size
+        for _, size := range []int64{0, int64(len(content))} {
+            envelope := sealStream(t, content, EnvelopeOptions{
+                DocumentHash: documentHash[:],
+                SegmentSize:  testSegmentSize,
+                Compression:  codec,
+                ContentSize:  size,
+            })
+            opened, err := openStream(envelope, nil)
+            if err != nil || !bytes.Equal(opened, content) {
+                t.Fatalf("%s: streaming round trip failed: %v", name, err)
+            }
+        }
+    }
+
+    // A declared size that does not match the content is refused when sealing
+    var buf bytes.Buffer
+    w, _ := NewEncryptWriter(&buf, EnvelopeOptions{Compression: CompressionZstd, ContentSize: 10})
+    w.Write(content)
+    if err := w.Close(); err == nil {
+        t.Fatalf("Expected a content size mismatch to be reported")
+    }
+
+    if _, err := ParseCompression("brotli"); err == nil {
+        t.Fatalf("Expected an unknown codec to be rejected")
+    }
+}
+
+func TestDecompressionLimit(t *testing.T) {
+    defer func(limit int64) { MaxDecompressedSize = limit }(MaxDecompressedSize)
+    MaxDecompressedSize = 1 << 20
+
+    // 8 MiB of zeros compresses to a few kilobytes
+    bomb := make([]byte, 8<<20)
+    for _, codec := range []uint8{CompressionGzip, CompressionZstd} {
+        name := CompressionName(codec)
+
+        // Without a recorded size the global limit applies
+        envelope := sealStream(t, bomb, EnvelopeOptions{Compression: codec, SegmentSize: DefaultSegmentSize})
+        if len(envelope) > 1<<20 {
+            t.Fatalf("%s: envelope unexpectedly large: %d bytes", name, len(envelope))
+        }
+        if _, err := openStream(envelope, nil); !errors.Is(err, ErrDecompressedSize) {
+            t.Fatalf("%s: expected ErrDecompressedSize, got %v", name, err)
+        }
+
+        // A recorded size above the limit is refused before decompressing
+        envelope, err := EncryptDocumentCompressed(bomb, nil, codec)
+        if err != nil {
+            t.Fatalf("%s: failed to encrypt: %v", name, err)
+        }
+        if _, err := DecryptDocument(envelope, nil); !errors.Is(err, ErrDecompressedSize) {
+            t.Fatalf("%s: expected ErrDecompressedSize, got %v", name, err)
+        }
+    }
+}
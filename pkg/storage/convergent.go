@@ -0,0 +1,54 @@
+package storage
+
+import (
+    "fmt"
+    "io"
+
+    "golang.org/x/crypto/hkdf"
+    "golang.org/x/crypto/sha3"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+// Convergent envelopes (KEMConvergent) derive the content key and nonce from a tenant
+// secret, the document's SHA3-256 hash and the rest of the header instead of generating
+// them randomly:
+//
+//	key || nonce  HKDF-SHA3-256(secret = tenant key, salt = document hash,
+//	                            info = convergentInfo || header without its nonce)
+//
+// Identical documents sealed with the same options under the same tenant key therefore
+// produce identical envelopes and dedupe to the same CID. Binding the header (suite,
+// compression, segment size, media type, file name and so on) means two envelopes of
+// the same document that differ anywhere else never reuse a key and nonce pair for
+// different ciphertexts. No key material is stored in the header; FieldTenantKeyID names
+// the tenant key and holders of it re-derive the content key from the header.
+//
+// This trades confidentiality for storage: anyone holding the tenant key can confirm
+// whether a guessed document is stored (and read it), and equal CIDs reveal that two
+// uploads are the same document. The KEM ID flags every convergent envelope, so readers
+// and auditors can tell them apart from randomly keyed ones.
+
+// convergentInfo domain-separates the content key and nonce of convergent envelopes
+var convergentInfo = []byte("quantum-doc-verify envelope v1 convergent content key")
+
+// convergentKey derives the content key and a nonce of nonceSize bytes for the document
+// described by h. The nonce in h, if any, is ignored.
+func convergentKey(tenantKey []byte, h *EnvelopeHeader, nonceSize int) ([]byte, []byte, error) {
+    if !crypto.IsTenantKey(tenantKey) {
+        return nil, nil, fmt.Errorf("tenant key must be %d bytes", crypto.TenantKeySize)
+    }
+    if len(h.DocumentHash) != 32 {
+        return nil, nil, fmt.Errorf("convergent encryption requires the document's SHA3-256 hash")
+    }
+
+    bound := *h
+    bound.nonce = nil
+    info := append(append([]byte(nil), convergentInfo...), bound.marshal()...)
+
+    material := make([]byte, 32+nonceSize)
+    if _, err := io.ReadFull(hkdf.New(sha3.New256, tenantKey, h.DocumentHash, info), material); err != nil {
+        return nil, nil, fmt.Errorf("failed to derive convergent content key: %w", err)
+    }
+    return material[:32], material[32:], nil
+}
@@ -0,0 +1,736 @@
+package storage
+
+import (
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+
+    "golang.org/x/crypto/hkdf"
+    "golang.org/x/crypto/sha3"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+// Envelope format, version 1 (all integers big-endian):
+//
+//	magic      "QDVE"
+//	version    uint8
+//	suite      uint16   cipher suite ID
+//	kem        uint16   key encapsulation mechanism ID
+//	fieldsLen  uint32   length of the header fields that follow
+//	fields     repeated [type uint8][length uint32][value]
+//	ciphertext          AEAD output; the header (magic through fields) is the associated data
+//
+// SuiteAES256GCMStream replaces the single AEAD output with a sequence of segments (see
+// stream.go), so documents can be encrypted and decrypted without holding them in memory.
+//
+// Readers skip field types they do not recognise, so fields can be added without a new
+// version. A new version is only needed when existing readers must refuse the envelope.
+//
+// Version 2 envelopes carry a FieldCompression codec: the content was compressed before
+// encryption, and FieldDocumentHash still covers the uncompressed content. Version 1
+// readers would return the compressed bytes, so they must refuse these envelopes.
+
+// EnvelopeMagic identifies an encrypted document envelope
+const EnvelopeMagic = "QDVE"
+
+// EnvelopeVersion is the envelope format version written by this package for
+// uncompressed content
+const EnvelopeVersion = 1
+
+// EnvelopeVersionCompressed is the version written for compressed content
+const EnvelopeVersionCompressed = 2
+
+// Cipher suite IDs
+const (
+    // SuiteAES256GCM encrypts the whole document with AES-256-GCM
+    SuiteAES256GCM uint16 = 1
+
+    // SuiteAES256GCMStream encrypts the document as a sequence of AES-256-GCM segments
+    SuiteAES256GCMStream uint16 = 2
+)
+
+// KEM IDs
+const (
+    // KEMNone carries the content key in the header itself. It provides integrity and
+    // identity binding but no confidentiality beyond access to the envelope, matching the
+    // behaviour of the legacy format.
+    KEMNone uint16 = 0
+
+    // KEMMLKEM768 encapsulates the content key to each recipient's ML-KEM-768 public key
+    KEMMLKEM768 uint16 = 1
+
+    // KEMConvergent derives the content key from a tenant secret and the document hash,
+    // so identical documents produce identical envelopes (see convergent.go)
+    KEMConvergent uint16 = 2
+
+    // KEMThreshold splits the content key into Shamir shares, each encapsulated to a
+    // custodian's ML-KEM-768 public key, so that a threshold of custodians must cooperate
+    // to decrypt (see threshold.go)
+    KEMThreshold uint16 = 3
+)
+
+// Header field types
+const (
+    FieldMediaType    uint8 = 1
+    FieldFileName     uint8 = 2
+    FieldDocumentHash uint8 = 3
+    FieldNonce        uint8 = 4
+    FieldContentKey   uint8 = 5
+    FieldRecipient    uint8 = 6
+    FieldSegmentSize  uint8 = 7
+    FieldCompression  uint8 = 8
+    FieldContentSize  uint8 = 9
+    FieldTenantKeyID  uint8 = 10
+    FieldThreshold    uint8 = 11
+)
+
+// envelopePrefixSize is the size of magic, version, suite, kem and fieldsLen
+const envelopePrefixSize = 4 + 1 + 2 + 2 + 4
+
+// keyWrapInfo domain-separates the key-wrapping key derived from a KEM shared secret
+var keyWrapInfo = []byte("quantum-doc-verify envelope v1 key wrap")
+
+var (
+    // ErrUnsupportedEnvelopeVersion is returned for envelopes written by a newer format version
+    ErrUnsupportedEnvelopeVersion = errors.New("unsupported envelope version")
+
+    // ErrNotRecipient is returned when the private key does not match any recipient, or
+    // is not the tenant key of a convergent envelope
+    ErrNotRecipient = errors.New("key is not a recipient of this document")
+
+    // ErrSharesRequired is returned when a threshold envelope is opened with anything but
+    // the content key recombined from custodian shares
+    ErrSharesRequired = errors.New("document is split among custodians: combine their shares to decrypt it")
+)
+
+// EnvelopeOptions describes the document being sealed
+type EnvelopeOptions struct {
+    MediaType string
+    FileName  string
+
+    // Recipients are ML-KEM-768 public keys. With no recipients the envelope uses KEMNone.
+    Recipients [][]byte
+
+    // TenantKey selects convergent encryption (KEMConvergent): the content key is derived
+    // from this tenant secret and the document hash, and readers need the same secret.
+    // It cannot be combined with Recipients. Identical documents only dedupe if the rest
+    // of the options, such as FileName, are identical too.
+    TenantKey []byte
+
+    // Custodians selects threshold encryption (KEMThreshold): the content key is split
+    // into one share per custodian ML-KEM-768 public key, and any Threshold of the
+    // shares recover it. It cannot be combined with Recipients or TenantKey.
+    Custodians [][]byte
+    Threshold  int
+
+    // DocumentHash is the SHA3-256 hash of the content. SealEnvelope computes it; streaming
+    // writers cannot, so it is optional there and checked against the content on Close.
+    DocumentHash []byte
+
+    // SegmentSize is the plaintext size of each segment written by NewEncryptWriter
+    // (default DefaultSegmentSize)
+    SegmentSize int
+
+    // Compression is the codec the content is compressed with before encryption
+    // (default CompressionNone)
+    Compression uint8
+
+    // ContentSize is the size of the content before compression. SealEnvelope sets it;
+    // streaming writers record it when given and check it on Close. Readers use it to
+    // bound decompression.
+    ContentSize int64
+}
+
+// EnvelopeField is a header field
+type EnvelopeField struct {
+    Type  uint8
+    Value []byte
+}
+
+// EnvelopeHeader is the parsed, authenticated-on-open header of an envelope
+type EnvelopeHeader struct {
+    Version uint8
+    Suite   uint16
+    KEM     uint16
+
+    MediaType    string
+    FileName     string
+    DocumentHash []byte
+
+    // SegmentSize is the plaintext segment size of a streaming envelope
+    SegmentSize int
+
+    // Compression is the codec the content was compressed with before encryption, and
+    // ContentSize its uncompressed size if recorded
+    Compression uint8
+    ContentSize int64
+
+    // RecipientKeyIDs identify the KEM public keys the content key is encapsulated to
+    RecipientKeyIDs [][]byte
+
+    // TenantKeyID identifies the tenant key of a convergent envelope
+    TenantKeyID []byte
+
+    // Threshold is the number of custodian shares needed to recover the content key of a
+    // threshold envelope; RecipientKeyIDs then identify the custodians
+    Threshold int
+
+    // Extensions holds fields this version does not interpret
+    Extensions []EnvelopeField
+
+    nonce      []byte
+    contentKey []byte
+    recipients []envelopeRecipient
+    raw        []byte
+
+    // granted is the recipient added by an access grant (see grant.go)
+    granted *envelopeRecipient
+}
+
+// envelopeRecipient is a FieldRecipient value: key ID, KEM ciphertext and wrapped content key
+type envelopeRecipient struct {
+    keyID        []byte
+    encapsulated []byte
+    wrappedKey   []byte
+}
+
+// Convergent reports whether the envelope's content key is derived from its content.
+// Such envelopes reveal when two documents are identical.
+func (h *EnvelopeHeader) Convergent() bool {
+    return h.KEM == KEMConvergent
+}
+
+// IsEnvelope reports whether data starts with the envelope magic bytes
+func IsEnvelope(data []byte) bool {
+    return len(data) >= len(EnvelopeMagic) && string(data[:len(EnvelopeMagic)]) == EnvelopeMagic
+}
+
+// EncryptDocument encrypts a document into a version 1 envelope.
+// If recipientKey is an ML-KEM-768 public key the content key is encapsulated to it;
+// any other key (such as the Dilithium keys used by earlier releases) produces a KEMNone envelope.
+func EncryptDocument(content []byte, recipientKey []byte) ([]byte, error) {
+    return EncryptDocumentCompressed(content, recipientKey, CompressionNone)
+}
+
+// EncryptDocumentCompressed is EncryptDocument with the content compressed by codec
+// before encryption
+func EncryptDocumentCompressed(content []byte, recipientKey []byte, codec uint8) ([]byte, error) {
+    opts := EnvelopeOptions{Compression: codec}
+    if crypto.IsKEMPublicKey(recipientKey) {
+        opts.Recipients = [][]byte{recipientKey}
+    }
+    return SealEnvelope(content, opts)
+}
+
+// DecryptDocument opens an envelope, falling back to the legacy format for data without
+// the envelope magic bytes. privateKey is the recipient's ML-KEM-768 private key, or the
+// content key recombined by CombineShares for a threshold envelope; it is not needed for
+// KEMNone or legacy documents.
+func DecryptDocument(encryptedData []byte, privateKey []byte) ([]byte, error) {
+    if !IsEnvelope(encryptedData) {
+        return DecryptLegacyDocument(encryptedData)
+    }
+
+    content, _, err := OpenEnvelope(encryptedData, privateKey)
+    return content, err
+}
+
+// SealEnvelope encrypts content with a fresh content key (or, with opts.TenantKey, one
+// derived from the content) and binds the header, including the document's SHA3-256
+// hash, as associated data
+func SealEnvelope(content []byte, opts EnvelopeOptions) ([]byte, error) {
+    documentHash := sha3.Sum256(content)
+    opts.DocumentHash = documentHash[:]
+    opts.ContentSize = int64(len(content))
+
+    // 1. Generate the content key and nonce, describe the document and make the content
+    // key available to the recipients
+    contentKey, header, err := newContentKeyAndHeader(SuiteAES256GCM, opts, 12)
+    if err != nil {
+        return nil, err
+    }
+    defer crypto.Wipe(contentKey)
+
+    if header.Compression != CompressionNone {
+        content, err = compress(header.Compression, content)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    // 2. Encrypt with the serialised header as associated data
+    headerBytes := header.marshal()
+    gcm, err := newGCM(contentKey)
+    if err != nil {
+        return nil, err
+    }
+
+    return gcm.Seal(headerBytes, header.nonce, content, headerBytes), nil
+}
+
+// OpenEnvelope authenticates and decrypts an envelope, returning the content and its header
+func OpenEnvelope(envelope []byte, privateKey []byte) ([]byte, *EnvelopeHeader, error) {
+    return OpenEnvelopeWithGrant(envelope, privateKey, nil)
+}
+
+// OpenEnvelopeWithGrant is OpenEnvelope for the recipient of an access grant
+func OpenEnvelopeWithGrant(envelope []byte, privateKey []byte, grant *AccessGrant) ([]byte, *EnvelopeHeader, error) {
+    header, ciphertext, err := ParseEnvelopeHeader(envelope)
+    if err != nil {
+        return nil, nil, err
+    }
+    if err := header.addGrant(grant); err != nil {
+        return nil, nil, err
+    }
+
+    switch header.Suite {
+    case SuiteAES256GCM:
+    case SuiteAES256GCMStream:
+        reader, err := newDecryptReader(header, bytes.NewReader(ciphertext), privateKey)
+        if err != nil {
+            return nil, nil, err
+        }
+        content, err := io.ReadAll(reader)
+        if err != nil {
+            return nil, nil, err
+        }
+        return content, header, nil
+    default:
+        return nil, nil, fmt.Errorf("unsupported cipher suite %d", header.Suite)
+    }
+
+    // 1. Recover the content key
+    contentKey, err := header.unwrapContentKey(privateKey)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer crypto.Wipe(contentKey)
+
+    // 2. Decrypt, authenticating the header
+    gcm, err := newGCM(contentKey)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(header.nonce) != gcm.NonceSize() {
+        return nil, nil, fmt.Errorf("invalid nonce length: %d", len(header.nonce))
+    }
+
+    content, err := gcm.Open(nil, header.nonce, ciphertext, header.raw)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to decrypt document: %w", err)
+    }
+
+    // 3. Decompress, checking the document is the one the header describes
+    if header.Compression != CompressionNone {
+        reader, err := newDecompressReader(header, bytes.NewReader(content))
+        if err != nil {
+            return nil, nil, err
+        }
+        if content, err = io.ReadAll(reader); err != nil {
+            return nil, nil, err
+        }
+        return content, header, nil
+    }
+
+    // 4. Otherwise, check the document is the one the header describes
+    documentHash := sha3.Sum256(content)
+    if !bytes.Equal(documentHash[:], header.DocumentHash) {
+        return nil, nil, fmt.Errorf("document hash does not match envelope header")
+    }
+
+    return content, header, nil
+}
+
+// ParseEnvelopeHeader parses an envelope header without decrypting it and returns the
+// remaining ciphertext. The header is only authenticated by OpenEnvelope.
+func ParseEnvelopeHeader(envelope []byte) (*EnvelopeHeader, []byte, error) {
+    if !IsEnvelope(envelope) {
+        return nil, nil, fmt.Errorf("not an encrypted document envelope")
+    }
+    if len(envelope) < envelopePrefixSize {
+        return nil, nil, fmt.Errorf("envelope header truncated")
+    }
+
+    header := &EnvelopeHeader{
+        Version: envelope[4],
+        Suite:   binary.BigEndian.Uint16(envelope[5:7]),
+        KEM:     binary.BigEndian.Uint16(envelope[7:9]),
+    }
+    if header.Version != EnvelopeVersion && header.Version != EnvelopeVersionCompressed {
+        return nil, nil, fmt.Errorf("%w %d: this build reads versions %d and %d", ErrUnsupportedEnvelopeVersion, header.Version, EnvelopeVersion, EnvelopeVersionCompressed)
+    }
+
+    fieldsLen := binary.BigEndian.Uint32(envelope[9:13])
+    if uint64(fieldsLen) > uint64(len(envelope)-envelopePrefixSize) {
+        return nil, nil, fmt.Errorf("envelope header truncated")
+    }
+    headerEnd := envelopePrefixSize + int(fieldsLen)
+    header.raw = envelope[:headerEnd]
+
+    fields := envelope[envelopePrefixSize:headerEnd]
+    for len(fields) > 0 {
+        if len(fields) < 5 {
+            return nil, nil, fmt.Errorf("malformed envelope field")
+        }
+        fieldType := fields[0]
+        length := binary.BigEndian.Uint32(fields[1:5])
+        if uint64(length) > uint64(len(fields)-5) {
+            return nil, nil, fmt.Errorf("malformed envelope field %d", fieldType)
+        }
+        value := fields[5 : 5+int(length)]
+        fields = fields[5+int(length):]
+
+        if err := header.setField(fieldType, value); err != nil {
+            return nil, nil, err
+        }
+    }
+
+    return header, envelope[headerEnd:], nil
+}
+
+func (h *EnvelopeHeader) setField(fieldType uint8, value []byte) error {
+    switch fieldType {
+    case FieldMediaType:
+        h.MediaType = string(value)
+    case FieldFileName:
+        h.FileName = string(value)
+    case FieldDocumentHash:
+        h.DocumentHash = value
+    case FieldNonce:
+        h.nonce = value
+    case FieldContentKey:
+        h.contentKey = value
+    case FieldSegmentSize:
+        if len(value) != 4 {
+            return fmt.Errorf("malformed segment size field")
+        }
+        h.SegmentSize = int(binary.BigEndian.Uint32(value))
+    case FieldCompression:
+        if len(value) != 1 || h.Version < EnvelopeVersionCompressed {
+            return fmt.Errorf("malformed compression field")
+        }
+        h.Compression = value[0]
+    case FieldContentSize:
+        if len(value) != 8 || binary.BigEndian.Uint64(value) > 1<<62 {
+            return fmt.Errorf("malformed content size field")
+        }
+        h.ContentSize = int64(binary.BigEndian.Uint64(value))
+    case FieldTenantKeyID:
+        if len(value) != crypto.TenantKeyIDSize {
+            return fmt.Errorf("malformed tenant key ID field")
+        }
+        h.TenantKeyID = value
+    case FieldThreshold:
+        if len(value) != 1 || value[0] == 0 {
+            return fmt.Errorf("malformed threshold field")
+        }
+        h.Threshold = int(value[0])
+    case FieldRecipient:
+        recipient, err := parseRecipient(value)
+        if err != nil {
+            return err
+        }
+        h.recipients = append(h.recipients, recipient)
+        h.RecipientKeyIDs = append(h.RecipientKeyIDs, recipient.keyID)
+    default:
+        h.Extensions = append(h.Extensions, EnvelopeField{Type: fieldType, Value: value})
+    }
+    return nil
+}
+
+// marshal serialises the header; the result is also the AEAD associated data
+func (h *EnvelopeHeader) marshal() []byte {
+    var fields []byte
+    appendField := func(fieldType uint8, value []byte) {
+        fields = append(fields, fieldType)
+        fields = binary.BigEndian.AppendUint32(fields, uint32(len(value)))
+        fields = append(fields, value...)
+    }
+
+    if h.MediaType != "" {
+        appendField(FieldMediaType, []byte(h.MediaType))
+    }
+    if h.FileName != "" {
+        appendField(FieldFileName, []byte(h.FileName))
+    }
+    if h.DocumentHash != nil {
+        appendField(FieldDocumentHash, h.DocumentHash)
+    }
+    appendField(FieldNonce, h.nonce)
+    if h.SegmentSize != 0 {
+        appendField(FieldSegmentSize, binary.BigEndian.AppendUint32(nil, uint32(h.SegmentSize)))
+    }
+    if h.Compression != CompressionNone {
+        appendField(FieldCompression, []byte{h.Compression})
+        if h.ContentSize > 0 {
+            appendField(FieldContentSize, binary.BigEndian.AppendUint64(nil, uint64(h.ContentSize)))
+        }
+    }
+    if h.contentKey != nil {
+        appendField(FieldContentKey, h.contentKey)
+    }
+    if h.TenantKeyID != nil {
+        appendField(FieldTenantKeyID, h.TenantKeyID)
+    }
+    if h.Threshold != 0 {
+        appendField(FieldThreshold, []byte{byte(h.Threshold)})
+    }
+    for _, r := range h.recipients {
+        appendField(FieldRecipient, r.marshal())
+    }
+    for _, ext := range h.Extensions {
+        appendField(ext.Type, ext.Value)
+    }
+
+    buf := make([]byte, 0, envelopePrefixSize+len(fields))
+    buf = append(buf, EnvelopeMagic...)
+    buf = append(buf, h.Version)
+    buf = binary.BigEndian.AppendUint16(buf, h.Suite)
+    buf = binary.BigEndian.AppendUint16(buf, h.KEM)
+    buf = binary.BigEndian.AppendUint32(buf, uint32(len(fields)))
+    return append(buf, fields...)
+}
+
+// newEnvelopeHeader describes a document encrypted under contentKey and makes the key
+// available to the recipients in opts
+func newEnvelopeHeader(suite uint16, contentKey, nonce []byte, opts EnvelopeOptions) (*EnvelopeHeader, error) {
+    header := &EnvelopeHeader{
+        Version:      EnvelopeVersion,
+        Suite:        suite,
+        KEM:          KEMNone,
+        MediaType:    opts.MediaType,
+        FileName:     opts.FileName,
+        DocumentHash: opts.DocumentHash,
+        nonce:        nonce,
+    }
+    if suite == SuiteAES256GCMStream {
+        header.SegmentSize = opts.SegmentSize
+    }
+
+    switch opts.Compression {
+    case CompressionNone:
+    case CompressionGzip, CompressionZstd:
+        header.Version = EnvelopeVersionCompressed
+        header.Compression = opts.Compression
+        header.ContentSize = opts.ContentSize
+    default:
+        return nil, fmt.Errorf("unsupported compression codec %d", opts.Compression)
+    }
+
+    if len(opts.Custodians) > 0 {
+        if len(opts.Recipients) > 0 || opts.TenantKey != nil {
+            return nil, fmt.Errorf("threshold envelopes cannot be encapsulated to recipients or a tenant key")
+        }
+        return header, header.splitContentKey(contentKey, opts.Custodians, opts.Threshold)
+    }
+
+    if opts.TenantKey != nil {
+        if len(opts.Recipients) > 0 {
+            return nil, fmt.Errorf("convergent envelopes cannot be encapsulated to recipients")
+        }
+        header.KEM = KEMConvergent
+        header.TenantKeyID = crypto.TenantKeyID(opts.TenantKey)
+        return header, nil
+    }
+
+    if len(opts.Recipients) == 0 {
+        header.contentKey = contentKey
+        return header, nil
+    }
+
+    header.KEM = KEMMLKEM768
+    for _, pub := range opts.Recipients {
+        recipient, err := wrapContentKey(contentKey, pub)
+        if err != nil {
+            return nil, err
+        }
+        header.recipients = append(header.recipients, recipient)
+    }
+    return header, nil
+}
+
+// unwrapContentKey recovers a copy of the content key for the holder of privateKey
+func (h *EnvelopeHeader) unwrapContentKey(privateKey []byte) ([]byte, error) {
+    if h.granted != nil && h.KEM != KEMNone && crypto.IsKEMPrivateKey(privateKey) {
+        pub, err := crypto.KEMPublicKey(privateKey)
+        if err != nil {
+            return nil, err
+        }
+        if bytes.Equal(h.granted.keyID, crypto.KEMKeyID(pub)) {
+            return unwrapContentKey(*h.granted, privateKey)
+        }
+    }
+
+    switch h.KEM {
+    case KEMNone:
+        if len(h.contentKey) != 32 {
+            return nil, fmt.Errorf("envelope has no content key")
+        }
+        return append([]byte(nil), h.contentKey...), nil
+    case KEMMLKEM768:
+        if !crypto.IsKEMPrivateKey(privateKey) {
+            return nil, fmt.Errorf("an ML-KEM-768 private key is required to decrypt this document")
+        }
+        pub, err := crypto.KEMPublicKey(privateKey)
+        if err != nil {
+            return nil, err
+        }
+        keyID := crypto.KEMKeyID(pub)
+
+        for _, r := range h.recipients {
+            if bytes.Equal(r.keyID, keyID) {
+                return unwrapContentKey(r, privateKey)
+            }
+        }
+        return nil, ErrNotRecipient
+    case KEMConvergent:
+        if !crypto.IsTenantKey(privateKey) || !bytes.Equal(crypto.TenantKeyID(privateKey), h.TenantKeyID) {
+            return nil, ErrNotRecipient
+        }
+        contentKey, _, err := convergentKey(privateKey, h, 0)
+        return contentKey, err
+    case KEMThreshold:
+        // The key is the content key recombined from custodian shares; a wrong one fails
+        // authentication
+        if len(privateKey) != 32 {
+            return nil, ErrSharesRequired
+        }
+        return append([]byte(nil), privateKey...), nil
+    default:
+        return nil, fmt.Errorf("unsupported KEM %d", h.KEM)
+    }
+}
+
+// wrapContentKey encapsulates a shared secret to pub and encrypts the content key under it
+func wrapContentKey(contentKey, pub []byte) (envelopeRecipient, error) {
+    if !crypto.IsKEMPublicKey(pub) {
+        return envelopeRecipient{}, fmt.Errorf("recipient key is not an ML-KEM-768 public key")
+    }
+
+    encapsulated, sharedSecret, err := crypto.KEMEncapsulate(pub)
+    if err != nil {
+        return envelopeRecipient{}, err
+    }
+    defer crypto.Wipe(sharedSecret)
+
+    keyID := crypto.KEMKeyID(pub)
+    gcm, err := keyWrapGCM(sharedSecret, keyID)
+    if err != nil {
+        return envelopeRecipient{}, err
+    }
+
+    // The wrapping key is unique per encapsulation, so a zero nonce is safe
+    nonce := make([]byte, gcm.NonceSize())
+    return envelopeRecipient{
+        keyID:        keyID,
+        encapsulated: encapsulated,
+        wrappedKey:   gcm.Seal(nil, nonce, contentKey, keyID),
+    }, nil
+}
+
+func unwrapContentKey(r envelopeRecipient, privateKey []byte) ([]byte, error) {
+    sharedSecret, err := crypto.KEMDecapsulate(privateKey, r.encapsulated)
+    if err != nil {
+        return nil, err
+    }
+    defer crypto.Wipe(sharedSecret)
+
+    gcm, err := keyWrapGCM(sharedSecret, r.keyID)
+    if err != nil {
+        return nil, err
+    }
+
+    contentKey, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), r.wrappedKey, r.keyID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to unwrap content key: %w", err)
+    }
+    return contentKey, nil
+}
+
+// marshal encodes a FieldRecipient value
+func (r envelopeRecipient) marshal() []byte {
+    return append(append(append([]byte(nil), r.keyID...), r.encapsulated...), r.wrappedKey...)
+}
+
+func parseRecipient(value []byte) (envelopeRecipient, error) {
+    encapsulatedSize := 1088 // ML-KEM-768 ciphertext
+    if len(value) <= crypto.KEMKeyIDSize+encapsulatedSize {
+        return envelopeRecipient{}, fmt.Errorf("malformed recipient field")
+    }
+    return envelopeRecipient{
+        keyID:        value[:crypto.KEMKeyIDSize],
+        encapsulated: value[crypto.KEMKeyIDSize : crypto.KEMKeyIDSize+encapsulatedSize],
+        wrappedKey:   value[crypto.KEMKeyIDSize+encapsulatedSize:],
+    }, nil
+}
+
+// keyWrapGCM derives the key-wrapping cipher from a KEM shared secret
+func keyWrapGCM(sharedSecret, keyID []byte) (cipher.AEAD, error) {
+    wrapKey := make([]byte, 32)
+    defer crypto.Wipe(wrapKey)
+    if _, err := io.ReadFull(hkdf.New(sha3.New256, sharedSecret, keyID, keyWrapInfo), wrapKey); err != nil {
+        return nil, fmt.Errorf("failed to derive key-wrapping key: %w", err)
+    }
+    return newGCM(wrapKey)
+}
+
+// newContentKeyAndHeader returns the content key for a document and a header with a
+// nonce of nonceSize bytes describing it: a random key and nonce, or for a convergent
+// envelope ones derived from the rest of the header
+func newContentKeyAndHeader(suite uint16, opts EnvelopeOptions, nonceSize int) ([]byte, *EnvelopeHeader, error) {
+    if opts.TenantKey != nil {
+        header, err := newEnvelopeHeader(suite, nil, nil, opts)
+        if err != nil {
+            return nil, nil, err
+        }
+        contentKey, nonce, err := convergentKey(opts.TenantKey, header, nonceSize)
+        if err != nil {
+            return nil, nil, err
+        }
+        header.nonce = nonce
+        return contentKey, header, nil
+    }
+
+    contentKey, err := newContentKey()
+    if err != nil {
+        return nil, nil, err
+    }
+    nonce := make([]byte, nonceSize)
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        crypto.Wipe(contentKey)
+        return nil, nil, fmt.Errorf("failed to generate nonce: %w", err)
+    }
+    header, err := newEnvelopeHeader(suite, contentKey, nonce, opts)
+    if err != nil {
+        crypto.Wipe(contentKey)
+        return nil, nil, err
+    }
+    return contentKey, header, nil
+}
+
+func newContentKey() ([]byte, error) {
+    contentKey := make([]byte, 32)
+    if _, err := io.ReadFull(rand.Reader, contentKey); err != nil {
+        return nil, fmt.Errorf("failed to generate content key: %w", err)
+    }
+    return contentKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+    }
+
+    gcm, err := cipher.NewGCM(block)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create GCM mode: %w", err)
+    }
+    return gcm, nil
+}
@@ -0,0 +1,290 @@
+package storage
+
+import (
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "encoding/binary"
+    "errors"
+    "testing"
+
+    "golang.org/x/crypto/sha3"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+func TestEnvelopeRecipients(t *testing.T) {
+    content := []byte("Quarterly report, for the board only")
+
+    pub, priv, err := crypto.GenerateKEMKeypair()
+    if err != nil {
+        t.Fatalf("Failed to generate KEM keypair: %v", err)
+    }
+    _, otherPriv, _ := crypto.GenerateKEMKeypair()
+
+    envelope, err := SealEnvelope(content, EnvelopeOptions{
+        MediaType:  "application/pdf",
+        FileName:   "report.pdf",
+        Recipients: [][]byte{pub},
+    })
+    if err != nil {
+        t.Fatalf("Failed to seal envelope: %v", err)
+    }
+    if bytes.Contains(envelope, content) {
+        t.Fatalf("Envelope contains the plaintext")
+    }
+
+    opened, header, err := OpenEnvelope(envelope, priv)
+    if err != nil {
+        t.Fatalf("Failed to open envelope: %v", err)
+    }
+    if !bytes.Equal(opened, content) {
+        t.Fatalf("Opened content does not match")
+    }
+    documentHash := sha3.Sum256(content)
+    if header.KEM != KEMMLKEM768 || header.MediaType != "application/pdf" || header.FileName != "report.pdf" ||
+        !bytes.Equal(header.DocumentHash, documentHash[:]) || !bytes.Equal(header.RecipientKeyIDs[0], crypto.KEMKeyID(pub)) {
+        t.Fatalf("Unexpected header: %+v", header)
+    }
+
+    if _, err := DecryptDocument(envelope, otherPriv); !errors.Is(err, ErrNotRecipient) {
+        t.Fatalf("Expected ErrNotRecipient, got %v", err)
+    }
+}
+
+func TestConvergentEnvelope(t *testing.T) {
+    content := bytes.Repeat([]byte("Standard supplier agreement, revision 4\n"), 4000)
+    tenantKey, _ := crypto.GenerateTenantKey()
+    otherTenant, _ := crypto.GenerateTenantKey()
+    opts := EnvelopeOptions{MediaType: "text/plain", TenantKey: tenantKey}
+
+    // Identical documents dedupe within a tenant, in both suites
+    first, err := SealEnvelope(content, opts)
+    if err != nil {
+        t.Fatalf("Failed to seal envelope: %v", err)
+    }
+    second, _ := SealEnvelope(content, opts)
+    if !bytes.Equal(first, second) {
+        t.Fatalf("Convergent envelopes of the same document differ")
+    }
+    if bytes.Contains(first, content[:40]) || bytes.Contains(first, tenantKey) {
+        t.Fatalf("Envelope leaks the plaintext or the tenant key")
+    }
+
+    documentHash := sha3.Sum256(content)
+    streamOpts := EnvelopeOptions{DocumentHash: documentHash[:], TenantKey: tenantKey, Compression: CompressionZstd}
+    stream := sealStream(t, content, streamOpts)
+    if !bytes.Equal(stream, sealStream(t, content, streamOpts)) {
+        t.Fatalf("Convergent streaming envelopes of the same document differ")
+    }
+
+    // Other documents and other tenants do not
+    if other, _ := SealEnvelope(append(content, '.'), opts); bytes.Equal(other[len(other)-32:], first[len(first)-32:]) {
+        t.Fatalf("Different documents produced the same ciphertext")
+    }
+    if other, _ := SealEnvelope(content, EnvelopeOptions{MediaType: "text/plain", TenantKey: otherTenant}); bytes.Equal(other, first) {
+        t.Fatalf("Different tenants produced the same envelope")
+    }
+
+    // The envelope is flagged and only opens with the tenant key
+    opened, header, err := OpenEnvelope(first, tenantKey)
+    if err != nil || !bytes.Equal(opened, content) {
+        t.Fatalf("Failed to open envelope: %v", err)
+    }
+    if !header.Convergent() || !bytes.Equal(header.TenantKeyID, crypto.TenantKeyID(tenantKey)) {
+        t.Fatalf("Unexpected header: %+v", header)
+    }
+    if opened, err := openStream(stream, tenantKey); err != nil || !bytes.Equal(opened, content) {
+        t.Fatalf("Failed to open streaming envelope: %v", err)
+    }
+    for _, key := range [][]byte{nil, otherTenant} {
+        if _, err := DecryptDocument(first, key); !errors.Is(err, ErrNotRecipient) {
+            t.Fatalf("Expected ErrNotRecipient, got %v", err)
+        }
+    }
+
+    // Streaming needs the hash up front, and recipients cannot share a derived key
+    var buf bytes.Buffer
+    if _, err := NewEncryptWriter(&buf, EnvelopeOptions{TenantKey: tenantKey}); err == nil {
+        t.Fatalf("Expected a convergent stream without a document hash to be rejected")
+    }
+    pub, _, _ := crypto.GenerateKEMKeypair()
+    if _, err := SealEnvelope(content, EnvelopeOptions{TenantKey: tenantKey, Recipients: [][]byte{pub}}); err == nil {
+        t.Fatalf("Expected recipients to be rejected in convergent mode")
+    }
+}
+
+func TestConvergentKeyBindsHeader(t *testing.T) {
+    content := []byte("Standard supplier agreement, revision 4")
+    documentHash := sha3.Sum256(content)
+    tenantKey, _ := crypto.GenerateTenantKey()
+    base := EnvelopeOptions{MediaType: "text/plain", FileName: "agreement.txt", TenantKey: tenantKey, DocumentHash: documentHash[:]}
+
+    variants := map[string]func(*EnvelopeOptions) uint16{
+        "base":        func(o *EnvelopeOptions) uint16 { return SuiteAES256GCM },
+        "media type":  func(o *EnvelopeOptions) uint16 { o.MediaType = "text/csv"; return SuiteAES256GCM },
+        "file name":   func(o *EnvelopeOptions) uint16 { o.FileName = "agreement-copy.txt"; return SuiteAES256GCM },
+        "compression": func(o *EnvelopeOptions) uint16 { o.Compression = CompressionGzip; return SuiteAES256GCM },
+        "suite": func(o *EnvelopeOptions) uint16 {
+            o.SegmentSize = DefaultSegmentSize
+            return SuiteAES256GCMStream
+        },
+        "segment size": func(o *EnvelopeOptions) uint16 {
+            o.SegmentSize = DefaultSegmentSize / 2
+            return SuiteAES256GCMStream
+        },
+    }
+
+    // Every variant derives a nonce of the same size so that they can be compared
+    seenKeys := make(map[string]string)
+    seenNonces := make(map[string]string)
+    for name, vary := range variants {
+        opts := base
+        suite := vary(&opts)
+        contentKey, header, err := newContentKeyAndHeader(suite, opts, streamNoncePrefixSize)
+        if err != nil {
+            t.Fatalf("%s: failed to derive key: %v", name, err)
+        }
+        if other, ok := seenKeys[string(contentKey)]; ok {
+            t.Fatalf("%s and %s derived the same content key", name, other)
+        }
+        if other, ok := seenNonces[string(header.nonce)]; ok {
+            t.Fatalf("%s and %s derived the same nonce", name, other)
+        }
+        seenKeys[string(contentKey)] = name
+        seenNonces[string(header.nonce)] = name
+
+        // Opening re-derives the same key from the parsed header
+        parsed, _, err := ParseEnvelopeHeader(header.marshal())
+        if err != nil {
+            t.Fatalf("%s: failed to parse header: %v", name, err)
+        }
+        reopened, err := parsed.unwrapContentKey(tenantKey)
+        if err != nil || !bytes.Equal(reopened, contentKey) {
+            t.Fatalf("%s: re-derived content key differs: %v", name, err)
+        }
+    }
+}
+
+func TestThresholdEnvelope(t *testing.T) {
+    content := []byte("Escrowed source code, release only by board resolution")
+
+    var pubs, privs [][]byte
+    for i := 0; i < 3; i++ {
+        pub, priv, err := crypto.GenerateKEMKeypair()
+        if err != nil {
+            t.Fatalf("Failed to generate KEM keypair: %v", err)
+        }
+        pubs, privs = append(pubs, pub), append(privs, priv)
+    }
+    combinerPub, combinerPriv, _ := crypto.GenerateKEMKeypair()
+
+    envelope, err := SealEnvelope(content, EnvelopeOptions{Custodians: pubs, Threshold: 2, Compression: CompressionGzip})
+    if err != nil {
+        t.Fatalf("Failed to seal envelope: %v", err)
+    }
+    header, _, err := ParseEnvelopeHeader(envelope)
+    if err != nil {
+        t.Fatalf("Failed to parse header: %v", err)
+    }
+    if header.KEM != KEMThreshold || header.Threshold != 2 || len(header.RecipientKeyIDs) != 3 {
+        t.Fatalf("Unexpected header: %+v", header)
+    }
+
+    // No single custodian can decrypt
+    if _, err := DecryptDocument(envelope, privs[0]); !errors.Is(err, ErrSharesRequired) {
+        t.Fatalf("Expected ErrSharesRequired, got %v", err)
+    }
+    first, err := header.UnwrapShare(privs[0], nil)
+    if err != nil {
+        t.Fatalf("Failed to unwrap share: %v", err)
+    }
+    if _, err := CombineShares(header, []*CustodianShare{first}, nil); err == nil {
+        t.Fatalf("Expected one share of two to be rejected")
+    }
+    if _, err := CombineShares(header, []*CustodianShare{first, first}, nil); err == nil {
+        t.Fatalf("Expected a custodian to count only once")
+    }
+
+    // Two custodians, one submitting to the combiner's key
+    third, err := header.UnwrapShare(privs[2], combinerPub)
+    if err != nil {
+        t.Fatalf("Failed to unwrap sealed share: %v", err)
+    }
+    if third.Share != nil || third.Sealed == nil {
+        t.Fatalf("Sealed share is exposed: %+v", third)
+    }
+    if _, err := CombineShares(header, []*CustodianShare{first, third}, privs[1]); !errors.Is(err, ErrNotRecipient) {
+        t.Fatalf("Expected ErrNotRecipient for the wrong combiner key, got %v", err)
+    }
+    contentKey, err := CombineShares(header, []*CustodianShare{third, first}, combinerPriv)
+    if err != nil {
+        t.Fatalf("Failed to combine shares: %v", err)
+    }
+    opened, err := DecryptDocument(envelope, contentKey)
+    if err != nil || !bytes.Equal(opened, content) {
+        t.Fatalf("Failed to decrypt with the combined key: %v", err)
+    }
+
+    // Shares of another envelope do not recover this one
+    other, _ := SealEnvelope(content, EnvelopeOptions{Custodians: pubs, Threshold: 2})
+    otherHeader, _, _ := ParseEnvelopeHeader(other)
+    second, _ := otherHeader.UnwrapShare(privs[1], nil)
+    wrongKey, err := CombineShares(header, []*CustodianShare{first, second}, nil)
+    if err != nil {
+        t.Fatalf("Failed to combine shares: %v", err)
+    }
+    if _, err := DecryptDocument(envelope, wrongKey); err == nil {
+        t.Fatalf("Expected a key from mixed shares to be rejected")
+    }
+
+    if _, err := SealEnvelope(content, EnvelopeOptions{Custodians: pubs, Threshold: 4}); err == nil {
+        t.Fatalf("Expected a threshold above the number of custodians to be rejected")
+    }
+}
+
+func TestEnvelopeBindsHeader(t *testing.T) {
+    envelope, err := SealEnvelope([]byte("contract v1"), EnvelopeOptions{FileName: "contract.txt"})
+    if err != nil {
+        t.Fatalf("Failed to seal envelope: %v", err)
+    }
+
+    // Renaming the document invalidates the envelope
+    tampered := bytes.Replace(envelope, []byte("contract.txt"), []byte("contract.TXT"), 1)
+    if _, err := DecryptDocument(tampered, nil); err == nil {
+        t.Fatalf("Expected tampered header to be rejected")
+    }
+
+    // Future versions are rejected with a clear error
+    future := append([]byte(nil), envelope...)
+    future[4] = EnvelopeVersionCompressed + 1
+    if _, err := DecryptDocument(future, nil); !errors.Is(err, ErrUnsupportedEnvelopeVersion) {
+        t.Fatalf("Expected ErrUnsupportedEnvelopeVersion, got %v", err)
+    }
+}
+
+func TestLegacyDocument(t *testing.T) {
+    content := []byte("Document encrypted by an earlier release")
+
+    // Build a legacy package by hand
+    aesKey := bytes.Repeat([]byte{7}, 32)
+    iv := bytes.Repeat([]byte{9}, 12)
+    block, _ := aes.NewCipher(aesKey)
+    gcm, _ := cipher.NewGCM(block)
+    ciphertext := gcm.Seal(nil, iv, content, nil)
+    checksum := sha3.Sum256(append(append([]byte(nil), aesKey...), ciphertext...))
+
+    var legacy []byte
+    for _, field := range [][]byte{aesKey, iv, ciphertext, checksum[:]} {
+        legacy = binary.LittleEndian.AppendUint32(legacy, uint32(len(field)))
+        legacy = append(legacy, field...)
+    }
+
+    decrypted, err := DecryptDocument(legacy, nil)
+    if err != nil {
+        t.Fatalf("Failed to decrypt legacy document: %v", err)
+    }
+    if !bytes.Equal(decrypted, content) {
+        t.Fatalf("Legacy content does not match")
+    }
+}
@@ -0,0 +1,551 @@
+package storage
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+
+    gocid "github.com/ipfs/go-cid"
+    "github.com/klauspost/reedsolomon"
+    "github.com/multiformats/go-multihash"
+)
+
+// ShardManifestFormat identifies shard manifests
+const ShardManifestFormat = "quantum-doc-verify/reed-solomon/v1"
+
+// ShardManifest records how a document was erasure-coded. It is stored as a raw block
+// on every node, and its CID is the identifier ErasureStore.Put returns.
+type ShardManifest struct {
+    Format       string `json:"format"`
+    DataShards   int    `json:"dataShards"`
+    ParityShards int    `json:"parityShards"`
+
+    // Size is the length of the document and ShardSize the length of every shard; the
+    // last data shard is padded with zeros
+    Size      int64 `json:"size"`
+    ShardSize int64 `json:"shardSize"`
+
+    // ContentCID is the CID of the whole document, checked after reconstruction
+    ContentCID string `json:"contentCid"`
+
+    Shards []Shard `json:"shards"`
+}
+
+// Shard is one data or parity shard of an erasure-coded document
+type Shard struct {
+    Index int    `json:"index"`
+    CID   string `json:"cid"`
+    Node  string `json:"node"`
+}
+
+// ErasureStore splits every document into DataShards data shards and ParityShards parity
+// shards with Reed-Solomon coding, storing each shard under its own CID on a different
+// node, so that any DataShards of them reconstruct the document. It stores
+// (DataShards+ParityShards)/DataShards times the document's size instead of a full copy
+// per node. With fewer nodes than shards, some nodes hold several shards and losing one
+// of them loses all of its shards.
+type ErasureStore struct {
+    nodes         []*replica
+    dataShards    int
+    parityShards  int
+    probeInterval time.Duration
+    now           func() time.Time
+}
+
+// NewErasureStore creates a store coding documents into dataShards+parityShards shards
+// across nodes. Every node must implement BlockStore to hold the shard manifests.
+func NewErasureStore(nodes []Replica, dataShards, parityShards int) (*ErasureStore, error) {
+    if len(nodes) == 0 {
+        return nil, fmt.Errorf("erasure-coded store requires at least one node")
+    }
+    if dataShards < 1 || parityShards < 1 || dataShards+parityShards > 256 {
+        return nil, fmt.Errorf("erasure coding requires at least one data and one parity shard, and at most 256 shards")
+    }
+    for _, node := range nodes {
+        if _, ok := node.Store.(BlockStore); !ok {
+            return nil, fmt.Errorf("%s: store does not support blocks", node.Name)
+        }
+    }
+
+    s := &ErasureStore{
+        dataShards:    dataShards,
+        parityShards:  parityShards,
+        probeInterval: DefaultProbeInterval,
+        now:           time.Now,
+    }
+    for _, node := range nodes {
+        s.nodes = append(s.nodes, &replica{Replica: node})
+    }
+    return s, nil
+}
+
+// parseErasure parses the "erasure=K+M" element of a store list
+func parseErasure(value string) (int, int, error) {
+    var k, m int
+    if _, err := fmt.Sscanf(value, "%d+%d", &k, &m); err != nil || fmt.Sprintf("%d+%d", k, m) != value {
+        return 0, 0, fmt.Errorf("invalid erasure coding %q, expected data+parity shards such as 4+2", value)
+    }
+    return k, m, nil
+}
+
+// Put splits the content into shards, uploads them in parallel and stores the shard
+// manifest on every node. Each shard goes to its own node, or to the next node that
+// accepts it if that one fails.
+func (s *ErasureStore) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    if opts.HashCID {
+        return "", fmt.Errorf("erasure-coded documents are addressed by their shard manifest and cannot use a hash CID")
+    }
+
+    // 1. Spool the content, computing the CID the reconstruction is checked against
+    builder := newContentBuilder(opts)
+    spool, size, err := spoolToFile(ctx, io.TeeReader(&progressReader{r: r, progress: opts.Progress}, builder))
+    if err != nil {
+        return "", err
+    }
+    defer removeSpool(spool)
+    if size == 0 {
+        return "", fmt.Errorf("cannot erasure-code an empty document")
+    }
+    contentCID, err := builder.Sum()
+    if err != nil {
+        return "", fmt.Errorf("failed to compute content CID: %w", err)
+    }
+
+    // 2. Split into data shards and compute the parity shards
+    shards, err := s.encode(spool, size)
+    if err != nil {
+        return "", err
+    }
+    defer func() {
+        for _, shard := range shards {
+            removeSpool(shard)
+        }
+    }()
+    shardSize := (size + int64(s.dataShards) - 1) / int64(s.dataShards)
+
+    // 3. Upload the shards in parallel
+    manifest := ShardManifest{
+        Format:       ShardManifestFormat,
+        DataShards:   s.dataShards,
+        ParityShards: s.parityShards,
+        Size:         size,
+        ShardSize:    shardSize,
+        ContentCID:   contentCID.String(),
+        Shards:       make([]Shard, len(shards)),
+    }
+    shardOpts := StoreOptions{Chunker: opts.Chunker, RawLeaves: opts.RawLeaves, Size: shardSize}
+    errs := make([]error, len(shards))
+    var wg sync.WaitGroup
+    for i, shard := range shards {
+        wg.Add(1)
+        go func(i int, shard *os.File) {
+            defer wg.Done()
+            manifest.Shards[i], errs[i] = s.putShard(ctx, i, io.NewSectionReader(shard, 0, shardSize), shardOpts)
+        }(i, shard)
+    }
+    wg.Wait()
+    if err := errors.Join(errs...); err != nil {
+        return "", fmt.Errorf("failed to store shards: %w", err)
+    }
+
+    // 4. Store the manifest
+    return s.putManifest(ctx, &manifest)
+}
+
+// encode writes the data and parity shards of the spooled content to temporary files
+func (s *ErasureStore) encode(spool *os.File, size int64) ([]*os.File, error) {
+    enc, err := reedsolomon.NewStream(s.dataShards, s.parityShards)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create erasure encoder: %w", err)
+    }
+
+    shards := make([]*os.File, s.dataShards+s.parityShards)
+    fail := func(err error) ([]*os.File, error) {
+        for _, shard := range shards {
+            if shard != nil {
+                removeSpool(shard)
+            }
+        }
+        return nil, err
+    }
+    for i := range shards {
+        if shards[i], err = os.CreateTemp("", "quantum-doc-verify-shard-*"); err != nil {
+            return fail(fmt.Errorf("failed to create temporary file: %w", err))
+        }
+    }
+
+    data := make([]io.Writer, s.dataShards)
+    for i := range data {
+        data[i] = shards[i]
+    }
+    if err := enc.Split(spool, data, size); err != nil {
+        return fail(fmt.Errorf("failed to split document into shards: %w", err))
+    }
+
+    shardSize := (size + int64(s.dataShards) - 1) / int64(s.dataShards)
+    readers := make([]io.Reader, s.dataShards)
+    for i := range readers {
+        readers[i] = io.NewSectionReader(shards[i], 0, shardSize)
+    }
+    parity := make([]io.Writer, s.parityShards)
+    for i := range parity {
+        parity[i] = shards[s.dataShards+i]
+    }
+    if err := enc.Encode(readers, parity); err != nil {
+        return fail(fmt.Errorf("failed to compute parity shards: %w", err))
+    }
+    return shards, nil
+}
+
+// putShard stores shard index on its node, falling back to the following nodes
+func (s *ErasureStore) putShard(ctx context.Context, index int, shard *io.SectionReader, opts StoreOptions) (Shard, error) {
+    var errs []error
+    for attempt := 0; attempt < len(s.nodes); attempt++ {
+        node := s.nodes[(index+attempt)%len(s.nodes)]
+        if !node.healthy() && s.now().Before(node.nextRetry()) {
+            continue
+        }
+
+        if _, err := shard.Seek(0, io.SeekStart); err != nil {
+            return Shard{}, err
+        }
+        cid, err := node.Store.Put(ctx, shard, opts)
+        node.record(err, s.now(), s.probeInterval)
+        if err == nil {
+            return Shard{Index: index, CID: cid, Node: node.Name}, nil
+        }
+        errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+    }
+    return Shard{}, fmt.Errorf("shard %d: no node stored it: %w", index, errors.Join(errs...))
+}
+
+// putManifest stores the manifest as a raw block, so every backend assigns it the same
+// CID. It must reach more nodes than the parity shards can tolerate losing.
+func (s *ErasureStore) putManifest(ctx context.Context, manifest *ShardManifest) (string, error) {
+    data, err := json.MarshalIndent(manifest, "", "  ")
+    if err != nil {
+        return "", fmt.Errorf("failed to encode shard manifest: %w", err)
+    }
+    sum, err := multihash.Sum(data, multihash.SHA2_256, -1)
+    if err != nil {
+        return "", fmt.Errorf("failed to hash shard manifest: %w", err)
+    }
+    cid := gocid.NewCidV1(gocid.Raw, sum).String()
+
+    required := min(s.parityShards+1, len(s.nodes))
+    stored := 0
+    var errs []error
+    for _, node := range s.nodes {
+        err := node.Store.(BlockStore).PutBlock(ctx, cid, data)
+        node.record(err, s.now(), s.probeInterval)
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+            continue
+        }
+        stored++
+    }
+    if stored < required {
+        return "", fmt.Errorf("shard manifest stored on %d nodes, %d required: %w", stored, required, errors.Join(errs...))
+    }
+    return cid, nil
+}
+
+// Manifest returns the shard manifest stored under cid
+func (s *ErasureStore) Manifest(ctx context.Context, cid string) (*ShardManifest, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+
+    var errs []error
+    notFound := true
+    for _, node := range s.nodes {
+        data, err := node.Store.(BlockStore).GetBlock(ctx, cid)
+        node.record(err, s.now(), s.probeInterval)
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+            notFound = notFound && errors.Is(err, ErrNotFound)
+            continue
+        }
+
+        var manifest ShardManifest
+        if err := json.Unmarshal(data, &manifest); err != nil || manifest.Format != ShardManifestFormat {
+            return nil, fmt.Errorf("%s is not an erasure-coded document", cid)
+        }
+        if err := manifest.validate(); err != nil {
+            return nil, fmt.Errorf("invalid shard manifest %s: %w", cid, err)
+        }
+        return &manifest, nil
+    }
+
+    if notFound {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    return nil, fmt.Errorf("no node returned shard manifest %s: %w", cid, errors.Join(errs...))
+}
+
+// ContentCID returns the CID of the document the shard manifest at cid describes, which
+// is what Get returns
+func (s *ErasureStore) ContentCID(ctx context.Context, cid string) (string, error) {
+    manifest, err := s.Manifest(ctx, cid)
+    if err != nil {
+        return "", err
+    }
+    return manifest.ContentCID, nil
+}
+
+func (m *ShardManifest) validate() error {
+    switch {
+    case m.DataShards < 1 || m.ParityShards < 1 || m.DataShards+m.ParityShards > 256:
+        return fmt.Errorf("unsupported shard counts %d+%d", m.DataShards, m.ParityShards)
+    case len(m.Shards) != m.DataShards+m.ParityShards:
+        return fmt.Errorf("lists %d shards, expected %d", len(m.Shards), m.DataShards+m.ParityShards)
+    case m.Size <= 0 || m.ShardSize != (m.Size+int64(m.DataShards)-1)/int64(m.DataShards):
+        return fmt.Errorf("inconsistent sizes")
+    }
+    for i, shard := range m.Shards {
+        if shard.Index != i {
+            return fmt.Errorf("shard %d is listed as %d", i, shard.Index)
+        }
+        if err := validateCID(shard.CID); err != nil {
+            return err
+        }
+    }
+    return validateCID(m.ContentCID)
+}
+
+// Get reads the shard manifest, fetches all shards at once and reconstructs the document
+// from the first DataShards that verify against their CIDs. The document is spooled to a
+// temporary file and checked against the manifest's content CID.
+func (s *ErasureStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    manifest, err := s.Manifest(ctx, cid)
+    if err != nil {
+        return nil, err
+    }
+
+    shards, err := s.fetchShards(ctx, manifest)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve %s: %w", cid, err)
+    }
+    defer func() {
+        for _, shard := range shards {
+            if shard != nil {
+                removeSpool(shard)
+            }
+        }
+    }()
+
+    return s.reconstruct(manifest, shards)
+}
+
+// fetchShards downloads shards in parallel until DataShards of them are complete. The
+// returned slice holds nil for shards that were not used.
+func (s *ErasureStore) fetchShards(ctx context.Context, manifest *ShardManifest) ([]*os.File, error) {
+    fetchCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    type fetchResult struct {
+        index int
+        file  *os.File
+        err   error
+    }
+    results := make(chan fetchResult, len(manifest.Shards))
+    for _, shard := range manifest.Shards {
+        go func(shard Shard) {
+            file, err := s.fetchShard(fetchCtx, shard, manifest.ShardSize)
+            results <- fetchResult{shard.Index, file, err}
+        }(shard)
+    }
+
+    shards := make([]*os.File, len(manifest.Shards))
+    var errs []error
+    have := 0
+    for received := 0; received < len(manifest.Shards); received++ {
+        result := <-results
+        if result.err != nil {
+            errs = append(errs, fmt.Errorf("shard %d: %w", result.index, result.err))
+            continue
+        }
+        shards[result.index] = result.file
+        have++
+        if have == manifest.DataShards {
+            // Discard the shards still arriving
+            cancel()
+            go func(pending int) {
+                for ; pending > 0; pending-- {
+                    if other := <-results; other.file != nil {
+                        removeSpool(other.file)
+                    }
+                }
+            }(len(manifest.Shards) - received - 1)
+            return shards, nil
+        }
+    }
+
+    for _, shard := range shards {
+        if shard != nil {
+            removeSpool(shard)
+        }
+    }
+    return nil, fmt.Errorf("only %d of %d shards retrieved, %d required: %w", have, len(manifest.Shards), manifest.DataShards, errors.Join(errs...))
+}
+
+// fetchShard downloads one shard from the node that stored it, or from every node if
+// that node is no longer configured
+func (s *ErasureStore) fetchShard(ctx context.Context, shard Shard, size int64) (*os.File, error) {
+    nodes := s.nodes
+    for _, node := range s.nodes {
+        if node.Name == shard.Node {
+            nodes = []*replica{node}
+        }
+    }
+
+    var errs []error
+    for _, node := range nodes {
+        file, err := s.fetchFrom(ctx, node, shard.CID, size)
+        if ctx.Err() == nil || err == nil {
+            node.record(err, s.now(), s.probeInterval)
+        }
+        if err == nil {
+            return file, nil
+        }
+        errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+    }
+    return nil, errors.Join(errs...)
+}
+
+func (s *ErasureStore) fetchFrom(ctx context.Context, node *replica, cid string, size int64) (*os.File, error) {
+    reader, err := node.Store.Get(ctx, cid)
+    if err != nil {
+        return nil, err
+    }
+    defer reader.Close()
+
+    file, n, err := spoolToFile(ctx, reader)
+    if err != nil {
+        return nil, err
+    }
+    if n != size {
+        removeSpool(file)
+        return nil, fmt.Errorf("shard is %d bytes, expected %d", n, size)
+    }
+    return file, nil
+}
+
+// reconstruct rebuilds any missing data shards and joins the data shards into the
+// document
+func (s *ErasureStore) reconstruct(manifest *ShardManifest, shards []*os.File) (io.ReadCloser, error) {
+    enc, err := reedsolomon.NewStream(manifest.DataShards, manifest.ParityShards)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create erasure decoder: %w", err)
+    }
+
+    valid := make([]io.Reader, len(shards))
+    fill := make([]io.Writer, len(shards))
+    missing := false
+    for i, shard := range shards {
+        switch {
+        case shard != nil:
+            valid[i] = io.NewSectionReader(shard, 0, manifest.ShardSize)
+        case i < manifest.DataShards:
+            if shards[i], err = os.CreateTemp("", "quantum-doc-verify-shard-*"); err != nil {
+                return nil, fmt.Errorf("failed to create temporary file: %w", err)
+            }
+            fill[i] = shards[i]
+            missing = true
+        }
+    }
+    if missing {
+        if err := enc.Reconstruct(valid, fill); err != nil {
+            return nil, fmt.Errorf("failed to reconstruct shards: %w", err)
+        }
+    }
+
+    data := make([]io.Reader, len(shards))
+    for i := 0; i < manifest.DataShards; i++ {
+        data[i] = io.NewSectionReader(shards[i], 0, manifest.ShardSize)
+    }
+    out, err := os.CreateTemp("", "quantum-doc-verify-*")
+    if err != nil {
+        return nil, fmt.Errorf("failed to create temporary file: %w", err)
+    }
+    builder := newContentBuilder(StoreOptions{})
+    if err := enc.Join(io.MultiWriter(out, builder), data, manifest.Size); err != nil {
+        removeSpool(out)
+        return nil, fmt.Errorf("failed to join shards: %w", err)
+    }
+
+    root, err := builder.Sum()
+    if err == nil && root.String() != manifest.ContentCID {
+        err = fmt.Errorf("reconstructed document does not match %s", manifest.ContentCID)
+    }
+    if err == nil {
+        _, err = out.Seek(0, io.SeekStart)
+    }
+    if err != nil {
+        removeSpool(out)
+        return nil, err
+    }
+    return &spooledReader{File: out}, nil
+}
+
+// PutBlock implements BlockStore, replicating the block to every node like a shard
+// manifest
+func (s *ErasureStore) PutBlock(ctx context.Context, cid string, data []byte) error {
+    if err := verifyBlock(cid, data); err != nil {
+        return err
+    }
+
+    required := min(s.parityShards+1, len(s.nodes))
+    stored := 0
+    var errs []error
+    for _, node := range s.nodes {
+        err := node.Store.(BlockStore).PutBlock(ctx, cid, data)
+        node.record(err, s.now(), s.probeInterval)
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+            continue
+        }
+        stored++
+    }
+    if stored < required {
+        return fmt.Errorf("block stored on %d nodes, %d required: %w", stored, required, errors.Join(errs...))
+    }
+    return nil
+}
+
+// GetBlock implements BlockStore, asking the nodes in turn
+func (s *ErasureStore) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    var errs []error
+    notFound := true
+    for _, node := range s.nodes {
+        data, err := node.Store.(BlockStore).GetBlock(ctx, cid)
+        node.record(err, s.now(), s.probeInterval)
+        if err == nil {
+            return data, nil
+        }
+        errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+        notFound = notFound && errors.Is(err, ErrNotFound)
+    }
+
+    if notFound {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    return nil, fmt.Errorf("no node returned block %s: %w", cid, errors.Join(errs...))
+}
+
+// Health reports the tracked health of every node
+func (s *ErasureStore) Health() []ReplicaHealth {
+    return replicaHealth(s.nodes)
+}
+
+// removeSpool closes and deletes a temporary file
+func removeSpool(file *os.File) {
+    file.Close()
+    os.Remove(file.Name())
+}
+
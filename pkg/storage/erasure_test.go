@@ -0,0 +1,196 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "errors"
+    "io"
+    "testing"
+    "time"
+)
+
+// faultyNode is a faultyStore over a FileStore that also serves blocks and unpins
+type faultyNode struct {
+    *faultyStore
+}
+
+func (f faultyNode) PutBlock(ctx context.Context, cid string, data []byte) error {
+    if f.down.Load() {
+        return errors.New("connection refused")
+    }
+    return f.DocumentStore.(*FileStore).PutBlock(ctx, cid, data)
+}
+
+func (f faultyNode) GetBlock(ctx context.Context, cid string) ([]byte, error) {
+    if f.down.Load() {
+        return nil, errors.New("connection refused")
+    }
+    return f.DocumentStore.(*FileStore).GetBlock(ctx, cid)
+}
+
+func (f faultyNode) Unpin(ctx context.Context, cid string) error {
+    return f.DocumentStore.(*FileStore).Unpin(ctx, cid)
+}
+
+func TestErasureStore(t *testing.T) {
+    ctx := context.Background()
+    stores, nodes := newReplicas(t, 6)
+    for i := range nodes {
+        nodes[i].Store = faultyNode{stores[i]}
+    }
+    store, err := NewErasureStore(nodes, 4, 2)
+    if err != nil {
+        t.Fatalf("Failed to create erasure-coded store: %v", err)
+    }
+
+    content := make([]byte, 3<<20+17)
+    rand.Read(content)
+    cid, err := store.Put(ctx, bytes.NewReader(content), StoreOptions{})
+    if err != nil {
+        t.Fatalf("Put failed: %v", err)
+    }
+
+    manifest, err := store.Manifest(ctx, cid)
+    if err != nil {
+        t.Fatalf("Manifest failed: %v", err)
+    }
+    if len(manifest.Shards) != 6 || manifest.ShardSize != (int64(len(content))+3)/4 {
+        t.Fatalf("Unexpected manifest %+v", manifest)
+    }
+    for i, shard := range manifest.Shards {
+        if shard.Node != nodes[i].Name {
+            t.Fatalf("Shard %d stored on %s, want %s", i, shard.Node, nodes[i].Name)
+        }
+    }
+
+    read := func() ([]byte, error) {
+        reader, err := store.Get(ctx, cid)
+        if err != nil {
+            return nil, err
+        }
+        defer reader.Close()
+        return io.ReadAll(reader)
+    }
+
+    // Any four shards reconstruct the document, including only data or only parity
+    for _, down := range [][]int{{}, {4, 5}, {0, 3}, {1, 2}} {
+        for i, s := range stores {
+            s.down.Store(false)
+            for _, d := range down {
+                s.down.Store(s.down.Load() || i == d)
+            }
+        }
+        got, err := read()
+        if err != nil || !bytes.Equal(got, content) {
+            t.Fatalf("Nodes %v down: document not reconstructed (%v)", down, err)
+        }
+    }
+
+    // Five nodes down leave too few shards
+    for i, s := range stores {
+        s.down.Store(i > 0)
+    }
+    if _, err := read(); err == nil {
+        t.Fatalf("Expected retrieval to fail with one shard")
+    }
+
+    // A shard that no longer matches its CID is not used
+    for _, s := range stores {
+        s.down.Store(false)
+    }
+    stores[0].corrupt.Store(true)
+    stores[1].down.Store(true)
+    stores[2].down.Store(true)
+    if _, err := read(); err == nil {
+        t.Fatalf("Expected retrieval to fail with a corrupted shard and two nodes down")
+    }
+    stores[0].corrupt.Store(false)
+
+    // Writes move shards to the next node when one is down
+    stores[1].down.Store(true)
+    stores[2].down.Store(false)
+    other, err := store.Put(ctx, bytes.NewReader(content[:1000]), StoreOptions{})
+    if err != nil {
+        t.Fatalf("Put with a node down failed: %v", err)
+    }
+    if m, _ := store.Manifest(ctx, other); m.Shards[1].Node == nodes[1].Name {
+        t.Fatalf("Shard 1 stored on the node that is down")
+    }
+    stores[1].down.Store(false)
+
+    if err := store.Unpin(ctx, cid); err != nil {
+        t.Fatalf("Unpin failed: %v", err)
+    }
+    if _, err := read(); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected ErrNotFound after unpinning, got %v", err)
+    }
+
+    if _, err := Open("file://" + t.TempDir() + ",file://" + t.TempDir() + ",erasure=1+1"); err != nil {
+        t.Fatalf("Failed to open erasure-coded store: %v", err)
+    }
+    if _, err := Open("localhost:5001,localhost:5002,erasure=2"); err == nil {
+        t.Fatalf("Expected an invalid erasure coding to be rejected")
+    }
+}
+
+func TestErasureStoreCache(t *testing.T) {
+    ctx := context.Background()
+    stores, nodes := newReplicas(t, 3)
+    for i := range nodes {
+        nodes[i].Store = faultyNode{stores[i]}
+    }
+    erasure, err := NewErasureStore(nodes, 2, 1)
+    if err != nil {
+        t.Fatalf("Failed to create erasure-coded store: %v", err)
+    }
+    cache, err := OpenCache(CacheOptions{Dir: t.TempDir(), MaxSize: 1 << 20, TTL: time.Hour})
+    if err != nil {
+        t.Fatalf("Failed to open cache: %v", err)
+    }
+    store := WithCache(erasure, cache)
+
+    content := make([]byte, 100000)
+    rand.Read(content)
+    cid, err := store.Put(ctx, bytes.NewReader(content), StoreOptions{})
+    if err != nil {
+        t.Fatalf("Put failed: %v", err)
+    }
+    manifest, err := erasure.Manifest(ctx, cid)
+    if err != nil {
+        t.Fatalf("Manifest failed: %v", err)
+    }
+
+    read := func() {
+        t.Helper()
+        reader, err := store.Get(ctx, cid)
+        if err != nil {
+            t.Fatalf("Get failed: %v", err)
+        }
+        retrieved, err := io.ReadAll(reader)
+        reader.Close()
+        if err != nil || !bytes.Equal(retrieved, content) {
+            t.Fatalf("Retrieved content does not match stored content (%v)", err)
+        }
+    }
+
+    // The document is cached under the CID of its content, and later reads fetch no
+    // shards
+    read()
+    if _, err := cache.Open(manifest.ContentCID); err != nil {
+        t.Fatalf("Expected the document to be cached under %s: %v", manifest.ContentCID, err)
+    }
+    for _, s := range stores {
+        s.calls.Store(0)
+    }
+    read()
+    read()
+    for i, s := range stores {
+        if n := s.calls.Load(); n != 0 {
+            t.Fatalf("Node %d was asked for %d shards after the document was cached", i, n)
+        }
+    }
+    if stats, _ := cache.Stats(); stats.Entries != 1 {
+        t.Fatalf("Expected 1 cache entry, got %+v", stats)
+    }
+}
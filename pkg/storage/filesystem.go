@@ -0,0 +1,103 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// FileStore keeps documents in a local directory, addressed by content.
+// Files are sharded into sub-directories by the last two characters of their CID.
+type FileStore struct {
+    root string
+}
+
+// NewFileStore creates a new filesystem store rooted at dir
+func NewFileStore(dir string) (*FileStore, error) {
+    if dir == "" {
+        return nil, fmt.Errorf("filesystem store requires a directory")
+    }
+
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create store directory: %w", err)
+    }
+
+    return &FileStore{root: dir}, nil
+}
+
+// Put writes the content to a temporary file while hashing it, then moves it into place
+func (s *FileStore) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    tmp, err := os.CreateTemp(s.root, ".put-*")
+    if err != nil {
+        return "", fmt.Errorf("failed to create temporary file: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+
+    builder := newContentBuilder(opts)
+    source := &progressReader{r: &contextReader{ctx: ctx, r: r}, progress: opts.Progress}
+    if _, err := io.Copy(io.MultiWriter(tmp, builder), source); err != nil {
+        tmp.Close()
+        return "", fmt.Errorf("failed to write document: %w", err)
+    }
+    if err := tmp.Close(); err != nil {
+        return "", fmt.Errorf("failed to write document: %w", err)
+    }
+
+    root, err := builder.Sum()
+    if err != nil {
+        return "", fmt.Errorf("failed to compute CID: %w", err)
+    }
+    if err := checkHashCID(root, opts); err != nil {
+        return "", err
+    }
+    cid := root.String()
+
+    path := s.path(cid)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return "", fmt.Errorf("failed to create shard directory: %w", err)
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return "", fmt.Errorf("failed to store document: %w", err)
+    }
+
+    return cid, nil
+}
+
+// Get opens the stored file for the given CID
+func (s *FileStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+
+    file, err := os.Open(s.path(cid))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open document: %w", err)
+    }
+
+    return unixfs.NewVerifyingReader(cid, file)
+}
+
+func (s *FileStore) path(cid string) string {
+    return filepath.Join(s.root, cid[len(cid)-2:], cid)
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+    ctx context.Context
+    r   io.Reader
+}
+
+func (c *contextReader) Read(b []byte) (int, error) {
+    if err := c.ctx.Err(); err != nil {
+        return 0, err
+    }
+    return c.r.Read(b)
+}
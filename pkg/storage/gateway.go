@@ -0,0 +1,267 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/car"
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// GatewayFlagUsage is the help text of the --fallback-gateways flag
+const GatewayFlagUsage = "HTTP gateways to retrieve from when the store cannot, e.g. https://trustless-gateway.link or https://{cid}.ipfs.dweb.link (subdomain)"
+
+// gatewayAccept asks for the whole file as a CARv1 in depth-first order with duplicate
+// blocks repeated, so it can be verified and streamed without buffering
+const gatewayAccept = "application/vnd.ipld.car; version=1; order=dfs; dups=y"
+
+// maxGatewayBuffer bounds the out-of-order or deduplicated blocks held in memory while
+// reading a gateway response that ignored the requested block order
+const maxGatewayBuffer = 256 << 20
+
+// GatewayStore retrieves documents from IPFS HTTP gateways using the trustless gateway
+// CAR response format. Every block is hashed and checked against the CID that links to
+// it, starting from the requested root, so a gateway cannot substitute content.
+//
+// Gateways are tried in order until one returns a CAR response. A gateway that fails
+// part-way through the content fails the read rather than falling over to the next one.
+type GatewayStore struct {
+    gateways   []string
+    httpClient *http.Client
+}
+
+// NewGatewayStore creates a store reading from the given gateways. Path gateways are
+// base URLs (https://ipfs.io); subdomain gateways contain a {cid} placeholder
+// (https://{cid}.ipfs.dweb.link), which is replaced by the base32 CIDv1.
+func NewGatewayStore(gateways []string) (*GatewayStore, error) {
+    if len(gateways) == 0 {
+        return nil, fmt.Errorf("no gateways configured")
+    }
+
+    var cleaned []string
+    for _, gw := range gateways {
+        gw = strings.TrimRight(strings.TrimSpace(gw), "/")
+        u, err := url.Parse(strings.ReplaceAll(gw, "{cid}", "cid"))
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return nil, fmt.Errorf("invalid gateway URL %q", gw)
+        }
+        cleaned = append(cleaned, gw)
+    }
+
+    return &GatewayStore{gateways: cleaned, httpClient: newHTTPClient()}, nil
+}
+
+// Put implements DocumentStore; gateways are read-only
+func (g *GatewayStore) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    return "", fmt.Errorf("HTTP gateways are read-only")
+}
+
+// Get implements DocumentStore, fetching the document as a CAR from the first gateway
+// that serves it
+func (g *GatewayStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    root, err := gocid.Decode(cid)
+    if err != nil {
+        return nil, fmt.Errorf("invalid CID %q: %w", cid, err)
+    }
+
+    var errs []error
+    notFound := true
+    for _, gw := range g.gateways {
+        reader, err := g.fetch(ctx, gw, root)
+        if err == nil {
+            return reader, nil
+        }
+        if ctx.Err() != nil {
+            return nil, err
+        }
+        errs = append(errs, err)
+        notFound = notFound && errors.Is(err, ErrNotFound)
+    }
+
+    if notFound {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    return nil, fmt.Errorf("no gateway returned %s: %w", cid, errors.Join(errs...))
+}
+
+// fetch requests the CAR for root from one gateway
+func (g *GatewayStore) fetch(ctx context.Context, gateway string, root gocid.Cid) (io.ReadCloser, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", gatewayEndpoint(gateway, root), nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    req.Header.Set("Accept", gatewayAccept)
+
+    resp, err := g.httpClient.Do(req)
+    if err != nil {
+        return nil, networkError(ctx, "failed to contact gateway "+gateway, err)
+    }
+
+    if resp.StatusCode == http.StatusNotFound {
+        resp.Body.Close()
+        return nil, fmt.Errorf("%w: %s on %s", ErrNotFound, root, gateway)
+    }
+    contentType := resp.Header.Get("Content-Type")
+    if resp.StatusCode != http.StatusOK || !strings.HasPrefix(contentType, "application/vnd.ipld.car") {
+        resp.Body.Close()
+        return nil, fmt.Errorf("gateway %s returned status %d (%s)", gateway, resp.StatusCode, contentType)
+    }
+
+    archive, err := car.NewReader(resp.Body)
+    if err != nil {
+        resp.Body.Close()
+        return nil, fmt.Errorf("gateway %s: %w", gateway, err)
+    }
+
+    source := &carBlockSource{
+        car:     archive,
+        pending: make(map[string][]byte),
+        keep:    !strings.Contains(contentType, "dups=y"),
+    }
+    return &gatewayReader{
+        Reader: unixfs.NewFileReader(root, source.get),
+        body:   resp.Body,
+    }, nil
+}
+
+// gatewayEndpoint returns the URL of c on a path or subdomain gateway
+func gatewayEndpoint(gateway string, c gocid.Cid) string {
+    if strings.Contains(gateway, "{cid}") {
+        // Subdomains are case-insensitive, so they need the base32 CIDv1
+        v1 := gocid.NewCidV1(c.Type(), c.Hash())
+        return strings.ReplaceAll(gateway, "{cid}", v1.String()) + "/"
+    }
+    return gateway + "/ipfs/" + c.String()
+}
+
+// carBlockSource serves blocks from a CAR stream in the order a DAG walk asks for them
+type carBlockSource struct {
+    car      *car.Reader
+    pending  map[string][]byte
+    buffered int
+
+    // keep retains visited blocks in case the gateway sends repeated blocks only once
+    keep bool
+    seen map[string][]byte
+
+    // refetch, if set, fetches blocks repeated in the DAG but sent only once, instead of
+    // keeping them; visited records the blocks already served
+    refetch unixfs.BlockGetter
+    visited map[string]bool
+}
+
+func (s *carBlockSource) get(c gocid.Cid) ([]byte, error) {
+    key := c.KeyString()
+    if data, ok := s.seen[key]; ok {
+        return data, nil
+    }
+    if s.visited[key] {
+        return s.refetch(c)
+    }
+    if data, ok := s.pending[key]; ok {
+        delete(s.pending, key)
+        s.buffered -= len(data)
+        return s.visit(key, data)
+    }
+
+    // Read ahead until the block arrives, holding back any others
+    for {
+        next, data, err := s.car.Next()
+        if err == io.EOF {
+            return nil, fmt.Errorf("gateway response ended without block %s", c)
+        }
+        if err != nil {
+            return nil, err
+        }
+        if next.Equals(c) {
+            return s.visit(key, data)
+        }
+
+        s.buffered += len(data)
+        if s.buffered > maxGatewayBuffer {
+            return nil, fmt.Errorf("gateway response is out of order by more than %d bytes", maxGatewayBuffer)
+        }
+        s.pending[next.KeyString()] = data
+    }
+}
+
+func (s *carBlockSource) visit(key string, data []byte) ([]byte, error) {
+    if s.refetch != nil {
+        if s.visited == nil {
+            s.visited = make(map[string]bool)
+        }
+        s.visited[key] = true
+    }
+    if !s.keep {
+        return data, nil
+    }
+    if s.seen == nil {
+        s.seen = make(map[string][]byte)
+    }
+    s.buffered += len(data)
+    if s.buffered > maxGatewayBuffer {
+        return nil, fmt.Errorf("gateway response without repeated blocks needs more than %d bytes of buffer", maxGatewayBuffer)
+    }
+    s.seen[key] = data
+    return data, nil
+}
+
+// gatewayReader reads verified file content and closes the response body. A block that
+// does not match its CID fails the read with unixfs.ErrCIDMismatch, as for every store.
+type gatewayReader struct {
+    io.Reader
+    body io.Closer
+}
+
+func (r *gatewayReader) Read(p []byte) (int, error) {
+    n, err := r.Reader.Read(p)
+    if errors.Is(err, car.ErrBlockMismatch) || errors.Is(err, unixfs.ErrBlockMismatch) {
+        err = fmt.Errorf("%w: %w", unixfs.ErrCIDMismatch, err)
+    }
+    return n, err
+}
+
+func (r *gatewayReader) Close() error {
+    return r.body.Close()
+}
+
+// fallbackStore retrieves from gateways when the primary store cannot
+type fallbackStore struct {
+    DocumentStore
+    gateways *GatewayStore
+}
+
+// WithGatewayFallback wraps store so that Get falls back to the given HTTP gateways when
+// the store fails. Writes still go to store only. With no gateways store is returned as is.
+func WithGatewayFallback(store DocumentStore, gateways []string) (DocumentStore, error) {
+    if len(gateways) == 0 {
+        return store, nil
+    }
+
+    gw, err := NewGatewayStore(gateways)
+    if err != nil {
+        return nil, err
+    }
+    return &fallbackStore{DocumentStore: store, gateways: gw}, nil
+}
+
+// Get tries the primary store, then the gateways
+func (s *fallbackStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    reader, err := s.DocumentStore.Get(ctx, cid)
+    if err == nil || ctx.Err() != nil {
+        return reader, err
+    }
+
+    reader, gwErr := s.gateways.Get(ctx, cid)
+    if gwErr != nil {
+        return nil, errors.Join(err, gwErr)
+    }
+    return reader, nil
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "errors"
+    "io"
+    "math/rand"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/car"
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// carFile builds the blocks of data and returns its root and a CARv1 with the blocks in
+// depth-first order, passing each block through edit
+func carFile(t *testing.T, data []byte, edit func(gocid.Cid, []byte) []byte) (gocid.Cid, []byte) {
+    blocks := make(map[string][]byte)
+    opts := unixfs.DefaultOptions(0)
+    opts.ChunkSize, opts.MaxLinks = 100, 4
+    opts.OnBlock = func(c gocid.Cid, block []byte) error {
+        blocks[c.KeyString()] = append([]byte(nil), block...)
+        return nil
+    }
+    root, err := unixfs.Compute(bytes.NewReader(data), opts)
+    if err != nil {
+        t.Fatalf("Compute failed: %v", err)
+    }
+
+    // {"roots": [root], "version": 1}
+    rootBytes := append([]byte{0}, root.Bytes()...)
+    header := []byte{0xa2, 0x65}
+    header = append(header, "roots"...)
+    header = append(header, 0x81, 0xd8, 42, 0x58, byte(len(rootBytes)))
+    header = append(header, rootBytes...)
+    header = append(header, 0x67)
+    header = append(header, "version"...)
+    header = append(header, 0x01)
+
+    archive := binary.AppendUvarint(nil, uint64(len(header)))
+    archive = append(archive, header...)
+
+    // Walking the file requests blocks in the order a gateway sends them
+    get := func(c gocid.Cid) ([]byte, error) {
+        block := blocks[c.KeyString()]
+        sent := block
+        if edit != nil {
+            sent = edit(c, block)
+        }
+        archive = binary.AppendUvarint(archive, uint64(len(c.Bytes())+len(sent)))
+        archive = append(archive, c.Bytes()...)
+        archive = append(archive, sent...)
+        return block, nil
+    }
+    if _, err := io.ReadAll(unixfs.NewFileReader(root, get)); err != nil {
+        t.Fatalf("Failed to walk file: %v", err)
+    }
+    return root, archive
+}
+
+func TestGatewayStore(t *testing.T) {
+    data := make([]byte, 5000)
+    rand.New(rand.NewSource(1)).Read(data)
+    root, archive := carFile(t, data, nil)
+
+    var requests []string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requests = append(requests, r.Host+r.URL.Path)
+        if !strings.HasPrefix(r.Header.Get("Accept"), "application/vnd.ipld.car") {
+            http.Error(w, "CAR only", http.StatusNotAcceptable)
+            return
+        }
+        switch r.URL.Path {
+        case "/ipfs/" + root.String(), "/":
+            w.Header().Set("Content-Type", "application/vnd.ipld.car; version=1; order=dfs; dups=y")
+            w.Write(archive)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+
+    ctx := context.Background()
+    read := func(store DocumentStore, cid string) ([]byte, error) {
+        reader, err := store.Get(ctx, cid)
+        if err != nil {
+            return nil, err
+        }
+        defer reader.Close()
+        return io.ReadAll(reader)
+    }
+
+    // Path gateway, after one that does not have the content
+    missing := httptest.NewServer(http.NotFoundHandler())
+    defer missing.Close()
+    store, err := NewGatewayStore([]string{missing.URL, server.URL})
+    if err != nil {
+        t.Fatalf("Failed to create gateway store: %v", err)
+    }
+    got, err := read(store, root.String())
+    if err != nil || !bytes.Equal(got, data) {
+        t.Fatalf("Path gateway read failed: %v", err)
+    }
+
+    // Subdomain gateways get the base32 CIDv1
+    subdomain := strings.Replace(server.URL, "127.0.0.1", "{cid}.ipfs.localhost", 1)
+    store, _ = NewGatewayStore([]string{subdomain})
+    store.httpClient.Transport = &http.Transport{
+        DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+            return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+        },
+    }
+    if got, err := read(store, root.String()); err != nil || !bytes.Equal(got, data) {
+        t.Fatalf("Subdomain gateway read failed: %v", err)
+    }
+    v1 := gocid.NewCidV1(gocid.DagProtobuf, root.Hash()).String()
+    if last := requests[len(requests)-1]; !strings.HasPrefix(last, v1+".ipfs.localhost") {
+        t.Fatalf("Unexpected subdomain request %s", last)
+    }
+
+    // A gateway substituting a block is caught while reading
+    sent := 0
+    _, forged := carFile(t, data, func(c gocid.Cid, block []byte) []byte {
+        if sent++; sent == 10 {
+            block = append([]byte(nil), block...)
+            block[len(block)-1] ^= 1
+        }
+        return block
+    })
+    archive = forged
+    store, _ = NewGatewayStore([]string{server.URL})
+    if _, err := read(store, root.String()); !errors.Is(err, car.ErrBlockMismatch) {
+        t.Fatalf("Expected ErrBlockMismatch from forged gateway, got %v", err)
+    }
+
+    // Missing everywhere is ErrNotFound, and the fallback reports both failures
+    store, _ = NewGatewayStore([]string{missing.URL})
+    if _, err := read(store, root.String()); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected ErrNotFound, got %v", err)
+    }
+    primary, _ := NewFileStore(t.TempDir())
+    fallback, err := WithGatewayFallback(primary, []string{missing.URL})
+    if err != nil {
+        t.Fatalf("Failed to create fallback store: %v", err)
+    }
+    if _, err := read(fallback, root.String()); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected ErrNotFound from fallback, got %v", err)
+    }
+}
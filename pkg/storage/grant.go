@@ -0,0 +1,187 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "time"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+// GrantVersion is the version of the access grant format written by this release
+const GrantVersion = 1
+
+// grantSignaturePrefix domain-separates grant signatures from document signatures made
+// with the same key
+var grantSignaturePrefix = []byte("quantum-doc-verify access grant v1\n")
+
+// ErrGrantRevoked is returned for an access grant that a revocation marker has withdrawn
+var ErrGrantRevoked = errors.New("access grant has been revoked")
+
+// AccessGrant gives a new recipient read access to a stored document without
+// re-encrypting or re-uploading it. The owner unwraps the envelope's content key and
+// wraps it to the recipient's ML-KEM-768 key; Recipient holds the result in the encoding
+// of a FieldRecipient value. Grants are signed by the owner's Dilithium key and stored
+// as small objects of their own, linked to the document by DocumentCID.
+type AccessGrant struct {
+    Version        int       `json:"version"`
+    DocumentCID    string    `json:"documentCid"`
+    DocumentHash   string    `json:"documentHash"`
+    RecipientKeyID string    `json:"recipientKeyId"`
+    Recipient      []byte    `json:"recipient"`
+    Created        time.Time `json:"created"`
+
+    SignatureAlgorithm string `json:"signatureAlgorithm"`
+    SignerKeyID        string `json:"signerKeyId"`
+    SignerPublicKey    []byte `json:"signerPublicKey"`
+    Signature          []byte `json:"signature,omitempty"`
+}
+
+// NewAccessGrant wraps the content key of the envelope described by header to
+// recipientKey, an ML-KEM-768 public key. ownerKey is whatever opens the envelope
+// today: a recipient's ML-KEM-768 private key, the tenant key of a convergent envelope
+// or the recombined key of a threshold envelope. The grant must be signed before it is
+// published.
+func NewAccessGrant(header *EnvelopeHeader, documentCID string, ownerKey, recipientKey []byte) (*AccessGrant, error) {
+    if header.KEM == KEMNone {
+        return nil, fmt.Errorf("document key is not encapsulated, so anyone with the envelope can already read it")
+    }
+
+    contentKey, err := header.unwrapContentKey(ownerKey)
+    if err != nil {
+        return nil, err
+    }
+    defer crypto.Wipe(contentKey)
+
+    recipient, err := wrapContentKey(contentKey, recipientKey)
+    if err != nil {
+        return nil, err
+    }
+
+    return &AccessGrant{
+        Version:        GrantVersion,
+        DocumentCID:    documentCID,
+        DocumentHash:   hex.EncodeToString(header.DocumentHash),
+        RecipientKeyID: hex.EncodeToString(recipient.keyID),
+        Recipient:      recipient.marshal(),
+        Created:        time.Now().UTC(),
+    }, nil
+}
+
+// Sign signs the grant with the private key loaded into signer
+func (g *AccessGrant) Sign(signer *crypto.DilithiumSigner) error {
+    publicKey, err := signer.ExportPublicKey()
+    if err != nil {
+        return fmt.Errorf("failed to export Dilithium public key: %w", err)
+    }
+    g.SignatureAlgorithm = crypto.DilithiumAlgorithm
+    g.SignerKeyID = crypto.DilithiumKeyID(publicKey)
+    g.SignerPublicKey = publicKey
+
+    message, err := g.signedMessage()
+    if err != nil {
+        return err
+    }
+    g.Signature, err = signer.Sign(message)
+    if err != nil {
+        return fmt.Errorf("failed to sign access grant: %w", err)
+    }
+    return nil
+}
+
+// Verify checks the grant's signature against the public key it carries. Callers must
+// still check that SignerKeyID is the document owner's.
+func (g *AccessGrant) Verify() error {
+    if g.Version != GrantVersion {
+        return fmt.Errorf("unsupported access grant version %d", g.Version)
+    }
+    if g.SignatureAlgorithm != crypto.DilithiumAlgorithm {
+        return fmt.Errorf("unsupported access grant signature algorithm %q", g.SignatureAlgorithm)
+    }
+    if crypto.DilithiumKeyID(g.SignerPublicKey) != g.SignerKeyID {
+        return fmt.Errorf("access grant signer key does not match its key ID")
+    }
+    if _, err := parseRecipient(g.Recipient); err != nil {
+        return err
+    }
+
+    message, err := g.signedMessage()
+    if err != nil {
+        return err
+    }
+    valid, err := crypto.NewDilithiumSigner().Verify(message, g.Signature, g.SignerPublicKey)
+    if err != nil {
+        return fmt.Errorf("failed to verify access grant: %w", err)
+    }
+    if !valid {
+        return fmt.Errorf("access grant signature is invalid")
+    }
+    return nil
+}
+
+// signedMessage is the grant without its signature, as signed
+func (g *AccessGrant) signedMessage() ([]byte, error) {
+    unsigned := *g
+    unsigned.Signature = nil
+    data, err := json.Marshal(unsigned)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode access grant: %w", err)
+    }
+    return append(append([]byte(nil), grantSignaturePrefix...), data...), nil
+}
+
+// PutAccessGrant stores a signed grant and returns its CID
+func PutAccessGrant(ctx context.Context, store DocumentStore, g *AccessGrant) (string, error) {
+    if err := g.Verify(); err != nil {
+        return "", err
+    }
+    data, err := json.MarshalIndent(g, "", "  ")
+    if err != nil {
+        return "", fmt.Errorf("failed to encode access grant: %w", err)
+    }
+    return store.Put(ctx, bytes.NewReader(data), StoreOptions{Size: int64(len(data))})
+}
+
+// GetAccessGrant reads the grant stored at cid and verifies its signature
+func GetAccessGrant(ctx context.Context, store DocumentStore, cid string) (*AccessGrant, error) {
+    reader, err := store.Get(ctx, cid)
+    if err != nil {
+        return nil, err
+    }
+    defer reader.Close()
+
+    data, err := io.ReadAll(io.LimitReader(reader, maxMetadataSize))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read access grant: %w", err)
+    }
+    var g AccessGrant
+    if err := json.Unmarshal(data, &g); err != nil {
+        return nil, fmt.Errorf("invalid access grant: %w", err)
+    }
+    if err := g.Verify(); err != nil {
+        return nil, err
+    }
+    return &g, nil
+}
+
+// addGrant lets unwrapContentKey recover the content key with the private key of the
+// grant's recipient
+func (h *EnvelopeHeader) addGrant(g *AccessGrant) error {
+    if g == nil {
+        return nil
+    }
+    if g.DocumentHash != hex.EncodeToString(h.DocumentHash) {
+        return fmt.Errorf("access grant is for another document")
+    }
+    recipient, err := parseRecipient(g.Recipient)
+    if err != nil {
+        return err
+    }
+    h.granted = &recipient
+    return nil
+}
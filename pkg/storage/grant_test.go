@@ -0,0 +1,94 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "testing"
+
+    "golang.org/x/crypto/sha3"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+func TestAccessGrant(t *testing.T) {
+    ctx := context.Background()
+    content := bytes.Repeat([]byte("Due diligence pack, section 4. "), 200)
+    documentHash := sha3.Sum256(content)
+
+    ownerPub, ownerPriv, _ := crypto.GenerateKEMKeypair()
+    auditorPub, auditorPriv, _ := crypto.GenerateKEMKeypair()
+    envelope := sealStream(t, content, EnvelopeOptions{
+        Recipients:   [][]byte{ownerPub},
+        DocumentHash: documentHash[:],
+        SegmentSize:  testSegmentSize,
+    })
+    if _, err := openStream(envelope, auditorPriv); !errors.Is(err, ErrNotRecipient) {
+        t.Fatalf("Expected ErrNotRecipient before the grant, got %v", err)
+    }
+
+    // The owner grants the auditor access and publishes the signed grant
+    header, _, err := ReadEnvelopeHeader(bytes.NewReader(envelope))
+    if err != nil {
+        t.Fatalf("Failed to read envelope header: %v", err)
+    }
+    if _, err := NewAccessGrant(header, "bafy-document", auditorPriv, auditorPub); !errors.Is(err, ErrNotRecipient) {
+        t.Fatalf("Expected only a key that opens the document to grant access, got %v", err)
+    }
+    grant, err := NewAccessGrant(header, "bafy-document", ownerPriv, auditorPub)
+    if err != nil {
+        t.Fatalf("NewAccessGrant failed: %v", err)
+    }
+    signer := crypto.NewDilithiumSigner()
+    defer signer.Close()
+    if _, _, err := signer.GenerateKeypair(); err != nil {
+        t.Fatalf("Failed to generate Dilithium keypair: %v", err)
+    }
+    if _, err := PutAccessGrant(ctx, nil, grant); err == nil {
+        t.Fatalf("Expected an unsigned grant to be refused")
+    }
+    if err := grant.Sign(signer); err != nil {
+        t.Fatalf("Failed to sign grant: %v", err)
+    }
+
+    store, _ := NewFileStore(t.TempDir())
+    grantCID, err := PutAccessGrant(ctx, store, grant)
+    if err != nil {
+        t.Fatalf("PutAccessGrant failed: %v", err)
+    }
+    published, err := GetAccessGrant(ctx, store, grantCID)
+    if err != nil {
+        t.Fatalf("GetAccessGrant failed: %v", err)
+    }
+
+    // The auditor reads the unchanged envelope through the grant
+    reader, _, err := NewDecryptReaderWithGrant(bytes.NewReader(envelope), auditorPriv, published)
+    if err != nil {
+        t.Fatalf("Failed to open envelope with grant: %v", err)
+    }
+    if got, err := io.ReadAll(reader); err != nil || !bytes.Equal(got, content) {
+        t.Fatalf("Granted content differs (%v)", err)
+    }
+    whole, err := SealEnvelope(content, EnvelopeOptions{Recipients: [][]byte{ownerPub}})
+    if err != nil {
+        t.Fatalf("Failed to seal envelope: %v", err)
+    }
+    if _, _, err := OpenEnvelopeWithGrant(whole, auditorPriv, published); err == nil {
+        t.Fatalf("Expected a grant for another envelope to fail")
+    }
+
+    // Tampering with a signed grant is detected
+    tampered := *published
+    tampered.DocumentCID = "bafy-other"
+    if err := tampered.Verify(); err == nil {
+        t.Fatalf("Expected a tampered grant to fail verification")
+    }
+
+    // Documents without key encapsulation have nothing to grant
+    plain, _ := SealEnvelope(content, EnvelopeOptions{})
+    plainHeader, _, _ := ParseEnvelopeHeader(plain)
+    if _, err := NewAccessGrant(plainHeader, "bafy-plain", nil, auditorPub); err == nil {
+        t.Fatalf("Expected a KEMNone envelope to be refused")
+    }
+}
@@ -3,144 +3,435 @@ package storage
 
 import (
     "bytes"
+    "context"
     "crypto/aes"
     "crypto/cipher"
-    "crypto/rand"
     "encoding/binary"
     "encoding/hex"
     "encoding/json"
+    "errors"
     "fmt"
+    "hash"
     "io"
-    "mime/multipart"
     "io/ioutil"
+    "mime/multipart"
     "net/http"
+    "net/url"
     "os"
     "path/filepath"
     "time"
 
+    gocid "github.com/ipfs/go-cid"
     "golang.org/x/crypto/sha3"
+    "quantum-doc-verify/pkg/car"
     "quantum-doc-verify/pkg/crypto" // Keep this import for Dilithium
+    "quantum-doc-verify/pkg/unixfs"
 )
 
-// IPFSClient handles interactions with IPFS
+// IPFSClient handles interactions with IPFS.
+// Requests share a pooled transport. Failures to reach the node are retried with
+// exponential back-off and jitter, and after repeated failures a circuit breaker fails
+// calls with ErrUnavailable until the node answers again.
 type IPFSClient struct {
-    apiURL string
+    apiURL     string
+    httpClient *http.Client
+    retry      retryPolicy
+    breaker    *circuitBreaker
+}
+
+// StoreOptions controls how content is added to IPFS
+type StoreOptions struct {
+    // Chunker is the Kubo chunking strategy, e.g. "size-262144" or "rabin-min-avg-max".
+    // Empty uses the node's default.
+    Chunker string
+
+    // RawLeaves stores leaf blocks as raw blocks instead of UnixFS-wrapped nodes
+    RawLeaves bool
+
+    // Size is the content length in bytes if known. It is used to scale the upload timeout.
+    Size int64
+
+    // Progress, if set, is called with the cumulative number of bytes uploaded
+    Progress func(sent int64)
+
+    // HashCID stores the content as a single raw block addressed by a CIDv1 with a
+    // SHA3-256 multihash, so that the CID can be derived from the document hash (see
+    // blockchain.DocumentCID). The content must not exceed MaxHashCIDSize.
+    HashCID bool
 }
 
+// MaxHashCIDSize is the largest document that can be stored under a hash CID. IPFS
+// nodes do not exchange larger blocks.
+const MaxHashCIDSize = 1 << 20
+
+const (
+    // baseTimeout is the allowance for request overhead on top of transfer time
+    baseTimeout = 10 * time.Second
+
+    // minThroughput is the slowest transfer rate (bytes/second) tolerated before timing out
+    minThroughput = 512 * 1024
+
+    // DefaultRequestTimeout bounds calls whose size is unknown and whose context has no deadline
+    DefaultRequestTimeout = 2 * time.Minute
+)
+
 // NewIPFSClient creates a new IPFS client
 func NewIPFSClient(gateway string) (*IPFSClient, error) {
     // Format the API URL
     apiURL := fmt.Sprintf("http://%s/api/v0", gateway)
-    
+
+    return newIPFSClientURL(apiURL), nil
+}
+
+// newIPFSClientURL creates a client for a full API URL such as https://host:5001/api/v0
+func newIPFSClientURL(apiURL string) *IPFSClient {
     return &IPFSClient{
-        apiURL: apiURL,
-    }, nil
+        apiURL:     apiURL,
+        httpClient: newHTTPClient(),
+        retry:      defaultRetryPolicy,
+        breaker:    newCircuitBreaker(),
+    }
+}
+
+// TimeoutForSize returns an upload/download timeout that scales with the content size
+func TimeoutForSize(size int64) time.Duration {
+    if size <= 0 {
+        return DefaultRequestTimeout
+    }
+    return baseTimeout + time.Duration(size/minThroughput)*time.Second
+}
+
+// withSizeTimeout applies a size-scaled deadline unless the context already has one
+func withSizeTimeout(ctx context.Context, size int64) (context.Context, context.CancelFunc) {
+    if _, ok := ctx.Deadline(); ok {
+        return ctx, func() {}
+    }
+    return context.WithTimeout(ctx, TimeoutForSize(size))
+}
+
+// do sends the request built by newRequest, retrying transient failures while ctx
+// allows. newRequest is called once per attempt and must return a request with a fresh
+// body. Responses other than 200 are returned as errors typed by status.
+func (c *IPFSClient) do(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+    var lastErr error
+    for attempt := 1; ; attempt++ {
+        if err := c.breaker.allow(); err != nil {
+            if lastErr != nil {
+                return nil, fmt.Errorf("%w (last error: %v)", err, lastErr)
+            }
+            return nil, err
+        }
+
+        req, err := newRequest()
+        if errors.Is(err, errNoReplay) && lastErr != nil {
+            return nil, lastErr
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to create request: %w", err)
+        }
+
+        resp, err := c.send(ctx, req)
+        if err == nil {
+            return resp, nil
+        }
+        lastErr = err
+
+        if attempt >= c.retry.maxAttempts || !retryable(ctx, err) {
+            return nil, err
+        }
+        if sleep(ctx, c.retry.delay(attempt)) != nil {
+            return nil, err
+        }
+    }
+}
+
+// send makes a single attempt and records its outcome with the circuit breaker
+func (c *IPFSClient) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+    resp, err := c.httpClient.Do(req)
+    if err != nil {
+        err = networkError(ctx, "failed to send request to IPFS", err)
+        c.breaker.record(err)
+        return nil, err
+    }
+
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+
+        // Kubo reports errors as {"Message": "...", "Code": 0, "Type": "error"}
+        var apiErr struct {
+            Message string `json:"Message"`
+        }
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+        if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+            body = []byte(apiErr.Message)
+        }
+        err = statusError(resp.StatusCode, string(body))
+        c.breaker.record(err)
+        return nil, err
+    }
+    c.breaker.record(nil)
+    return resp, nil
 }
 
 // Store uploads content to IPFS
-func (c *IPFSClient) Store(content []byte) (string, error) {
+func (c *IPFSClient) Store(ctx context.Context, content []byte) (string, error) {
+    return c.StoreReader(ctx, bytes.NewReader(content), StoreOptions{Size: int64(len(content))})
+}
+
+// StoreReader streams content from r to IPFS without buffering it in memory.
+// The multipart request body is produced on the fly through a pipe. A failed upload is
+// retried only if r is an io.Seeker that can be rewound, or nothing was read from it yet.
+func (c *IPFSClient) StoreReader(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    ctx, cancel := withSizeTimeout(ctx, opts.Size)
+    defer cancel()
+
     // Create the API endpoint for adding files
-    url := fmt.Sprintf("%s/add", c.apiURL)
-    
-    // Create a buffer to store our multipart form
-    var buf bytes.Buffer
-    
-    // Create a new multipart writer
-    w := multipart.NewWriter(&buf)
-    
-    // Create a form file field
-    fileField, err := w.CreateFormFile("file", "document")
-    if err != nil {
-        return "", fmt.Errorf("failed to create form file: %w", err)
+    query := url.Values{}
+    if opts.Chunker != "" {
+        query.Set("chunker", opts.Chunker)
     }
-    
-    // Write the content to the form file field
-    _, err = fileField.Write(content)
-    if err != nil {
-        return "", fmt.Errorf("failed to write content to form: %w", err)
+    if opts.RawLeaves {
+        query.Set("raw-leaves", "true")
     }
-    
-    // Close the multipart writer to set the terminating boundary
-    w.Close()
-    
-    // Create a new HTTP request
-    req, err := http.NewRequest("POST", url, &buf)
-    if err != nil {
-        return "", fmt.Errorf("failed to create request: %w", err)
+    if opts.HashCID {
+        query.Set("cid-version", "1")
+        query.Set("raw-leaves", "true")
+        query.Set("hash", "sha3-256")
+        query.Set("chunker", fmt.Sprintf("size-%d", MaxHashCIDSize))
     }
-    
-    // Set the content type with the writer's boundary
-    req.Header.Set("Content-Type", w.FormDataContentType())
-    
-    // Send the request
-    client := &http.Client{
-        Timeout: 10 * time.Second,
+    endpoint := fmt.Sprintf("%s/add", c.apiURL)
+    if len(query) > 0 {
+        endpoint += "?" + query.Encode()
     }
-    resp, err := client.Do(req)
+
+    start := int64(-1)
+    seeker, ok := r.(io.Seeker)
+    if ok {
+        if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+            start = offset
+        }
+    }
+
+    source := &progressReader{r: r, progress: opts.Progress}
+    var pipe *io.PipeReader
+    var written chan struct{}
+
+    // With HashCID the CID is also computed from the content sent, to catch a node that
+    // ignores the hash option
+    var builder *unixfs.Builder
+    newRequest := func() (*http.Request, error) {
+        if pipe != nil {
+            // Wait for the previous attempt to stop reading before rewinding
+            pipe.CloseWithError(errNoReplay)
+            <-written
+            if source.read > 0 {
+                if start < 0 {
+                    return nil, errNoReplay
+                }
+                if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+                    return nil, errNoReplay
+                }
+                source.read = 0
+            }
+        }
+
+        // Produce the multipart form in a goroutine; the HTTP client reads from the pipe
+        pr, pw := io.Pipe()
+        w := multipart.NewWriter(pw)
+        done := make(chan struct{})
+        if opts.HashCID {
+            builder = newContentBuilder(opts)
+        }
+        hashed := builder
+        go func() {
+            defer close(done)
+            fileField, err := w.CreateFormFile("file", "document")
+            if err != nil {
+                pw.CloseWithError(fmt.Errorf("failed to create form file: %w", err))
+                return
+            }
+
+            var dst io.Writer = fileField
+            if hashed != nil {
+                dst = io.MultiWriter(fileField, hashed)
+            }
+            if _, err := io.Copy(dst, source); err != nil {
+                pw.CloseWithError(fmt.Errorf("failed to write content to form: %w", err))
+                return
+            }
+
+            // Close the multipart writer to set the terminating boundary
+            pw.CloseWithError(w.Close())
+        }()
+        pipe, written = pr, done
+
+        req, err := http.NewRequestWithContext(ctx, "POST", endpoint, pr)
+        if err != nil {
+            return nil, err
+        }
+        // Set the content type with the writer's boundary
+        req.Header.Set("Content-Type", w.FormDataContentType())
+        return req, nil
+    }
+    defer func() {
+        if pipe != nil {
+            pipe.CloseWithError(errNoReplay)
+        }
+    }()
+
+    resp, err := c.do(ctx, newRequest)
     if err != nil {
-        return "", fmt.Errorf("failed to send request to IPFS: %w", err)
+        return "", err
     }
     defer resp.Body.Close()
-    
-    // Check status code
-    if resp.StatusCode != http.StatusOK {
-        body, _ := io.ReadAll(resp.Body)
-        return "", fmt.Errorf("IPFS returned error: %s (status %d)", string(body), resp.StatusCode)
-    }
-    
+
     // Parse the JSON response properly
     var result struct {
         Name string `json:"Name"`
         Hash string `json:"Hash"`
         Size string `json:"Size"`
     }
-    
+
     if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
         return "", fmt.Errorf("failed to decode response: %w", err)
     }
-    
+
     if result.Hash == "" {
         return "", fmt.Errorf("empty hash in IPFS response")
     }
-    
+    if opts.HashCID {
+        root, err := gocid.Decode(result.Hash)
+        if err != nil {
+            return "", fmt.Errorf("IPFS returned invalid CID %q: %w", result.Hash, err)
+        }
+        if err := checkHashCID(root, opts); err != nil {
+            return "", err
+        }
+
+        // Wait for the form to be written before reading the CID of what was sent
+        pipe.CloseWithError(errNoReplay)
+        <-written
+        expected, err := builder.Sum()
+        if err != nil {
+            return "", fmt.Errorf("failed to compute CID: %w", err)
+        }
+        if !root.Equals(expected) {
+            return "", fmt.Errorf("%w: IPFS stored the document as %s instead of its hash CID %s", unixfs.ErrCIDMismatch, root, expected)
+        }
+    }
+
     // Return the CID (Hash)
     return result.Hash, nil
 }
 
-// Retrieve downloads content from IPFS
-func (c *IPFSClient) Retrieve(cid string) ([]byte, error) {
-    // Create the API endpoint for getting files
-    url := fmt.Sprintf("%s/cat?arg=%s", c.apiURL, cid)
-    
-    // Create HTTP request
-    req, err := http.NewRequest("POST", url, nil)
+// Retrieve downloads content from IPFS. Without a deadline on ctx the download is
+// bounded by DefaultRequestTimeout.
+func (c *IPFSClient) Retrieve(ctx context.Context, cid string) ([]byte, error) {
+    ctx, cancel := withSizeTimeout(ctx, 0)
+    defer cancel()
+
+    reader, err := c.RetrieveReader(ctx, cid)
     if err != nil {
-        return nil, fmt.Errorf("failed to create request: %w", err)
+        return nil, err
     }
-    
-    // Send the request
-    client := &http.Client{
-        Timeout: 10 * time.Second, // Add a timeout
+    defer reader.Close()
+
+    // Read response
+    content, err := io.ReadAll(reader)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read response: %w", err)
     }
-    resp, err := client.Do(req)
+
+    return content, nil
+}
+
+// RetrieveReader opens a streaming reader for content stored on IPFS.
+// The caller must close the reader; the transfer is bounded by ctx. The node exports the
+// file's DAG as a CAR and every block is checked against the CID linking to it before
+// its content is returned, so content stored with any chunker is verified. Reading fails
+// with unixfs.ErrCIDMismatch at the first block that does not match.
+// Only opening the content is retried: a transfer that fails part-way fails the read.
+func (c *IPFSClient) RetrieveReader(ctx context.Context, cid string) (io.ReadCloser, error) {
+    root, err := gocid.Decode(cid)
     if err != nil {
-        return nil, fmt.Errorf("failed to send request to IPFS: %w", err)
+        return nil, fmt.Errorf("invalid CID %q: %w", cid, err)
     }
-    defer resp.Body.Close()
-    
-    // Check status code
-    if resp.StatusCode != http.StatusOK {
-        body, _ := io.ReadAll(resp.Body)
-        return nil, fmt.Errorf("IPFS returned error: %s (status %d)", string(body), resp.StatusCode)
+
+    query := url.Values{"arg": {cid}, "progress": {"false"}}
+    resp, err := c.do(ctx, func() (*http.Request, error) {
+        return http.NewRequestWithContext(ctx, "POST", c.apiURL+"/dag/export?"+query.Encode(), nil)
+    })
+    if err != nil {
+        return nil, err
     }
-    
-    // Read response
-    content, err := io.ReadAll(resp.Body)
+
+    archive, err := car.NewReader(resp.Body)
     if err != nil {
-        return nil, fmt.Errorf("failed to read response: %w", err)
+        resp.Body.Close()
+        return nil, fmt.Errorf("failed to read DAG of %s: %w", cid, err)
     }
-    
-    return content, nil
+
+    // Kubo sends blocks repeated in the file only once; fetch them again when needed
+    source := &carBlockSource{
+        car:     archive,
+        pending: make(map[string][]byte),
+        refetch: func(block gocid.Cid) ([]byte, error) {
+            return c.GetBlock(ctx, block.String())
+        },
+    }
+    return &gatewayReader{
+        Reader: unixfs.NewFileReader(root, source.get),
+        body:   resp.Body,
+    }, nil
+}
+
+// Pin pins cid and everything it links to on the node, so it is kept by garbage
+// collection. Use pkg/pinning to replicate it to remote pinning services.
+func (c *IPFSClient) Pin(ctx context.Context, cid string) error {
+    if err := validateCID(cid); err != nil {
+        return err
+    }
+
+    var result struct {
+        Pins []string `json:"Pins"`
+    }
+    query := url.Values{"arg": {cid}, "recursive": {"true"}}
+    if err := c.call(ctx, "pin/add", query, &result); err != nil {
+        return fmt.Errorf("failed to pin %s: %w", cid, err)
+    }
+    return nil
+}
+
+// Ping checks that the node's API is reachable. It makes a single attempt even while
+// the circuit breaker is open, so a successful ping closes the circuit.
+func (c *IPFSClient) Ping(ctx context.Context) error {
+    req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL+"/version", nil)
+    if err != nil {
+        return fmt.Errorf("failed to create request: %w", err)
+    }
+
+    resp, err := c.send(ctx, req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+// progressReader reports the cumulative number of bytes read
+type progressReader struct {
+    r        io.Reader
+    read     int64
+    progress func(int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+    n, err := p.r.Read(b)
+    p.read += int64(n)
+    if n > 0 && p.progress != nil {
+        p.progress(p.read)
+    }
+    return n, err
 }
 
 // CalculateDocumentHash calculates a hash of document content using SHA3 (quantum-resistant)
@@ -150,9 +441,15 @@ func CalculateDocumentHash(content []byte) string {
     return hex.EncodeToString(hash[:])
 }
 
+// NewDocumentHasher returns a hash.Hash producing the same digest as CalculateDocumentHash,
+// for hashing documents while they are streamed
+func NewDocumentHasher() hash.Hash {
+    return sha3.New256()
+}
+
 // StoreWithDilithium stores a document on IPFS and creates a Dilithium signature
 // Returns CID, signature, and error
-func (c *IPFSClient) StoreWithDilithium(content []byte, dilithiumPrivKey []byte) (string, []byte, error) {
+func (c *IPFSClient) StoreWithDilithium(ctx context.Context, content []byte, dilithiumPrivKey []byte) (string, []byte, error) {
     // Create a temporary file for the content
     tempDir, err := ioutil.TempDir("", "dilithium-sign")
     if err != nil {
@@ -167,6 +464,7 @@ func (c *IPFSClient) StoreWithDilithium(content []byte, dilithiumPrivKey []byte)
     
     // Create a Dilithium signer
     signer := crypto.NewDilithiumSigner()
+    defer signer.Close()
     
     // Sign the document
     signature, err := signer.SignDocument(tempFile, dilithiumPrivKey)
@@ -175,7 +473,7 @@ func (c *IPFSClient) StoreWithDilithium(content []byte, dilithiumPrivKey []byte)
     }
     
     // Store on IPFS
-    cid, err := c.Store(content)
+    cid, err := c.Store(ctx, content)
     if err != nil {
         return "", nil, fmt.Errorf("failed to store on IPFS: %w", err)
     }
@@ -211,82 +509,10 @@ type EncryptedDocument struct {
     Signature  []byte // Dilithium signature
 }
 
-// EncryptDocument uses a hybrid approach with AES-256 and Dilithium signatures
-func EncryptDocument(content []byte, dilithiumPubKey []byte) ([]byte, error) {
-    // 1. Generate a random AES-256 key (32 bytes)
-    aesKey := make([]byte, 32)
-    if _, err := io.ReadFull(rand.Reader, aesKey); err != nil {
-        return nil, fmt.Errorf("failed to generate AES key: %w", err)
-    }
-
-    // 2. Generate random IV for AES-GCM
-    iv := make([]byte, 12) // GCM mode needs 12 bytes
-    if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-        return nil, fmt.Errorf("failed to generate IV: %w", err)
-    }
-
-    // 3. Create AES cipher block
-    block, err := aes.NewCipher(aesKey)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create AES cipher: %w", err)
-    }
-
-    // 4. Create GCM mode
-    gcm, err := cipher.NewGCM(block)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create GCM mode: %w", err)
-    }
-
-    // 5. Encrypt the content
-    ciphertext := gcm.Seal(nil, iv, content, nil)
-
-    // 6. Now we need to securely store the AES key
-    // In a real quantum-resistant system, we would use Kyber or similar to encrypt the key
-    // For this implementation, we'll use Dilithium to sign the encrypted data instead
-
-    // Create a temporary file with ciphertext for signing
-    tempDir, err := ioutil.TempDir("", "dilithium-encrypt")
-    if err != nil {
-        return nil, fmt.Errorf("failed to create temp directory: %w", err)
-    }
-    defer os.RemoveAll(tempDir)
-
-    // We'll include the AES key in the data we sign
-    dataToSign := append(aesKey, ciphertext...)
-    tempFile := filepath.Join(tempDir, "encrypted.tmp")
-    if err := ioutil.WriteFile(tempFile, dataToSign, 0600); err != nil {
-        return nil, fmt.Errorf("failed to write temp file: %w", err)
-    }
-
-    // 7. Sign with Dilithium - in practice, we'd need the private key here
-    // For now, we'll use a placeholder signature calculation
-    signature := sha3.Sum256(dataToSign)
-    
-    // 8. Create the final encrypted package
-    // Format: [AES Key length (4 bytes)][AES Key][IV length (4 bytes)][IV][Ciphertext length (4 bytes)][Ciphertext][Signature length (4 bytes)][Signature]
-    buf := new(bytes.Buffer)
-    
-    // Write AES key
-    binary.Write(buf, binary.LittleEndian, uint32(len(aesKey)))
-    buf.Write(aesKey)
-    
-    // Write IV
-    binary.Write(buf, binary.LittleEndian, uint32(len(iv)))
-    buf.Write(iv)
-    
-    // Write ciphertext
-    binary.Write(buf, binary.LittleEndian, uint32(len(ciphertext)))
-    buf.Write(ciphertext)
-    
-    // Write signature
-    binary.Write(buf, binary.LittleEndian, uint32(len(signature)))
-    buf.Write(signature[:])
-    
-    return buf.Bytes(), nil
-}
-
-// DecryptDocument decrypts a document encrypted with our hybrid approach
-func DecryptDocument(encryptedData []byte, dilithiumPrivKey []byte) ([]byte, error) {
+// DecryptLegacyDocument opens documents written before the envelope format:
+// [AES key length][AES key][IV length][IV][ciphertext length][ciphertext][signature length][signature],
+// with little-endian uint32 lengths and a SHA3-256 checksum in place of a signature
+func DecryptLegacyDocument(encryptedData []byte) ([]byte, error) {
     buf := bytes.NewBuffer(encryptedData)
     
     // 1. Read AES key
@@ -368,7 +594,7 @@ func DecryptDocument(encryptedData []byte, dilithiumPrivKey []byte) ([]byte, err
 }
 
 // StoreEncrypted stores an encrypted document on IPFS
-func (c *IPFSClient) StoreEncrypted(content []byte, dilithiumPubKey []byte) (string, error) {
+func (c *IPFSClient) StoreEncrypted(ctx context.Context, content []byte, dilithiumPubKey []byte) (string, error) {
     // Encrypt the content first
     encryptedData, err := EncryptDocument(content, dilithiumPubKey)
     if err != nil {
@@ -376,13 +602,13 @@ func (c *IPFSClient) StoreEncrypted(content []byte, dilithiumPubKey []byte) (str
     }
     
     // Store the encrypted data on IPFS
-    return c.Store(encryptedData)
+    return c.Store(ctx, encryptedData)
 }
 
 // RetrieveEncrypted retrieves and decrypts a document from IPFS
-func (c *IPFSClient) RetrieveEncrypted(cid string, dilithiumPrivKey []byte) ([]byte, error) {
+func (c *IPFSClient) RetrieveEncrypted(ctx context.Context, cid string, dilithiumPrivKey []byte) ([]byte, error) {
     // Retrieve the encrypted data from IPFS
-    encryptedData, err := c.Retrieve(cid)
+    encryptedData, err := c.Retrieve(ctx, cid)
     if err != nil {
         return nil, fmt.Errorf("failed to retrieve document from IPFS: %w", err)
     }
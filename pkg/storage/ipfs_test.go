@@ -2,8 +2,24 @@ package storage
 
 import (
     "bytes"
+    "context"
     "crypto/rand"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
     "testing"
+    "time"
+
+    gocid "github.com/ipfs/go-cid"
+
+    "quantum-doc-verify/pkg/car"
+    "quantum-doc-verify/pkg/ipfs/ipfstest"
+    "quantum-doc-verify/pkg/unixfs"
 )
 
 func TestHybridEncryption(t *testing.T) {
@@ -35,4 +51,328 @@ func TestHybridEncryption(t *testing.T) {
     if !bytes.Equal(content, decryptedData) {
         t.Fatalf("Decryption did not restore original content")
     }
-}
\ No newline at end of file
+}
+
+func TestStreamingStoreAndRetrieve(t *testing.T) {
+    blocks := make(map[string][]byte)
+    var root gocid.Cid
+    tamper := false
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/api/v0/add":
+            if r.URL.Query().Get("chunker") != "size-1024" || r.URL.Query().Get("raw-leaves") != "true" {
+                http.Error(w, "missing add options", http.StatusBadRequest)
+                return
+            }
+            file, _, err := r.FormFile("file")
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            opts := unixfs.DefaultOptions(0)
+            opts.RawLeaves = true
+            opts.ChunkSize = 1024
+            opts.OnBlock = func(c gocid.Cid, data []byte) error {
+                blocks[c.KeyString()] = append([]byte(nil), data...)
+                return nil
+            }
+            builder := unixfs.NewBuilder(opts)
+            size, _ := io.Copy(builder, file)
+            root, _ = builder.Sum()
+            fmt.Fprintf(w, `{"Name":"document","Hash":"%s","Size":"%d"}`, root, size)
+        case "/api/v0/dag/export":
+            var archive bytes.Buffer
+            writer, _ := car.NewWriter(&archive, []gocid.Cid{root})
+            unixfs.Walk(root, func(c gocid.Cid) ([]byte, error) { return blocks[c.KeyString()], nil }, writer.Put)
+            exported := archive.Bytes()
+            if tamper {
+                exported[len(exported)-1] ^= 1
+            }
+            w.Write(exported)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+
+    client, err := NewIPFSClient(strings.TrimPrefix(server.URL, "http://"))
+    if err != nil {
+        t.Fatalf("Failed to create client: %v", err)
+    }
+
+    content := make([]byte, 3<<20)
+    rand.Read(content)
+
+    var lastProgress int64
+    cid, err := client.StoreReader(context.Background(), bytes.NewReader(content), StoreOptions{
+        Chunker:   "size-1024",
+        RawLeaves: true,
+        Size:      int64(len(content)),
+        Progress:  func(sent int64) { lastProgress = sent },
+    })
+    if err != nil {
+        t.Fatalf("StoreReader failed: %v", err)
+    }
+    if !strings.HasPrefix(cid, "Qm") {
+        t.Fatalf("Unexpected CID %q", cid)
+    }
+    if lastProgress != int64(len(content)) {
+        t.Fatalf("Progress reported %d bytes, want %d", lastProgress, len(content))
+    }
+
+    reader, err := client.RetrieveReader(context.Background(), cid)
+    if err != nil {
+        t.Fatalf("RetrieveReader failed: %v", err)
+    }
+    defer reader.Close()
+
+    retrieved, err := io.ReadAll(reader)
+    if err != nil {
+        t.Fatalf("Failed to read content: %v", err)
+    }
+    if !bytes.Equal(content, retrieved) {
+        t.Fatalf("Retrieved content does not match stored content")
+    }
+
+    // Content that no longer matches its CID is rejected
+    tamper = true
+    if _, err := client.Retrieve(context.Background(), cid); !errors.Is(err, unixfs.ErrCIDMismatch) {
+        t.Fatalf("Expected ErrCIDMismatch for tampered content, got %v", err)
+    }
+}
+
+func TestIPNS(t *testing.T) {
+    keys := map[string]string{"self": "k51self"}
+    records := map[string]string{}
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        query := r.URL.Query()
+        switch r.URL.Path {
+        case "/api/v0/key/list":
+            var list []IPNSKey
+            for name, id := range keys {
+                list = append(list, IPNSKey{Name: name, ID: id})
+            }
+            json.NewEncoder(w).Encode(map[string]interface{}{"Keys": list})
+        case "/api/v0/key/gen":
+            if query.Get("type") != "ed25519" {
+                http.Error(w, `{"Message":"unsupported key type","Type":"error"}`, http.StatusInternalServerError)
+                return
+            }
+            keys[query.Get("arg")] = "k51" + query.Get("arg")
+            json.NewEncoder(w).Encode(IPNSKey{Name: query.Get("arg"), ID: keys[query.Get("arg")]})
+        case "/api/v0/name/publish":
+            id, ok := keys[query.Get("key")]
+            if !ok {
+                http.Error(w, `{"Message":"no key by the given name was found","Type":"error"}`, http.StatusInternalServerError)
+                return
+            }
+            records[id] = query.Get("arg")
+            json.NewEncoder(w).Encode(map[string]string{"Name": id, "Value": query.Get("arg")})
+        case "/api/v0/name/resolve":
+            path, ok := records[strings.TrimPrefix(query.Get("arg"), "/ipns/")]
+            if !ok {
+                http.Error(w, `{"Message":"could not resolve name","Type":"error"}`, http.StatusInternalServerError)
+                return
+            }
+            json.NewEncoder(w).Encode(map[string]string{"Path": path})
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    defer server.Close()
+
+    client := newIPFSClientURL(server.URL + "/api/v0")
+    ctx := context.Background()
+    v1, _ := unixfs.Compute(strings.NewReader("policy v1"), unixfs.DefaultOptions(0))
+    v2, _ := unixfs.Compute(strings.NewReader("policy v2"), unixfs.DefaultOptions(0))
+
+    key, err := client.EnsureKey(ctx, "policy")
+    if err != nil || key.ID != "k51policy" {
+        t.Fatalf("EnsureKey failed: %+v %v", key, err)
+    }
+    if again, _ := client.EnsureKey(ctx, "policy"); again != key {
+        t.Fatalf("EnsureKey did not reuse the existing key: %+v", again)
+    }
+
+    // Re-publishing moves the name to the new version
+    for _, version := range []string{v1.String(), v2.String()} {
+        name, err := client.PublishName(ctx, "policy", version, 0)
+        if err != nil || name != key.ID {
+            t.Fatalf("PublishName failed: %s %v", name, err)
+        }
+        resolved, err := client.ResolveName(ctx, "/ipns/"+name)
+        if err != nil || resolved != version {
+            t.Fatalf("Resolved %s (%v), want %s", resolved, err, version)
+        }
+    }
+
+    if _, err := client.PublishName(ctx, "missing", v1.String(), time.Hour); err == nil || !strings.Contains(err.Error(), "no key by the given name") {
+        t.Fatalf("Expected the node's error message, got %v", err)
+    }
+    if _, err := client.ResolveName(ctx, "k51unknown"); err == nil {
+        t.Fatalf("Expected unknown name to fail")
+    }
+}
+
+func TestRetriesAndCircuitBreaker(t *testing.T) {
+    var mu sync.Mutex
+    var requests, failAdds int
+    var down bool
+    var stored []byte
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mu.Lock()
+        defer mu.Unlock()
+        requests++
+        if down {
+            http.Error(w, "node restarting", http.StatusServiceUnavailable)
+            return
+        }
+
+        switch r.URL.Path {
+        case "/api/v0/add":
+            file, _, err := r.FormFile("file")
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            content, _ := io.ReadAll(file)
+            if failAdds > 0 {
+                failAdds--
+                http.Error(w, "overloaded", http.StatusServiceUnavailable)
+                return
+            }
+            stored = content
+            cid, _ := unixfs.Compute(bytes.NewReader(content), unixfs.DefaultOptions(0))
+            fmt.Fprintf(w, `{"Name":"document","Hash":"%s"}`, cid)
+        case "/api/v0/dag/export":
+            w.WriteHeader(http.StatusInternalServerError)
+            fmt.Fprint(w, `{"Message":"merkledag: not found","Code":0,"Type":"error"}`)
+        case "/api/v0/version":
+            fmt.Fprint(w, `{"Version":"0.30.0"}`)
+        }
+    }))
+    defer server.Close()
+
+    client, _ := NewIPFSClient(strings.TrimPrefix(server.URL, "http://"))
+    client.retry = retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+    now := time.Now()
+    client.breaker.now = func() time.Time { return now }
+    ctx := context.Background()
+    count := func() int {
+        mu.Lock()
+        defer mu.Unlock()
+        n := requests
+        requests = 0
+        return n
+    }
+
+    // Transient failures are retried, rewinding a seekable body
+    content := make([]byte, 1<<20)
+    rand.Read(content)
+    failAdds = 2
+    if _, err := client.StoreReader(ctx, bytes.NewReader(content), StoreOptions{}); err != nil {
+        t.Fatalf("Expected upload to succeed after retries: %v", err)
+    }
+    if n := count(); n != 3 || !bytes.Equal(stored, content) {
+        t.Fatalf("Expected 3 attempts uploading the whole content, got %d", n)
+    }
+
+    // A body that cannot be rewound is sent once
+    failAdds = 1
+    if _, err := client.StoreReader(ctx, io.MultiReader(bytes.NewReader(content)), StoreOptions{}); !errors.Is(err, ErrUnavailable) {
+        t.Fatalf("Expected ErrUnavailable, got %v", err)
+    }
+    if n := count(); n != 1 {
+        t.Fatalf("Expected a single attempt for a one-shot body, got %d", n)
+    }
+
+    // Missing content is typed and not retried
+    if _, err := client.RetrieveReader(ctx, "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected ErrNotFound, got %v", err)
+    }
+    if n := count(); n != 1 {
+        t.Fatalf("Expected a single attempt for missing content, got %d", n)
+    }
+
+    // Repeated failures open the circuit, which then fails without contacting the node
+    down = true
+    client.Store(ctx, content)
+    client.Store(ctx, content)
+    if n := count(); n != breakerThreshold {
+        t.Fatalf("Expected the circuit to open after %d requests, got %d", breakerThreshold, n)
+    }
+    if _, err := client.Store(ctx, content); !errors.Is(err, ErrUnavailable) || count() != 0 {
+        t.Fatalf("Expected an open circuit to fail fast with ErrUnavailable, got %v", err)
+    }
+
+    // After the cooldown one request probes the node, and success closes the circuit
+    down = false
+    now = now.Add(breakerCooldown)
+    if err := client.Ping(ctx); err != nil {
+        t.Fatalf("Ping failed: %v", err)
+    }
+    if _, err := client.Store(ctx, content); err != nil {
+        t.Fatalf("Expected the circuit to close after a successful probe: %v", err)
+    }
+}
+
+func TestInMemoryNode(t *testing.T) {
+    ctx := context.Background()
+    node := ipfstest.NewServer()
+    defer node.Close()
+
+    client, err := NewIPFSClient(node.Addr())
+    if err != nil {
+        t.Fatalf("Failed to create client: %v", err)
+    }
+    if err := client.Ping(ctx); err != nil {
+        t.Fatalf("Ping failed: %v", err)
+    }
+
+    // The node assigns the CIDs Kubo does
+    cid, err := client.Store(ctx, []byte("hello world\n"))
+    if err != nil || cid != "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o" {
+        t.Fatalf("Store returned %q (%v)", cid, err)
+    }
+
+    content := make([]byte, 1<<20)
+    rand.Read(content)
+    large, err := client.StoreReader(ctx, bytes.NewReader(content), StoreOptions{RawLeaves: true})
+    if err != nil {
+        t.Fatalf("StoreReader failed: %v", err)
+    }
+    retrieved, err := client.Retrieve(ctx, large)
+    if err != nil || !bytes.Equal(retrieved, content) {
+        t.Fatalf("Retrieved content does not match stored content (%v)", err)
+    }
+
+    // Any chunker can be verified, including files whose repeated blocks are exported once
+    repeated := bytes.Repeat([]byte("same block "), 10000)
+    chunked, err := client.StoreReader(ctx, bytes.NewReader(repeated), StoreOptions{Chunker: "size-1100"})
+    if err != nil {
+        t.Fatalf("StoreReader failed: %v", err)
+    }
+    if retrieved, err := client.Retrieve(ctx, chunked); err != nil || !bytes.Equal(retrieved, repeated) {
+        t.Fatalf("Retrieved content does not match content stored with a custom chunker (%v)", err)
+    }
+
+    // Released content is collected; pinned content is kept
+    if err := client.Unpin(ctx, large); err != nil {
+        t.Fatalf("Unpin failed: %v", err)
+    }
+    if err := client.Unpin(ctx, large); err != nil {
+        t.Fatalf("Unpinning twice failed: %v", err)
+    }
+    if removed, err := client.GC(ctx); err != nil || removed != 5 {
+        t.Fatalf("GC removed %d blocks (%v), want 5", removed, err)
+    }
+    if _, err := client.Retrieve(ctx, large); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected ErrNotFound for collected content, got %v", err)
+    }
+    if err := client.Pin(ctx, large); err == nil {
+        t.Fatalf("Expected pinning missing content to fail")
+    }
+    if !node.Pinned(cid) || !node.Has(cid) {
+        t.Fatalf("Pinned content was collected")
+    }
+}
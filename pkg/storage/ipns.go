@@ -0,0 +1,123 @@
+package storage
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    gocid "github.com/ipfs/go-cid"
+)
+
+// IPNS records are signed by the node with keys from its key ring ("ipfs key gen").
+// One key per logical document gives it a stable /ipns/ name that is re-pointed at
+// each new version's CID.
+
+// IPNSKey is a key from the node's key ring
+type IPNSKey struct {
+    Name string `json:"Name"`
+    ID   string `json:"Id"`
+}
+
+// ListKeys returns the keys in the node's key ring
+func (c *IPFSClient) ListKeys(ctx context.Context) ([]IPNSKey, error) {
+    var result struct {
+        Keys []IPNSKey `json:"Keys"`
+    }
+    if err := c.call(ctx, "key/list", nil, &result); err != nil {
+        return nil, fmt.Errorf("failed to list keys: %w", err)
+    }
+    return result.Keys, nil
+}
+
+// EnsureKey returns the key with the given name, generating an Ed25519 key if the
+// key ring does not have one yet
+func (c *IPFSClient) EnsureKey(ctx context.Context, name string) (IPNSKey, error) {
+    keys, err := c.ListKeys(ctx)
+    if err != nil {
+        return IPNSKey{}, err
+    }
+    for _, key := range keys {
+        if key.Name == name {
+            return key, nil
+        }
+    }
+
+    var key IPNSKey
+    query := url.Values{"arg": {name}, "type": {"ed25519"}}
+    if err := c.call(ctx, "key/gen", query, &key); err != nil {
+        return IPNSKey{}, fmt.Errorf("failed to generate key %q: %w", name, err)
+    }
+    return key, nil
+}
+
+// PublishName points the IPNS name of keyName at cid and returns the name.
+// A zero lifetime keeps the node's default record lifetime.
+func (c *IPFSClient) PublishName(ctx context.Context, keyName, cid string, lifetime time.Duration) (string, error) {
+    if _, err := gocid.Decode(cid); err != nil {
+        return "", fmt.Errorf("invalid CID %q: %w", cid, err)
+    }
+
+    query := url.Values{"arg": {"/ipfs/" + cid}, "key": {keyName}}
+    if lifetime > 0 {
+        query.Set("lifetime", lifetime.String())
+    }
+
+    var result struct {
+        Name  string `json:"Name"`
+        Value string `json:"Value"`
+    }
+    if err := c.call(ctx, "name/publish", query, &result); err != nil {
+        return "", fmt.Errorf("failed to publish IPNS record: %w", err)
+    }
+    return result.Name, nil
+}
+
+// ResolveName returns the CID an IPNS name currently points to
+func (c *IPFSClient) ResolveName(ctx context.Context, name string) (string, error) {
+    name = strings.TrimPrefix(name, "/ipns/")
+    query := url.Values{"arg": {"/ipns/" + name}, "recursive": {"true"}}
+
+    var result struct {
+        Path string `json:"Path"`
+    }
+    if err := c.call(ctx, "name/resolve", query, &result); err != nil {
+        return "", fmt.Errorf("failed to resolve %s: %w", name, err)
+    }
+
+    cid := strings.TrimPrefix(result.Path, "/ipfs/")
+    if _, err := gocid.Decode(cid); err != nil || cid == result.Path {
+        return "", fmt.Errorf("%s resolved to %q, which is not an IPFS path", name, result.Path)
+    }
+    return cid, nil
+}
+
+// call invokes an RPC API command and decodes its JSON response into out
+func (c *IPFSClient) call(ctx context.Context, command string, query url.Values, out interface{}) error {
+    if _, ok := ctx.Deadline(); !ok {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+        defer cancel()
+    }
+
+    endpoint := fmt.Sprintf("%s/%s", c.apiURL, command)
+    if len(query) > 0 {
+        endpoint += "?" + query.Encode()
+    }
+
+    resp, err := c.do(ctx, func() (*http.Request, error) {
+        return http.NewRequestWithContext(ctx, "POST", endpoint, nil)
+    })
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+        return fmt.Errorf("failed to parse IPFS response: %w", err)
+    }
+    return nil
+}
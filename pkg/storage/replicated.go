@@ -0,0 +1,422 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// DefaultProbeInterval is how long a failing replica is skipped before it is tried again.
+// The delay doubles with each consecutive failure, up to maxProbeBackoff.
+const DefaultProbeInterval = 30 * time.Second
+
+// maxProbeBackoff caps the delay before a failing replica is re-probed
+const maxProbeBackoff = 10 * time.Minute
+
+// Pinger is implemented by stores that can report whether they are reachable without
+// transferring content
+type Pinger interface {
+    Ping(ctx context.Context) error
+}
+
+// Replica is one node of a ReplicatedStore
+type Replica struct {
+    Name  string
+    Store DocumentStore
+}
+
+// ReplicaHealth describes the tracked health of a replica
+type ReplicaHealth struct {
+    Name      string    `json:"name"`
+    Healthy   bool      `json:"healthy"`
+    Failures  int       `json:"failures"`
+    LastError string    `json:"lastError,omitempty"`
+    RetryAt   time.Time `json:"retryAt,omitempty"`
+}
+
+// replica tracks the health of one node
+type replica struct {
+    Replica
+
+    mu        sync.Mutex
+    failures  int
+    lastError error
+    retryAt   time.Time
+}
+
+// ReplicatedStore writes every document to several stores and reads from whichever
+// answers first. A write succeeds once WriteQuorum replicas agree on the CID; the
+// remaining uploads continue in the background. Replicas that fail are skipped until
+// their back-off expires, after which the next request (or Probe) tries them again.
+type ReplicatedStore struct {
+    replicas      []*replica
+    writeQuorum   int
+    probeInterval time.Duration
+    now           func() time.Time
+}
+
+// NewReplicatedStore creates a store replicating to replicas. A writeQuorum of 0 selects
+// a majority of the replicas.
+func NewReplicatedStore(replicas []Replica, writeQuorum int) (*ReplicatedStore, error) {
+    if len(replicas) == 0 {
+        return nil, fmt.Errorf("replicated store requires at least one replica")
+    }
+    if writeQuorum == 0 {
+        writeQuorum = len(replicas)/2 + 1
+    }
+    if writeQuorum < 1 || writeQuorum > len(replicas) {
+        return nil, fmt.Errorf("write quorum must be between 1 and %d", len(replicas))
+    }
+
+    s := &ReplicatedStore{
+        writeQuorum:   writeQuorum,
+        probeInterval: DefaultProbeInterval,
+        now:           time.Now,
+    }
+    for _, r := range replicas {
+        s.replicas = append(s.replicas, &replica{Replica: r})
+    }
+    return s, nil
+}
+
+// openReplicated parses a comma-separated list of store URLs with an optional
+// "quorum=N" element, e.g. "node1:5001,node2:5001,node3:5001,quorum=2", or an
+// "erasure=K+M" element to erasure-code documents across the stores instead
+func openReplicated(storeURL string) (DocumentStore, error) {
+    var replicas []Replica
+    quorum := 0
+    dataShards, parityShards := 0, 0
+    for _, part := range strings.Split(storeURL, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        if value, ok := strings.CutPrefix(part, "quorum="); ok {
+            n, err := strconv.Atoi(value)
+            if err != nil {
+                return nil, fmt.Errorf("invalid write quorum %q", value)
+            }
+            quorum = n
+            continue
+        }
+        if value, ok := strings.CutPrefix(part, "erasure="); ok {
+            var err error
+            if dataShards, parityShards, err = parseErasure(value); err != nil {
+                return nil, err
+            }
+            continue
+        }
+
+        store, err := Open(part)
+        if err != nil {
+            return nil, err
+        }
+        replicas = append(replicas, Replica{Name: part, Store: store})
+    }
+
+    if dataShards > 0 {
+        if quorum != 0 {
+            return nil, fmt.Errorf("quorum= does not apply to erasure-coded stores")
+        }
+        return NewErasureStore(replicas, dataShards, parityShards)
+    }
+    return NewReplicatedStore(replicas, quorum)
+}
+
+// Put spools the content to a temporary file and uploads it to every available replica
+// in parallel, returning once WriteQuorum of them have stored it under the same CID
+func (s *ReplicatedStore) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    // 1. Spool the content so each replica can read it independently
+    spool, size, err := spoolToFile(ctx, &progressReader{r: r, progress: opts.Progress})
+    if err != nil {
+        return "", err
+    }
+    opts.Size = size
+    opts.Progress = nil
+
+    targets := s.available()
+    if len(targets) < s.writeQuorum {
+        spool.Close()
+        os.Remove(spool.Name())
+        return "", fmt.Errorf("only %d of %d replicas are available, %d required", len(targets), len(s.replicas), s.writeQuorum)
+    }
+
+    // 2. Upload everywhere. Uploads outlive the caller's context once the quorum is
+    // reached, so they get their own deadline.
+    uploadCtx, cancel := withSizeTimeout(context.WithoutCancel(ctx), size)
+    type putResult struct {
+        replica *replica
+        cid     string
+        err     error
+    }
+    results := make(chan putResult, len(targets))
+
+    var wg sync.WaitGroup
+    for _, target := range targets {
+        wg.Add(1)
+        go func(target *replica) {
+            defer wg.Done()
+            cid, err := target.Store.Put(uploadCtx, io.NewSectionReader(spool, 0, size), opts)
+            target.record(err, s.now(), s.probeInterval)
+            results <- putResult{target, cid, err}
+        }(target)
+    }
+
+    go func() {
+        wg.Wait()
+        cancel()
+        spool.Close()
+        os.Remove(spool.Name())
+    }()
+
+    // 3. Wait for enough replicas to agree on the CID
+    votes := make(map[string]int)
+    var errs []error
+    for received := 0; received < len(targets); received++ {
+        var result putResult
+        select {
+        case result = <-results:
+        case <-ctx.Done():
+            return "", fmt.Errorf("replicated write interrupted: %w", ctx.Err())
+        }
+
+        if result.err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", result.replica.Name, result.err))
+            continue
+        }
+        votes[result.cid]++
+        if votes[result.cid] >= s.writeQuorum {
+            return result.cid, nil
+        }
+    }
+
+    if len(votes) > 1 {
+        errs = append(errs, fmt.Errorf("replicas returned different CIDs: %v", votes))
+    }
+    return "", fmt.Errorf("write quorum of %d not reached: %w", s.writeQuorum, errors.Join(errs...))
+}
+
+// Get asks every available replica for the content at once and returns the first copy
+// that is read completely and verifies against the CID. The copy is spooled to a
+// temporary file, which is removed when the reader is closed.
+func (s *ReplicatedStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+
+    targets := s.available()
+    raceCtx, cancel := context.WithCancel(ctx)
+
+    type getResult struct {
+        file *os.File
+        err  error
+    }
+    results := make(chan getResult, len(targets))
+    for _, target := range targets {
+        go func(target *replica) {
+            file, err := s.fetch(raceCtx, target, cid)
+            // Losing the race is not a replica failure
+            if raceCtx.Err() == nil || err == nil {
+                target.record(err, s.now(), s.probeInterval)
+            }
+            if err != nil {
+                err = fmt.Errorf("%s: %w", target.Name, err)
+            }
+            results <- getResult{file, err}
+        }(target)
+    }
+
+    var errs []error
+    for received := 0; received < len(targets); received++ {
+        result := <-results
+        if result.err != nil {
+            errs = append(errs, result.err)
+            continue
+        }
+
+        // Stop the other transfers and discard any copies they complete
+        cancel()
+        go func(pending int) {
+            for ; pending > 0; pending-- {
+                if other := <-results; other.file != nil {
+                    other.file.Close()
+                    os.Remove(other.file.Name())
+                }
+            }
+        }(len(targets) - received - 1)
+        return &spooledReader{File: result.file}, nil
+    }
+    cancel()
+
+    // Report not found only if every replica agreed it is missing
+    notFound := len(errs) > 0
+    for _, err := range errs {
+        notFound = notFound && errors.Is(err, ErrNotFound)
+    }
+    if notFound {
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    }
+    return nil, fmt.Errorf("no replica returned verified content for %s: %w", cid, errors.Join(errs...))
+}
+
+// fetch downloads and verifies a replica's copy into a temporary file
+func (s *ReplicatedStore) fetch(ctx context.Context, target *replica, cid string) (*os.File, error) {
+    reader, err := target.Store.Get(ctx, cid)
+    if err != nil {
+        return nil, err
+    }
+    defer reader.Close()
+
+    file, _, err := spoolToFile(ctx, reader)
+    return file, err
+}
+
+// Probe pings every replica whose back-off has expired and updates its health.
+// Replicas that cannot be pinged are left to be retried by the next request.
+func (s *ReplicatedStore) Probe(ctx context.Context) {
+    now := s.now()
+    for _, r := range s.replicas {
+        pinger, ok := r.Store.(Pinger)
+        if !ok || r.healthy() || now.Before(r.nextRetry()) {
+            continue
+        }
+        r.record(pinger.Ping(ctx), s.now(), s.probeInterval)
+    }
+}
+
+// StartProbing calls Probe every interval until ctx is done
+func (s *ReplicatedStore) StartProbing(ctx context.Context, interval time.Duration) {
+    go func() {
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                s.Probe(ctx)
+            }
+        }
+    }()
+}
+
+// Health reports the tracked health of every replica
+func (s *ReplicatedStore) Health() []ReplicaHealth {
+    return replicaHealth(s.replicas)
+}
+
+// Replicas returns the stores the content is replicated to
+func (s *ReplicatedStore) Replicas() []Replica {
+    replicas := make([]Replica, 0, len(s.replicas))
+    for _, r := range s.replicas {
+        replicas = append(replicas, r.Replica)
+    }
+    return replicas
+}
+
+func replicaHealth(replicas []*replica) []ReplicaHealth {
+    health := make([]ReplicaHealth, 0, len(replicas))
+    for _, r := range replicas {
+        r.mu.Lock()
+        h := ReplicaHealth{
+            Name:     r.Name,
+            Healthy:  r.failures == 0,
+            Failures: r.failures,
+            RetryAt:  r.retryAt,
+        }
+        if r.lastError != nil {
+            h.LastError = r.lastError.Error()
+        }
+        r.mu.Unlock()
+        health = append(health, h)
+    }
+    return health
+}
+
+// available returns the healthy replicas and those due to be re-probed. If every replica
+// is backing off, all of them are tried rather than failing outright.
+func (s *ReplicatedStore) available() []*replica {
+    now := s.now()
+    var targets []*replica
+    for _, r := range s.replicas {
+        if r.healthy() || !now.Before(r.nextRetry()) {
+            targets = append(targets, r)
+        }
+    }
+    if len(targets) == 0 {
+        return s.replicas
+    }
+    return targets
+}
+
+func (r *replica) healthy() bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.failures == 0
+}
+
+func (r *replica) nextRetry() time.Time {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.retryAt
+}
+
+// record updates the replica's health after a request. A missing document is a valid
+// answer, not a failure.
+func (r *replica) record(err error, now time.Time, interval time.Duration) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if err == nil || errors.Is(err, ErrNotFound) {
+        r.failures = 0
+        r.lastError = nil
+        return
+    }
+
+    r.failures++
+    r.lastError = err
+    backoff := interval
+    for i := 1; i < r.failures && backoff < maxProbeBackoff; i++ {
+        backoff *= 2
+    }
+    if backoff > maxProbeBackoff {
+        backoff = maxProbeBackoff
+    }
+    r.retryAt = now.Add(backoff)
+}
+
+// spoolToFile copies r to a new temporary file and rewinds it
+func spoolToFile(ctx context.Context, r io.Reader) (*os.File, int64, error) {
+    file, err := os.CreateTemp("", "quantum-doc-verify-*")
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to create temporary file: %w", err)
+    }
+
+    size, err := io.Copy(file, &contextReader{ctx: ctx, r: r})
+    if err == nil {
+        _, err = file.Seek(0, io.SeekStart)
+    }
+    if err != nil {
+        file.Close()
+        os.Remove(file.Name())
+        return nil, 0, err
+    }
+    return file, size, nil
+}
+
+// spooledReader reads a temporary file and removes it on Close
+type spooledReader struct {
+    *os.File
+}
+
+func (s *spooledReader) Close() error {
+    err := s.File.Close()
+    os.Remove(s.File.Name())
+    return err
+}
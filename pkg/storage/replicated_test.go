@@ -0,0 +1,138 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// faultyStore wraps a store, failing or corrupting requests on demand
+type faultyStore struct {
+    DocumentStore
+    down    atomic.Bool
+    corrupt atomic.Bool
+    calls   atomic.Int32
+}
+
+func (f *faultyStore) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    f.calls.Add(1)
+    if f.down.Load() {
+        return "", errors.New("connection refused")
+    }
+    return f.DocumentStore.Put(ctx, r, opts)
+}
+
+func (f *faultyStore) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    f.calls.Add(1)
+    if f.down.Load() {
+        return nil, errors.New("connection refused")
+    }
+    if f.corrupt.Load() {
+        return unixfs.NewVerifyingReader(cid, io.NopCloser(bytes.NewReader([]byte("forged content"))))
+    }
+    return f.DocumentStore.Get(ctx, cid)
+}
+
+func newReplicas(t *testing.T, n int) ([]*faultyStore, []Replica) {
+    var stores []*faultyStore
+    var replicas []Replica
+    for i := 0; i < n; i++ {
+        fs, err := NewFileStore(t.TempDir())
+        if err != nil {
+            t.Fatalf("Failed to create file store: %v", err)
+        }
+        store := &faultyStore{DocumentStore: fs}
+        stores = append(stores, store)
+        replicas = append(replicas, Replica{Name: string(rune('a' + i)), Store: store})
+    }
+    return stores, replicas
+}
+
+func TestReplicatedStoreQuorum(t *testing.T) {
+    stores, replicas := newReplicas(t, 3)
+    store, err := NewReplicatedStore(replicas, 2)
+    if err != nil {
+        t.Fatalf("Failed to create replicated store: %v", err)
+    }
+    start := time.Now()
+    var elapsed atomic.Int64
+    store.now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+
+    ctx := context.Background()
+    content := []byte("replicated document")
+
+    // One node down: the write still reaches quorum and the node is marked unhealthy
+    stores[2].down.Store(true)
+    cid, err := store.Put(ctx, bytes.NewReader(content), StoreOptions{})
+    if err != nil {
+        t.Fatalf("Put failed with one replica down: %v", err)
+    }
+    // The failure is recorded by an upload that may finish after the quorum is reached
+    for deadline := time.Now().Add(time.Second); store.Health()[2].Healthy && time.Now().Before(deadline); {
+        time.Sleep(time.Millisecond)
+    }
+    if health := store.Health(); health[2].Healthy || !health[0].Healthy {
+        t.Fatalf("Unexpected health: %+v", health)
+    }
+
+    // The unhealthy node is skipped until its back-off expires
+    calls := stores[2].calls.Load()
+    stores[1].down.Store(true)
+    if _, err := store.Put(ctx, bytes.NewReader(content), StoreOptions{}); err == nil {
+        t.Fatalf("Expected write to fail without quorum")
+    }
+    if stores[2].calls.Load() != calls {
+        t.Fatalf("Unhealthy replica was not skipped")
+    }
+
+    // Once it recovers and is due for a probe, it counts towards the quorum again
+    stores[2].down.Store(false)
+    elapsed.Store(int64(maxProbeBackoff))
+    if _, err := store.Put(ctx, bytes.NewReader(content), StoreOptions{}); err != nil {
+        t.Fatalf("Expected recovered replica to restore quorum: %v", err)
+    }
+    if !store.Health()[2].Healthy {
+        t.Fatalf("Recovered replica still marked unhealthy")
+    }
+
+    // Reads skip corrupt copies and take the first verified one
+    stores[1].down.Store(false)
+    stores[0].corrupt.Store(true)
+    reader, err := store.Get(ctx, cid)
+    if err != nil {
+        t.Fatalf("Get failed: %v", err)
+    }
+    got, _ := io.ReadAll(reader)
+    reader.Close()
+    if !bytes.Equal(got, content) {
+        t.Fatalf("Got %q, want %q", got, content)
+    }
+
+    // Missing everywhere is reported as ErrNotFound
+    missing, _ := unixfs.Compute(bytes.NewReader([]byte("never stored")), unixfs.DefaultOptions(1))
+    stores[0].corrupt.Store(false)
+    if _, err := store.Get(ctx, missing.String()); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Expected ErrNotFound, got %v", err)
+    }
+}
+
+func TestOpenReplicated(t *testing.T) {
+    store, err := Open("file://" + t.TempDir() + ",file://" + t.TempDir() + ",localhost:5001,quorum=3")
+    if err != nil {
+        t.Fatalf("Failed to open replicated store: %v", err)
+    }
+    replicated, ok := store.(*ReplicatedStore)
+    if !ok || len(replicated.replicas) != 3 || replicated.writeQuorum != 3 {
+        t.Fatalf("Unexpected store: %#v", store)
+    }
+
+    if _, err := Open("localhost:5001,localhost:5002,quorum=3"); err == nil {
+        t.Fatalf("Expected quorum larger than the replica count to be rejected")
+    }
+}
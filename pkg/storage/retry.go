@@ -0,0 +1,201 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/rand/v2"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Typed errors let callers tell a missing document from a store that is slow or down.
+// They are wrapped, so test for them with errors.Is.
+var (
+    // ErrTimeout is returned when a request does not complete before its deadline
+    ErrTimeout = errors.New("request timed out")
+
+    // ErrUnavailable is returned when a store cannot be reached or is overloaded, and
+    // while its circuit breaker is open
+    ErrUnavailable = errors.New("store unavailable")
+)
+
+// errNoReplay is returned by a request builder whose body has already been consumed
+var errNoReplay = errors.New("request body cannot be replayed")
+
+// sharedTransport pools connections for every HTTP client in the package, so repeated
+// calls to a node reuse connections instead of dialing each time
+var sharedTransport = &http.Transport{
+    Proxy: http.ProxyFromEnvironment,
+    DialContext: (&net.Dialer{
+        Timeout:   10 * time.Second,
+        KeepAlive: 30 * time.Second,
+    }).DialContext,
+    ForceAttemptHTTP2:     true,
+    MaxIdleConns:          100,
+    MaxIdleConnsPerHost:   16,
+    IdleConnTimeout:       90 * time.Second,
+    TLSHandshakeTimeout:   10 * time.Second,
+    ExpectContinueTimeout: time.Second,
+}
+
+// newHTTPClient returns a client on the shared transport. It has no client-wide
+// timeout: deadlines come from the request context so that large transfers are not cut
+// off at a fixed duration.
+func newHTTPClient() *http.Client {
+    return &http.Client{Transport: sharedTransport}
+}
+
+// retryPolicy bounds the attempts made for one call. Delays grow exponentially from
+// baseDelay up to maxDelay, with full jitter so that clients do not retry in lockstep.
+type retryPolicy struct {
+    maxAttempts int
+    baseDelay   time.Duration
+    maxDelay    time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{maxAttempts: 4, baseDelay: 250 * time.Millisecond, maxDelay: 5 * time.Second}
+
+// delay returns the wait before retrying after the given failed attempt (1-based)
+func (p retryPolicy) delay(attempt int) time.Duration {
+    d := p.baseDelay
+    for i := 1; i < attempt && d < p.maxDelay; i++ {
+        d *= 2
+    }
+    if d > p.maxDelay {
+        d = p.maxDelay
+    }
+    if d <= 0 {
+        return 0
+    }
+    return rand.N(d + 1)
+}
+
+// retryable reports whether a failed attempt is worth repeating. Once the caller's
+// context is done there is no time left to retry.
+func retryable(ctx context.Context, err error) bool {
+    if ctx.Err() != nil || errors.Is(err, errCircuitOpen) {
+        return false
+    }
+    return errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
+
+// networkError wraps a failed round trip as ErrTimeout or ErrUnavailable. A request
+// cancelled by the caller is returned as is.
+func networkError(ctx context.Context, msg string, err error) error {
+    if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+        return fmt.Errorf("%s: %w", msg, err)
+    }
+
+    var netErr net.Error
+    if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+        return fmt.Errorf("%w: %s: %w", ErrTimeout, msg, err)
+    }
+    return fmt.Errorf("%w: %s: %w", ErrUnavailable, msg, err)
+}
+
+// kuboNotFound matches the messages Kubo answers with, as status 500, when it has no
+// content for a CID or name
+var kuboNotFound = []string{
+    "not found",
+    "no link named",
+    "could not resolve name",
+}
+
+// statusError converts a non-200 Kubo API response into an error, typed by status
+func statusError(status int, message string) error {
+    err := fmt.Errorf("IPFS returned error: %s (status %d)", message, status)
+
+    switch status {
+    case http.StatusNotFound:
+        return fmt.Errorf("%w: %w", ErrNotFound, err)
+    case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+        return fmt.Errorf("%w: %w", ErrTimeout, err)
+    case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+        return fmt.Errorf("%w: %w", ErrUnavailable, err)
+    case http.StatusInternalServerError:
+        lower := strings.ToLower(message)
+        for _, pattern := range kuboNotFound {
+            if strings.Contains(lower, pattern) {
+                return fmt.Errorf("%w: %w", ErrNotFound, err)
+            }
+        }
+    }
+    return err
+}
+
+const (
+    // breakerThreshold is the number of consecutive failed requests that opens the circuit
+    breakerThreshold = 5
+
+    // breakerCooldown is how long an open circuit fails requests before letting one through
+    breakerCooldown = 30 * time.Second
+)
+
+// errCircuitOpen marks requests refused by an open circuit breaker
+var errCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrUnavailable)
+
+// circuitBreaker fails requests fast while a node is down. After breakerThreshold
+// consecutive failures the circuit opens for breakerCooldown; then a single request is
+// let through, and its outcome closes the circuit or opens it again.
+type circuitBreaker struct {
+    mu       sync.Mutex
+    failures int
+    openAt   time.Time
+    probing  bool
+    now      func() time.Time
+}
+
+func newCircuitBreaker() *circuitBreaker {
+    return &circuitBreaker{now: time.Now}
+}
+
+// allow returns an error wrapping ErrUnavailable if the request must not be sent
+func (b *circuitBreaker) allow() error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if b.failures < breakerThreshold {
+        return nil
+    }
+    if b.probing || b.now().Before(b.openAt.Add(breakerCooldown)) {
+        return fmt.Errorf("%w after %d consecutive failures", errCircuitOpen, b.failures)
+    }
+    b.probing = true
+    return nil
+}
+
+// record updates the breaker with the outcome of a request. Only failures to reach the
+// node and overload responses count; other error responses mean the node is up.
+func (b *circuitBreaker) record(err error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.probing = false
+    if errors.Is(err, context.Canceled) {
+        return
+    }
+    if err == nil || !(errors.Is(err, ErrUnavailable) || errors.Is(err, ErrTimeout)) {
+        b.failures = 0
+        return
+    }
+    b.failures++
+    if b.failures >= breakerThreshold {
+        b.openAt = b.now()
+    }
+}
@@ -0,0 +1,289 @@
+package storage
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// S3Config describes an S3-compatible bucket (AWS S3, MinIO, Ceph RGW, ...)
+type S3Config struct {
+    // Endpoint is the service URL, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+    Endpoint string
+    Region   string
+    Bucket   string
+
+    // Prefix is prepended to every object key
+    Prefix string
+
+    AccessKeyID     string
+    SecretAccessKey string
+    SessionToken    string
+}
+
+// S3Store keeps documents as objects in an S3-compatible bucket, keyed by CID.
+// Requests use path-style addressing and AWS Signature Version 4.
+type S3Store struct {
+    cfg        S3Config
+    httpClient *http.Client
+    now        func() time.Time
+}
+
+// NewS3Store creates a new S3 store
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+    if cfg.Bucket == "" {
+        return nil, fmt.Errorf("S3 store requires a bucket")
+    }
+    if cfg.Region == "" {
+        cfg.Region = "us-east-1"
+    }
+    if cfg.Endpoint == "" {
+        cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+    }
+    cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+    cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+
+    if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+        return nil, fmt.Errorf("S3 store requires credentials (AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+    }
+
+    return &S3Store{
+        cfg:        cfg,
+        httpClient: newHTTPClient(),
+        now:        time.Now,
+    }, nil
+}
+
+// NewS3StoreFromURL creates an S3 store from a URL of the form
+// s3://bucket/prefix?endpoint=http://localhost:9000&region=us-east-1.
+// Credentials are read from the standard AWS environment variables.
+func NewS3StoreFromURL(u *url.URL) (*S3Store, error) {
+    query := u.Query()
+
+    endpoint := query.Get("endpoint")
+    if endpoint == "" {
+        endpoint = os.Getenv("AWS_ENDPOINT_URL")
+    }
+    region := query.Get("region")
+    if region == "" {
+        region = os.Getenv("AWS_REGION")
+    }
+
+    return NewS3Store(S3Config{
+        Endpoint:        endpoint,
+        Region:          region,
+        Bucket:          u.Host,
+        Prefix:          u.Path,
+        AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+        SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+        SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+    })
+}
+
+// Put spools the content to a temporary file to learn its CID and length, then uploads it
+func (s *S3Store) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    tmp, err := os.CreateTemp("", "qdv-s3-*")
+    if err != nil {
+        return "", fmt.Errorf("failed to create temporary file: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+
+    builder := newContentBuilder(opts)
+    payloadHash := sha256.New()
+    size, err := io.Copy(io.MultiWriter(tmp, builder, payloadHash), &contextReader{ctx: ctx, r: r})
+    if err != nil {
+        return "", fmt.Errorf("failed to read document: %w", err)
+    }
+    if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+        return "", fmt.Errorf("failed to rewind temporary file: %w", err)
+    }
+
+    root, err := builder.Sum()
+    if err != nil {
+        return "", fmt.Errorf("failed to compute CID: %w", err)
+    }
+    if err := checkHashCID(root, opts); err != nil {
+        return "", err
+    }
+    cid := root.String()
+
+    ctx, cancel := withSizeTimeout(ctx, size)
+    defer cancel()
+
+    body := &progressReader{r: tmp, progress: opts.Progress}
+    req, err := http.NewRequestWithContext(ctx, "PUT", s.objectURL(cid), io.NopCloser(body))
+    if err != nil {
+        return "", fmt.Errorf("failed to create request: %w", err)
+    }
+    req.ContentLength = size
+    req.Header.Set("Content-Type", "application/octet-stream")
+
+    s.sign(req, hex.EncodeToString(payloadHash.Sum(nil)))
+
+    resp, err := s.httpClient.Do(req)
+    if err != nil {
+        return "", networkError(ctx, "failed to send request to S3", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        respBody, _ := io.ReadAll(resp.Body)
+        return "", fmt.Errorf("S3 returned error: %s (status %d)", string(respBody), resp.StatusCode)
+    }
+
+    return cid, nil
+}
+
+// Get opens the object stored for the given CID
+func (s *S3Store) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    if err := validateCID(cid); err != nil {
+        return nil, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "GET", s.objectURL(cid), nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create request: %w", err)
+    }
+    s.sign(req, emptyPayloadHash)
+
+    resp, err := s.httpClient.Do(req)
+    if err != nil {
+        return nil, networkError(ctx, "failed to send request to S3", err)
+    }
+
+    switch resp.StatusCode {
+    case http.StatusOK:
+        return unixfs.NewVerifyingReader(cid, resp.Body)
+    case http.StatusNotFound:
+        resp.Body.Close()
+        return nil, fmt.Errorf("%w: %s", ErrNotFound, cid)
+    default:
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(resp.Body)
+        return nil, fmt.Errorf("S3 returned error: %s (status %d)", string(body), resp.StatusCode)
+    }
+}
+
+func (s *S3Store) objectURL(cid string) string {
+    key := cid
+    if s.cfg.Prefix != "" {
+        key = s.cfg.Prefix + "/" + cid
+    }
+    return fmt.Sprintf("%s/%s/%s", s.cfg.Endpoint, s.cfg.Bucket, key)
+}
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds AWS Signature Version 4 headers to the request.
+// Every header already set on the request is included in the signature.
+func (s *S3Store) sign(req *http.Request, payloadHash string) {
+    t := s.now().UTC()
+    amzDate := t.Format("20060102T150405Z")
+    date := t.Format("20060102")
+
+    req.Header.Set("X-Amz-Date", amzDate)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+    if s.cfg.SessionToken != "" {
+        req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+    }
+
+    // 1. Canonical request
+    host := req.Host
+    if host == "" {
+        host = req.URL.Host
+    }
+    headers := map[string]string{"host": host}
+    for name, values := range req.Header {
+        headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+    }
+    names := make([]string, 0, len(headers))
+    for name := range headers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var canonicalHeaders strings.Builder
+    for _, name := range names {
+        canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+    }
+    signedHeaders := strings.Join(names, ";")
+
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        awsURIEncode(req.URL.Path, false),
+        canonicalQueryString(req.URL.Query()),
+        canonicalHeaders.String(),
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+
+    // 2. String to sign
+    scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.cfg.Region)
+    requestHash := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+    // 3. Signing key and signature
+    key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+    key = hmacSHA256(key, s.cfg.Region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
+
+// awsURIEncode percent-encodes everything except unreserved characters (and '/' in paths)
+func awsURIEncode(s string, encodeSlash bool) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+            c == '-', c == '_', c == '.', c == '~':
+            b.WriteByte(c)
+        case c == '/' && !encodeSlash:
+            b.WriteByte(c)
+        default:
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
+
+func canonicalQueryString(query url.Values) string {
+    keys := make([]string, 0, len(query))
+    for key := range query {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    var parts []string
+    for _, key := range keys {
+        values := append([]string(nil), query[key]...)
+        sort.Strings(values)
+        for _, value := range values {
+            parts = append(parts, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+        }
+    }
+    return strings.Join(parts, "&")
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "strings"
+
+    gocid "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+
+    "quantum-doc-verify/pkg/unixfs"
+)
+
+// StoreFlagUsage is the help text of the --store flag shared by the command-line tools
+const StoreFlagUsage = "Document store URL: host:port or http://host:port (IPFS), file:///path or s3://bucket/prefix, or a comma-separated list to replicate with an optional quorum=N, or to erasure-code with erasure=K+M (overrides --gateway)"
+
+// ErrNotFound is returned when a store holds no content for the requested identifier
+var ErrNotFound = errors.New("document not found")
+
+// DocumentStore is a content-addressed document backend.
+// Implementations return an identifier from Put that retrieves the same bytes from Get,
+// and Get verifies the bytes against the identifier: a reader whose content does not
+// match fails with unixfs.ErrCIDMismatch instead of io.EOF.
+type DocumentStore interface {
+    // Put stores the content read from r and returns its content identifier
+    Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error)
+
+    // Get opens the content with the given identifier. The caller must close the reader.
+    Get(ctx context.Context, cid string) (io.ReadCloser, error)
+}
+
+// Open returns the DocumentStore selected by the URL scheme:
+//
+//	localhost:5001, http://host:port or ipfs://host:port  Kubo HTTP API
+//	file:///var/lib/documents                             local content-addressed directory
+//	s3://bucket/prefix?endpoint=http://minio:9000         S3-compatible object storage
+//	node1:5001,node2:5001,node3:5001,quorum=2             replicated across several stores
+//	node1:5001,...,node6:5001,erasure=4+2                 erasure-coded across several stores
+//
+// A bare host:port is treated as a Kubo API address for compatibility with --gateway.
+// A comma-separated list opens a ReplicatedStore, with quorum defaulting to a majority,
+// or an ErasureStore with K data and M parity shards.
+func Open(storeURL string) (DocumentStore, error) {
+    if strings.Contains(storeURL, ",") {
+        return openReplicated(storeURL)
+    }
+
+    if !strings.Contains(storeURL, ":/") && !strings.HasPrefix(storeURL, "file:") {
+        return NewIPFSClient(storeURL)
+    }
+
+    u, err := url.Parse(storeURL)
+    if err != nil {
+        return nil, fmt.Errorf("invalid store URL %q: %w", storeURL, err)
+    }
+
+    switch u.Scheme {
+    case "http", "https":
+        path := strings.TrimSuffix(u.Path, "/")
+        if path == "" {
+            path = "/api/v0"
+        }
+        return newIPFSClientURL(fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, path)), nil
+    case "ipfs":
+        return NewIPFSClient(u.Host)
+    case "file":
+        dir := u.Path
+        if u.Opaque != "" {
+            dir = u.Opaque
+        }
+        if u.Host != "" && u.Host != "localhost" {
+            dir = u.Host + dir
+        }
+        return NewFileStore(dir)
+    case "s3":
+        return NewS3StoreFromURL(u)
+    default:
+        return nil, fmt.Errorf("unsupported store scheme %q", u.Scheme)
+    }
+}
+
+// StoreURL returns the --store URL, falling back to the legacy --gateway address
+func StoreURL(storeURL, gateway string) string {
+    if storeURL != "" {
+        return storeURL
+    }
+    return gateway
+}
+
+// Put implements DocumentStore using the Kubo HTTP API
+func (c *IPFSClient) Put(ctx context.Context, r io.Reader, opts StoreOptions) (string, error) {
+    return c.StoreReader(ctx, r, opts)
+}
+
+// Get implements DocumentStore using the Kubo HTTP API.
+// The content is verified against the CID as it is read.
+func (c *IPFSClient) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+    return c.RetrieveReader(ctx, cid)
+}
+
+// newContentBuilder computes the identifier used by the filesystem and S3 backends:
+// the CID Kubo assigns with "ipfs add --cid-version=1", so every backend agrees on the
+// identifier of a document. With opts.HashCID it computes the hash CID instead, which
+// Kubo assigns with a single raw leaf hashed with SHA3-256.
+func newContentBuilder(opts StoreOptions) *unixfs.Builder {
+    builderOpts := unixfs.DefaultOptions(1)
+    if opts.HashCID {
+        builderOpts.ChunkSize = MaxHashCIDSize
+        builderOpts.HashFunction = multihash.SHA3_256
+    }
+    return unixfs.NewBuilder(builderOpts)
+}
+
+// checkHashCID rejects content stored with opts.HashCID that did not fit in a single
+// raw block
+func checkHashCID(root gocid.Cid, opts StoreOptions) error {
+    if opts.HashCID && root.Type() != gocid.Raw {
+        return fmt.Errorf("documents stored under a hash CID must not exceed %d bytes", MaxHashCIDSize)
+    }
+    return nil
+}
+
+// validateCID rejects identifiers that are not well-formed CIDs, so they are safe to use
+// as file names and object keys
+func validateCID(cid string) error {
+    if _, err := gocid.Decode(cid); err != nil {
+        return fmt.Errorf("invalid CID %q: %w", cid, err)
+    }
+    return nil
+}
@@ -0,0 +1,472 @@
+package storage
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/cipher"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+
+    "golang.org/x/crypto/sha3"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+// Streaming envelopes (SuiteAES256GCMStream) follow the header with the document split
+// into fixed-size plaintext segments, each sealed separately with AES-256-GCM:
+//
+//	segment i  AES-GCM(content key, nonce_i, plaintext_i, SHA3-256(header))
+//	nonce_i    prefix (7 bytes, FieldNonce) || i (uint32 big-endian) || final flag (1 byte)
+//
+// Every segment but the last carries exactly SegmentSize bytes of plaintext; the last is
+// sealed with the final flag set and may be shorter (it is empty only for an empty
+// document). The counter in the nonce detects reordered or dropped segments and the final
+// flag detects truncation at a segment boundary. This is the STREAM construction of
+// Hoang, Reyhanitabar, Rogaway and Vizár.
+
+// DefaultSegmentSize is the plaintext size of a streaming envelope segment
+const DefaultSegmentSize = 64 * 1024
+
+// maxSegmentSize bounds the segment buffer a reader allocates for an untrusted header
+const maxSegmentSize = 16 << 20
+
+// maxHeaderSize bounds the header fields a reader buffers from an untrusted stream
+const maxHeaderSize = 1 << 20
+
+// streamNoncePrefixSize is the random part of each segment nonce
+const streamNoncePrefixSize = 7
+
+// ErrSegmentAuthentication is returned when a segment fails to decrypt because the stream
+// was truncated, reordered or modified
+var ErrSegmentAuthentication = errors.New("encrypted segment failed authentication")
+
+// streamCipher holds the state shared by the encrypting writer and decrypting reader
+type streamCipher struct {
+    gcm         cipher.AEAD
+    aad         []byte
+    nonce       []byte
+    segmentSize int
+    counter     uint64
+}
+
+func newStreamCipher(header *EnvelopeHeader, contentKey []byte) (*streamCipher, error) {
+    if len(header.nonce) != streamNoncePrefixSize {
+        return nil, fmt.Errorf("invalid nonce length: %d", len(header.nonce))
+    }
+    if header.SegmentSize <= 0 || header.SegmentSize > maxSegmentSize {
+        return nil, fmt.Errorf("invalid segment size: %d", header.SegmentSize)
+    }
+
+    gcm, err := newGCM(contentKey)
+    if err != nil {
+        return nil, err
+    }
+
+    aad := sha3.Sum256(header.raw)
+    nonce := make([]byte, gcm.NonceSize())
+    copy(nonce, header.nonce)
+
+    return &streamCipher{
+        gcm:         gcm,
+        aad:         aad[:],
+        nonce:       nonce,
+        segmentSize: header.SegmentSize,
+    }, nil
+}
+
+// nextNonce returns the nonce for the next segment
+func (s *streamCipher) nextNonce(final bool) ([]byte, error) {
+    if s.counter > 0xFFFFFFFF {
+        return nil, fmt.Errorf("document exceeds the maximum number of segments")
+    }
+    binary.BigEndian.PutUint32(s.nonce[streamNoncePrefixSize:], uint32(s.counter))
+    s.nonce[len(s.nonce)-1] = 0
+    if final {
+        s.nonce[len(s.nonce)-1] = 1
+    }
+    s.counter++
+    return s.nonce, nil
+}
+
+// encryptWriter seals plaintext into segments as it is written
+type encryptWriter struct {
+    w      io.Writer
+    stream *streamCipher
+    buf    []byte
+    out    []byte
+
+    // compressor, if set, compresses the content into the segments
+    compressor io.WriteCloser
+
+    documentHash []byte
+    hasher       hash.Hash
+    contentSize  int64
+    written      int64
+
+    closed bool
+    err    error
+}
+
+// NewEncryptWriter writes a streaming envelope header to w and returns a writer that
+// encrypts everything written to it, compressing it first if opts.Compression is set.
+// Close must be called to seal the final segment; it does not close w.
+func NewEncryptWriter(w io.Writer, opts EnvelopeOptions) (io.WriteCloser, error) {
+    segmentSize := opts.SegmentSize
+    if segmentSize == 0 {
+        segmentSize = DefaultSegmentSize
+    }
+    if segmentSize < 0 || segmentSize > maxSegmentSize {
+        return nil, fmt.Errorf("invalid segment size: %d", segmentSize)
+    }
+
+    // 1. Generate the content key and nonce prefix. Convergent envelopes derive them from
+    // the header and opts.DocumentHash, which Close checks against the content.
+    opts.SegmentSize = segmentSize
+    contentKey, header, err := newContentKeyAndHeader(SuiteAES256GCMStream, opts, streamNoncePrefixSize)
+    if err != nil {
+        return nil, err
+    }
+    defer crypto.Wipe(contentKey)
+
+    // 2. Write the header
+    header.raw = header.marshal()
+
+    if _, err := w.Write(header.raw); err != nil {
+        return nil, fmt.Errorf("failed to write envelope header: %w", err)
+    }
+
+    stream, err := newStreamCipher(header, contentKey)
+    if err != nil {
+        return nil, err
+    }
+
+    ew := &encryptWriter{
+        w:      w,
+        stream: stream,
+        buf:    make([]byte, 0, segmentSize),
+        out:    make([]byte, 0, segmentSize+stream.gcm.Overhead()),
+    }
+    if opts.DocumentHash != nil {
+        ew.documentHash = opts.DocumentHash
+        ew.hasher = sha3.New256()
+    }
+    if header.Compression != CompressionNone {
+        ew.contentSize = header.ContentSize
+        ew.compressor, err = newCompressWriter(header.Compression, segmentWriter{ew})
+        if err != nil {
+            return nil, err
+        }
+    }
+    return ew, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+    if ew.err != nil {
+        return 0, ew.err
+    }
+    if ew.closed {
+        return 0, fmt.Errorf("write to closed encrypt writer")
+    }
+    if ew.hasher != nil {
+        ew.hasher.Write(p)
+    }
+    ew.written += int64(len(p))
+
+    if ew.compressor != nil {
+        n, err := ew.compressor.Write(p)
+        if err != nil && ew.err == nil {
+            ew.err = err
+        }
+        return n, err
+    }
+    return ew.write(p)
+}
+
+// segmentWriter feeds compressed content into the segments of an encryptWriter
+type segmentWriter struct {
+    ew *encryptWriter
+}
+
+func (s segmentWriter) Write(p []byte) (int, error) {
+    return s.ew.write(p)
+}
+
+// write buffers plaintext into segments, sealing each full segment
+func (ew *encryptWriter) write(p []byte) (int, error) {
+    if ew.err != nil {
+        return 0, ew.err
+    }
+
+    written := 0
+    for len(p) > 0 {
+        // A full segment is only sealed once more data arrives, since the last
+        // segment must carry the final flag
+        if len(ew.buf) == cap(ew.buf) {
+            if err := ew.seal(false); err != nil {
+                return written, err
+            }
+        }
+
+        n := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+        ew.buf = ew.buf[:len(ew.buf)+n]
+        p = p[n:]
+        written += n
+    }
+    return written, nil
+}
+
+// Close seals the final segment
+func (ew *encryptWriter) Close() error {
+    if ew.closed {
+        return ew.err
+    }
+    ew.closed = true
+    if ew.err != nil {
+        return ew.err
+    }
+
+    if ew.compressor != nil {
+        // Flush the compressed stream into the segments
+        if err := ew.compressor.Close(); err != nil {
+            if ew.err == nil {
+                ew.err = fmt.Errorf("failed to compress document: %w", err)
+            }
+            return ew.err
+        }
+        if ew.contentSize > 0 && ew.written != ew.contentSize {
+            ew.err = fmt.Errorf("document is %d bytes, envelope header declares %d", ew.written, ew.contentSize)
+            return ew.err
+        }
+    }
+    if ew.hasher != nil && !bytes.Equal(ew.hasher.Sum(nil), ew.documentHash) {
+        ew.err = fmt.Errorf("document hash does not match envelope header")
+        return ew.err
+    }
+    return ew.seal(true)
+}
+
+func (ew *encryptWriter) seal(final bool) error {
+    nonce, err := ew.stream.nextNonce(final)
+    if err != nil {
+        ew.err = err
+        return err
+    }
+
+    ew.out = ew.stream.gcm.Seal(ew.out[:0], nonce, ew.buf, ew.stream.aad)
+    if _, err := ew.w.Write(ew.out); err != nil {
+        ew.err = fmt.Errorf("failed to write encrypted segment: %w", err)
+        return ew.err
+    }
+    ew.buf = ew.buf[:0]
+    return nil
+}
+
+// decryptReader opens segments as they are read
+type decryptReader struct {
+    r      *bufio.Reader
+    stream *streamCipher
+    in     []byte
+    plain  []byte
+    out    []byte
+    final  bool
+
+    documentHash []byte
+    hasher       hash.Hash
+
+    err error
+}
+
+// NewDecryptReader reads an encrypted document from r and returns a reader of its
+// plaintext along with the envelope header. Streaming envelopes are decrypted segment by
+// segment; whole-document envelopes and legacy documents (which have no header, so the
+// returned header is nil) are buffered and decrypted in memory.
+//
+// Plaintext from a streaming envelope is returned before the end of the document has been
+// authenticated. Consumers must treat the content as untrusted until Read returns io.EOF;
+// any other error means the document is truncated or has been tampered with.
+func NewDecryptReader(r io.Reader, privateKey []byte) (io.Reader, *EnvelopeHeader, error) {
+    return NewDecryptReaderWithGrant(r, privateKey, nil)
+}
+
+// NewDecryptReaderWithGrant is NewDecryptReader for the recipient of an access grant
+func NewDecryptReaderWithGrant(r io.Reader, privateKey []byte, grant *AccessGrant) (io.Reader, *EnvelopeHeader, error) {
+    br := bufio.NewReader(r)
+
+    magic, err := br.Peek(len(EnvelopeMagic))
+    if err != nil && err != io.EOF {
+        return nil, nil, fmt.Errorf("failed to read encrypted document: %w", err)
+    }
+    if !IsEnvelope(magic) {
+        data, err := io.ReadAll(br)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to read encrypted document: %w", err)
+        }
+        content, err := DecryptLegacyDocument(data)
+        if err != nil {
+            return nil, nil, err
+        }
+        return bytes.NewReader(content), nil, nil
+    }
+
+    header, err := readEnvelopeHeader(br)
+    if err != nil {
+        return nil, nil, err
+    }
+    if err := header.addGrant(grant); err != nil {
+        return nil, nil, err
+    }
+
+    if header.Suite != SuiteAES256GCMStream {
+        ciphertext, err := io.ReadAll(br)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to read encrypted document: %w", err)
+        }
+        content, header, err := OpenEnvelopeWithGrant(append(header.raw, ciphertext...), privateKey, grant)
+        if err != nil {
+            return nil, nil, err
+        }
+        return bytes.NewReader(content), header, nil
+    }
+
+    reader, err := newDecryptReader(header, br, privateKey)
+    if err != nil {
+        return nil, nil, err
+    }
+    return reader, header, nil
+}
+
+// newDecryptReader opens the segments of a streaming envelope, decompressing them if the
+// header records a codec
+func newDecryptReader(header *EnvelopeHeader, r io.Reader, privateKey []byte) (io.Reader, error) {
+    contentKey, err := header.unwrapContentKey(privateKey)
+    if err != nil {
+        return nil, err
+    }
+    defer crypto.Wipe(contentKey)
+
+    stream, err := newStreamCipher(header, contentKey)
+    if err != nil {
+        return nil, err
+    }
+
+    br, ok := r.(*bufio.Reader)
+    if !ok {
+        br = bufio.NewReader(r)
+    }
+
+    dr := &decryptReader{
+        r:      br,
+        stream: stream,
+        in:     make([]byte, stream.segmentSize+stream.gcm.Overhead()),
+        plain:  make([]byte, 0, stream.segmentSize),
+    }
+    if header.Compression != CompressionNone {
+        // The hash covers the uncompressed content, so it is checked after decompression
+        return newDecompressReader(header, dr)
+    }
+    if header.DocumentHash != nil {
+        dr.documentHash = header.DocumentHash
+        dr.hasher = sha3.New256()
+    }
+    return dr, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+    for len(dr.out) == 0 {
+        if dr.err != nil {
+            return 0, dr.err
+        }
+        if dr.final {
+            dr.err = io.EOF
+            if dr.hasher != nil && !bytes.Equal(dr.hasher.Sum(nil), dr.documentHash) {
+                dr.err = fmt.Errorf("document hash does not match envelope header")
+            }
+            continue
+        }
+        if err := dr.open(); err != nil {
+            dr.err = err
+        }
+    }
+
+    n := copy(p, dr.out)
+    dr.out = dr.out[n:]
+    return n, nil
+}
+
+// open reads and decrypts the next segment
+func (dr *decryptReader) open() error {
+    // 1. Read a full segment; a short one must be the last
+    n, err := io.ReadFull(dr.r, dr.in)
+    final := false
+    switch {
+    case err == io.EOF || err == io.ErrUnexpectedEOF:
+        final = true
+    case err != nil:
+        return fmt.Errorf("failed to read encrypted segment: %w", err)
+    default:
+        // A full segment is the last if nothing follows it
+        if _, err := dr.r.Peek(1); err == io.EOF {
+            final = true
+        } else if err != nil {
+            return fmt.Errorf("failed to read encrypted segment: %w", err)
+        }
+    }
+
+    // 2. Authenticate its position in the stream
+    segment := dr.stream.counter
+    nonce, err := dr.stream.nextNonce(final)
+    if err != nil {
+        return err
+    }
+
+    out, err := dr.stream.gcm.Open(dr.plain[:0], nonce, dr.in[:n], dr.stream.aad)
+    if err != nil {
+        return fmt.Errorf("%w: segment %d", ErrSegmentAuthentication, segment)
+    }
+
+    if dr.hasher != nil {
+        dr.hasher.Write(out)
+    }
+    dr.out = out
+    dr.final = final
+    return nil
+}
+
+// ReadEnvelopeHeader reads the header at the start of an envelope without decrypting it,
+// returning it with a reader of the whole envelope to pass on to NewDecryptReader. The
+// header is only authenticated when the envelope is decrypted.
+func ReadEnvelopeHeader(r io.Reader) (*EnvelopeHeader, io.Reader, error) {
+    header, err := readEnvelopeHeader(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    return header, io.MultiReader(bytes.NewReader(header.raw), r), nil
+}
+
+// readEnvelopeHeader reads exactly one envelope header from r
+func readEnvelopeHeader(r io.Reader) (*EnvelopeHeader, error) {
+    prefix := make([]byte, envelopePrefixSize)
+    if _, err := io.ReadFull(r, prefix); err != nil {
+        return nil, fmt.Errorf("envelope header truncated")
+    }
+    if !IsEnvelope(prefix) {
+        return nil, fmt.Errorf("not an encrypted document envelope")
+    }
+
+    fieldsLen := binary.BigEndian.Uint32(prefix[9:13])
+    if fieldsLen > maxHeaderSize {
+        return nil, fmt.Errorf("envelope header too large: %d bytes", fieldsLen)
+    }
+
+    raw := make([]byte, envelopePrefixSize+int(fieldsLen))
+    copy(raw, prefix)
+    if _, err := io.ReadFull(r, raw[envelopePrefixSize:]); err != nil {
+        return nil, fmt.Errorf("envelope header truncated")
+    }
+
+    header, _, err := ParseEnvelopeHeader(raw)
+    return header, err
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+    "bytes"
+    "errors"
+    "io"
+    "testing"
+
+    "golang.org/x/crypto/sha3"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+const testSegmentSize = 1024
+
+func sealStream(t *testing.T, content []byte, opts EnvelopeOptions) []byte {
+    t.Helper()
+
+    var buf bytes.Buffer
+    w, err := NewEncryptWriter(&buf, opts)
+    if err != nil {
+        t.Fatalf("Failed to create encrypt writer: %v", err)
+    }
+    // Write in odd-sized pieces to exercise segment boundaries
+    for data := content; len(data) > 0; {
+        n := 333
+        if n > len(data) {
+            n = len(data)
+        }
+        if _, err := w.Write(data[:n]); err != nil {
+            t.Fatalf("Write failed: %v", err)
+        }
+        data = data[n:]
+    }
+    if err := w.Close(); err != nil {
+        t.Fatalf("Close failed: %v", err)
+    }
+    return buf.Bytes()
+}
+
+func openStream(envelope []byte, privateKey []byte) ([]byte, error) {
+    reader, _, err := NewDecryptReader(bytes.NewReader(envelope), privateKey)
+    if err != nil {
+        return nil, err
+    }
+    return io.ReadAll(reader)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+    pub, priv, err := crypto.GenerateKEMKeypair()
+    if err != nil {
+        t.Fatalf("Failed to generate KEM keypair: %v", err)
+    }
+
+    for _, size := range []int{0, 1, testSegmentSize - 1, testSegmentSize, 3 * testSegmentSize, 3*testSegmentSize + 7} {
+        content := bytes.Repeat([]byte{'q'}, size)
+        documentHash := sha3.Sum256(content)
+
+        envelope := sealStream(t, content, EnvelopeOptions{
+            FileName:     "scan.tiff",
+            Recipients:   [][]byte{pub},
+            DocumentHash: documentHash[:],
+            SegmentSize:  testSegmentSize,
+        })
+
+        opened, err := openStream(envelope, priv)
+        if err != nil {
+            t.Fatalf("Failed to decrypt %d-byte document: %v", size, err)
+        }
+        if !bytes.Equal(opened, content) {
+            t.Fatalf("Decrypted %d-byte document does not match", size)
+        }
+
+        // The whole-document API understands streaming envelopes too
+        opened, header, err := OpenEnvelope(envelope, priv)
+        if err != nil || !bytes.Equal(opened, content) {
+            t.Fatalf("OpenEnvelope failed for %d-byte document: %v", size, err)
+        }
+        if header.Suite != SuiteAES256GCMStream || header.SegmentSize != testSegmentSize || header.FileName != "scan.tiff" {
+            t.Fatalf("Unexpected header: %+v", header)
+        }
+    }
+}
+
+func TestStreamDetectsTampering(t *testing.T) {
+    content := bytes.Repeat([]byte("segmented "), 400)
+    envelope := sealStream(t, content, EnvelopeOptions{SegmentSize: testSegmentSize})
+
+    header, _, err := ParseEnvelopeHeader(envelope)
+    if err != nil {
+        t.Fatalf("Failed to parse header: %v", err)
+    }
+    headerSize := len(header.raw)
+    segment := testSegmentSize + 16
+    segments := envelope[headerSize:]
+    if len(segments) != 3*segment+len(content)-3*testSegmentSize+16 {
+        t.Fatalf("Unexpected ciphertext length %d", len(segments))
+    }
+
+    join := func(parts ...[]byte) []byte {
+        return bytes.Join(append([][]byte{envelope[:headerSize]}, parts...), nil)
+    }
+
+    tests := map[string][]byte{
+        "truncated at boundary": join(segments[:2*segment]),
+        "truncated mid-segment": join(segments[:2*segment+100]),
+        "final segment dropped": join(segments[:3*segment]),
+        "segments reordered":    join(segments[segment:2*segment], segments[:segment], segments[2*segment:]),
+        "segment duplicated":    join(segments[:segment], segments),
+        "trailing data":         join(segments, []byte("extra")),
+        "bit flipped":           join(segments[:segment+5], []byte{segments[segment+5] ^ 1}, segments[segment+6:]),
+    }
+
+    for name, tampered := range tests {
+        if _, err := openStream(tampered, nil); !errors.Is(err, ErrSegmentAuthentication) {
+            t.Errorf("%s: expected ErrSegmentAuthentication, got %v", name, err)
+        }
+    }
+
+    // The segments are bound to the header they were written with
+    renamed := sealStream(t, content, EnvelopeOptions{FileName: "a.txt", SegmentSize: testSegmentSize})
+    renamed = bytes.Replace(renamed, []byte("a.txt"), []byte("b.txt"), 1)
+    if _, err := openStream(renamed, nil); !errors.Is(err, ErrSegmentAuthentication) {
+        t.Errorf("Expected renamed envelope to be rejected, got %v", err)
+    }
+}
+
+func TestDecryptReaderFormats(t *testing.T) {
+    content := []byte("Sealed in one piece")
+
+    envelope, err := SealEnvelope(content, EnvelopeOptions{FileName: "note.txt"})
+    if err != nil {
+        t.Fatalf("Failed to seal envelope: %v", err)
+    }
+
+    reader, header, err := NewDecryptReader(bytes.NewReader(envelope), nil)
+    if err != nil {
+        t.Fatalf("Failed to open whole-document envelope: %v", err)
+    }
+    opened, _ := io.ReadAll(reader)
+    if !bytes.Equal(opened, content) || header.FileName != "note.txt" {
+        t.Fatalf("Unexpected whole-document result %q %+v", opened, header)
+    }
+
+    // A wrong document hash is caught before the final segment is sealed
+    w, _ := NewEncryptWriter(io.Discard, EnvelopeOptions{DocumentHash: make([]byte, 32)})
+    w.Write(content)
+    if err := w.Close(); err == nil {
+        t.Fatalf("Expected document hash mismatch on Close")
+    }
+}
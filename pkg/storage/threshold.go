@@ -0,0 +1,181 @@
+package storage
+
+import (
+    "bytes"
+    "encoding/hex"
+    "fmt"
+
+    "quantum-doc-verify/pkg/crypto"
+)
+
+// Threshold envelopes (KEMThreshold) split the content key with Shamir's scheme into one
+// share per custodian. Each FieldRecipient wraps a share, rather than the content key,
+// to the custodian's ML-KEM-768 key, and FieldThreshold records how many shares recover
+// the key. Custodians unwrap their shares with UnwrapShare and hand them, optionally
+// sealed to the combiner's KEM key, to whoever runs CombineShares.
+
+// CustodianShare is a custodian's share of the content key of a threshold envelope, as
+// submitted for recombination. Share holds the share in the clear, or Sealed holds it
+// encapsulated to the ML-KEM-768 key identified by SealedTo.
+type CustodianShare struct {
+    DocumentHash   string `json:"documentHash"`
+    Threshold      int    `json:"threshold"`
+    CustodianKeyID string `json:"custodianKeyId"`
+    Share          []byte `json:"share,omitempty"`
+    Sealed         []byte `json:"sealed,omitempty"`
+    SealedTo       string `json:"sealedTo,omitempty"`
+}
+
+// splitContentKey makes the header a threshold header with the content key shared among
+// the custodians
+func (h *EnvelopeHeader) splitContentKey(contentKey []byte, custodians [][]byte, threshold int) error {
+    seen := make(map[string]bool)
+    for _, pub := range custodians {
+        keyID := string(crypto.KEMKeyID(pub))
+        if seen[keyID] {
+            return fmt.Errorf("custodian keys must be distinct")
+        }
+        seen[keyID] = true
+    }
+
+    shares, err := crypto.SplitSecret(contentKey, len(custodians), threshold)
+    if err != nil {
+        return err
+    }
+    defer func() {
+        for _, share := range shares {
+            crypto.Wipe(share)
+        }
+    }()
+
+    h.KEM = KEMThreshold
+    h.Threshold = threshold
+    for i, pub := range custodians {
+        custodian, err := wrapContentKey(shares[i], pub)
+        if err != nil {
+            return err
+        }
+        h.recipients = append(h.recipients, custodian)
+    }
+    return nil
+}
+
+// UnwrapShare recovers the share of the custodian holding privateKey. If sealTo is an
+// ML-KEM-768 public key the share is encapsulated to it, so that only the holder of the
+// matching private key can combine it.
+func (h *EnvelopeHeader) UnwrapShare(privateKey, sealTo []byte) (*CustodianShare, error) {
+    if h.KEM != KEMThreshold {
+        return nil, fmt.Errorf("document is not split among custodians")
+    }
+    if !crypto.IsKEMPrivateKey(privateKey) {
+        return nil, fmt.Errorf("an ML-KEM-768 private key is required to unwrap a custodian share")
+    }
+    pub, err := crypto.KEMPublicKey(privateKey)
+    if err != nil {
+        return nil, err
+    }
+    keyID := crypto.KEMKeyID(pub)
+
+    for _, r := range h.recipients {
+        if !bytes.Equal(r.keyID, keyID) {
+            continue
+        }
+        share, err := unwrapContentKey(r, privateKey)
+        if err != nil {
+            return nil, err
+        }
+
+        submitted := &CustodianShare{
+            DocumentHash:   hex.EncodeToString(h.DocumentHash),
+            Threshold:      h.Threshold,
+            CustodianKeyID: hex.EncodeToString(keyID),
+        }
+        if sealTo == nil {
+            submitted.Share = share
+            return submitted, nil
+        }
+
+        defer crypto.Wipe(share)
+        sealed, err := wrapContentKey(share, sealTo)
+        if err != nil {
+            return nil, err
+        }
+        submitted.Sealed = append(append([]byte(nil), sealed.encapsulated...), sealed.wrappedKey...)
+        submitted.SealedTo = hex.EncodeToString(sealed.keyID)
+        return submitted, nil
+    }
+    return nil, ErrNotRecipient
+}
+
+// CombineShares recovers the content key of a threshold envelope from its custodians'
+// shares. Shares sealed to a combiner are unsealed with privateKey. The key is passed to
+// OpenEnvelope or NewDecryptReader in place of a private key; shares that do not belong
+// to the envelope are caught there, when the header fails to authenticate.
+func CombineShares(h *EnvelopeHeader, shares []*CustodianShare, privateKey []byte) ([]byte, error) {
+    if h.KEM != KEMThreshold {
+        return nil, fmt.Errorf("document is not split among custodians")
+    }
+
+    custodians := make(map[string]bool)
+    for _, keyID := range h.RecipientKeyIDs {
+        custodians[hex.EncodeToString(keyID)] = true
+    }
+
+    var raw [][]byte
+    defer func() {
+        for _, share := range raw {
+            crypto.Wipe(share)
+        }
+    }()
+    for _, share := range shares {
+        if share.DocumentHash != hex.EncodeToString(h.DocumentHash) {
+            return nil, fmt.Errorf("share from custodian %s is for another document", share.CustodianKeyID)
+        }
+        if !custodians[share.CustodianKeyID] {
+            return nil, fmt.Errorf("%s is not a custodian of this document", share.CustodianKeyID)
+        }
+        // Each custodian counts once
+        delete(custodians, share.CustodianKeyID)
+
+        value, err := share.open(privateKey)
+        if err != nil {
+            return nil, fmt.Errorf("failed to open share from custodian %s: %w", share.CustodianKeyID, err)
+        }
+        raw = append(raw, value)
+    }
+    if len(raw) < h.Threshold {
+        return nil, fmt.Errorf("%d of the %d custodian shares needed", len(raw), h.Threshold)
+    }
+
+    return crypto.CombineShares(raw)
+}
+
+// open returns a copy of the share, unsealing it with privateKey if it was sealed
+func (s *CustodianShare) open(privateKey []byte) ([]byte, error) {
+    if s.Sealed == nil {
+        if s.Share == nil {
+            return nil, fmt.Errorf("share is empty")
+        }
+        return append([]byte(nil), s.Share...), nil
+    }
+
+    if !crypto.IsKEMPrivateKey(privateKey) {
+        return nil, fmt.Errorf("share is sealed to %s: an ML-KEM-768 private key is required", s.SealedTo)
+    }
+    pub, err := crypto.KEMPublicKey(privateKey)
+    if err != nil {
+        return nil, err
+    }
+    keyID := crypto.KEMKeyID(pub)
+    if hex.EncodeToString(keyID) != s.SealedTo {
+        return nil, fmt.Errorf("share is sealed to %s: %w", s.SealedTo, ErrNotRecipient)
+    }
+    if len(s.Sealed) <= crypto.KEMCiphertextSize {
+        return nil, fmt.Errorf("malformed sealed share")
+    }
+    return unwrapContentKey(envelopeRecipient{
+        keyID:        keyID,
+        encapsulated: s.Sealed[:crypto.KEMCiphertextSize],
+        wrappedKey:   s.Sealed[crypto.KEMCiphertextSize:],
+    }, privateKey)
+}
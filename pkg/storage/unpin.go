@@ -0,0 +1,254 @@
+package storage
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+)
+
+// Unpinner is implemented by stores that can release content they hold, so that it is
+// no longer kept. Releasing content the store does not hold is not an error.
+type Unpinner interface {
+    // Unpin releases cid. Content linked from cid is released only if it was not
+    // stored separately.
+    Unpin(ctx context.Context, cid string) error
+}
+
+// GarbageCollector is implemented by stores where unpinned content stays on disk until
+// it is collected
+type GarbageCollector interface {
+    // GC deletes unpinned content and returns the number of blocks removed
+    GC(ctx context.Context) (int, error)
+}
+
+// Unpin implements Unpinner using "ipfs pin rm". The content stays in the node's
+// repository until GC runs.
+func (c *IPFSClient) Unpin(ctx context.Context, cid string) error {
+    if err := validateCID(cid); err != nil {
+        return err
+    }
+
+    var result struct {
+        Pins []string `json:"Pins"`
+    }
+    query := url.Values{"arg": {cid}, "recursive": {"true"}}
+    err := c.call(ctx, "pin/rm", query, &result)
+    if err != nil && strings.Contains(err.Error(), "not pinned") {
+        // Kubo refuses to unpin content that is not pinned directly
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to unpin %s: %w", cid, err)
+    }
+    return nil
+}
+
+// GC implements GarbageCollector using "ipfs repo gc"
+func (c *IPFSClient) GC(ctx context.Context) (int, error) {
+    resp, err := c.do(ctx, func() (*http.Request, error) {
+        return http.NewRequestWithContext(ctx, "POST", c.apiURL+"/repo/gc?stream-errors=true", nil)
+    })
+    if err != nil {
+        return 0, fmt.Errorf("failed to collect garbage: %w", err)
+    }
+    defer resp.Body.Close()
+
+    // Kubo streams one object per removed block
+    var errs []error
+    removed := 0
+    decoder := json.NewDecoder(resp.Body)
+    for {
+        var result struct {
+            Key struct {
+                Cid string `json:"/"`
+            } `json:"Key"`
+            Error string `json:"Error"`
+        }
+        err := decoder.Decode(&result)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return removed, fmt.Errorf("failed to parse IPFS response: %w", err)
+        }
+        if result.Error != "" {
+            errs = append(errs, errors.New(result.Error))
+            continue
+        }
+        removed++
+    }
+
+    if len(errs) > 0 {
+        return removed, fmt.Errorf("garbage collection failed: %w", errors.Join(errs...))
+    }
+    return removed, nil
+}
+
+// Unpin implements Unpinner by deleting the file and block stored for cid
+func (s *FileStore) Unpin(ctx context.Context, cid string) error {
+    if err := validateCID(cid); err != nil {
+        return err
+    }
+
+    for _, path := range []string{s.path(cid), s.blockPath(cid)} {
+        if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+            return fmt.Errorf("failed to remove %s: %w", cid, err)
+        }
+    }
+    return nil
+}
+
+// Unpin implements Unpinner by deleting the object and block stored for cid
+func (s *S3Store) Unpin(ctx context.Context, cid string) error {
+    if err := validateCID(cid); err != nil {
+        return err
+    }
+
+    for _, key := range []string{cid, "blocks/" + cid} {
+        req, err := http.NewRequestWithContext(ctx, "DELETE", s.objectURL(key), nil)
+        if err != nil {
+            return fmt.Errorf("failed to create request: %w", err)
+        }
+        s.sign(req, emptyPayloadHash)
+
+        resp, err := s.httpClient.Do(req)
+        if err != nil {
+            return networkError(ctx, "failed to send request to S3", err)
+        }
+        body, _ := io.ReadAll(resp.Body)
+        resp.Body.Close()
+
+        switch resp.StatusCode {
+        case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+        default:
+            return fmt.Errorf("S3 returned error: %s (status %d)", string(body), resp.StatusCode)
+        }
+    }
+    return nil
+}
+
+// Unpin implements Unpinner on every replica, including those currently failing, so
+// that no copy is left behind
+func (s *ReplicatedStore) Unpin(ctx context.Context, cid string) error {
+    var errs []error
+    for _, target := range s.replicas {
+        unpinner, ok := target.Store.(Unpinner)
+        if !ok {
+            errs = append(errs, fmt.Errorf("%s: store cannot unpin", target.Name))
+            continue
+        }
+
+        err := unpinner.Unpin(ctx, cid)
+        target.record(err, s.now(), s.probeInterval)
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// GC implements GarbageCollector on the replicas that need it
+func (s *ReplicatedStore) GC(ctx context.Context) (int, error) {
+    var errs []error
+    removed := 0
+    for _, target := range s.replicas {
+        collector, ok := target.Store.(GarbageCollector)
+        if !ok {
+            continue
+        }
+
+        n, err := collector.GC(ctx)
+        target.record(err, s.now(), s.probeInterval)
+        removed += n
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+        }
+    }
+    return removed, errors.Join(errs...)
+}
+
+// Unpin implements Unpinner on the primary store. Content cannot be released from
+// public gateways.
+func (s *fallbackStore) Unpin(ctx context.Context, cid string) error {
+    unpinner, ok := s.DocumentStore.(Unpinner)
+    if !ok {
+        return fmt.Errorf("store cannot unpin")
+    }
+    return unpinner.Unpin(ctx, cid)
+}
+
+// GC implements GarbageCollector on the primary store
+func (s *fallbackStore) GC(ctx context.Context) (int, error) {
+    collector, ok := s.DocumentStore.(GarbageCollector)
+    if !ok {
+        return 0, nil
+    }
+    return collector.GC(ctx)
+}
+
+// Unpin drops cid from the cache and releases it on the underlying store
+func (s *cachedStore) Unpin(ctx context.Context, cid string) error {
+    if err := s.cache.Remove(cid); err != nil {
+        return err
+    }
+
+    unpinner, ok := s.DocumentStore.(Unpinner)
+    if !ok {
+        return fmt.Errorf("store cannot unpin")
+    }
+    return unpinner.Unpin(ctx, cid)
+}
+
+// GC implements GarbageCollector on the underlying store
+func (s *cachedStore) GC(ctx context.Context) (int, error) {
+    collector, ok := s.DocumentStore.(GarbageCollector)
+    if !ok {
+        return 0, nil
+    }
+    return collector.GC(ctx)
+}
+
+// Unpin implements Unpinner by releasing every shard on its node and the shard manifest
+// on every node
+func (s *ErasureStore) Unpin(ctx context.Context, cid string) error {
+    manifest, err := s.Manifest(ctx, cid)
+    if errors.Is(err, ErrNotFound) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    var errs []error
+    for _, shard := range manifest.Shards {
+        for _, node := range s.nodes {
+            if node.Name != shard.Node {
+                continue
+            }
+            unpinner, ok := node.Store.(Unpinner)
+            if !ok {
+                errs = append(errs, fmt.Errorf("%s: store cannot unpin", node.Name))
+                continue
+            }
+            if err := unpinner.Unpin(ctx, shard.CID); err != nil {
+                errs = append(errs, fmt.Errorf("%s: shard %d: %w", node.Name, shard.Index, err))
+            }
+        }
+    }
+    for _, node := range s.nodes {
+        unpinner, ok := node.Store.(Unpinner)
+        if !ok {
+            continue
+        }
+        if err := unpinner.Unpin(ctx, cid); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
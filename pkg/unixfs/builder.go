@@ -0,0 +1,287 @@
+package unixfs
+
+import (
+    "fmt"
+    "io"
+
+    "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+)
+
+const (
+    // DefaultChunkSize matches Kubo's default "size-262144" chunker
+    DefaultChunkSize = 256 * 1024
+
+    // DefaultMaxLinks is the maximum number of children per node in Kubo's balanced layout
+    DefaultMaxLinks = 174
+)
+
+// Options controls how content is split and addressed
+type Options struct {
+    // CIDVersion is 0 (Qm...) or 1 (bafy.../bafk...)
+    CIDVersion int
+
+    // RawLeaves stores chunks as raw blocks instead of UnixFS file nodes
+    RawLeaves bool
+
+    // ChunkSize is the fixed chunk size in bytes
+    ChunkSize int
+
+    // MaxLinks is the maximum number of children per intermediate node
+    MaxLinks int
+
+    // HashFunction is the multihash code used for every block (CIDv0 requires SHA2-256)
+    HashFunction uint64
+
+    // OnBlock, if set, is called for every block in the order it is produced.
+    // data is only valid for the duration of the call.
+    OnBlock func(c cid.Cid, data []byte) error
+}
+
+// DefaultOptions returns the options Kubo uses for "ipfs add" with the given CID version.
+// As in Kubo, CIDv1 implies raw leaves.
+func DefaultOptions(cidVersion int) Options {
+    return Options{
+        CIDVersion:   cidVersion,
+        RawLeaves:    cidVersion == 1,
+        ChunkSize:    DefaultChunkSize,
+        MaxLinks:     DefaultMaxLinks,
+        HashFunction: multihash.SHA2_256,
+    }
+}
+
+// link is a reference to a finished block
+type link struct {
+    cid      cid.Cid
+    tsize    uint64 // serialised size of the block and everything below it
+    filesize uint64 // file bytes covered by the block
+}
+
+// Builder computes the CID of a file as Kubo would import it, using the balanced layout
+// and a fixed-size chunker. It is an io.Writer so content can be hashed while streamed;
+// only the current chunk and one level of links per tree level are held in memory.
+type Builder struct {
+    opts   Options
+    chunk  []byte
+    levels [][]link
+    leaves int
+    size   uint64
+    root   *link
+    err    error
+}
+
+// NewBuilder creates a new builder
+func NewBuilder(opts Options) *Builder {
+    defaults := DefaultOptions(opts.CIDVersion)
+    if opts.ChunkSize <= 0 {
+        opts.ChunkSize = defaults.ChunkSize
+    }
+    if opts.MaxLinks <= 1 {
+        opts.MaxLinks = defaults.MaxLinks
+    }
+    if opts.HashFunction == 0 {
+        opts.HashFunction = defaults.HashFunction
+    }
+
+    return &Builder{
+        opts:  opts,
+        chunk: make([]byte, 0, opts.ChunkSize),
+    }
+}
+
+// Write adds content to the file
+func (b *Builder) Write(p []byte) (int, error) {
+    if b.err != nil {
+        return 0, b.err
+    }
+    if b.root != nil {
+        return 0, fmt.Errorf("write after Sum")
+    }
+
+    written := 0
+    for len(p) > 0 {
+        // A full chunk is only flushed once more data arrives, so the final chunk
+        // is always handled by Sum
+        if len(b.chunk) == b.opts.ChunkSize {
+            if err := b.flushChunk(); err != nil {
+                b.err = err
+                return written, err
+            }
+        }
+
+        n := copy(b.chunk[len(b.chunk):b.opts.ChunkSize], p)
+        b.chunk = b.chunk[:len(b.chunk)+n]
+        p = p[n:]
+        written += n
+    }
+    b.size += uint64(written)
+
+    return written, nil
+}
+
+// Size returns the number of bytes written so far
+func (b *Builder) Size() uint64 {
+    return b.size
+}
+
+// Sum finishes the file and returns its root CID
+func (b *Builder) Sum() (cid.Cid, error) {
+    if b.err != nil {
+        return cid.Undef, b.err
+    }
+    if b.root != nil {
+        return b.root.cid, nil
+    }
+
+    // The last (possibly empty) chunk always produces a leaf
+    if err := b.flushChunk(); err != nil {
+        b.err = err
+        return cid.Undef, err
+    }
+
+    // A single chunk is its own root
+    if b.leaves == 1 {
+        b.root = &b.levels[0][0]
+        return b.root.cid, nil
+    }
+
+    // Close every partially filled level from the bottom up
+    for level := 0; level < len(b.levels)-1; level++ {
+        if len(b.levels[level]) == 0 {
+            continue
+        }
+        if err := b.closeLevel(level); err != nil {
+            b.err = err
+            return cid.Undef, err
+        }
+    }
+
+    top := len(b.levels) - 1
+    root, err := b.newNode(b.levels[top])
+    if err != nil {
+        b.err = err
+        return cid.Undef, err
+    }
+    b.root = &root
+
+    return root.cid, nil
+}
+
+// DagSize returns the serialised size of every block of the file, the value Kubo records
+// as the size of a link to it. It is only valid after Sum.
+func (b *Builder) DagSize() uint64 {
+    if b.root == nil {
+        return 0
+    }
+    return b.root.tsize
+}
+
+// flushChunk turns the buffered chunk into a leaf block
+func (b *Builder) flushChunk() error {
+    var leaf link
+    var err error
+    if b.opts.RawLeaves {
+        leaf, err = b.emit(cid.Raw, b.chunk)
+        leaf.filesize = uint64(len(b.chunk))
+    } else {
+        data := encodeFileData(b.chunk, uint64(len(b.chunk)), nil)
+        leaf, err = b.emit(cid.DagProtobuf, encodeNode(nil, data))
+        leaf.filesize = uint64(len(b.chunk))
+    }
+    if err != nil {
+        return err
+    }
+
+    b.chunk = b.chunk[:0]
+    b.leaves++
+    return b.addLink(0, leaf)
+}
+
+// addLink appends a link at the given tree level, first closing the level into a parent
+// node when it is already full
+func (b *Builder) addLink(level int, l link) error {
+    if level == len(b.levels) {
+        b.levels = append(b.levels, nil)
+    }
+
+    if len(b.levels[level]) == b.opts.MaxLinks {
+        if err := b.closeLevel(level); err != nil {
+            return err
+        }
+    }
+
+    b.levels[level] = append(b.levels[level], l)
+    return nil
+}
+
+// closeLevel builds a node from the links at level and adds it to the level above
+func (b *Builder) closeLevel(level int) error {
+    node, err := b.newNode(b.levels[level])
+    if err != nil {
+        return err
+    }
+    b.levels[level] = nil
+    return b.addLink(level+1, node)
+}
+
+// newNode builds an intermediate UnixFS file node over the given children
+func (b *Builder) newNode(children []link) (link, error) {
+    var filesize, tsize uint64
+    blocksizes := make([]uint64, len(children))
+    for i, child := range children {
+        blocksizes[i] = child.filesize
+        filesize += child.filesize
+        tsize += child.tsize
+    }
+
+    node := encodeNode(children, encodeFileData(nil, filesize, blocksizes))
+    l, err := b.emit(cid.DagProtobuf, node)
+    if err != nil {
+        return link{}, err
+    }
+
+    l.tsize += tsize
+    l.filesize = filesize
+    return l, nil
+}
+
+// emit hashes a block, reports it and returns a link to it
+func (b *Builder) emit(codec uint64, data []byte) (link, error) {
+    c, err := b.cidFor(codec, data)
+    if err != nil {
+        return link{}, err
+    }
+
+    if b.opts.OnBlock != nil {
+        if err := b.opts.OnBlock(c, data); err != nil {
+            return link{}, err
+        }
+    }
+
+    return link{cid: c, tsize: uint64(len(data))}, nil
+}
+
+func (b *Builder) cidFor(codec uint64, data []byte) (cid.Cid, error) {
+    sum, err := multihash.Sum(data, b.opts.HashFunction, -1)
+    if err != nil {
+        return cid.Undef, fmt.Errorf("failed to hash block: %w", err)
+    }
+
+    // Raw blocks cannot be expressed as CIDv0
+    if b.opts.CIDVersion == 0 && codec == cid.DagProtobuf {
+        if b.opts.HashFunction != multihash.SHA2_256 {
+            return cid.Undef, fmt.Errorf("CIDv0 requires SHA2-256")
+        }
+        return cid.NewCidV0(sum), nil
+    }
+    return cid.NewCidV1(codec, sum), nil
+}
+
+// Compute returns the CID of the content read from r
+func Compute(r io.Reader, opts Options) (cid.Cid, error) {
+    b := NewBuilder(opts)
+    if _, err := io.Copy(b, r); err != nil {
+        return cid.Undef, err
+    }
+    return b.Sum()
+}
@@ -0,0 +1,63 @@
+package unixfs
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "strings"
+
+    "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+)
+
+// ErrNotDirectory is returned when decoding a block that is not a UnixFS directory
+var ErrNotDirectory = errors.New("block is not a UnixFS directory")
+
+// Link is a named entry of a UnixFS directory
+type Link struct {
+    Name string
+    Cid  cid.Cid
+
+    // Size is the serialised size of the linked DAG (Builder.DagSize for files)
+    Size uint64
+}
+
+// Directory encodes a basic (unsharded) UnixFS directory holding links and returns its
+// CID and block. Links are sorted by name, as Kubo writes them.
+func Directory(links []Link, cidVersion int) (cid.Cid, []byte, error) {
+    sorted := append([]Link(nil), links...)
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+    for i, l := range sorted {
+        if l.Name == "" || strings.Contains(l.Name, "/") {
+            return cid.Undef, nil, fmt.Errorf("invalid directory entry name %q", l.Name)
+        }
+        if i > 0 && sorted[i-1].Name == l.Name {
+            return cid.Undef, nil, fmt.Errorf("duplicate directory entry %q", l.Name)
+        }
+    }
+
+    block := encodeNamedNode(sorted, appendVarintField(nil, 1, typeDirectory))
+
+    sum, err := multihash.Sum(block, multihash.SHA2_256, -1)
+    if err != nil {
+        return cid.Undef, nil, fmt.Errorf("failed to hash directory: %w", err)
+    }
+    if cidVersion == 0 {
+        return cid.NewCidV0(sum), block, nil
+    }
+    return cid.NewCidV1(cid.DagProtobuf, sum), block, nil
+}
+
+// DecodeDirectory returns the entries of a basic UnixFS directory block
+func DecodeDirectory(block []byte) ([]Link, error) {
+    links, data, err := decodeNode(block)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrNotDirectory, err)
+    }
+    dataType, _, err := decodeFileData(data)
+    if err != nil || dataType != typeDirectory {
+        return nil, ErrNotDirectory
+    }
+    return links, nil
+}
@@ -0,0 +1,177 @@
+package unixfs
+
+import (
+    "encoding/binary"
+    "fmt"
+
+    "github.com/ipfs/go-cid"
+)
+
+// Protobuf wire format helpers for the dag-pb (PBNode/PBLink) and UnixFS (Data) messages.
+// Fields are written in the canonical order used by Kubo.
+
+const (
+    wireVarint = 0
+    wireBytes  = 2
+)
+
+// UnixFS Data.DataType values
+const (
+    typeRaw       = 0
+    typeDirectory = 1
+    typeFile      = 2
+)
+
+func appendTag(buf []byte, field, wireType int) []byte {
+    return binary.AppendUvarint(buf, uint64(field<<3|wireType))
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+    buf = appendTag(buf, field, wireVarint)
+    return binary.AppendUvarint(buf, v)
+}
+
+func appendBytesField(buf []byte, field int, b []byte) []byte {
+    buf = appendTag(buf, field, wireBytes)
+    buf = binary.AppendUvarint(buf, uint64(len(b)))
+    return append(buf, b...)
+}
+
+// encodeFileData encodes a UnixFS Data message of type File.
+// Empty data is omitted, matching Kubo's encoding of empty files.
+func encodeFileData(data []byte, filesize uint64, blocksizes []uint64) []byte {
+    buf := appendVarintField(nil, 1, typeFile)
+    if len(data) > 0 {
+        buf = appendBytesField(buf, 2, data)
+    }
+    buf = appendVarintField(buf, 3, filesize)
+    for _, size := range blocksizes {
+        buf = appendVarintField(buf, 4, size)
+    }
+    return buf
+}
+
+// encodeNode encodes a dag-pb PBNode. Links (field 2) precede Data (field 1);
+// file links carry an empty name.
+func encodeNode(links []link, data []byte) []byte {
+    named := make([]Link, len(links))
+    for i, l := range links {
+        named[i] = Link{Cid: l.cid, Size: l.tsize}
+    }
+    return encodeNamedNode(named, data)
+}
+
+// encodeNamedNode encodes a dag-pb PBNode whose links carry names
+func encodeNamedNode(links []Link, data []byte) []byte {
+    var buf []byte
+    for _, l := range links {
+        var pbLink []byte
+        pbLink = appendBytesField(pbLink, 1, l.Cid.Bytes())
+        pbLink = appendBytesField(pbLink, 2, []byte(l.Name))
+        pbLink = appendVarintField(pbLink, 3, l.Size)
+        buf = appendBytesField(buf, 2, pbLink)
+    }
+    return appendBytesField(buf, 1, data)
+}
+
+// pbField is one decoded protobuf field
+type pbField struct {
+    num      int
+    wireType int
+    varint   uint64
+    bytes    []byte
+}
+
+// decodeFields splits a protobuf message into its fields. Only the varint and
+// length-delimited wire types used by dag-pb and UnixFS are accepted.
+func decodeFields(buf []byte) ([]pbField, error) {
+    var fields []pbField
+    for len(buf) > 0 {
+        tag, n := binary.Uvarint(buf)
+        if n <= 0 {
+            return nil, fmt.Errorf("malformed protobuf tag")
+        }
+        buf = buf[n:]
+
+        f := pbField{num: int(tag >> 3), wireType: int(tag & 7)}
+        switch f.wireType {
+        case wireVarint:
+            f.varint, n = binary.Uvarint(buf)
+            if n <= 0 {
+                return nil, fmt.Errorf("malformed protobuf varint in field %d", f.num)
+            }
+            buf = buf[n:]
+        case wireBytes:
+            length, n := binary.Uvarint(buf)
+            if n <= 0 || length > uint64(len(buf)-n) {
+                return nil, fmt.Errorf("malformed protobuf bytes in field %d", f.num)
+            }
+            f.bytes = buf[n : n+int(length)]
+            buf = buf[n+int(length):]
+        default:
+            return nil, fmt.Errorf("unsupported protobuf wire type %d", f.wireType)
+        }
+        fields = append(fields, f)
+    }
+    return fields, nil
+}
+
+// decodeNode decodes a dag-pb PBNode into its links and Data field
+func decodeNode(block []byte) ([]Link, []byte, error) {
+    fields, err := decodeFields(block)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var links []Link
+    var data []byte
+    for _, f := range fields {
+        switch {
+        case f.num == 1 && f.wireType == wireBytes:
+            data = f.bytes
+        case f.num == 2 && f.wireType == wireBytes:
+            linkFields, err := decodeFields(f.bytes)
+            if err != nil {
+                return nil, nil, err
+            }
+            var l Link
+            var hash []byte
+            for _, lf := range linkFields {
+                switch {
+                case lf.num == 1 && lf.wireType == wireBytes:
+                    hash = lf.bytes
+                case lf.num == 2 && lf.wireType == wireBytes:
+                    l.Name = string(lf.bytes)
+                case lf.num == 3 && lf.wireType == wireVarint:
+                    l.Size = lf.varint
+                }
+            }
+            l.Cid, err = cid.Cast(hash)
+            if err != nil {
+                return nil, nil, fmt.Errorf("invalid link CID: %w", err)
+            }
+            links = append(links, l)
+        }
+    }
+    return links, data, nil
+}
+
+// decodeFileData decodes a UnixFS Data message, returning its type and inline data
+func decodeFileData(data []byte) (uint64, []byte, error) {
+    fields, err := decodeFields(data)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    var dataType uint64
+    var content []byte
+    for _, f := range fields {
+        switch {
+        case f.num == 1 && f.wireType == wireVarint:
+            dataType = f.varint
+        case f.num == 2 && f.wireType == wireBytes:
+            content = f.bytes
+        }
+    }
+    return dataType, content, nil
+}
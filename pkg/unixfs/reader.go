@@ -0,0 +1,154 @@
+package unixfs
+
+import (
+    "errors"
+    "fmt"
+    "io"
+
+    "github.com/ipfs/go-cid"
+)
+
+// ErrBlockMismatch is returned when a block does not hash to the CID it was requested by
+var ErrBlockMismatch = errors.New("block does not match its CID")
+
+// BlockGetter returns the block with the given CID
+type BlockGetter func(c cid.Cid) ([]byte, error)
+
+// VerifyBlock checks that data hashes to c
+func VerifyBlock(c cid.Cid, data []byte) error {
+    sum, err := c.Prefix().Sum(data)
+    if err != nil {
+        return fmt.Errorf("failed to hash block %s: %w", c, err)
+    }
+    if !sum.Equals(c) {
+        return fmt.Errorf("%w: %s", ErrBlockMismatch, c)
+    }
+    return nil
+}
+
+// fileReader walks a UnixFS file DAG depth-first, fetching each block when it is needed
+type fileReader struct {
+    get   BlockGetter
+    stack []cid.Cid
+    buf   []byte
+    err   error
+}
+
+// NewFileReader returns a reader of the UnixFS file rooted at root. Blocks are fetched
+// with get in depth-first order as the file is read, and every block is verified against
+// its CID before it is used, so the content is exactly the file root addresses.
+func NewFileReader(root cid.Cid, get BlockGetter) io.Reader {
+    return &fileReader{get: get, stack: []cid.Cid{root}}
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+    for len(r.buf) == 0 {
+        if r.err != nil {
+            return 0, r.err
+        }
+        if len(r.stack) == 0 {
+            r.err = io.EOF
+            continue
+        }
+        r.err = r.next()
+    }
+
+    n := copy(p, r.buf)
+    r.buf = r.buf[n:]
+    return n, nil
+}
+
+// next visits the block on top of the stack
+func (r *fileReader) next() error {
+    c := r.stack[len(r.stack)-1]
+    r.stack = r.stack[:len(r.stack)-1]
+
+    block, err := r.get(c)
+    if err != nil {
+        return err
+    }
+    if err := VerifyBlock(c, block); err != nil {
+        return err
+    }
+
+    switch c.Type() {
+    case cid.Raw:
+        r.buf = block
+    case cid.DagProtobuf:
+        links, data, err := decodeNode(block)
+        if err != nil {
+            return fmt.Errorf("failed to decode block %s: %w", c, err)
+        }
+        dataType, content, err := decodeFileData(data)
+        if err != nil {
+            return fmt.Errorf("failed to decode block %s: %w", c, err)
+        }
+        if dataType != typeFile && dataType != typeRaw {
+            return fmt.Errorf("block %s is not part of a file (UnixFS type %d)", c, dataType)
+        }
+
+        // A node's own data precedes its children's
+        r.buf = content
+        for i := len(links) - 1; i >= 0; i-- {
+            r.stack = append(r.stack, links[i].Cid)
+        }
+    default:
+        return fmt.Errorf("unsupported codec 0x%x in block %s", c.Type(), c)
+    }
+    return nil
+}
+
+// Links returns the CIDs a block links to. Raw blocks have no links.
+func Links(c cid.Cid, block []byte) ([]cid.Cid, error) {
+    switch c.Type() {
+    case cid.Raw:
+        return nil, nil
+    case cid.DagProtobuf:
+        links, _, err := decodeNode(block)
+        if err != nil {
+            return nil, fmt.Errorf("failed to decode block %s: %w", c, err)
+        }
+        cids := make([]cid.Cid, len(links))
+        for i, l := range links {
+            cids[i] = l.Cid
+        }
+        return cids, nil
+    default:
+        return nil, fmt.Errorf("unsupported codec 0x%x in block %s", c.Type(), c)
+    }
+}
+
+// Walk calls visit for every block of the DAG rooted at root, parents before children
+// and each block once. Directories are walked as well as files. Blocks are fetched with
+// get and verified against their CID, so a DAG that walks without error is complete.
+func Walk(root cid.Cid, get BlockGetter, visit func(c cid.Cid, block []byte) error) error {
+    seen := make(map[string]bool)
+    stack := []cid.Cid{root}
+    for len(stack) > 0 {
+        c := stack[len(stack)-1]
+        stack = stack[:len(stack)-1]
+        if seen[c.KeyString()] {
+            continue
+        }
+        seen[c.KeyString()] = true
+
+        block, err := get(c)
+        if err != nil {
+            return err
+        }
+        if err := VerifyBlock(c, block); err != nil {
+            return err
+        }
+        links, err := Links(c, block)
+        if err != nil {
+            return err
+        }
+        if err := visit(c, block); err != nil {
+            return err
+        }
+        for i := len(links) - 1; i >= 0; i-- {
+            stack = append(stack, links[i])
+        }
+    }
+    return nil
+}
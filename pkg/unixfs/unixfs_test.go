@@ -0,0 +1,256 @@
+package unixfs
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "errors"
+    "io"
+    "math/rand"
+    "testing"
+
+    "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+)
+
+// Expected CIDs were produced by Kubo's importer (boxo balanced layout, size splitter)
+func TestComputeMatchesKubo(t *testing.T) {
+    seeded := func(size int) []byte {
+        data := make([]byte, size)
+        rand.New(rand.NewSource(int64(size))).Read(data)
+        return data
+    }
+
+    tests := []struct {
+        name      string
+        data      []byte
+        version   int
+        rawLeaves bool
+        chunkSize int
+        maxLinks  int
+        expected  string
+    }{
+        {"empty v0", nil, 0, false, 0, 0, "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+        {"empty v1", nil, 1, true, 0, 0, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+        {"hello v0", []byte("hello world\n"), 0, false, 0, 0, "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+        {"hello v1", []byte("hello world\n"), 1, true, 0, 0, "bafkreifjjcie6lypi6ny7amxnfftagclbuxndqonfipmb64f2km2devei4"},
+        {"one chunk v0", seeded(262144), 0, false, 0, 0, "QmcJX3xVk2ZsSSzfDhEy8oTszQM7Wn492Pv4g5MGfU3sPc"},
+        {"two chunks v0", seeded(262145), 0, false, 0, 0, "QmSv3XSikn9wURsaMPc9rNXiKWNZK5fCFwZ6s2ELxbK8mk"},
+        {"two chunks v0 raw leaves", seeded(262145), 0, true, 0, 0, "QmdUApr2CrV9fH8AyNBPEsSuVVVBGRNyd3tf1PHTAJrpXE"},
+        {"two chunks v1", seeded(262145), 1, true, 0, 0, "bafybeihazrwaw6jap6b4ueakkihngg4kiuus5migbr6oe6sh36nqxhmdju"},
+        {"deep tree v0", seeded(811), 0, false, 10, 3, "Qmdhwnoo6JZcfFdDyg9abQPU3MeioYdZFLiem7gforhQcd"},
+        {"deep tree v1", seeded(811), 1, true, 10, 3, "bafybeig6tlk6fymfyzgxsdtivr3u44era4mm4nlvu2mxurcpvoptcsvgaa"},
+        {"full level v1", seeded(91), 1, true, 10, 3, "bafybeiadzdcp6274sfvmslkwbeimocsearlqyiunufh64hj4srk7dp5gka"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            opts := DefaultOptions(tt.version)
+            opts.RawLeaves = tt.rawLeaves
+            if tt.chunkSize > 0 {
+                opts.ChunkSize, opts.MaxLinks = tt.chunkSize, tt.maxLinks
+            }
+
+            // Write in odd-sized pieces to exercise chunk boundaries
+            b := NewBuilder(opts)
+            for data := tt.data; len(data) > 0; {
+                n := 7
+                if n > len(data) {
+                    n = len(data)
+                }
+                b.Write(data[:n])
+                data = data[n:]
+            }
+
+            got, err := b.Sum()
+            if err != nil {
+                t.Fatalf("Sum failed: %v", err)
+            }
+            if got.String() != tt.expected {
+                t.Fatalf("Got CID %s, want %s", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestVerifyingReader(t *testing.T) {
+    data := bytes.Repeat([]byte("quantum-doc-verify "), 50000)
+
+    for _, version := range []int{0, 1} {
+        c, err := Compute(bytes.NewReader(data), DefaultOptions(version))
+        if err != nil {
+            t.Fatalf("Compute failed: %v", err)
+        }
+
+        reader, err := NewVerifyingReader(c.String(), io.NopCloser(bytes.NewReader(data)))
+        if err != nil {
+            t.Fatalf("Failed to create verifying reader: %v", err)
+        }
+        if _, err := io.ReadAll(reader); err != nil {
+            t.Fatalf("Valid content rejected: %v", err)
+        }
+
+        tampered := append([]byte(nil), data...)
+        tampered[len(tampered)/2] ^= 1
+        reader, _ = NewVerifyingReader(c.String(), io.NopCloser(bytes.NewReader(tampered)))
+        if _, err := io.ReadAll(reader); !errors.Is(err, ErrCIDMismatch) {
+            t.Fatalf("Expected ErrCIDMismatch for tampered content, got %v", err)
+        }
+    }
+}
+
+func TestVerifyingReaderDigestLength(t *testing.T) {
+    data := []byte("hello world\n")
+    digest := sha256.Sum256(data)
+
+    for name, d := range map[string][]byte{
+        "truncated": digest[:20],
+        "oversized": append(digest[:], make([]byte, 8)...),
+    } {
+        mh, err := multihash.Encode(d, multihash.SHA2_256)
+        if err != nil {
+            t.Fatalf("%s: failed to encode multihash: %v", name, err)
+        }
+        c := cid.NewCidV1(cid.Raw, mh)
+
+        reader, err := NewVerifyingReader(c.String(), io.NopCloser(bytes.NewReader(data)))
+        if err != nil {
+            t.Fatalf("%s: failed to create verifying reader: %v", name, err)
+        }
+        if _, err := io.ReadAll(reader); !errors.Is(err, ErrCIDMismatch) {
+            t.Fatalf("%s: expected ErrCIDMismatch, got %v", name, err)
+        }
+    }
+}
+
+func TestInferOptions(t *testing.T) {
+    data := make([]byte, 100000)
+    rand.New(rand.NewSource(100000)).Read(data)
+
+    tests := []struct {
+        name string
+        data []byte
+        opts Options
+    }{
+        {"default v0", data, DefaultOptions(0)},
+        {"size-1024 v0", data, Options{CIDVersion: 0, ChunkSize: 1024}},
+        {"size-1000 v1 raw leaves", data, Options{CIDVersion: 1, RawLeaves: true, ChunkSize: 1000}},
+        {"deep tree v0 raw leaves", data, Options{CIDVersion: 0, RawLeaves: true, ChunkSize: 1000, MaxLinks: 3}},
+        {"one large chunk v0", data, Options{CIDVersion: 0, ChunkSize: 1 << 20}},
+        {"one large chunk v1", data, Options{CIDVersion: 1, RawLeaves: true, ChunkSize: 1 << 20}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            blocks := make(map[string][]byte)
+            opts := tt.opts
+            opts.OnBlock = func(c cid.Cid, block []byte) error {
+                blocks[c.KeyString()] = append([]byte(nil), block...)
+                return nil
+            }
+            root, err := Compute(bytes.NewReader(tt.data), opts)
+            if err != nil {
+                t.Fatalf("Compute failed: %v", err)
+            }
+
+            inferred, err := InferOptions(root, func(c cid.Cid) ([]byte, error) {
+                return blocks[c.KeyString()], nil
+            })
+            if err != nil {
+                t.Fatalf("InferOptions failed: %v", err)
+            }
+            verifier, err := NewVerifier(root.String(), inferred)
+            if err != nil {
+                t.Fatalf("Failed to create verifier: %v", err)
+            }
+            verifier.Write(tt.data)
+            if err := verifier.Verify(); err != nil {
+                t.Fatalf("Content rejected with inferred options %+v: %v", inferred, err)
+            }
+        })
+    }
+}
+
+func TestFileReader(t *testing.T) {
+    data := make([]byte, 811)
+    rand.New(rand.NewSource(811)).Read(data)
+
+    for _, version := range []int{0, 1} {
+        blocks := make(map[string][]byte)
+        opts := DefaultOptions(version)
+        opts.ChunkSize, opts.MaxLinks = 10, 3
+        opts.OnBlock = func(c cid.Cid, block []byte) error {
+            blocks[c.KeyString()] = append([]byte(nil), block...)
+            return nil
+        }
+        root, err := Compute(bytes.NewReader(data), opts)
+        if err != nil {
+            t.Fatalf("Compute failed: %v", err)
+        }
+        get := func(c cid.Cid) ([]byte, error) { return blocks[c.KeyString()], nil }
+
+        got, err := io.ReadAll(NewFileReader(root, get))
+        if err != nil {
+            t.Fatalf("Failed to read v%d file: %v", version, err)
+        }
+        if !bytes.Equal(got, data) {
+            t.Fatalf("v%d content differs from the original", version)
+        }
+
+        // Substituting any block is detected
+        for key, block := range blocks {
+            forged := append([]byte(nil), block...)
+            forged[len(forged)-1] ^= 1
+            get := func(c cid.Cid) ([]byte, error) {
+                if c.KeyString() == key {
+                    return forged, nil
+                }
+                return blocks[c.KeyString()], nil
+            }
+            if _, err := io.ReadAll(NewFileReader(root, get)); !errors.Is(err, ErrBlockMismatch) {
+                t.Fatalf("Expected ErrBlockMismatch for forged block, got %v", err)
+            }
+        }
+    }
+}
+
+func TestDirectory(t *testing.T) {
+    // The empty directory every Kubo node knows
+    for version, expected := range []string{"QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn", "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354"} {
+        c, _, err := Directory(nil, version)
+        if err != nil || c.String() != expected {
+            t.Fatalf("Empty v%d directory: got %s (%v), want %s", version, c, err, expected)
+        }
+    }
+
+    file, _ := Compute(bytes.NewReader([]byte("hello world\n")), DefaultOptions(0))
+    other, _ := Compute(bytes.NewReader([]byte("other")), DefaultOptions(1))
+    links := []Link{{Name: "b.txt", Cid: other, Size: 5}, {Name: "a.txt", Cid: file, Size: 20}}
+
+    _, block, err := Directory(links, 1)
+    if err != nil {
+        t.Fatalf("Directory failed: %v", err)
+    }
+    decoded, err := DecodeDirectory(block)
+    if err != nil {
+        t.Fatalf("DecodeDirectory failed: %v", err)
+    }
+    if len(decoded) != 2 || decoded[0].Name != "a.txt" || !decoded[0].Cid.Equals(file) || decoded[0].Size != 20 || decoded[1].Name != "b.txt" {
+        t.Fatalf("Unexpected entries: %+v", decoded)
+    }
+
+    if _, _, err := Directory(append(links, Link{Name: "a.txt", Cid: file}), 1); err == nil {
+        t.Fatalf("Expected duplicate names to be rejected")
+    }
+
+    // File nodes are not directories
+    var fileBlock []byte
+    opts := DefaultOptions(0)
+    opts.OnBlock = func(c cid.Cid, data []byte) error {
+        fileBlock = append([]byte(nil), data...)
+        return nil
+    }
+    Compute(bytes.NewReader([]byte("hello world\n")), opts)
+    if _, err := DecodeDirectory(fileBlock); !errors.Is(err, ErrNotDirectory) {
+        t.Fatalf("Expected ErrNotDirectory, got %v", err)
+    }
+}
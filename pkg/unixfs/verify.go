@@ -0,0 +1,208 @@
+package unixfs
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+
+    "github.com/ipfs/go-cid"
+    "github.com/multiformats/go-multihash"
+)
+
+// ErrCIDMismatch is returned when content does not hash to the expected CID
+var ErrCIDMismatch = errors.New("content does not match CID")
+
+// verifyLayouts are the chunker/fan-out combinations tried when verifying a dag-pb CID:
+// Kubo's default, "size-1048576" and the wide 1 MiB/1024-link profile
+var verifyLayouts = []struct {
+    chunkSize int
+    maxLinks  int
+}{
+    {DefaultChunkSize, DefaultMaxLinks},
+    {1024 * 1024, DefaultMaxLinks},
+    {1024 * 1024, 1024},
+}
+
+// Verifier checks streamed content against an expected CID.
+// Raw CIDs are checked by hashing the whole content; dag-pb CIDs are rebuilt with each
+// supported fixed-size layout, with and without raw leaves, and any layouts given.
+type Verifier struct {
+    expected cid.Cid
+    raw      hash.Hash
+    builders []*Builder
+}
+
+// NewVerifier creates a verifier for the given CID. layouts are tried in addition to the
+// supported ones for a dag-pb CID, such as the layout found by InferOptions; their CID
+// version and hash function are taken from the CID.
+func NewVerifier(expected string, layouts ...Options) (*Verifier, error) {
+    c, err := cid.Decode(expected)
+    if err != nil {
+        return nil, fmt.Errorf("invalid CID %q: %w", expected, err)
+    }
+    prefix := c.Prefix()
+
+    v := &Verifier{expected: c}
+    switch prefix.Codec {
+    case cid.Raw:
+        v.raw, err = multihash.GetHasher(prefix.MhType)
+        if err != nil {
+            return nil, fmt.Errorf("unsupported hash function in CID %s: %w", c, err)
+        }
+    case cid.DagProtobuf:
+        for _, layout := range verifyLayouts {
+            for _, rawLeaves := range []bool{prefix.Version == 1, prefix.Version == 0} {
+                v.builders = append(v.builders, NewBuilder(Options{
+                    CIDVersion:   int(prefix.Version),
+                    RawLeaves:    rawLeaves,
+                    ChunkSize:    layout.chunkSize,
+                    MaxLinks:     layout.maxLinks,
+                    HashFunction: prefix.MhType,
+                }))
+            }
+        }
+        for _, layout := range layouts {
+            layout.CIDVersion = int(prefix.Version)
+            layout.HashFunction = prefix.MhType
+            layout.OnBlock = nil
+            v.builders = append(v.builders, NewBuilder(layout))
+        }
+    default:
+        return nil, fmt.Errorf("unsupported codec in CID %s", c)
+    }
+
+    return v, nil
+}
+
+// Write feeds content to the verifier
+func (v *Verifier) Write(p []byte) (int, error) {
+    if v.raw != nil {
+        return v.raw.Write(p)
+    }
+    for _, b := range v.builders {
+        if _, err := b.Write(p); err != nil {
+            return 0, err
+        }
+    }
+    return len(p), nil
+}
+
+// Verify reports whether the content written so far matches the expected CID
+func (v *Verifier) Verify() error {
+    if v.raw != nil {
+        decoded, err := multihash.Decode(v.expected.Hash())
+        if err != nil {
+            return fmt.Errorf("invalid multihash in CID %s: %w", v.expected, err)
+        }
+        // A digest of any other length, truncated or oversized, never matches
+        if decoded.Length == v.raw.Size() && bytes.Equal(v.raw.Sum(nil), decoded.Digest) {
+            return nil
+        }
+        return fmt.Errorf("%w %s", ErrCIDMismatch, v.expected)
+    }
+
+    for _, b := range v.builders {
+        got, err := b.Sum()
+        if err != nil {
+            continue
+        }
+        if got.Equals(v.expected) {
+            return nil
+        }
+    }
+    return fmt.Errorf("%w %s", ErrCIDMismatch, v.expected)
+}
+
+// InferOptions returns the options a balanced file DAG rooted at root was built with, read
+// from the blocks on its leftmost path: the leftmost leaf holds a whole chunk (or the
+// whole file), and the leftmost node below the root a full set of links. The
+// result only describes root if content rebuilt with it hashes to root, which a Verifier
+// checks.
+func InferOptions(root cid.Cid, get BlockGetter) (Options, error) {
+    prefix := root.Prefix()
+    opts := DefaultOptions(int(prefix.Version))
+    opts.HashFunction = prefix.MhType
+
+    c := root
+    depth := 0
+    for {
+        block, err := get(c)
+        if err != nil {
+            return Options{}, err
+        }
+        if err := VerifyBlock(c, block); err != nil {
+            return Options{}, err
+        }
+
+        if c.Type() == cid.Raw {
+            opts.RawLeaves = true
+            opts.ChunkSize = max(len(block), 1)
+            return opts, nil
+        }
+        if c.Type() != cid.DagProtobuf {
+            return Options{}, fmt.Errorf("unsupported codec 0x%x in block %s", c.Type(), c)
+        }
+
+        links, data, err := decodeNode(block)
+        if err != nil {
+            return Options{}, fmt.Errorf("failed to decode block %s: %w", c, err)
+        }
+        if len(links) == 0 {
+            _, content, err := decodeFileData(data)
+            if err != nil {
+                return Options{}, fmt.Errorf("failed to decode block %s: %w", c, err)
+            }
+            opts.RawLeaves = false
+            opts.ChunkSize = max(len(content), 1)
+            return opts, nil
+        }
+
+        // Below the root every node on the leftmost path is full; a root over leaves
+        // only bounds the fan-out from below
+        switch depth {
+        case 0:
+            opts.MaxLinks = max(len(links), DefaultMaxLinks)
+        case 1:
+            opts.MaxLinks = len(links)
+        }
+        c = links[0].Cid
+        depth++
+    }
+}
+
+// verifyingReader checks content as it is read and replaces io.EOF with
+// ErrCIDMismatch if the content does not match
+type verifyingReader struct {
+    r        io.ReadCloser
+    verifier *Verifier
+}
+
+// NewVerifyingReader wraps r so that reaching the end of the content verifies it against
+// the expected CID. Content is passed through as it is read, so callers must treat a
+// read error as invalidating everything read before it.
+func NewVerifyingReader(expected string, r io.ReadCloser) (io.ReadCloser, error) {
+    verifier, err := NewVerifier(expected)
+    if err != nil {
+        return nil, err
+    }
+    return &verifyingReader{r: r, verifier: verifier}, nil
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+    n, err := v.r.Read(p)
+    if n > 0 {
+        v.verifier.Write(p[:n])
+    }
+    if err == io.EOF {
+        if verr := v.verifier.Verify(); verr != nil {
+            return n, verr
+        }
+    }
+    return n, err
+}
+
+func (v *verifyingReader) Close() error {
+    return v.r.Close()
+}
@@ -5,6 +5,8 @@ import (
     "fmt"
     "os"
     "path/filepath"
+
+    "quantum-doc-verify/pkg/crypto"
 )
 
 // HashDocument creates a SHA-256 hash of a document
@@ -65,11 +67,12 @@ func GenerateAndSaveProof(
         return fmt.Errorf("failed to load document: %w", err)
     }
     
-    // Load private key
-    privateKey, err := LoadDocument(privateKeyPath)
+    // Load private key into locked memory, wiped once the proof is generated
+    privateKey, err := crypto.ReadSecretFile(privateKeyPath)
     if err != nil {
         return fmt.Errorf("failed to load private key: %w", err)
     }
+    defer privateKey.Destroy()
     
     // Load public key
     publicKey, err := LoadDocument(publicKeyPath)
@@ -86,7 +89,7 @@ func GenerateAndSaveProof(
     // Generate proof
     proof, err := prover.GenerateProof(
         document,
-        privateKey,
+        privateKey.Bytes(),
         documentHashBytes,
         publicKey,
         signature,
@@ -2,18 +2,20 @@ package test
 
 import (
     "bytes"
+    "context"
     "fmt"
     "os"
     "os/exec"
     "path/filepath"
+    "strings"
     "testing"
 	"runtime"
     
 
     "github.com/stretchr/testify/assert"
     
-    "quantum-doc-verify/pkg/blockchain"
     "quantum-doc-verify/pkg/crypto"
+    "quantum-doc-verify/pkg/ipfs/ipfstest"
     "quantum-doc-verify/pkg/storage"
 )
 
@@ -68,19 +70,21 @@ func TestCompleteWorkflow(t *testing.T) {
     documentHash := storage.CalculateDocumentHash(documentBytes)
     fmt.Printf("Document hash: %s\n", documentHash)
 
-    // 6. Connect to local IPFS node
-    ipfs, err := storage.NewIPFSClient("localhost:5001")
+    // 6. Start an in-memory IPFS node
+    node := ipfstest.NewServer()
+    defer node.Close()
+    ipfs, err := storage.NewIPFSClient(node.Addr())
     assert.NoError(t, err, "Failed to create IPFS client")
 
-    // 7. Store document on IPFS
-    cid, err := ipfs.Store(documentBytes)
-    if err != nil {
-        // If IPFS storage fails (e.g., no local node), simulate it for testing
-        fmt.Println("IPFS storage failed, using mock CID for testing")
-        cid = "QmTest123456789"
-    } else {
-        fmt.Printf("Document stored on IPFS with CID: %s\n", cid)
-    }
+    // 7. Store document on IPFS and read it back
+    cid, err := ipfs.Store(context.Background(), documentBytes)
+    assert.NoError(t, err, "Failed to store document on IPFS")
+    assert.True(t, node.Pinned(cid), "Stored document is not pinned")
+    fmt.Printf("Document stored on IPFS with CID: %s\n", cid)
+
+    storedBytes, err := ipfs.Retrieve(context.Background(), cid)
+    assert.NoError(t, err, "Failed to retrieve document from IPFS")
+    assert.Equal(t, documentBytes, storedBytes, "Retrieved document differs from the stored one")
 
     // 8. Encrypt document with hybrid encryption
     encryptedData, err := storage.EncryptDocument(documentBytes, pubKey)
@@ -127,22 +131,6 @@ func TestCompleteWorkflow(t *testing.T) {
         fmt.Printf("Document registered on blockchain: %s\n", string(registerResult))
     }
 
-    // Define blockchainCID at a scope accessible to the integratedTest function
-    var blockchainCID string
-
-    // Create client and get blockchain CID
-    client, err := blockchain.NewBlockchainClient("http://localhost:8545", contractAddress)
-    if err != nil {
-        fmt.Println("Failed to create blockchain client for details, using mock CID")
-        blockchainCID = "Qm" + documentHash[:20]
-        fmt.Printf("Using mock blockchain CID: %s\n", blockchainCID)
-    } else {
-        // Get the CID that the blockchain client would return
-        _, retrievedCID, _, _, _ := client.GetDocumentDetails(documentHash)
-        blockchainCID = retrievedCID
-        fmt.Printf("Blockchain would return CID: %s\n", blockchainCID)
-    }
-
     // 12. Verify document on blockchain
     fmt.Println("Verifying document on blockchain...")
     verifyResult, err := exec.Command(blockchainBin, "verify",
@@ -169,18 +157,29 @@ func TestCompleteWorkflow(t *testing.T) {
             "--contract="+contractAddress,
             "--eth-key="+ethPrivateKey, // Use the same eth private key
             "--dilithium-key="+privKeyPath,
+            "--gateway="+node.Addr(),
         ).CombinedOutput()
         
         if err != nil {
             fmt.Printf("Integrated store-register command failed: %s\n%s\n", err, string(storeRegisterResult))
-        } else {
-            fmt.Printf("Integrated store-register result: %s\n", string(storeRegisterResult))
+            return
+        }
+        fmt.Printf("Integrated store-register result: %s\n", string(storeRegisterResult))
+        
+        // Retrieve the document by the CID store-register registered
+        var registeredCID string
+        for _, line := range strings.Split(string(storeRegisterResult), "\n") {
+            if value, ok := strings.CutPrefix(line, "Document CID (for IPFS storage): "); ok {
+                registeredCID = strings.TrimSpace(value)
+            }
         }
+        assert.NotEmpty(t, registeredCID, "store-register did not report a CID")
+        assert.True(t, node.Has(registeredCID), "Registered document is not on the IPFS node")
         
-        // Try to retrieve the document using the integrated command
         retrievedPath := filepath.Join(testDir, "retrieved_document.txt")
         verifyRetrieveResult, err := exec.Command(integratedBin, "verify-retrieve",
-            "--cid="+blockchainCID,  // Use blockchainCID instead of actual CID
+            "--cid="+registeredCID,
+            "--gateway="+node.Addr(),
             "--out="+retrievedPath,
             "--contract="+contractAddress,
             "--hash="+documentHash,
@@ -195,21 +194,11 @@ func TestCompleteWorkflow(t *testing.T) {
             // Verify the retrieved document matches the original
             retrievedContent, err := os.ReadFile(retrievedPath)
             if err != nil {
-                fmt.Printf("Failed to read retrieved document: %v\n", err)
+                t.Errorf("Failed to read retrieved document: %v", err)
+            } else if !bytes.Equal(documentContent, retrievedContent) {
+                t.Error("Retrieved document doesn't match original")
             } else {
-                // Check if the document contains "MOCK DOCUMENT" (indicating test mode)
-                if bytes.Contains(retrievedContent, []byte("MOCK DOCUMENT")) {
-                    fmt.Println("Retrieved mock document as expected in test mode")
-                    // Test passes because we expect a mock document in test environment
-                } else {
-                    // For real document retrievals, content should match exactly
-                    // This will be skipped in test mode but would run in production
-                    if !bytes.Equal(documentContent, retrievedContent) {
-                        t.Error("Retrieved document doesn't match original")
-                    } else {
-                        fmt.Println("Retrieved document matches the original - full workflow verification successful!")
-                    }
-                }
+                fmt.Println("Retrieved document matches the original - full workflow verification successful!")
             }
         }
     }